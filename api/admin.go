@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"strings"
+
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/info"
+	"github.com/contiv/volplugin/storage"
+	"github.com/gorilla/mux"
+)
+
+// AdminRoutes adds the admin routes to the router, which should be a
+// sub-router on /admin of a local socket. They serve the pprof profiles under
+// /debug/pprof/, and the in-memory state behind mounting: the mount
+// collection on /mounts, the mount counters on /mounts/counts, everything
+// known about a single volume on /mounts/{policy}/{volume}, the volumes with
+// a running TTL refresh on /refreshes and the global configuration in use on
+// /global. Secrets are redacted.
+func (a *API) AdminRoutes(router *mux.Router) {
+	router.HandleFunc("/debug/pprof/", pprof.Index)
+	router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	router.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	router.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	router.HandleFunc("/debug/pprof/{profile}", func(w http.ResponseWriter, r *http.Request) {
+		pprof.Handler(mux.Vars(r)["profile"]).ServeHTTP(w, r)
+	})
+
+	routes := map[string]func(http.ResponseWriter, *http.Request){
+		"/mounts":                   a.adminMounts,
+		"/mounts/counts":            a.adminMountCounts,
+		"/mounts/{policy}/{volume}": a.adminMount,
+		"/refreshes":                a.adminRefreshes,
+		"/global":                   a.adminGlobal,
+	}
+
+	for path, f := range routes {
+		router.HandleFunc(path, f).Methods("GET")
+	}
+}
+
+// AdminMount is everything volplugin knows about a volume on this host.
+type AdminMount struct {
+	Mount      *storage.Mount `json:"mount"`
+	Count      int            `json:"count"`
+	Refreshing bool           `json:"refreshing"`
+	Draining   bool           `json:"draining"`
+}
+
+func (a *API) adminMounts(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, a.MountCollection.List())
+}
+
+func (a *API) adminMountCounts(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, a.MountCounter.List())
+}
+
+func (a *API) adminMount(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	volName := strings.Join([]string{vars["policy"], vars["volume"]}, "/")
+
+	am := &AdminMount{
+		Count:    a.MountCounter.Get(volName),
+		Draining: a.Draining(volName),
+	}
+
+	if mount, err := a.MountCollection.Get(volName); err == nil {
+		am.Mount = mount
+	}
+
+	a.lockStopChanMutex.Lock()
+	_, am.Refreshing = a.lockStopChans[volName]
+	a.lockStopChanMutex.Unlock()
+
+	writeAdminJSON(w, am)
+}
+
+func (a *API) adminRefreshes(w http.ResponseWriter, r *http.Request) {
+	a.lockStopChanMutex.Lock()
+	volumes := []string{}
+	for volName := range a.lockStopChans {
+		volumes = append(volumes, volName)
+	}
+	a.lockStopChanMutex.Unlock()
+
+	sort.Strings(volumes)
+	writeAdminJSON(w, volumes)
+}
+
+func (a *API) adminGlobal(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, (*a.Global).Published())
+}
+
+func writeAdminJSON(w http.ResponseWriter, value interface{}) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(info.Redact(content))
+}
@@ -9,15 +9,22 @@ import (
 	"strings"
 	"sync"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/contiv/volplugin/api/internals/mount"
+	"github.com/contiv/volplugin/auth"
 	"github.com/contiv/volplugin/config"
 	"github.com/contiv/volplugin/errors"
 	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/logging"
+	"github.com/contiv/volplugin/metrics"
 	"github.com/contiv/volplugin/storage"
 	"github.com/contiv/volplugin/storage/backend"
+	"github.com/contiv/volplugin/trace"
+
+	"golang.org/x/net/context"
 )
 
+var log = logging.For("api")
+
 // Volume abstracts the notion of a volume as it is received from the plugins.
 // It is used heavily by the interfaces.
 type Volume struct {
@@ -25,6 +32,13 @@ type Volume struct {
 	Policy     string
 	Name       string
 	Options    map[string]string
+
+	// CallerID identifies the caller of a mount or unmount, if the frontend
+	// sends one. Docker sends a unique ID for each mount.
+	CallerID string
+
+	// Context carries the trace of the request. It may be nil.
+	Context context.Context
 }
 
 func (v *Volume) String() string {
@@ -35,27 +49,69 @@ func (v *Volume) String() string {
 type API struct {
 	Volplugin
 	Hostname          string
+	Labels            map[string]string
+	APIServer         string
+	APICredentials    *auth.Credentials
+	ListLocal         bool
 	Client            *config.Client
 	Global            **config.Global // double pointer so we can track watch updates
 	Lock              *lock.Driver
-	lockStopChanMutex sync.Mutex
+	lockStopChanMutex *sync.Mutex
 	lockStopChans     map[string]chan struct{}
+	drainMutex        *sync.Mutex
+	draining          map[string]struct{}
 	MountCounter      *mount.Counter
 	MountCollection   *mount.Collection
 }
 
 // NewAPI returns an *API
 func NewAPI(volplugin Volplugin, hostname string, client *config.Client, global **config.Global) *API {
-	return &API{
-		Volplugin:       volplugin,
-		Hostname:        hostname,
-		Client:          client,
-		Global:          global,
-		Lock:            lock.NewDriver(client),
-		MountCollection: mount.NewCollection(),
-		MountCounter:    mount.NewCounter(),
-		lockStopChans:   map[string]chan struct{}{},
+	a := &API{
+		Volplugin:         volplugin,
+		Hostname:          hostname,
+		Labels:            map[string]string{},
+		Client:            client,
+		Global:            global,
+		Lock:              lock.NewDriver(client),
+		MountCollection:   mount.NewCollection(),
+		MountCounter:      mount.NewCounter(),
+		lockStopChanMutex: &sync.Mutex{},
+		lockStopChans:     map[string]chan struct{}{},
+		drainMutex:        &sync.Mutex{},
+		draining:          map[string]struct{}{},
 	}
+
+	a.Lock.Lost = a.lockLost
+	return a
+}
+
+// lockLost records that the lock of a mount could not be held. Another host
+// may mount the volume once it takes the lock.
+func (a *API) lockLost(uc config.UseLocker, err error) {
+	log.Errorf("Lost the %s lock of %q: %v", uc.GetReason(), uc.GetVolume(), err)
+	a.Client.RecordEvent(config.EventLockStolen, uc.GetVolume(), a.Hostname, "%s lock could not be held: %v", uc.GetReason(), err)
+}
+
+// Frontend returns an *API serving another client interface, such as
+// kubernetes alongside docker. It shares the mount state and locks of this
+// API, so a volume mounted through one frontend is accounted for in both.
+func (a *API) Frontend(volplugin Volplugin) *API {
+	frontend := *a
+	frontend.Volplugin = volplugin
+	return &frontend
+}
+
+// Detach returns a context carrying the span and request ID of the request
+// context, which is not cancelled when the client disconnects. Requests do
+// their work under it, so a device map or lock release is never interrupted
+// midway.
+func Detach(ctx context.Context) context.Context {
+	detached := trace.Detach(ctx)
+	if id := logging.RequestID(ctx); id != "" {
+		detached = logging.WithRequestID(detached, id)
+	}
+
+	return detached
 }
 
 // RESTHTTPError returns a 500 status with the error.
@@ -64,32 +120,43 @@ func RESTHTTPError(w http.ResponseWriter, err error) {
 		err = errors.Unknown
 	}
 
-	logrus.Errorf("Returning HTTP error handling plugin negotiation: %s", err.Error())
+	metrics.HTTPErrors.Inc(metrics.ErrorCategory(err))
+	logging.WithResponse(log, w).Errorf("Returning HTTP error handling plugin negotiation: %s", err.Error())
 	http.Error(w, err.Error(), http.StatusInternalServerError)
 }
 
 // Action is a catchall for additional driver functions.
 func Action(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
-	logrus.Debugf("Unknown driver action at %q", r.URL.Path)
+	logger := logging.WithContext(log, r.Context())
+	logger.Debugf("Unknown driver action at %q", r.URL.Path)
 	content, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		logrus.Debug("Error reading body for %q", r.URL.Path)
+		logger.Debugf("Error reading body for %q", r.URL.Path)
 		RESTHTTPError(w, err)
 		return
 	}
 
-	logrus.Debug("Body content:", string(content))
+	logger.Debug("Body content:", string(content))
 	w.WriteHeader(503)
 }
 
-// LogHandler injects a request logging handler if debugging is active. In either event it will dispatch.
+// LogHandler injects a request logging handler if debugging is active. In
+// either event it will dispatch, with the request ID from the X-Request-Id
+// header, or a new one, in the request's context and the response headers.
 func LogHandler(name string, debug bool, actionFunc func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(logging.RequestIDHeader)
+		if id == "" {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(logging.RequestIDHeader, id)
+		r = r.WithContext(logging.WithRequestID(r.Context(), id))
+
 		if debug {
 			buf := new(bytes.Buffer)
 			io.Copy(buf, r.Body)
-			logrus.Debugf("Dispatching %s with %v", name, strings.TrimSpace(string(buf.Bytes())))
+			logging.WithContext(log, r.Context()).Debugf("Dispatching %s with %v", name, strings.TrimSpace(string(buf.Bytes())))
 			var writer *io.PipeWriter
 			r.Body, writer = io.Pipe()
 			go func() {
@@ -105,7 +172,7 @@ func LogHandler(name string, debug bool, actionFunc func(http.ResponseWriter, *h
 // GetStorageParameters accepts a Volume API request and turns it into several internal structs.
 func (a *API) GetStorageParameters(uc *Volume) (storage.MountDriver, *config.Volume, storage.DriverOptions, error) {
 	driverOpts := storage.DriverOptions{}
-	volConfig, err := a.Client.GetVolume(uc.Policy, uc.Name)
+	volConfig, err := a.Client.WithContext(uc.Context).GetVolume(uc.Policy, uc.Name)
 	if err != nil {
 		return nil, nil, driverOpts, err
 	}
@@ -119,6 +186,7 @@ func (a *API) GetStorageParameters(uc *Volume) (storage.MountDriver, *config.Vol
 	if err != nil {
 		return nil, nil, driverOpts, errors.UnmarshalRequest.Combine(err)
 	}
+	driverOpts.Context = uc.Context
 
 	return driver, volConfig, driverOpts, nil
 }
@@ -1,31 +1,70 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/auth"
 	"github.com/contiv/volplugin/config"
 	"github.com/contiv/volplugin/errors"
 	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/logging"
+	"github.com/contiv/volplugin/metrics"
 	"github.com/contiv/volplugin/storage"
 	"github.com/contiv/volplugin/storage/cgroup"
 	"github.com/contiv/volplugin/storage/control"
+	"github.com/contiv/volplugin/trace"
+
+	"golang.org/x/net/context"
 )
 
 func (a *API) createVolume(w http.ResponseWriter, volume *config.VolumeRequest, policyObj *config.Policy) func(ld *lock.Driver, ucs []config.UseLocker) error {
 	return func(ld *lock.Driver, ucs []config.UseLocker) error {
 		global := *a.Global
 
-		volConfig, err := a.Client.CreateVolume(volume)
+		volConfig, err := ld.Config.CreateVolume(volume)
 		if err != nil {
 			return err
 		}
 
-		logrus.Debugf("Volume Create: %#v", *volConfig)
+		logger := logging.WithContext(log, ld.Config.Context())
+		logger.Debugf("Volume Create: %#v", *volConfig)
+
+		// creating a volume which already exists does not count against the
+		// quota again.
+		published := true
+		if _, err := ld.Config.GetVolume(volConfig.PolicyName, volConfig.VolumeName); err != nil {
+			if er, ok := err.(*errored.Error); !ok || !er.Contains(errors.NotExists) {
+				return errors.GetVolume.Combine(err)
+			}
+
+			usage, err := config.VolumeUsage(volConfig)
+			if err != nil {
+				return err
+			}
+
+			if err := ld.Config.ReservePolicyUsage(volConfig.PolicyName, policyObj.Quota, usage); err != nil {
+				return err
+			}
+
+			published = false
+			defer func() {
+				if !published {
+					if err := ld.Config.ReleasePolicyUsage(volConfig.PolicyName, usage); err != nil {
+						logger.Warnf("Could not release quota of volume %q: %v", volConfig, err)
+					}
+				}
+			}()
+		}
 
-		do, err := control.CreateVolume(policyObj, volConfig, global.Timeout)
+		do, err := control.CreateVolume(ld.Config.Context(), policyObj, volConfig, global.Timeout)
 		if err == errors.NoActionTaken {
 			goto publish
 		}
@@ -36,18 +75,19 @@ func (a *API) createVolume(w http.ResponseWriter, volume *config.VolumeRequest,
 
 		if err := control.FormatVolume(volConfig, do); err != nil {
 			if err := control.RemoveVolume(volConfig, global.Timeout); err != nil {
-				logrus.Errorf("Error during cleanup of failed format: %v", err)
+				logger.Errorf("Error during cleanup of failed format: %v", err)
 			}
 			return errors.FormatVolume.Combine(err)
 		}
 
 	publish:
-		if err := a.Client.PublishVolume(volConfig); err != nil && err != errors.Exists {
+		if err := ld.Config.PublishVolume(volConfig); err != nil && err != errors.Exists {
 			if _, ok := err.(*errored.Error); !ok {
 				return errors.PublishVolume.Combine(err)
 			}
 			return err
 		}
+		published = true
 
 		return a.WriteCreate(volConfig, w)
 	}
@@ -55,29 +95,39 @@ func (a *API) createVolume(w http.ResponseWriter, volume *config.VolumeRequest,
 
 // Create fully creates a volume
 func (a *API) Create(w http.ResponseWriter, r *http.Request) {
-	volume, err := a.ReadCreate(r)
+	start := time.Now()
+	span, ctx := trace.Start(Detach(trace.Extract(r.Context(), r.Header)), "create")
+	err := a.create(ctx, w, r)
+	span.Finish(err)
+	metrics.ObserveOperation("create", start, err)
 	if err != nil {
 		a.HTTPError(w, err)
-		return
 	}
+}
 
-	if vol, err := a.Client.GetVolume(volume.Policy, volume.Name); err == nil && vol != nil {
-		a.HTTPError(w, errors.Exists)
-		return
+func (a *API) create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	volume, err := a.ReadCreate(r)
+	if err != nil {
+		return err
+	}
+	trace.FromContext(ctx).SetTag("volume", volume.String())
+
+	client := a.Client.WithContext(ctx)
+
+	if vol, err := client.GetVolume(volume.Policy, volume.Name); err == nil && vol != nil {
+		return errors.Exists
 	}
 
-	logrus.Infof("Creating volume %s", volume)
+	logging.WithContext(log, ctx).Infof("Creating volume %s", volume)
 
 	hostname, err := os.Hostname()
 	if err != nil {
-		a.HTTPError(w, errors.GetHostname.Combine(err))
-		return
+		return errors.GetHostname.Combine(err)
 	}
 
-	policyObj, err := a.Client.GetPolicy(volume.Policy)
+	policyObj, err := client.GetPolicy(volume.Policy)
 	if err != nil {
-		a.HTTPError(w, errors.GetPolicy.Combine(errored.New(volume.Policy)).Combine(err))
-		return
+		return errors.GetPolicy.Combine(errored.New(volume.Policy)).Combine(err)
 	}
 
 	uc := &config.UseMount{
@@ -93,39 +143,40 @@ func (a *API) Create(w http.ResponseWriter, r *http.Request) {
 
 	global := *a.Global
 
-	err = lock.NewDriver(a.Client).ExecuteWithMultiUseLock(
+	err = lock.NewDriver(client).ExecuteWithMultiUseLock(
 		[]config.UseLocker{uc, snapUC},
 		global.Timeout,
 		a.createVolume(w, volume, policyObj),
 	)
 
 	if err != nil && err != errors.Exists {
-		a.HTTPError(w, errors.CreateVolume.Combine(err))
-		return
+		return errors.CreateVolume.Combine(err)
 	}
+
+	return nil
 }
 
-func (a *API) get(origName string, r *http.Request) (string, error) {
+func (a *API) get(origName string, r *http.Request) (string, *config.Volume, error) {
 	policy, name, err := storage.SplitName(origName)
 	if err != nil {
-		return "", errors.GetVolume.Combine(err)
+		return "", nil, errors.GetVolume.Combine(err)
 	}
 
 	driver, volConfig, driverOpts, err := a.GetStorageParameters(&Volume{Policy: policy, Name: name})
 	if err != nil {
-		return "", errors.GetVolume.Combine(err)
+		return "", nil, errors.GetVolume.Combine(err)
 	}
 
 	if err := volConfig.Validate(); err != nil {
-		return "", errors.ConfiguringVolume.Combine(err)
+		return "", nil, errors.ConfiguringVolume.Combine(err)
 	}
 
 	path, err := driver.MountPath(driverOpts)
 	if err != nil {
-		return "", errors.MountPath.Combine(err)
+		return "", nil, errors.MountPath.Combine(err)
 	}
 
-	return path, nil
+	return path, volConfig, nil
 }
 
 func (a *API) writePathError(w http.ResponseWriter, err error) {
@@ -142,8 +193,7 @@ func (a *API) getMountPath(driver storage.MountDriver, driverOpts storage.Driver
 	return path, err
 }
 
-// Path is the handler for both Path and Remove requests. We do not honor
-// remove requests; they can be done with volcli.
+// Path is the handler for Path requests.
 func (a *API) Path(w http.ResponseWriter, r *http.Request) {
 	origName, err := a.ReadPath(r)
 	if err != nil {
@@ -151,7 +201,7 @@ func (a *API) Path(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	path, err := a.get(origName, r)
+	path, _, err := a.get(origName, r)
 	if err != nil {
 		a.writePathError(w, err)
 		return
@@ -162,6 +212,114 @@ func (a *API) Path(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Remove is the request to remove a volume. What is removed depends on the
+// remove mode of the volume's policy: nothing, only the volume's record, or
+// the volume and its image. Volumes mounted anywhere are not removed.
+func (a *API) Remove(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	span, ctx := trace.Start(Detach(trace.Extract(r.Context(), r.Header)), "remove")
+	err := a.remove(ctx, w, r)
+	span.Finish(err)
+	metrics.ObserveOperation("remove", start, err)
+	if err != nil {
+		a.HTTPError(w, err)
+	}
+}
+
+func (a *API) remove(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	request, err := a.ReadRemove(r)
+	if err != nil {
+		return errors.RemoveVolume.Combine(err)
+	}
+	request.Context = ctx
+	trace.FromContext(ctx).SetTag("volume", request.String())
+
+	policyObj, err := a.Client.WithContext(ctx).GetPolicy(request.Policy)
+	if err != nil {
+		return errors.GetPolicy.Combine(errored.New(request.Policy)).Combine(err)
+	}
+
+	mode := policyObj.RemoveMode()
+	logging.WithContext(log, ctx).Infof("Remove of volume %q requested; remove mode of policy %q is %q", request, request.Policy, mode)
+
+	if mode != config.RemoveNever {
+		if err := a.removeVolume(request, mode); err != nil {
+			return errors.RemoveVolume.Combine(errored.New(request.String())).Combine(err)
+		}
+	}
+
+	if err := a.WritePath("", w); err != nil {
+		return errors.RemoveVolume.Combine(err)
+	}
+
+	return nil
+}
+
+// removeVolume removes the volume through the apiserver, which takes the
+// remove locks. The mount lock is checked first so a volume in use elsewhere
+// fails with the host holding it instead of a lock timeout. A volume which
+// does not exist is not an error.
+func (a *API) removeVolume(request *Volume, mode string) error {
+	if a.APIServer == "" {
+		return errored.Errorf("No apiserver is configured to remove volumes through")
+	}
+
+	vc := &config.Volume{PolicyName: request.Policy, VolumeName: request.Name}
+	um := &config.UseMount{}
+	if err := a.Client.WithContext(request.Context).GetUse(um, vc); err == nil {
+		return errors.LockFailed.Combine(errored.Errorf("Volume %q is in use on host %q (%s)", vc, um.Hostname, um.Reason))
+	} else if erd, ok := err.(*errored.Error); !ok || !erd.Contains(errors.NotExists) {
+		return errors.GetMount.Combine(err)
+	}
+
+	req := &config.VolumeRequest{Policy: request.Policy, Name: request.Name, Options: map[string]string{}}
+	if mode == config.RemoveRecordOnly {
+		req.Options["record-only"] = "true"
+	}
+
+	content, err := json.Marshal(req)
+	if err != nil {
+		return errors.MarshalVolume.Combine(err)
+	}
+
+	creds := a.APICredentials
+	if creds == nil {
+		creds = &auth.Credentials{}
+	}
+
+	client, err := creds.Client()
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequest("DELETE", creds.URL(a.APIServer, "/volumes/remove"), bytes.NewBuffer(content))
+	if err != nil {
+		return err
+	}
+	trace.Inject(request.Context, httpReq.Header)
+	if id := logging.RequestID(request.Context); id != "" {
+		httpReq.Header.Set(logging.RequestIDHeader, id)
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return errors.VolmasterRequest.Combine(err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNotFound:
+		return nil
+	default:
+		content, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return errors.ReadBody.Combine(err)
+		}
+
+		return errored.Errorf("apiserver returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+}
+
 // Get is the request to obtain information about a volume.
 func (a *API) Get(w http.ResponseWriter, r *http.Request) {
 	origName, err := a.ReadGet(r)
@@ -170,18 +328,19 @@ func (a *API) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	path, err := a.get(origName, r)
+	path, volConfig, err := a.get(origName, r)
 	if err != nil {
 		a.writePathError(w, err)
 		return
 	}
 
-	if err := a.WriteGet(origName, path, w); err != nil {
+	if err := a.WriteGet(origName, path, a.volumeStatus(r.Context(), volConfig), w); err != nil {
 		a.HTTPError(w, errors.GetVolume.Combine(err))
 	}
 }
 
-// List is the request to obtain a list of the volumes.
+// List is the request to obtain a list of the volumes. If ListLocal is set,
+// only the volumes whose mount backend is available on this host are listed.
 func (a *API) List(w http.ResponseWriter, r *http.Request) {
 	volList, err := a.Client.ListAllVolumes()
 	if err != nil {
@@ -189,13 +348,20 @@ func (a *API) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if a.ListLocal {
+		volList, err = a.localVolumes(volList)
+		if err != nil {
+			a.HTTPError(w, errors.ListVolume.Combine(err))
+			return
+		}
+	}
+
 	if err := a.WriteList(volList, w); err != nil {
 		a.HTTPError(w, errors.ListVolume.Combine(err))
 	}
 }
 
 type mountState struct {
-	w          http.ResponseWriter
 	err        error
 	ut         *config.UseMount
 	driver     storage.MountDriver
@@ -204,21 +370,20 @@ type mountState struct {
 }
 
 // triggered on any failure during call into mount.
-func (a *API) clearMount(ms mountState) {
-	logrus.Errorf("MOUNT FAILURE: %v", ms.err)
+func (a *API) clearMount(ms mountState) error {
+	logger := logging.WithContext(log, ms.driverOpts.Context)
+	logger.Errorf("MOUNT FAILURE: %v", ms.err)
 
 	if err := ms.driver.Unmount(ms.driverOpts); err != nil {
 		// literally can't do anything about this situation. Log.
-		logrus.Errorf("Failure during unmount after failed mount: %v %v", err, ms.err)
+		logger.Errorf("Failure during unmount after failed mount: %v %v", err, ms.err)
 	}
 
 	if err := a.Lock.ClearLock(ms.ut, (*a.Global).Timeout); err != nil {
-		a.HTTPError(ms.w, errors.RefreshMount.Combine(errored.New(ms.volConfig.String())).Combine(err).Combine(ms.err))
-		return
+		return errors.RefreshMount.Combine(errored.New(ms.volConfig.String())).Combine(err).Combine(ms.err)
 	}
 
-	a.HTTPError(ms.w, errors.MountFailed.Combine(ms.err))
-	return
+	return errors.MountFailed.Combine(ms.err)
 }
 
 // Mount is the request to mount a volume.
@@ -228,17 +393,71 @@ func (a *API) Mount(w http.ResponseWriter, r *http.Request) {
 		a.HTTPError(w, errors.ConfiguringVolume.Combine(err))
 		return
 	}
+	request.Context = Detach(trace.Extract(r.Context(), r.Header))
+
+	path, err := a.MountVolume(request)
+	if err != nil {
+		a.HTTPError(w, err)
+		return
+	}
+
+	a.WriteMount(path, w)
+}
+
+// MountVolume mounts the volume under the mount lock, and returns the path it
+// is mounted at. It is used by every frontend.
+func (a *API) MountVolume(request *Volume) (string, error) {
+	start := time.Now()
+	span, ctx := trace.Start(request.Context, "mount")
+	span.SetTag("volume", request.String())
+	request.Context = ctx
+	path, err := a.mountVolume(request)
+	span.Finish(err)
+	metrics.ObserveOperation("mount", start, err)
+	if err == nil {
+		a.Client.RecordEvent(config.EventMounted, request.String(), a.Hostname, "mounted at %q", path)
+	}
+	return path, err
+}
+
+// unmountsFailedMounts reports whether the frontend sends an unmount after
+// every failed mount.
+func (a *API) unmountsFailedMounts() bool {
+	fmu, ok := a.Volplugin.(FailedMountUnmounter)
+	return ok && fmu.UnmountsFailedMounts()
+}
+
+// callerLogger returns the logger for the request, with its caller if the
+// frontend sent one.
+func callerLogger(request *Volume) *logrus.Entry {
+	logger := logging.WithContext(log, request.Context)
+	if request.CallerID != "" {
+		logger = logger.WithField("caller", request.CallerID)
+	}
 
-	logrus.Infof("Mounting volume %q", request)
-	logrus.Debugf("%#v", a.MountCollection)
+	return logger
+}
+
+func (a *API) mountVolume(request *Volume) (path string, err error) {
+	logger := callerLogger(request)
+	logger.Infof("Mounting volume %q", request)
+	logger.Debugf("%#v", a.MountCollection)
 
 	driver, volConfig, driverOpts, err := a.GetStorageParameters(request)
 	if err != nil {
-		a.HTTPError(w, errors.ConfiguringVolume.Combine(err))
-		return
+		return "", errors.ConfiguringVolume.Combine(err)
 	}
 
 	volName := volConfig.String()
+
+	if !config.MatchConstraints(volConfig.Constraints, a.Labels) {
+		return "", errors.PlacementConstraint.Combine(errored.Errorf("Volume %q requires labels %v; host %q has labels %v", volName, volConfig.Constraints, a.Hostname, a.Labels))
+	}
+
+	if a.Draining(volName) {
+		return "", errors.VolumeDraining.Combine(errored.New(volName))
+	}
+
 	ut := &config.UseMount{
 		Volume:   volName,
 		Reason:   lock.ReasonMount,
@@ -250,29 +469,34 @@ func (a *API) Mount(w http.ResponseWriter, r *http.Request) {
 		// previous mounts, is when in locked mode and a mount is held on another
 		// host. So we take an indefinite lock HERE while we calculate whether or not
 		// we already have one.
-		if err := a.Client.PublishUse(ut); err != nil {
-			a.HTTPError(w, errors.LockFailed.Combine(err))
-			return
+		if err := a.Client.WithContext(request.Context).PublishUse(ut); err != nil {
+			return "", errors.LockFailed.Combine(err)
 		}
 	}
 
 	// XXX docker issues unmount request after every mount failure so, this evens out
-	//     decreaseMount() in unmount
+	//     decreaseMount() in unmount. The other frontends do not, so the count
+	//     is taken back here when the mount fails.
+	if !a.unmountsFailedMounts() {
+		defer func() {
+			if err != nil {
+				a.MountCounter.Sub(volName)
+			}
+		}()
+	}
+
 	if a.MountCounter.Add(volName) > 1 {
 		if volConfig.Unlocked {
-			logrus.Warnf("Duplicate mount of %q detected: returning existing mount path", volName)
+			logger.Warnf("Duplicate mount of %q detected: returning existing mount path", volName)
 			path, err := a.getMountPath(driver, driverOpts)
 			if err != nil {
-				a.HTTPError(w, errors.MarshalResponse.Combine(err))
-				return
+				return "", errors.MarshalResponse.Combine(err)
 			}
-			a.WriteMount(path, w)
-			return
+			return path, nil
 		}
 
-		logrus.Warnf("Duplicate mount of %q detected: Lock failed", volName)
-		a.HTTPError(w, errors.LockFailed.Combine(errored.Errorf("Duplicate mount")))
-		return
+		logger.Warnf("Duplicate mount of %q detected: Lock failed", volName)
+		return "", errors.LockFailed.Combine(errored.Errorf("Duplicate mount"))
 	}
 
 	// so. if EBUSY is returned here, the resulting unmount will unmount an
@@ -284,8 +508,7 @@ func (a *API) Mount(w http.ResponseWriter, r *http.Request) {
 	// reach a user.
 	mc, err := driver.Mount(driverOpts)
 	if err != nil {
-		a.clearMount(mountState{w, err, ut, driver, driverOpts, volConfig})
-		return
+		return "", a.clearMount(mountState{err, ut, driver, driverOpts, volConfig})
 	}
 
 	a.MountCollection.Add(mc)
@@ -294,23 +517,21 @@ func (a *API) Mount(w http.ResponseWriter, r *http.Request) {
 	if !volConfig.Unlocked {
 		if err := a.startTTLRefresh(volName); err != nil {
 			a.RemoveStopChan(volName)
-			a.clearMount(mountState{w, err, ut, driver, driverOpts, volConfig})
-			return
+			return "", a.clearMount(mountState{err, ut, driver, driverOpts, volConfig})
 		}
 	}
 
 	if err := cgroup.ApplyCGroupRateLimit(volConfig.RuntimeOptions, mc); err != nil {
-		logrus.Errorf("Could not apply cgroups to volume %q", volConfig)
+		logger.Errorf("Could not apply cgroups to volume %q", volConfig)
 	}
 
-	path, err := driver.MountPath(driverOpts)
+	path, err = driver.MountPath(driverOpts)
 	if err != nil {
 		a.RemoveStopChan(volName)
-		a.clearMount(mountState{w, err, ut, driver, driverOpts, volConfig})
-		return
+		return "", a.clearMount(mountState{err, ut, driver, driverOpts, volConfig})
 	}
 
-	a.WriteMount(path, w)
+	return path, nil
 }
 
 func (a *API) startTTLRefresh(volName string) error {
@@ -337,17 +558,52 @@ func (a *API) Unmount(w http.ResponseWriter, r *http.Request) {
 		a.HTTPError(w, errors.UnmarshalRequest.Combine(err))
 		return
 	}
+	request.Context = Detach(trace.Extract(r.Context(), r.Header))
+
+	path, err := a.UnmountVolume(request)
+	if err != nil {
+		a.HTTPError(w, err)
+		return
+	}
 
-	logrus.Infof("Unmounting volume %q", request)
+	a.WriteMount(path, w)
+}
+
+// UnmountVolume unmounts the volume once its last mount on this host is
+// released, and returns the path it was mounted at. It is used by every
+// frontend.
+func (a *API) UnmountVolume(request *Volume) (string, error) {
+	start := time.Now()
+	span, ctx := trace.Start(request.Context, "unmount")
+	span.SetTag("volume", request.String())
+	request.Context = ctx
+	path, err := a.unmountVolume(request)
+	span.Finish(err)
+	metrics.ObserveOperation("unmount", start, err)
+	if err == nil {
+		a.Client.RecordEvent(config.EventUnmounted, request.String(), a.Hostname, "unmounted from %q", path)
+	}
+	return path, err
+}
+
+func (a *API) unmountVolume(request *Volume) (string, error) {
+	logger := callerLogger(request)
+	logger.Infof("Unmounting volume %q", request)
 
 	driver, volConfig, driverOpts, err := a.GetStorageParameters(request)
 	if err != nil {
-		a.HTTPError(w, errors.GetDriver.Combine(err))
-		return
+		return "", errors.GetDriver.Combine(err)
 	}
 
 	volName := volConfig.String()
 
+	// a mount which failed, and was taken off the count, leaves nothing to
+	// unmount. This is checked before the lock is taken, as it is not released
+	// on failure.
+	if a.MountCounter.Get(volName) == 0 {
+		return "", errors.UnmountFailed.Combine(errored.Errorf("%q is not mounted", volName))
+	}
+
 	ut := &config.UseMount{
 		Volume:   volName,
 		Reason:   lock.ReasonMount,
@@ -358,27 +614,23 @@ func (a *API) Unmount(w http.ResponseWriter, r *http.Request) {
 		// XXX to doubly ensure we do not UNMOUNT something that is held elsewhere
 		// (presumably because it is mounted THERE instead), we refuse to unmount
 		// anything that doesn't acquire a lock.
-		if err := a.Client.PublishUse(ut); err != nil {
-			a.HTTPError(w, errors.LockFailed.Combine(err))
-			return
+		if err := a.Client.WithContext(request.Context).PublishUse(ut); err != nil {
+			return "", errors.LockFailed.Combine(err)
 		}
 	}
 
 	if a.MountCounter.Sub(volName) > 0 {
-		logrus.Warnf("Duplicate unmount of %q detected: ignoring and returning success", volName)
+		logger.Warnf("Duplicate unmount of %q detected: ignoring and returning success", volName)
 		path, err := a.getMountPath(driver, driverOpts)
 		if err != nil {
-			a.HTTPError(w, errors.MarshalResponse.Combine(err))
-			return
+			return "", errors.MarshalResponse.Combine(err)
 		}
 
-		a.WriteMount(path, w)
-		return
+		return path, nil
 	}
 
 	if err := driver.Unmount(driverOpts); err != nil {
-		a.HTTPError(w, errors.UnmountFailed.Combine(err))
-		return
+		return "", errors.UnmountFailed.Combine(err)
 	}
 
 	a.MountCollection.Remove(volName)
@@ -389,9 +641,8 @@ func (a *API) Unmount(w http.ResponseWriter, r *http.Request) {
 
 	path, err := a.getMountPath(driver, driverOpts)
 	if err != nil {
-		a.HTTPError(w, errors.MarshalResponse.Combine(err))
-		return
+		return "", errors.MarshalResponse.Combine(err)
 	}
 
-	a.WriteMount(path, w)
+	return path, nil
 }
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	. "testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/db/impl/etcd3/etcd3test"
+	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/backend"
+)
+
+type apiSuite struct {
+	server *etcd3test.Server
+	driver *fakeMountDriver
+	mount  func(string) (storage.MountDriver, error)
+	client *config.Client
+	global *config.Global
+}
+
+var _ = Suite(&apiSuite{})
+
+func TestAPI(t *T) { TestingT(t) }
+
+func (s *apiSuite) SetUpTest(c *C) {
+	s.server = etcd3test.NewServer()
+
+	var err error
+	s.client, err = config.NewStoreClient("/volplugin", "etcd3://"+strings.TrimPrefix(s.server.URL, "http://"), nil)
+	c.Assert(err, IsNil)
+
+	s.global = config.NewGlobalConfig()
+	s.global.TTL = time.Minute
+	c.Assert(s.client.PublishGlobal(s.global), IsNil)
+
+	policy := &config.Policy{
+		Name:          "policy1",
+		Backends:      &config.BackendDrivers{CRUD: "ceph", Mount: "ceph", Snapshot: "ceph"},
+		DriverOptions: map[string]string{"pool": "rbd"},
+		CreateOptions: config.CreateOptions{Size: "10MB", FileSystem: "ext4"},
+	}
+	c.Assert(s.client.PublishPolicy(policy.Name, policy), IsNil)
+
+	vol, err := s.client.CreateVolume(&config.VolumeRequest{Policy: "policy1", Name: "foo"})
+	c.Assert(err, IsNil)
+	c.Assert(s.client.PublishVolume(vol), IsNil)
+
+	// the ceph mount driver is replaced, as policies may only name real backends.
+	s.driver = &fakeMountDriver{mounted: map[string]bool{}}
+	s.mount = backend.MountDrivers["ceph"]
+	backend.MountDrivers["ceph"] = func(string) (storage.MountDriver, error) { return s.driver, nil }
+}
+
+func (s *apiSuite) TearDownTest(c *C) {
+	backend.MountDrivers["ceph"] = s.mount
+	s.server.Close()
+}
+
+// frontend is a frontend which does not unmount after failed mounts. Remove
+// requests are the volume's name in the body.
+type frontend struct {
+	Volplugin
+}
+
+func (f *frontend) ReadRemove(r *http.Request) (*Volume, error) {
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, name, err := storage.SplitName(string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Volume{Policy: policy, Name: name}, nil
+}
+
+func (f *frontend) WritePath(path string, w http.ResponseWriter) error {
+	_, err := w.Write([]byte(path))
+	return err
+}
+
+func (f *frontend) HTTPError(w http.ResponseWriter, err error) {
+	RESTHTTPError(w, err)
+}
+
+// unmountingFrontend unmounts after failed mounts, like docker.
+type unmountingFrontend struct {
+	Volplugin
+}
+
+func (f *unmountingFrontend) UnmountsFailedMounts() bool { return true }
+
+func (s *apiSuite) TestFailedMountUnmount(c *C) {
+	a := NewAPI(&frontend{}, "mon0", s.client, &s.global)
+	vol := &Volume{Policy: "policy1", Name: "foo"}
+
+	s.driver.fail = true
+	_, err := a.MountVolume(vol)
+	c.Assert(err, NotNil)
+	c.Assert(a.MountCounter.Get("policy1/foo"), Equals, 0)
+
+	// there is nothing to unmount.
+	_, err = a.UnmountVolume(vol)
+	c.Assert(err, NotNil)
+	c.Assert(a.MountCounter.Get("policy1/foo"), Equals, 0)
+
+	// the failed mount is not taken for a duplicate of the next one.
+	s.driver.fail = false
+	_, err = a.MountVolume(vol)
+	c.Assert(err, IsNil)
+	c.Assert(a.MountCounter.Get("policy1/foo"), Equals, 1)
+	c.Assert(s.driver.isMounted("policy1/foo"), Equals, true)
+
+	_, err = a.UnmountVolume(vol)
+	c.Assert(err, IsNil)
+	c.Assert(a.MountCounter.Get("policy1/foo"), Equals, 0)
+	c.Assert(s.driver.isMounted("policy1/foo"), Equals, false)
+}
+
+func (s *apiSuite) TestFailedMountUnmountedByFrontend(c *C) {
+	a := NewAPI(&unmountingFrontend{}, "mon0", s.client, &s.global)
+	vol := &Volume{Policy: "policy1", Name: "foo"}
+
+	s.driver.fail = true
+	_, err := a.MountVolume(vol)
+	c.Assert(err, NotNil)
+	c.Assert(a.MountCounter.Get("policy1/foo"), Equals, 1)
+
+	// the unmount sent by the frontend evens out the count.
+	_, err = a.UnmountVolume(vol)
+	c.Assert(err, IsNil)
+	c.Assert(a.MountCounter.Get("policy1/foo"), Equals, 0)
+}
+
+// removeServer serves the removals of the apiserver, and records them.
+func removeServer(c *C, removed *[]*config.VolumeRequest) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Method, Equals, "DELETE")
+		c.Assert(r.URL.Path, Equals, "/volumes/remove")
+
+		req := &config.VolumeRequest{}
+		c.Assert(json.NewDecoder(r.Body).Decode(req), IsNil)
+		*removed = append(*removed, req)
+	}))
+}
+
+func (s *apiSuite) removeMode(c *C, mode string) {
+	policy, err := s.client.GetPolicy("policy1")
+	c.Assert(err, IsNil)
+	policy.Remove = mode
+	c.Assert(s.client.PublishPolicy("policy1", policy), IsNil)
+}
+
+func (s *apiSuite) remove(a *API, name string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	a.Remove(w, httptest.NewRequest("POST", "/VolumeDriver.Remove", strings.NewReader(name)))
+	return w
+}
+
+func (s *apiSuite) TestRemoveRecordOnly(c *C) {
+	removed := []*config.VolumeRequest{}
+	server := removeServer(c, &removed)
+	defer server.Close()
+
+	a := NewAPI(&frontend{}, "mon0", s.client, &s.global)
+	a.APIServer = strings.TrimPrefix(server.URL, "http://")
+
+	// volumes are not removed by default.
+	w := s.remove(a, "policy1/foo")
+	c.Assert(w.Code, Equals, http.StatusOK, Commentf("%s", w.Body))
+	c.Assert(removed, HasLen, 0)
+
+	s.removeMode(c, config.RemoveRecordOnly)
+	w = s.remove(a, "policy1/foo")
+	c.Assert(w.Code, Equals, http.StatusOK, Commentf("%s", w.Body))
+	c.Assert(removed, HasLen, 1)
+	c.Assert(removed[0].Policy, Equals, "policy1")
+	c.Assert(removed[0].Name, Equals, "foo")
+	c.Assert(removed[0].Options["record-only"], Equals, "true")
+
+	s.removeMode(c, config.RemoveDestroy)
+	w = s.remove(a, "policy1/foo")
+	c.Assert(w.Code, Equals, http.StatusOK, Commentf("%s", w.Body))
+	c.Assert(removed, HasLen, 2)
+	c.Assert(removed[1].Options["record-only"], Equals, "")
+}
+
+func (s *apiSuite) TestRemoveInUse(c *C) {
+	removed := []*config.VolumeRequest{}
+	server := removeServer(c, &removed)
+	defer server.Close()
+
+	a := NewAPI(&frontend{}, "mon0", s.client, &s.global)
+	a.APIServer = strings.TrimPrefix(server.URL, "http://")
+	s.removeMode(c, config.RemoveDestroy)
+
+	um := &config.UseMount{Volume: "policy1/foo", Reason: lock.ReasonMount, Hostname: "mon1"}
+	c.Assert(s.client.PublishUse(um), IsNil)
+
+	// the apiserver is not asked to remove a volume mounted elsewhere.
+	w := s.remove(a, "policy1/foo")
+	c.Assert(w.Code, Equals, http.StatusInternalServerError)
+	c.Assert(w.Body.String(), Matches, `(?s).*in use on host "mon1".*`)
+	c.Assert(removed, HasLen, 0)
+
+	c.Assert(s.client.RemoveUse(um, true), IsNil)
+	w = s.remove(a, "policy1/foo")
+	c.Assert(w.Code, Equals, http.StatusOK, Commentf("%s", w.Body))
+	c.Assert(removed, HasLen, 1)
+}
+
+// fakeMountDriver mounts volumes in memory. Mounts fail while fail is set.
+type fakeMountDriver struct {
+	mutex   sync.Mutex
+	fail    bool
+	mounted map[string]bool
+}
+
+func (f *fakeMountDriver) isMounted(name string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.mounted[name]
+}
+
+func (f *fakeMountDriver) Name() string                             { return "ceph" }
+func (f *fakeMountDriver) Validate(do *storage.DriverOptions) error { return nil }
+
+func (f *fakeMountDriver) Mount(do storage.DriverOptions) (*storage.Mount, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.fail {
+		return nil, errored.Errorf("mount of %q failed", do.Volume.Name)
+	}
+
+	f.mounted[do.Volume.Name] = true
+	return &storage.Mount{Path: "/mnt/" + do.Volume.Name, Volume: do.Volume}, nil
+}
+
+func (f *fakeMountDriver) Unmount(do storage.DriverOptions) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.mounted, do.Volume.Name)
+	return nil
+}
+
+func (f *fakeMountDriver) Mounted(time.Duration) ([]*storage.Mount, error) {
+	return nil, nil
+}
+
+func (f *fakeMountDriver) MountPath(do storage.DriverOptions) (string, error) {
+	return "/mnt/" + do.Volume.Name, nil
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/lock"
+	"github.com/jbeda/go-wait"
+)
+
+// Draining returns true if the volume is being handed off from this host and
+// must not be mounted.
+func (a *API) Draining(volName string) bool {
+	a.drainMutex.Lock()
+	defer a.drainMutex.Unlock()
+	_, ok := a.draining[volName]
+	return ok
+}
+
+// Undrain allows mounts of the volume again.
+func (a *API) Undrain(volName string) {
+	a.drainMutex.Lock()
+	delete(a.draining, volName)
+	a.drainMutex.Unlock()
+}
+
+// mounted determines if the volume is still mounted, or being unmounted, on
+// this host. The counter drops before the unmount completes, so the mount
+// collection and TTL refresh are checked too.
+func (a *API) mounted(volName string) bool {
+	if a.MountCounter.Get(volName) > 0 {
+		return true
+	}
+
+	if _, err := a.MountCollection.Get(volName); err == nil {
+		return true
+	}
+
+	a.lockStopChanMutex.Lock()
+	defer a.lockStopChanMutex.Unlock()
+	_, ok := a.lockStopChans[volName]
+	return ok
+}
+
+// Drain refuses any new mounts of the volume and waits up to the timeout for
+// docker to unmount it everywhere on this host, giving up early if cancelled
+// returns true. The volume stays drained until Undrain is called.
+func (a *API) Drain(volName string, timeout time.Duration, cancelled func() bool) error {
+	a.drainMutex.Lock()
+	a.draining[volName] = struct{}{}
+	a.drainMutex.Unlock()
+
+	now := time.Now()
+
+	for a.mounted(volName) {
+		if time.Since(now) >= timeout {
+			return errors.Handoff.Combine(errored.Errorf("Timed out waiting for %q to be unmounted", volName))
+		}
+
+		if cancelled() {
+			return errors.HandoffCancelled.Combine(errored.New(volName))
+		}
+
+		log.Debugf("Waiting for %q to be unmounted for handoff", volName)
+		time.Sleep(wait.Jitter(time.Second, 0))
+	}
+
+	return nil
+}
+
+// Handoff drains the volume from this host and reserves its mount lock for
+// the receiving host for the grace window in the handoff.
+func (a *API) Handoff(h *config.Handoff) error {
+	log.Infof("Handing off volume %q to host %q", h.Volume, h.To)
+
+	cancelled := func() bool { return a.handoffCancelled(h) }
+
+	if err := a.Drain(h.Volume, (*a.Global).Timeout, cancelled); err != nil {
+		a.Undrain(h.Volume)
+		return err
+	}
+
+	defer a.Undrain(h.Volume)
+
+	if cancelled() {
+		return errors.HandoffCancelled.Combine(errored.New(h.Volume))
+	}
+
+	// the unmount released our lock through the TTL refresh goroutine already,
+	// but the reservation is a compare/swap against our lock in case that has
+	// not happened yet.
+	from := &config.UseMount{Volume: h.Volume, Reason: lock.ReasonMount, Hostname: a.Hostname}
+	to := &config.UseMount{Volume: h.Volume, Reason: lock.ReasonMount, Hostname: h.To}
+
+	if err := a.Client.ReserveUse(from, to, h.Grace); err != nil {
+		return errors.Handoff.Combine(errored.New(h.Volume)).Combine(err)
+	}
+
+	return nil
+}
+
+// handoffCancelled determines if the handoff record was removed or replaced
+// while the volume was draining.
+func (a *API) handoffCancelled(h *config.Handoff) bool {
+	current, err := a.Client.GetHandoff(h.Volume)
+	if err != nil {
+		return true
+	}
+
+	return current.Status != config.HandoffDraining || current.From != h.From || current.To != h.To || !current.Requested.Equal(h.Requested)
+}
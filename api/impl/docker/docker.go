@@ -6,14 +6,16 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/contiv/volplugin/api"
 	"github.com/contiv/volplugin/config"
 	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/logging"
 	"github.com/contiv/volplugin/storage"
 	"github.com/gorilla/mux"
 )
 
+var log = logging.For("api")
+
 // Volplugin implements the docker volumes API via the interfaces in api/interfaces.go.
 type Volplugin struct{}
 
@@ -22,15 +24,22 @@ func NewVolplugin() api.Volplugin {
 	return &Volplugin{}
 }
 
+// UnmountsFailedMounts is true: docker sends an unmount after every failed
+// mount.
+func (v *Volplugin) UnmountsFailedMounts() bool {
+	return true
+}
+
 // Router returns a docker-compatible HTTP gorilla/mux router. If the debug
-// global is set, handlers will be wrapped in a request logger.
+// global is set, handlers will be wrapped in a request logger. The admin
+// routes are served under /admin.
 func (v *Volplugin) Router(a *api.API) *mux.Router {
 	var routeMap = map[string]func(http.ResponseWriter, *http.Request){
 		"/Plugin.Activate":           Activate,
 		"/Plugin.Deactivate":         Deactivate,
 		"/VolumeDriver.Capabilities": Capabilities,
 		"/VolumeDriver.Create":       a.Create,
-		"/VolumeDriver.Remove":       a.Path, // we never actually remove through docker's interface.
+		"/VolumeDriver.Remove":       a.Remove,
 		"/VolumeDriver.Path":         a.Path,
 		"/VolumeDriver.Get":          a.Get,
 		"/VolumeDriver.List":         a.List,
@@ -50,6 +59,8 @@ func (v *Volplugin) Router(a *api.API) *mux.Router {
 		s.HandleFunc("{action:.*}", api.Action)
 	}
 
+	a.AdminRoutes(router.PathPrefix("/admin").Subrouter())
+
 	return router
 }
 
@@ -62,7 +73,7 @@ func (v *Volplugin) HTTPError(w http.ResponseWriter, err error) {
 		return
 	}
 
-	logrus.Errorf("Returning HTTP error handling plugin negotiation: %s", err.Error())
+	logging.WithResponse(log, w).Errorf("Returning HTTP error handling plugin negotiation: %s", err.Error())
 	http.Error(w, string(content), http.StatusOK)
 }
 
@@ -124,8 +135,8 @@ func (v *Volplugin) ReadGet(r *http.Request) (string, error) {
 }
 
 // WriteGet writes an appropriate response to Get calls.
-func (v *Volplugin) WriteGet(name, mountpoint string, w http.ResponseWriter) error {
-	content, err := json.Marshal(VolumeGetResponse{Volume: Volume{Name: name, Mountpoint: mountpoint}})
+func (v *Volplugin) WriteGet(name, mountpoint string, status map[string]interface{}, w http.ResponseWriter) error {
+	content, err := json.Marshal(VolumeGetResponse{Volume: Volume{Name: name, Mountpoint: mountpoint, Status: status}})
 	if err != nil {
 		return err
 	}
@@ -202,6 +213,22 @@ func (v *Volplugin) ReadMount(r *http.Request) (*api.Volume, error) {
 		return nil, err
 	}
 
+	return &api.Volume{Policy: policy, Name: name, CallerID: vol.ID}, nil
+}
+
+// ReadRemove reads a remove request and returns the volume to remove. Docker
+// does not say who requested the removal.
+func (v *Volplugin) ReadRemove(r *http.Request) (*api.Volume, error) {
+	vol, err := unmarshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, name, err := storage.SplitName(vol.Name)
+	if err != nil {
+		return nil, err
+	}
+
 	return &api.Volume{Policy: policy, Name: name}, nil
 }
 
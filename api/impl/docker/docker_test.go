@@ -10,6 +10,7 @@ import (
 	"os/exec"
 	"strings"
 	. "testing"
+	"time"
 
 	"github.com/contiv/volplugin/api"
 	"github.com/contiv/volplugin/config"
@@ -125,7 +126,7 @@ func (s *dockerSuite) TestBasic(c *C) {
 	c.Assert(len(list.Volumes), Equals, 1)
 	c.Assert(list.Volumes[0].Name, Equals, "policy1/test")
 
-	// XXX ensure that remove does NOT remove the volume
+	// XXX ensure that remove does NOT remove the volume under the default remove mode
 	resp, err = s.postStruct("VolumeDriver.Remove", &Volume{Name: "policy1/test"})
 	c.Assert(err, IsNil)
 	c.Assert(resp.StatusCode, Equals, 200, Commentf("%v", resp))
@@ -161,3 +162,90 @@ func (s *dockerSuite) TestBasic(c *C) {
 	c.Assert(list.Err, Equals, "", Commentf("%v", list.Err))
 	c.Assert(list.Volumes, IsNil)
 }
+
+func (s *dockerSuite) TestCapabilities(c *C) {
+	resp, err := s.postStruct("VolumeDriver.Capabilities", nil)
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, 200, Commentf("%v", resp))
+
+	content, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	caps := &CapabilitiesResponse{}
+	c.Assert(json.Unmarshal(content, caps), IsNil)
+	c.Assert(caps.Err, Equals, "")
+	c.Assert(caps.Capabilities.Scope, Equals, ScopeGlobal)
+}
+
+func (s *dockerSuite) TestGetStatus(c *C) {
+	err := s.client.PublishPolicy("policy1", &config.Policy{
+		Name:          "policy1",
+		Backend:       "ceph",
+		DriverOptions: map[string]string{"pool": "rbd"},
+		CreateOptions: config.CreateOptions{
+			Size: "10MB",
+		},
+	})
+	c.Assert(err, IsNil)
+
+	resp, err := s.postStruct("VolumeDriver.Create", VolumeGetRequest{Name: "policy1/test"})
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, 200, Commentf("%v", resp))
+
+	get := func() map[string]interface{} {
+		resp, err := s.postStruct("VolumeDriver.Get", VolumeGetRequest{Name: "policy1/test"})
+		c.Assert(err, IsNil)
+		c.Assert(resp.StatusCode, Equals, 200, Commentf("%v", resp))
+
+		content, err := ioutil.ReadAll(resp.Body)
+		c.Assert(err, IsNil)
+		getResp := &VolumeGetResponse{}
+		c.Assert(json.Unmarshal(content, getResp), IsNil)
+		c.Assert(getResp.Err, Equals, "")
+
+		return getResp.Volume.Status
+	}
+
+	status := get()
+	c.Assert(status["policy"], Equals, "policy1")
+	c.Assert(status["backend"], Equals, "ceph")
+	c.Assert(status["size"], Equals, "10MB")
+	c.Assert(status["locked"], Equals, true)
+	c.Assert(status["holders"], DeepEquals, []interface{}{})
+	_, ok := status["snapshots"]
+	c.Assert(ok, Equals, false)
+
+	// the snapshot count comes from the published usage.
+	snapshots := 2
+	c.Assert(s.client.PublishVolumeCapacity(&config.VolumeCapacity{Volume: "policy1/test", Snapshots: &snapshots}, time.Minute), IsNil)
+	c.Assert(get()["snapshots"], Equals, float64(2))
+
+	c.Assert(s.client.RemoveVolume("policy1", "test"), IsNil)
+}
+
+func (s *dockerSuite) TestAdmin(c *C) {
+	s.api.MountCounter.Add("policy1/test")
+	s.api.AddStopChan("policy1/test", make(chan struct{}, 1))
+	defer s.api.RemoveStopChan("policy1/test")
+
+	resp, err := http.Get(s.server.URL + "/admin/mounts/policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, 200)
+
+	am := &api.AdminMount{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(am), IsNil)
+	c.Assert(am.Count, Equals, 1)
+	c.Assert(am.Refreshing, Equals, true)
+	c.Assert(am.Mount, IsNil)
+
+	resp, err = http.Get(s.server.URL + "/admin/refreshes")
+	c.Assert(err, IsNil)
+	refreshes := []string{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(&refreshes), IsNil)
+	c.Assert(refreshes, DeepEquals, []string{"policy1/test"})
+
+	for _, path := range []string{"/admin/mounts", "/admin/mounts/counts", "/admin/global", "/admin/debug/pprof/", "/admin/debug/pprof/goroutine"} {
+		resp, err := http.Get(s.server.URL + path)
+		c.Assert(err, IsNil)
+		c.Assert(resp.StatusCode, Equals, 200, Commentf("%s", path))
+	}
+}
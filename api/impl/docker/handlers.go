@@ -24,16 +24,12 @@ func Deactivate(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(200)
 }
 
-// Capabilities is the API response for docker capabilities requests.
+// Capabilities is the API response for docker capabilities requests. Volumes
+// are kept in etcd and can be mounted on any host, so the scope is global.
 func Capabilities(w http.ResponseWriter, r *http.Request) {
-	content, err := json.Marshal(map[string]map[string]string{
-		"Capabilities": {
-			"Scope": "global",
-		},
-	})
-
+	content, err := json.Marshal(CapabilitiesResponse{Capabilities: Capability{Scope: ScopeGlobal}})
 	if err != nil {
-		NewVolplugin().HTTPError(w, errors.UnmarshalRequest.Combine(err))
+		NewVolplugin().HTTPError(w, errors.MarshalResponse.Combine(err))
 		return
 	}
 
@@ -1,9 +1,12 @@
 package docker
 
 // VolumeCreateRequest is taken from struct Request in https://github.com/calavera/docker-volume-api/blob/master/api.go#L27
+// ID identifies the mount; docker sends it with mount and unmount requests
+// only. Remove requests name the volume and nothing else.
 type VolumeCreateRequest struct {
 	Name string
 	Opts map[string]string
+	ID   string
 }
 
 // Response is taken from struct Response in https://github.com/calavera/docker-volume-api/blob/master/api.go#L33
@@ -12,10 +15,12 @@ type Response struct {
 	Err        string
 }
 
-// Volume represents the docker 'Volume' entity used in get and list
+// Volume represents the docker 'Volume' entity used in get and list. Status
+// is only reported by get.
 type Volume struct {
 	Name       string
 	Mountpoint string
+	Status     map[string]interface{} `json:",omitempty"`
 }
 
 // VolumeGetRequest is taken from this struct in https://github.com/docker/docker/blob/master/volume/drivers/proxy.go#L187
@@ -34,3 +39,21 @@ type VolumeList struct {
 	Volumes []Volume
 	Err     string
 }
+
+// Scopes of the volumes of a driver. Volumes of a global driver are created
+// once for the cluster; volumes of a local driver exist on one host.
+const (
+	ScopeGlobal = "global"
+	ScopeLocal  = "local"
+)
+
+// Capability is taken from struct Capability in https://github.com/docker/docker/blob/master/volume/volume.go
+type Capability struct {
+	Scope string
+}
+
+// CapabilitiesResponse is taken from struct volumeDriverProxyCapabilitiesResponse in https://github.com/docker/docker/blob/master/volume/drivers/proxy.go
+type CapabilitiesResponse struct {
+	Capabilities Capability
+	Err          string
+}
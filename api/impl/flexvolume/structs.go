@@ -0,0 +1,34 @@
+package flexvolume
+
+// Status values of a FlexVolume response.
+const (
+	StatusSuccess      = "Success"
+	StatusFailure      = "Failure"
+	StatusNotSupported = "Not supported"
+)
+
+// Capabilities are the driver capabilities reported to the kubelet on init.
+type Capabilities struct {
+	Attach bool `json:"attach"`
+}
+
+// Response is the FlexVolume driver response, taken from
+// https://github.com/kubernetes/kubernetes/blob/master/pkg/volume/flexvolume/driver-call.go
+// Mountpoint is not part of the protocol; it is used between the driver and
+// volplugin only.
+type Response struct {
+	Status       string        `json:"status"`
+	Message      string        `json:"message,omitempty"`
+	Device       string        `json:"device,omitempty"`
+	VolumeName   string        `json:"volumeName,omitempty"`
+	Attached     bool          `json:"attached,omitempty"`
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+	Mountpoint   string        `json:"mountpoint,omitempty"`
+}
+
+// Request is sent by the driver to volplugin. Volume is the policy/volume
+// name and Options are the options the kubelet supplied.
+type Request struct {
+	Volume  string            `json:"volume"`
+	Options map[string]string `json:"options"`
+}
@@ -0,0 +1,181 @@
+// Package mesos implements the volplugin side of the Mesos docker/volume
+// isolator. The isolator executes dvdcli, which forwards its calls to
+// volplugin over a local unix socket; they are served here through the same
+// handlers as docker's, so volume names and options behave identically.
+package mesos
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/logging"
+	"github.com/contiv/volplugin/storage"
+	"github.com/gorilla/mux"
+)
+
+var log = logging.For("api")
+
+// DefaultSocket is the socket volplugin serves the Mesos frontend on.
+const DefaultSocket = "/run/volplugin/mesos.sock"
+
+// Volplugin implements the Mesos frontend via the interfaces in api/interfaces.go.
+type Volplugin struct{}
+
+// NewVolplugin initializes the Mesos api interface for volplugin.
+func NewVolplugin() api.Volplugin {
+	return &Volplugin{}
+}
+
+// Router returns the gorilla/mux router for the dvdcli calls. If the debug
+// global is set, handlers will be wrapped in a request logger.
+func (v *Volplugin) Router(a *api.API) *mux.Router {
+	var routeMap = map[string]func(http.ResponseWriter, *http.Request){
+		"/Mesos.Create":  a.Create,
+		"/Mesos.Mount":   a.Mount,
+		"/Mesos.Unmount": a.Unmount,
+		"/Mesos.Path":    a.Path,
+	}
+
+	router := mux.NewRouter()
+	s := router.Methods("POST").Subrouter()
+
+	for key, value := range routeMap {
+		s.HandleFunc(key, api.LogHandler(key[1:], (*a.Global).Debug, value))
+	}
+
+	if (*a.Global).Debug {
+		s.HandleFunc("{action:.*}", api.Action)
+	}
+
+	return router
+}
+
+// HTTPError returns a 200 status with the error in the response, which
+// dvdcli relays to the isolator. It returns 500 if marshaling failed.
+func (v *Volplugin) HTTPError(w http.ResponseWriter, err error) {
+	resp := Response{Err: err.Error()}
+	if er, ok := err.(*errored.Error); ok && er.Contains(errors.Exists) {
+		resp.Code = CodeExists
+	}
+
+	content, errc := json.Marshal(resp)
+	if errc != nil {
+		http.Error(w, errc.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logging.WithResponse(log, w).Errorf("Returning HTTP error handling Mesos request: %s", err.Error())
+	http.Error(w, string(content), http.StatusOK)
+}
+
+func unmarshal(r *http.Request) (*Request, error) {
+	req := &Request{}
+
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, errors.ReadBody.Combine(err)
+	}
+
+	if err := json.Unmarshal(content, req); err != nil {
+		return nil, errors.UnmarshalRequest.Combine(err)
+	}
+
+	return req, nil
+}
+
+func writeResponse(resp Response, w http.ResponseWriter) error {
+	content, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(content)
+	return err
+}
+
+// ReadCreate reads a create request and parses it into a policy/volume, as
+// the docker frontend does.
+func (v *Volplugin) ReadCreate(r *http.Request) (*config.VolumeRequest, error) {
+	req, err := unmarshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, volume, err := storage.SplitName(req.Volume)
+	if err != nil {
+		return nil, errors.UnmarshalRequest.Combine(errors.InvalidVolume).Combine(err)
+	}
+
+	return &config.VolumeRequest{Policy: policy, Name: volume, Options: req.Options}, nil
+}
+
+// WriteCreate writes the response to a create request.
+func (v *Volplugin) WriteCreate(volConfig *config.Volume, w http.ResponseWriter) error {
+	return writeResponse(Response{}, w)
+}
+
+// ReadGet reads a get request and returns the name of the volume.
+func (v *Volplugin) ReadGet(r *http.Request) (string, error) {
+	return v.ReadPath(r)
+}
+
+// WriteGet writes the response to a get request.
+func (v *Volplugin) WriteGet(name, mountpoint string, status map[string]interface{}, w http.ResponseWriter) error {
+	return writeResponse(Response{Mountpoint: mountpoint}, w)
+}
+
+// ReadPath reads a path request and returns the name of the volume.
+func (v *Volplugin) ReadPath(r *http.Request) (string, error) {
+	req, err := unmarshal(r)
+	if err != nil {
+		return "", err
+	}
+
+	if _, _, err := storage.SplitName(req.Volume); err != nil {
+		return "", err
+	}
+
+	return req.Volume, nil
+}
+
+// WritePath writes the response to a path request.
+func (v *Volplugin) WritePath(mountpoint string, w http.ResponseWriter) error {
+	return writeResponse(Response{Mountpoint: mountpoint}, w)
+}
+
+// WriteList writes the response to a list request. dvdcli has no list call,
+// so only an empty response is written.
+func (v *Volplugin) WriteList(volumes []string, w http.ResponseWriter) error {
+	return writeResponse(Response{}, w)
+}
+
+// ReadMount reads a mount or unmount request and returns the volume.
+func (v *Volplugin) ReadMount(r *http.Request) (*api.Volume, error) {
+	req, err := unmarshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, name, err := storage.SplitName(req.Volume)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.Volume{Policy: policy, Name: name, Options: req.Options}, nil
+}
+
+// ReadRemove reads a remove request and returns the volume. Volumes are not
+// removed through Mesos, but the request is parsed for completeness.
+func (v *Volplugin) ReadRemove(r *http.Request) (*api.Volume, error) {
+	return v.ReadMount(r)
+}
+
+// WriteMount writes the mountpoint as a reply to a mount or unmount request.
+func (v *Volplugin) WriteMount(mountPoint string, w http.ResponseWriter) error {
+	return writeResponse(Response{Mountpoint: mountPoint}, w)
+}
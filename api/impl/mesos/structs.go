@@ -0,0 +1,19 @@
+package mesos
+
+// Request is sent by dvdcli to volplugin. Volume is the policy/volume name and
+// Options are the volume options, which are the same as docker's.
+type Request struct {
+	Volume  string            `json:"volume"`
+	Options map[string]string `json:"options"`
+}
+
+// CodeExists is the Code of a failure to create a volume which exists.
+const CodeExists = "exists"
+
+// Response is volplugin's reply to dvdcli. Err is set on failure; Code is set
+// for failures the client acts on.
+type Response struct {
+	Mountpoint string `json:"mountpoint,omitempty"`
+	Err        string `json:"err,omitempty"`
+	Code       string `json:"code,omitempty"`
+}
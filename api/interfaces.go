@@ -20,10 +20,18 @@ type Volplugin interface {
 	ReadCreate(*http.Request) (*config.VolumeRequest, error)
 	WriteCreate(*config.Volume, http.ResponseWriter) error
 	ReadGet(*http.Request) (string, error)
-	WriteGet(string, string, http.ResponseWriter) error
+	WriteGet(string, string, map[string]interface{}, http.ResponseWriter) error
 	ReadPath(*http.Request) (string, error)
 	WritePath(string, http.ResponseWriter) error
 	WriteList([]string, http.ResponseWriter) error
 	ReadMount(*http.Request) (*Volume, error)
+	ReadRemove(*http.Request) (*Volume, error)
 	WriteMount(string, http.ResponseWriter) error
 }
+
+// FailedMountUnmounter is implemented by frontends whose clients send an
+// unmount after every failed mount, as docker does. Mounts which fail through
+// any other frontend are taken off the mount count by MountVolume itself.
+type FailedMountUnmounter interface {
+	UnmountsFailedMounts() bool
+}
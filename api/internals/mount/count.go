@@ -3,8 +3,6 @@ package mount
 import (
 	"fmt"
 	"sync"
-
-	"github.com/Sirupsen/logrus"
 )
 
 // Counter implements a tracker for specific mounts.
@@ -39,7 +37,7 @@ func (c *Counter) Add(mp string) int {
 	defer c.mutex.Unlock()
 
 	c.count[mp]++
-	logrus.Debugf("Mount count increased to %d for %q", c.count[mp], mp)
+	log.Debugf("Mount count increased to %d for %q", c.count[mp], mp)
 	return c.count[mp]
 }
 
@@ -50,7 +48,7 @@ func (c *Counter) AddCount(mp string, n int) int {
 	defer c.mutex.Unlock()
 
 	c.count[mp] += n
-	logrus.Debugf("Mount count increased to %d for %q", c.count[mp], mp)
+	log.Debugf("Mount count increased to %d for %q", c.count[mp], mp)
 	return c.count[mp]
 }
 
@@ -61,10 +59,36 @@ func (c *Counter) Sub(mp string) int {
 	defer c.mutex.Unlock()
 
 	c.count[mp]--
-	logrus.Debugf("Mount count decreased to %d for %q", c.count[mp], mp)
+	log.Debugf("Mount count decreased to %d for %q", c.count[mp], mp)
 	if c.count[mp] < 0 {
 		panic(fmt.Sprintf("Assertion failed while tracking unmount: mount count for %q is less than 0", mp))
 	}
 
 	return c.count[mp]
 }
+
+// List returns a copy of the mount counters, by volume name.
+func (c *Counter) List() map[string]int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	counts := map[string]int{}
+	for mp, count := range c.count {
+		counts[mp] = count
+	}
+
+	return counts
+}
+
+// Total returns the sum of the mount counters of all volumes.
+func (c *Counter) Total() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var total int
+	for _, count := range c.count {
+		total += count
+	}
+
+	return total
+}
@@ -4,12 +4,14 @@ import (
 	"fmt"
 	"sync"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/logging"
 	"github.com/contiv/volplugin/storage"
 )
 
+var log = logging.For("api")
+
 // Collection is a data structure used for tracking live mounts.
 type Collection struct {
 	mountMap      map[string]*storage.Mount
@@ -29,7 +31,7 @@ func NewCollection() *Collection {
 func (c *Collection) Add(mc *storage.Mount) {
 	c.mountMapMutex.Lock()
 	defer c.mountMapMutex.Unlock()
-	logrus.Infof("Adding mount %q", mc.Volume.Name)
+	log.Infof("Adding mount %q", mc.Volume.Name)
 
 	if _, ok := c.mountMap[mc.Volume.Name]; ok {
 		// we should NEVER see this and volplugin should absolutely crash if it is seen.
@@ -43,16 +45,29 @@ func (c *Collection) Add(mc *storage.Mount) {
 func (c *Collection) Remove(vol string) {
 	c.mountMapMutex.Lock()
 	defer c.mountMapMutex.Unlock()
-	logrus.Infof("Removing mount %q", vol)
+	log.Infof("Removing mount %q", vol)
 	delete(c.mountMap, vol)
 }
 
+// List returns the mounts in the collection.
+func (c *Collection) List() []*storage.Mount {
+	c.mountMapMutex.Lock()
+	defer c.mountMapMutex.Unlock()
+
+	mounts := []*storage.Mount{}
+	for _, mc := range c.mountMap {
+		mounts = append(mounts, mc)
+	}
+
+	return mounts
+}
+
 // Get obtains the mount from the collection
 func (c *Collection) Get(vol string) (*storage.Mount, error) {
 	c.mountMapMutex.Lock()
 	defer c.mountMapMutex.Unlock()
-	logrus.Debugf("Retrieving mount %q", vol)
-	logrus.Debugf("Mount collection: %#v", c.mountMap)
+	log.Debugf("Retrieving mount %q", vol)
+	log.Debugf("Mount collection: %#v", c.mountMap)
 	mc, ok := c.mountMap[vol]
 	if !ok {
 		return nil, errored.Errorf("Could not find mount for volume %q", vol).Combine(errors.NotExists)
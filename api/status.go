@@ -0,0 +1,91 @@
+package api
+
+import (
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/logging"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/backend"
+
+	"golang.org/x/net/context"
+)
+
+// volumeStatus returns the status of the volume reported by Get: its policy,
+// backend, size, locking, the hosts holding its mount lock, and its snapshot
+// count if its usage is published. Details which cannot be retrieved are
+// logged and left out.
+func (a *API) volumeStatus(ctx context.Context, volConfig *config.Volume) map[string]interface{} {
+	status := map[string]interface{}{
+		"policy": volConfig.PolicyName,
+		"size":   volConfig.CreateOptions.Size,
+		"locked": !volConfig.Unlocked,
+		"mounts": a.MountCounter.Get(volConfig.String()),
+	}
+
+	if volConfig.Backends != nil {
+		status["backend"] = volConfig.Backends.Mount
+	}
+
+	if !volConfig.Unlocked {
+		holders := []string{}
+
+		um := &config.UseMount{}
+		if err := a.Client.GetUse(um, volConfig); err == nil {
+			holders = append(holders, um.Hostname)
+		} else if erd, ok := err.(*errored.Error); !ok || !erd.Contains(errors.NotExists) {
+			logging.WithContext(log, ctx).Warnf("Could not retrieve the mount lock of %q: %v", volConfig, err)
+		}
+
+		status["holders"] = holders
+	}
+
+	// the snapshot count is published with the usage of mounted volumes, as
+	// listing the snapshots on every call is too expensive.
+	vc, err := a.Client.GetVolumeCapacity(volConfig.String())
+	if err == nil {
+		if vc.Snapshots != nil {
+			status["snapshots"] = *vc.Snapshots
+		}
+	} else if erd, ok := err.(*errored.Error); !ok || !erd.Contains(errors.NotExists) {
+		logging.WithContext(log, ctx).Warnf("Could not retrieve the usage of %q: %v", volConfig, err)
+	}
+
+	return status
+}
+
+// localVolumes filters the volumes down to those whose mount backend is
+// available on this host.
+func (a *API) localVolumes(volumes []string) ([]string, error) {
+	available := map[string]bool{}
+	local := []string{}
+
+	for _, name := range volumes {
+		policy, volume, err := storage.SplitName(name)
+		if err != nil {
+			return nil, err
+		}
+
+		volConfig, err := a.Client.GetVolume(policy, volume)
+		if erd, ok := err.(*errored.Error); ok && erd.Contains(errors.NotExists) {
+			continue
+		} else if err != nil {
+			return nil, errors.GetVolume.Combine(err)
+		}
+
+		if volConfig.Backends == nil {
+			continue
+		}
+
+		mount := volConfig.Backends.Mount
+		if _, ok := available[mount]; !ok {
+			available[mount] = backend.MountAvailable(mount)
+		}
+
+		if available[mount] {
+			local = append(local, name)
+		}
+	}
+
+	return local, nil
+}
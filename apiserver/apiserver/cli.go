@@ -7,7 +7,10 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/contiv/volplugin/apiserver"
+	"github.com/contiv/volplugin/auth"
 	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/logging"
+	"github.com/contiv/volplugin/trace"
 
 	"github.com/codegangsta/cli"
 )
@@ -16,15 +19,39 @@ import (
 var version = ""
 
 func start(ctx *cli.Context) {
-	cfg, err := config.NewClient(ctx.String("prefix"), ctx.StringSlice("etcd"))
+	if err := logging.SetFormat(ctx.String("log-format")); err != nil {
+		logrus.Fatal(err)
+	}
+
+	cfg, err := config.NewStoreClient(ctx.String("prefix"), ctx.String("store"), ctx.StringSlice("etcd"))
 	if err != nil {
 		logrus.Fatal(err)
 	}
 
+	exporter, err := trace.NewExporter(ctx.String("trace-exporter"))
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	trace.SetExporter(exporter)
+
 	d := &apiserver.DaemonConfig{
 		Config:   cfg,
 		MountTTL: ctx.Int("ttl"),
 		Timeout:  time.Duration(ctx.Int("timeout")) * time.Minute,
+		Auth:     ctx.Bool("auth"),
+		TLSCert:  ctx.String("tls-cert"),
+		TLSKey:   ctx.String("tls-key"),
+		ClientCA: ctx.String("tls-client-ca"),
+		Version:  ctx.App.Version,
+
+		CSISocket:    ctx.String("csi-socket"),
+		CSIAPIServer: ctx.String("csi-apiserver"),
+		CSICredentials: &auth.Credentials{
+			Token:    ctx.String("csi-apiserver-token"),
+			CertFile: ctx.String("csi-apiserver-cert"),
+			KeyFile:  ctx.String("csi-apiserver-key"),
+			CAFile:   ctx.String("csi-apiserver-ca"),
+		},
 	}
 
 	d.Daemon(ctx.String("listen"))
@@ -52,6 +79,66 @@ func main() {
 			Usage: "URL for etcd",
 			Value: &cli.StringSlice{"http://localhost:2379"},
 		},
+		cli.StringFlag{
+			Name:   "store",
+			Usage:  "URL of the store: etcd://host:port,..., etcd3://host:port or consul://host:port. Defaults to etcd at --etcd",
+			EnvVar: "VOLPLUGIN_APISERVER_STORE",
+		},
+		cli.BoolFlag{
+			Name:   "auth",
+			Usage:  "require authenticated clients and enforce per-policy roles",
+			EnvVar: "VOLPLUGIN_APISERVER_AUTH",
+		},
+		cli.StringFlag{
+			Name:  "tls-cert",
+			Usage: "certificate to serve the API over TLS with",
+		},
+		cli.StringFlag{
+			Name:  "tls-key",
+			Usage: "key of the TLS certificate",
+		},
+		cli.StringFlag{
+			Name:  "tls-client-ca",
+			Usage: "CA to verify client certificates against",
+		},
+		cli.StringFlag{
+			Name:   "csi-socket",
+			Usage:  "Socket to serve the CSI identity and controller services on; empty to disable",
+			EnvVar: "VOLPLUGIN_APISERVER_CSI_SOCKET",
+		},
+		cli.StringFlag{
+			Name:  "csi-apiserver",
+			Usage: "address the CSI controller reaches this apiserver at",
+			Value: "127.0.0.1:9005",
+		},
+		cli.StringFlag{
+			Name:   "csi-apiserver-token",
+			Usage:  "bearer token the CSI controller presents to the apiserver",
+			EnvVar: "VOLPLUGIN_APISERVER_CSI_TOKEN",
+		},
+		cli.StringFlag{
+			Name:  "csi-apiserver-cert",
+			Usage: "client certificate the CSI controller presents to the apiserver; enables TLS",
+		},
+		cli.StringFlag{
+			Name:  "csi-apiserver-key",
+			Usage: "key of the CSI controller's client certificate",
+		},
+		cli.StringFlag{
+			Name:  "csi-apiserver-ca",
+			Usage: "CA to verify the apiserver against from the CSI controller; enables TLS",
+		},
+		cli.StringFlag{
+			Name:   "trace-exporter",
+			Usage:  "Where to export request traces: \"stdout\" or \"file:<path>\" for JSON; empty to disable",
+			EnvVar: "VOLPLUGIN_APISERVER_TRACE_EXPORTER",
+		},
+		cli.StringFlag{
+			Name:   "log-format",
+			Usage:  "Format of log lines: \"text\" or \"json\"",
+			Value:  "text",
+			EnvVar: "VOLPLUGIN_APISERVER_LOG_FORMAT",
+		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -0,0 +1,220 @@
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	. "testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/db/impl/etcd3/etcd3test"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/backend"
+	"github.com/gorilla/mux"
+)
+
+type apiserverSuite struct {
+	server   *etcd3test.Server
+	driver   *fakeDriver
+	crud     func() (storage.CRUDDriver, error)
+	snapshot func() (storage.SnapshotDriver, error)
+	d        *DaemonConfig
+}
+
+var _ = Suite(&apiserverSuite{})
+
+func TestAPIServer(t *T) { TestingT(t) }
+
+var testPolicy = &config.Policy{
+	Name:          "policy1",
+	Backends:      &config.BackendDrivers{CRUD: "ceph", Mount: "ceph", Snapshot: "ceph"},
+	DriverOptions: map[string]string{"pool": "rbd"},
+	CreateOptions: config.CreateOptions{Size: "10MB", FileSystem: "ext4"},
+}
+
+func (s *apiserverSuite) SetUpTest(c *C) {
+	s.server = etcd3test.NewServer()
+
+	cfg, err := config.NewStoreClient("/volplugin", "etcd3://"+strings.TrimPrefix(s.server.URL, "http://"), nil)
+	c.Assert(err, IsNil)
+
+	global := config.NewGlobalConfig()
+	c.Assert(cfg.PublishGlobal(global), IsNil)
+	c.Assert(cfg.PublishPolicy(testPolicy.Name, testPolicy), IsNil)
+
+	s.d = &DaemonConfig{Config: cfg, Global: global}
+
+	// the ceph drivers are replaced, as policies may only name real backends.
+	s.driver = &fakeDriver{images: map[string]uint64{}, snapshots: map[string][]string{}}
+	s.crud = backend.CRUDDrivers["ceph"]
+	s.snapshot = backend.SnapshotDrivers["ceph"]
+	backend.CRUDDrivers["ceph"] = func() (storage.CRUDDriver, error) { return s.driver, nil }
+	backend.SnapshotDrivers["ceph"] = func() (storage.SnapshotDriver, error) { return s.driver, nil }
+}
+
+func (s *apiserverSuite) TearDownTest(c *C) {
+	backend.CRUDDrivers["ceph"] = s.crud
+	backend.SnapshotDrivers["ceph"] = s.snapshot
+	s.server.Close()
+}
+
+// request calls the handler with the body marshalled to JSON.
+func request(handler http.HandlerFunc, method, path string, body interface{}) *httptest.ResponseRecorder {
+	content, _ := json.Marshal(body)
+	r, _ := http.NewRequest(method, path, bytes.NewReader(content))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// fakeDriver is a CRUD and snapshot driver keeping images in memory, named
+// like ceph's.
+type fakeDriver struct {
+	mutex     sync.Mutex
+	images    map[string]uint64
+	snapshots map[string][]string
+}
+
+func (f *fakeDriver) internalName(name string) string {
+	return strings.Replace(name, "/", ".", 1)
+}
+
+func (f *fakeDriver) key(do storage.DriverOptions) string {
+	return do.Volume.Params["pool"] + "/" + f.internalName(do.Volume.Name)
+}
+
+func (f *fakeDriver) has(pool, image string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	_, ok := f.images[pool+"/"+image]
+	return ok
+}
+
+func (f *fakeDriver) add(pool, image string) {
+	f.addSized(pool, image, 0)
+}
+
+func (f *fakeDriver) addSized(pool, image string, size uint64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.images[pool+"/"+image] = size
+}
+
+func (f *fakeDriver) Name() string                             { return "ceph" }
+func (f *fakeDriver) Validate(do *storage.DriverOptions) error { return nil }
+func (f *fakeDriver) Format(do storage.DriverOptions) error    { return nil }
+
+func (f *fakeDriver) Create(do storage.DriverOptions) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.images[f.key(do)]; ok {
+		return storage.ErrVolumeExist
+	}
+
+	f.images[f.key(do)] = do.Volume.Size
+	return nil
+}
+
+func (f *fakeDriver) Destroy(do storage.DriverOptions) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.images, f.key(do))
+	return nil
+}
+
+func (f *fakeDriver) List(lo storage.ListOptions) ([]storage.Volume, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	volumes := []storage.Volume{}
+	for key := range f.images {
+		parts := strings.SplitN(key, "/", 2)
+		if parts[0] == lo.Params["pool"] {
+			volumes = append(volumes, storage.Volume{Name: strings.Replace(parts[1], ".", "/", 1), Params: lo.Params})
+		}
+	}
+
+	return volumes, nil
+}
+
+func (f *fakeDriver) Exists(do storage.DriverOptions) (bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	_, ok := f.images[f.key(do)]
+	return ok, nil
+}
+
+func (f *fakeDriver) InternalName(name string) (string, error) {
+	return f.internalName(name), nil
+}
+
+func (f *fakeDriver) Rename(do storage.DriverOptions, image string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	from := do.Volume.Params["pool"] + "/" + image
+	f.images[f.key(do)] = f.images[from]
+	delete(f.images, from)
+	return nil
+}
+
+func (f *fakeDriver) Size(do storage.DriverOptions, image string) (uint64, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.images[do.Volume.Params["pool"]+"/"+image], nil
+}
+
+func (f *fakeDriver) CreateSnapshot(snap string, do storage.DriverOptions) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.snapshots[f.key(do)] = append(f.snapshots[f.key(do)], snap)
+	return nil
+}
+
+func (f *fakeDriver) RemoveSnapshot(snap string, do storage.DriverOptions) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	snaps := []string{}
+	for _, name := range f.snapshots[f.key(do)] {
+		if name != snap {
+			snaps = append(snaps, name)
+		}
+	}
+	f.snapshots[f.key(do)] = snaps
+	return nil
+}
+
+func (f *fakeDriver) ListSnapshots(do storage.DriverOptions) ([]string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.snapshots[f.key(do)], nil
+}
+
+func (f *fakeDriver) CopySnapshot(do storage.DriverOptions, snap, image string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.images[do.Volume.Params["pool"]+"/"+f.internalName(image)] = f.images[f.key(do)]
+	return nil
+}
+
+func (s *apiserverSuite) TestRouteVars(c *C) {
+	vars := map[string]string{}
+	handler := func(w http.ResponseWriter, r *http.Request) { vars = mux.Vars(r) }
+
+	r := mux.NewRouter()
+	r.HandleFunc("/volumes/{policy}/{volume}", logHandler("get", false, instrument("GET", "/volumes/{policy}/{volume}", handler)))
+
+	req, err := http.NewRequest("GET", "/volumes/policy1/foo", nil)
+	c.Assert(err, IsNil)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	// the route variables survive the request getting a new context.
+	c.Assert(vars, DeepEquals, map[string]string{"policy": "policy1", "volume": "foo"})
+}
@@ -0,0 +1,184 @@
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/auth"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/logging"
+	"github.com/gorilla/mux"
+)
+
+// permission is the role a route requires. If onPolicy is set the role must
+// be granted on the policy of the request, otherwise on all policies. An
+// empty role only requires the caller to be authenticated.
+type permission struct {
+	role     string
+	onPolicy bool
+}
+
+var (
+	authenticated = permission{}
+	consumer      = permission{role: config.RoleConsumer, onPolicy: true}
+	policyOwner   = permission{role: config.RolePolicyOwner, onPolicy: true}
+	admin         = permission{role: config.RoleAdmin}
+)
+
+// permissions is keyed by method and route path. Every route must have an
+// entry; addRoute refuses routes without one.
+var permissions = map[string]map[string]permission{
+	"POST": {
+		"/global":                           admin,
+		"/volumes/create":                   consumer,
+		"/volumes/copy":                     consumer,
+		"/volumes/import":                   policyOwner,
+		"/volumes/migrate":                  policyOwner,
+		"/volumes/request":                  consumer,
+		"/policies/{policy}":                policyOwner,
+		"/policy-usage/{policy}":            admin,
+		"/runtime/{policy}/{volume}":        policyOwner,
+		"/snapshots/take/{policy}/{volume}": consumer,
+	},
+	"DELETE": {
+		"/volumes/remove":             consumer,
+		"/volumes/removeforce":        policyOwner,
+		"/policies/{policy}":          policyOwner,
+		"/handoffs/{policy}/{volume}": policyOwner,
+	},
+	"GET": {
+		"/global":                              authenticated,
+		"/policy-archives/{policy}":            consumer,
+		"/policy-archives/{policy}/{revision}": consumer,
+		"/policy-usage/{policy}":               consumer,
+		"/policies":                            authenticated,
+		"/policies/{policy}":                   consumer,
+		"/uses/mounts/{policy}/{volume}":       consumer,
+		"/uses/snapshots/{policy}/{volume}":    consumer,
+		"/volumes":                             authenticated,
+		"/volumes/{policy}":                    consumer,
+		"/volumes/{policy}/{volume}":           consumer,
+		"/volumes/{policy}/{volume}/usage":     consumer,
+		"/runtime/{policy}/{volume}":           consumer,
+		"/snapshots/{policy}/{volume}":         consumer,
+		"/nodes":                               admin,
+		"/nodes/{node}":                        admin,
+		"/operations":                          authenticated,
+		"/handoffs/{policy}/{volume}":          consumer,
+		"/events":                              admin,
+		"/events/{policy}/{volume}":            consumer,
+		"/debug/bundle":                        admin,
+	},
+}
+
+// visibility returns whether the caller may see the items of a listing on a
+// policy: those it holds a role on. Routes listing items of all policies only
+// require authentication, so their handlers filter the items with it.
+func (d *DaemonConfig) visibility(r *http.Request) func(policy string) bool {
+	if !d.Auth {
+		return func(string) bool { return true }
+	}
+
+	id, err := d.authenticate(r)
+	return func(policy string) bool {
+		return err == nil && id.Allowed(policy, config.RoleConsumer)
+	}
+}
+
+// isAdmin is true if the caller is an admin, or authorization is disabled.
+func (d *DaemonConfig) isAdmin(r *http.Request) bool {
+	if !d.Auth {
+		return true
+	}
+
+	id, err := d.authenticate(r)
+	return err == nil && id.Allowed("", config.RoleAdmin)
+}
+
+// authenticate finds the identity of the request, by client certificate
+// first and bearer token second.
+func (d *DaemonConfig) authenticate(r *http.Request) (*config.Identity, error) {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		name := r.TLS.PeerCertificates[0].Subject.CommonName
+		id, err := d.Config.GetIdentity(name)
+		if err != nil {
+			return nil, errors.Unauthenticated.Combine(errored.Errorf("certificate %q", name)).Combine(err)
+		}
+		return id, nil
+	}
+
+	if token := auth.BearerToken(r); token != "" {
+		id, err := d.Config.IdentityByToken(token)
+		if err != nil {
+			return nil, errors.Unauthenticated.Combine(err)
+		}
+		return id, nil
+	}
+
+	return nil, errors.Unauthenticated.Combine(errored.New("no credentials presented"))
+}
+
+// requestPolicy returns the policy the request acts on: the route's policy
+// variable, or the policy in the volume request body. The body is restored
+// for the handler.
+func requestPolicy(r *http.Request) (string, error) {
+	if policy, ok := mux.Vars(r)["policy"]; ok {
+		return policy, nil
+	}
+
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "", errors.ReadBody.Combine(err)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(content))
+
+	req := config.VolumeRequest{}
+	if err := json.Unmarshal(content, &req); err != nil {
+		return "", errors.UnmarshalRequest.Combine(err)
+	}
+
+	return req.Policy, nil
+}
+
+// authorize wraps the handler of a route with the route's permission check.
+// If authorization is disabled, the handler is returned as is.
+func (d *DaemonConfig) authorize(perm permission, actionFunc func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	if !d.Auth {
+		return actionFunc
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := d.authenticate(r)
+		if err != nil {
+			logging.WithContext(log, r.Context()).Warnf("Refusing %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if perm.role != "" {
+			var policy string
+
+			if perm.onPolicy {
+				policy, err = requestPolicy(r)
+				if err != nil {
+					api.RESTHTTPError(w, err)
+					return
+				}
+			}
+
+			if !id.Allowed(policy, perm.role) {
+				err := errors.Unauthorized.Combine(errored.Errorf("%q requires role %q", id.Name, perm.role))
+				logging.WithContext(log, r.Context()).Warnf("Refusing %s %s: %v", r.Method, r.URL.Path, err)
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+
+		actionFunc(w, r)
+	}
+}
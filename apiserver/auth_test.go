@@ -0,0 +1,186 @@
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/config"
+	"github.com/gorilla/mux"
+)
+
+// routed sends the request through the apiserver's routes, with the token if
+// one is given.
+func routed(r *mux.Router, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	content, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewReader(content))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func (s *apiserverSuite) TestAuthorize(c *C) {
+	for _, id := range []*config.Identity{
+		{Name: "admin", TokenHash: config.HashToken("admin-token"), Grants: map[string]string{config.AllPolicies: config.RoleAdmin}},
+		{Name: "owner", TokenHash: config.HashToken("owner-token"), Grants: map[string]string{"policy1": config.RolePolicyOwner}},
+		{Name: "team", TokenHash: config.HashToken("team-token"), Grants: map[string]string{"policy1": config.RoleConsumer}},
+	} {
+		c.Assert(s.d.Config.PublishIdentity(id), IsNil)
+	}
+
+	s.d.Auth = true
+	s.d.Global.Debug = true
+	r, err := s.d.router()
+	c.Assert(err, IsNil)
+
+	// requests without a known token are not authenticated.
+	c.Assert(routed(r, "GET", "/policies", "", nil).Code, Equals, http.StatusUnauthorized)
+	c.Assert(routed(r, "GET", "/policies", "wrong-token", nil).Code, Equals, http.StatusUnauthorized)
+	c.Assert(routed(r, "GET", "/policies", "team-token", nil).Code, Equals, http.StatusOK)
+
+	// consumers are denied admin routes, including the debug handler.
+	for _, req := range [][]string{
+		{"POST", "/global"},
+		{"POST", "/policy-usage/policy1"},
+		{"GET", "/events"},
+		{"GET", "/debug/bundle"},
+		{"GET", "/unrouted"},
+	} {
+		w := routed(r, req[0], req[1], "team-token", nil)
+		c.Assert(w.Code, Equals, http.StatusForbidden, Commentf("%v: %s", req, w.Body))
+		c.Assert(routed(r, req[0], req[1], "", nil).Code, Equals, http.StatusUnauthorized, Commentf("%v", req))
+	}
+
+	c.Assert(routed(r, "GET", "/unrouted", "admin-token", nil).Code, Equals, http.StatusNotFound)
+
+	// consumers are denied policy-owner routes, and other policies.
+	remove := &config.VolumeRequest{Policy: "policy1", Name: "foo"}
+	c.Assert(routed(r, "DELETE", "/volumes/removeforce", "team-token", remove).Code, Equals, http.StatusForbidden)
+	c.Assert(routed(r, "DELETE", "/volumes/removeforce", "owner-token", remove).Code, Equals, http.StatusNotFound)
+	w := routed(r, "GET", "/policy-usage/policy1", "team-token", nil)
+	c.Assert(w.Code, Equals, http.StatusOK, Commentf("%s", w.Body))
+	c.Assert(routed(r, "GET", "/policy-usage/policy2", "team-token", nil).Code, Equals, http.StatusForbidden)
+	c.Assert(routed(r, "GET", "/policy-usage/policy2", "owner-token", nil).Code, Equals, http.StatusForbidden)
+
+	// a replaced token no longer authenticates.
+	c.Assert(s.d.Config.PublishIdentity(&config.Identity{Name: "team", TokenHash: config.HashToken("new-token"), Grants: map[string]string{"policy1": config.RoleConsumer}}), IsNil)
+	c.Assert(routed(r, "GET", "/policies", "team-token", nil).Code, Equals, http.StatusUnauthorized)
+	c.Assert(routed(r, "GET", "/policies", "new-token", nil).Code, Equals, http.StatusOK)
+
+	// tokens belong to one identity only.
+	c.Assert(s.d.Config.PublishIdentity(&config.Identity{Name: "other", TokenHash: config.HashToken("new-token")}), NotNil)
+
+	c.Assert(s.d.Config.RemoveIdentity("team"), IsNil)
+	c.Assert(routed(r, "GET", "/policies", "new-token", nil).Code, Equals, http.StatusUnauthorized)
+}
+
+func (s *apiserverSuite) TestListVisibility(c *C) {
+	policy2 := *testPolicy
+	policy2.Name = "policy2"
+	c.Assert(s.d.Config.PublishPolicy(policy2.Name, &policy2), IsNil)
+
+	for _, policy := range []string{"policy1", "policy2"} {
+		vc, err := s.d.Config.CreateVolume(&config.VolumeRequest{Policy: policy, Name: "foo"})
+		c.Assert(err, IsNil)
+		c.Assert(s.d.Config.PublishVolume(vc), IsNil)
+		c.Assert(s.d.Config.PublishOperation(newOperation(config.OperationCreate, vc, "host1")), IsNil)
+	}
+
+	for _, id := range []*config.Identity{
+		{Name: "admin", TokenHash: config.HashToken("admin-token"), Grants: map[string]string{config.AllPolicies: config.RoleAdmin}},
+		{Name: "team", TokenHash: config.HashToken("team-token"), Grants: map[string]string{"policy1": config.RoleConsumer}},
+	} {
+		c.Assert(s.d.Config.PublishIdentity(id), IsNil)
+	}
+
+	s.d.Auth = true
+	r, err := s.d.router()
+	c.Assert(err, IsNil)
+
+	list := func(path, token string, res interface{}) {
+		w := routed(r, "GET", path, token, nil)
+		c.Assert(w.Code, Equals, http.StatusOK, Commentf("%s %s: %s", path, token, w.Body))
+		c.Assert(json.Unmarshal(w.Body.Bytes(), res), IsNil)
+	}
+
+	// a consumer of policy1 only sees policy1's policies, volumes and
+	// operations.
+	policies := []config.Policy{}
+	list("/policies", "team-token", &policies)
+	c.Assert(policies, HasLen, 1)
+	c.Assert(policies[0].Name, Equals, "policy1")
+
+	volumes := []*config.Volume{}
+	list("/volumes", "team-token", &volumes)
+	c.Assert(volumes, HasLen, 1)
+	c.Assert(volumes[0].String(), Equals, "policy1/foo")
+
+	ops := []*config.Operation{}
+	list("/operations", "team-token", &ops)
+	c.Assert(ops, HasLen, 1)
+	c.Assert(ops[0].Volume.String(), Equals, "policy1/foo")
+
+	// nodes are not on a policy, so only admins see them.
+	c.Assert(routed(r, "GET", "/nodes", "team-token", nil).Code, Equals, http.StatusForbidden)
+	c.Assert(routed(r, "GET", "/nodes/host1", "team-token", nil).Code, Equals, http.StatusForbidden)
+	c.Assert(routed(r, "GET", "/nodes", "admin-token", nil).Code, Equals, http.StatusOK)
+
+	// admins see everything.
+	list("/policies", "admin-token", &policies)
+	c.Assert(policies, HasLen, 2)
+	list("/volumes", "admin-token", &volumes)
+	c.Assert(volumes, HasLen, 2)
+	list("/operations", "admin-token", &ops)
+	c.Assert(ops, HasLen, 2)
+}
+
+func (s *apiserverSuite) TestPolicyQuota(c *C) {
+	policy := *testPolicy
+	policy.Quota = &config.Quota{Volumes: 2, Size: "1GB"}
+	c.Assert(s.d.Config.PublishPolicy(policy.Name, &policy), IsNil)
+
+	for _, id := range []*config.Identity{
+		{Name: "admin", TokenHash: config.HashToken("admin-token"), Grants: map[string]string{config.AllPolicies: config.RoleAdmin}},
+		{Name: "owner", TokenHash: config.HashToken("owner-token"), Grants: map[string]string{"policy1": config.RolePolicyOwner}},
+	} {
+		c.Assert(s.d.Config.PublishIdentity(id), IsNil)
+	}
+
+	s.d.Auth = true
+	r, err := s.d.router()
+	c.Assert(err, IsNil)
+
+	quota := func() *config.Quota {
+		stored, err := s.d.Config.GetPolicy("policy1")
+		c.Assert(err, IsNil)
+		return stored.Quota
+	}
+
+	// owners may change their policy, but not raise or remove its quota.
+	changed := policy
+	changed.CreateOptions.Size = "20MB"
+	w := routed(r, "POST", "/policies/policy1", "owner-token", changed)
+	c.Assert(w.Code, Equals, http.StatusOK, Commentf("%s", w.Body))
+
+	raised := policy
+	raised.Quota = &config.Quota{Volumes: 100, Size: "1GB"}
+	c.Assert(routed(r, "POST", "/policies/policy1", "owner-token", raised).Code, Equals, http.StatusForbidden)
+	c.Assert(quota(), DeepEquals, policy.Quota)
+
+	removed := policy
+	removed.Quota = nil
+	c.Assert(routed(r, "POST", "/policies/policy1", "owner-token", removed).Code, Equals, http.StatusForbidden)
+	c.Assert(quota(), DeepEquals, policy.Quota)
+
+	// admins may.
+	w = routed(r, "POST", "/policies/policy1", "admin-token", raised)
+	c.Assert(w.Code, Equals, http.StatusOK, Commentf("%s", w.Body))
+	c.Assert(quota(), DeepEquals, raised.Quota)
+}
@@ -0,0 +1,81 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/backend"
+	"github.com/gorilla/mux"
+)
+
+// handleVolumeUsage reports the usage the volplugin mounting the volume
+// published. Volumes which are not mounted only have their backend usage,
+// if the backend can report it.
+func (d *DaemonConfig) handleVolumeUsage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	policy := vars["policy"]
+	volumeName := vars["volume"]
+
+	vol, err := d.Config.GetVolume(policy, volumeName)
+	if erd, ok := err.(*errored.Error); ok && erd.Contains(errors.NotExists) {
+		w.WriteHeader(404)
+		return
+	} else if err != nil {
+		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
+		return
+	}
+
+	vc, err := d.Config.GetVolumeCapacity(vol.String())
+	if erd, ok := err.(*errored.Error); ok && erd.Contains(errors.NotExists) {
+		vc, err = d.backendCapacity(vol)
+	}
+
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetVolumeUsage.Combine(err))
+		return
+	}
+
+	content, err := json.Marshal(vc)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
+func (d *DaemonConfig) backendCapacity(vol *config.Volume) (*config.VolumeCapacity, error) {
+	vc := &config.VolumeCapacity{Volume: vol.String(), Updated: time.Now()}
+
+	if vol.Backends == nil || vol.Backends.CRUD == "" {
+		return vc, nil
+	}
+
+	driver, err := backend.NewCRUDDriver(vol.Backends.CRUD)
+	if err != nil {
+		return nil, err
+	}
+
+	ud, ok := driver.(storage.UsageDriver)
+	if !ok {
+		return vc, nil
+	}
+
+	usage, err := ud.Usage(storage.DriverOptions{
+		Volume:  storage.Volume{Name: vol.String(), Params: vol.DriverOptions},
+		Timeout: d.Global.Timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	vc.ProvisionedBytes = usage.Provisioned
+	vc.ActualBytes = usage.Used
+	return vc, nil
+}
@@ -11,26 +11,50 @@ import (
 	"strings"
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/auth"
 	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/csi"
 	"github.com/contiv/volplugin/errors"
 	"github.com/contiv/volplugin/info"
 	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/logging"
+	"github.com/contiv/volplugin/metrics"
 	"github.com/contiv/volplugin/storage"
 	"github.com/contiv/volplugin/storage/backend"
 	"github.com/contiv/volplugin/storage/control"
+	"github.com/contiv/volplugin/trace"
 	"github.com/contiv/volplugin/watch"
 	"github.com/gorilla/mux"
+
+	"golang.org/x/net/context"
 )
 
+var log = logging.For("apiserver")
+
 // DaemonConfig is the configuration struct used by the apiserver to hold globals.
 type DaemonConfig struct {
 	Config   *config.Client
 	MountTTL int
 	Timeout  time.Duration
 	Global   *config.Global
+	Version  string
+
+	// Auth enables authentication and per-policy authorization of requests.
+	Auth bool
+	// TLSCert and TLSKey serve the API over TLS. Client certificates are
+	// verified against ClientCA when it is set.
+	TLSCert  string
+	TLSKey   string
+	ClientCA string
+
+	// CSISocket serves the CSI identity and controller services. The
+	// controller creates and removes volumes through the apiserver at
+	// CSIAPIServer, presenting CSICredentials.
+	CSISocket      string
+	CSIAPIServer   string
+	CSICredentials *auth.Credentials
 }
 
 // volume is the json response of a volume. Taken from
@@ -46,20 +70,18 @@ type routeHandlers map[string]func(http.ResponseWriter, *http.Request)
 func (d *DaemonConfig) Daemon(listen string) {
 	global, err := d.Config.GetGlobal()
 	if err != nil {
-		logrus.Errorf("Error fetching global configuration: %v", err)
-		logrus.Infof("No global configuration. Proceeding with defaults...")
+		log.Errorf("Error fetching global configuration: %v", err)
+		log.Infof("No global configuration. Proceeding with defaults...")
 		global = config.NewGlobalConfig()
 	}
 
 	d.Global = global
-	if d.Global.Debug {
-		logrus.SetLevel(logrus.DebugLevel)
-	}
+	logging.SetLevels(d.Global.Debug, d.Global.LogLevels)
 	errored.AlwaysDebug = d.Global.Debug
 	errored.AlwaysTrace = d.Global.Debug
 
 	go info.HandleDebugSignal()
-	go info.HandleDumpTarballSignal(d.Config)
+	go info.HandleDumpTarballSignal(d.Config, "apiserver", d.Version)
 
 	activity := make(chan *watch.Watch)
 	d.Config.WatchGlobal(activity)
@@ -69,42 +91,91 @@ func (d *DaemonConfig) Daemon(listen string) {
 
 			errored.AlwaysDebug = d.Global.Debug
 			errored.AlwaysTrace = d.Global.Debug
-			if d.Global.Debug {
-				logrus.SetLevel(logrus.DebugLevel)
-			}
+			logging.SetLevels(d.Global.Debug, d.Global.LogLevels)
 		}
 	}()
 
+	// usage is seeded before operations are rolled, as rolling them releases
+	// the usage of their volumes.
+	d.seedQuotas()
+	d.recoverOperations(true)
+	go d.pollOperations()
+
+	if d.CSISocket != "" {
+		go d.serveCSI()
+	}
+
+	r, err := d.router()
+	if err != nil {
+		log.Fatalf("Error starting apiserver: %v", err)
+	}
+
+	if d.TLSCert == "" {
+		if err := http.ListenAndServe(listen, r); err != nil {
+			log.Fatalf("Error starting apiserver: %v", err)
+		}
+		return
+	}
+
+	tlsConfig, err := auth.ServerTLSConfig(d.ClientCA)
+	if err != nil {
+		log.Fatalf("Error starting apiserver: %v", err)
+	}
+
+	server := &http.Server{Addr: listen, Handler: r, TLSConfig: tlsConfig}
+	if err := server.ListenAndServeTLS(d.TLSCert, d.TLSKey); err != nil {
+		log.Fatalf("Error starting apiserver: %v", err)
+	}
+}
+
+// serveCSI serves the CSI identity and controller services on the CSI socket.
+func (d *DaemonConfig) serveCSI() {
+	controller := csi.NewController(d.Config, d.CSIAPIServer)
+	controller.Credentials = d.CSICredentials
+
+	server := csi.NewServer(csi.NewIdentity(d.Version, true), controller, nil)
+	if err := server.ListenAndServe(d.CSISocket); err != nil {
+		log.Fatalf("Error serving CSI: %v", err)
+	}
+}
+
+// router routes the handlers of the apiserver.
+func (d *DaemonConfig) router() (*mux.Router, error) {
 	r := mux.NewRouter()
 
 	postRouter := map[string]func(http.ResponseWriter, *http.Request){
 		"/global":                           d.handleGlobalUpload,
 		"/volumes/create":                   d.handleCreate,
 		"/volumes/copy":                     d.handleCopy,
+		"/volumes/import":                   d.handleImport,
+		"/volumes/migrate":                  d.handleMigrate,
 		"/volumes/request":                  d.handleRequest,
 		"/policies/{policy}":                d.handlePolicyUpload,
+		"/policy-usage/{policy}":            d.handlePolicyUsageRecount,
 		"/runtime/{policy}/{volume}":        d.handleRuntimeUpload,
 		"/snapshots/take/{policy}/{volume}": d.handleSnapshotTake,
 	}
 
-	if err := addRoute(r, postRouter, "POST", d.Global.Debug); err != nil {
-		logrus.Fatalf("Error starting apiserver: %v", err)
+	if err := d.addRoute(r, postRouter, "POST"); err != nil {
+		return nil, err
 	}
 
 	deleteRouter := map[string]func(http.ResponseWriter, *http.Request){
-		"/volumes/remove":      d.handleRemove,
-		"/volumes/removeforce": d.handleRemoveForce,
-		"/policies/{policy}":   d.handlePolicyDelete,
+		"/volumes/remove":             d.handleRemove,
+		"/volumes/removeforce":        d.handleRemoveForce,
+		"/policies/{policy}":          d.handlePolicyDelete,
+		"/handoffs/{policy}/{volume}": d.handleHandoffCancel,
 	}
 
-	if err := addRoute(r, deleteRouter, "DELETE", d.Global.Debug); err != nil {
-		logrus.Fatalf("Error starting apiserver: %v", err)
+	if err := d.addRoute(r, deleteRouter, "DELETE"); err != nil {
+		return nil, err
 	}
 
 	getRouter := map[string]func(http.ResponseWriter, *http.Request){
 		"/global":                              d.handleGlobal,
 		"/policy-archives/{policy}":            d.handlePolicyListRevisions,
 		"/policy-archives/{policy}/{revision}": d.handlePolicyGetRevision,
+		"/policy-usage/{policy}":               d.handlePolicyUsage,
 		"/policies":                            d.handlePolicyList,
 		"/policies/{policy}":                   d.handlePolicy,
 		"/uses/mounts/{policy}/{volume}":       d.handleUsesMountsVolume,
@@ -112,41 +183,85 @@ func (d *DaemonConfig) Daemon(listen string) {
 		"/volumes":                             d.handleListAll,
 		"/volumes/{policy}":                    d.handleList,
 		"/volumes/{policy}/{volume}":           d.handleGet,
+		"/volumes/{policy}/{volume}/usage":     d.handleVolumeUsage,
 		"/runtime/{policy}/{volume}":           d.handleRuntime,
 		"/snapshots/{policy}/{volume}":         d.handleSnapshotList,
+		"/nodes":                               d.handleNodeList,
+		"/nodes/{node}":                        d.handleNode,
+		"/operations":                          d.handleOperationList,
+		"/handoffs/{policy}/{volume}":          d.handleHandoff,
+		"/events":                              d.handleEventList,
+		"/events/{policy}/{volume}":            d.handleEvents,
+		"/debug/bundle":                        d.handleDebugBundle,
 	}
 
-	if err := addRoute(r, getRouter, "GET", d.Global.Debug); err != nil {
-		logrus.Fatalf("Error starting apiserver: %v", err)
+	if err := d.addRoute(r, getRouter, "GET"); err != nil {
+		return nil, err
 	}
 
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+	r.HandleFunc("/healthz", d.handleHealthz).Methods("GET")
+	r.HandleFunc("/readyz", d.handleReadyz).Methods("GET")
+
+	// the debug handler dumps the body of any other request, so it is for
+	// admins only.
 	if d.Global.Debug {
-		r.HandleFunc("{action:.*}", d.handleDebug)
+		r.HandleFunc("/{action:.*}", d.authorize(admin, d.handleDebug))
 	}
 
-	if err := http.ListenAndServe(listen, r); err != nil {
-		logrus.Fatalf("Error starting apiserver: %v", err)
-	}
+	return r, nil
 }
 
-func addRoute(r *mux.Router, handlers routeHandlers, method string, debug bool) error {
+func (d *DaemonConfig) addRoute(r *mux.Router, handlers routeHandlers, method string) error {
 	for path, f := range handlers {
 		if strings.HasSuffix(path, "/") {
 			return fmt.Errorf("route path %v has trailing slash", path)
 		}
-		r.HandleFunc(path, logHandler(path, debug, f)).Methods(method)
+		perm, ok := permissions[method][path]
+		if !ok {
+			return fmt.Errorf("route %v %v has no permission", method, path)
+		}
+		f = instrument(method, path, d.authorize(perm, f))
+		r.HandleFunc(path, logHandler(path, d.Global.Debug, f)).Methods(method)
 		pathSlash := fmt.Sprintf("%v/", path)
-		r.HandleFunc(pathSlash, logHandler(pathSlash, debug, f)).Methods(method)
+		r.HandleFunc(pathSlash, logHandler(pathSlash, d.Global.Debug, f)).Methods(method)
 	}
 	return nil
 }
 
+// instrument records the latency of the route's requests, and traces them as
+// part of the caller's trace if it sent one.
+func instrument(method, path string, actionFunc func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer metrics.HTTPRequests.Since(time.Now(), method, path)
+
+		span, ctx := trace.Start(trace.Extract(r.Context(), r.Header), method+" "+path)
+		defer span.Finish(nil)
+
+		withContext(r, ctx)
+		actionFunc(w, r)
+	}
+}
+
+// withContext replaces the context of the request in place. mux keeps the
+// route variables by request, so they would be lost with a copy of it.
+func withContext(r *http.Request, ctx context.Context) {
+	*r = *r.WithContext(ctx)
+}
+
 func logHandler(name string, debug bool, actionFunc func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(logging.RequestIDHeader)
+		if id == "" {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(logging.RequestIDHeader, id)
+		withContext(r, logging.WithRequestID(r.Context(), id))
+
 		if debug {
 			buf := new(bytes.Buffer)
 			io.Copy(buf, r.Body)
-			logrus.Debugf("Dispatching %s with %v", name, strings.TrimSpace(string(buf.Bytes())))
+			logging.WithContext(log, r.Context()).Debugf("Dispatching %s with %v", name, strings.TrimSpace(string(buf.Bytes())))
 			var writer *io.PipeWriter
 			r.Body, writer = io.Pipe()
 			go func() {
@@ -177,6 +292,17 @@ func (d *DaemonConfig) handleGlobalUpload(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// webhook secrets are redacted when the global is read.
+	if err := global.KeepSecrets(d.Global); err != nil {
+		api.RESTHTTPError(w, err)
+		return
+	}
+
+	if err := global.Validate(); err != nil {
+		api.RESTHTTPError(w, err)
+		return
+	}
+
 	if err := d.Config.PublishGlobal(global); err != nil {
 		api.RESTHTTPError(w, errors.PublishGlobal.Combine(err))
 		return
@@ -199,12 +325,46 @@ func (d *DaemonConfig) handlePolicyUpload(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// the quota limits what the policy's owners may use, so only admins may
+	// change it.
+	if !d.isAdmin(r) {
+		var quota *config.Quota
+
+		current, err := d.Config.GetPolicy(policyName)
+		if err == nil {
+			quota = current.Quota
+		} else if erd, ok := err.(*errored.Error); !ok || !erd.Contains(errors.NotExists) {
+			api.RESTHTTPError(w, errors.GetPolicy.Combine(err))
+			return
+		}
+
+		if !sameQuota(quota, policy.Quota) {
+			err := errors.Unauthorized.Combine(errored.Errorf("Only admins may change the quota of policy %q", policyName))
+			logging.WithContext(log, r.Context()).Warnf("Refusing %s %s: %v", r.Method, r.URL.Path, err)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
 	if err := d.Config.PublishPolicy(policyName, policy); err != nil {
 		api.RESTHTTPError(w, errors.PublishPolicy.Combine(err))
 		return
 	}
 }
 
+// sameQuota is true if the quotas are equal. A missing quota is no quota.
+func sameQuota(a, b *config.Quota) bool {
+	if a == nil {
+		a = &config.Quota{}
+	}
+
+	if b == nil {
+		b = &config.Quota{}
+	}
+
+	return *a == *b
+}
+
 func (d *DaemonConfig) handlePolicyDelete(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	policy := vars["policy"]
@@ -255,7 +415,16 @@ func (d *DaemonConfig) handlePolicyList(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	content, err := json.Marshal(policies)
+	visible := d.visibility(r)
+
+	response := []config.Policy{}
+	for _, policy := range policies {
+		if visible(policy.Name) {
+			response = append(response, policy)
+		}
+	}
+
+	content, err := json.Marshal(response)
 	if err != nil {
 		api.RESTHTTPError(w, errors.ListPolicy.Combine(err))
 		return
@@ -315,6 +484,44 @@ func (d *DaemonConfig) handleUserEndpoints(ul config.UseLocker, w http.ResponseW
 	w.Write(content)
 }
 
+func (d *DaemonConfig) handleNodeList(w http.ResponseWriter, r *http.Request) {
+	nodes, err := d.Config.ListNodes()
+	if err != nil {
+		api.RESTHTTPError(w, errors.ListNode.Combine(err))
+		return
+	}
+
+	content, err := json.Marshal(nodes)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
+func (d *DaemonConfig) handleNode(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	hostname := vars["node"]
+
+	node, err := d.Config.GetNode(hostname)
+	if erd, ok := err.(*errored.Error); ok && erd.Contains(errors.NotExists) {
+		w.WriteHeader(404)
+		return
+	} else if err != nil {
+		api.RESTHTTPError(w, errors.GetNode.Combine(err))
+		return
+	}
+
+	content, err := json.Marshal(node)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
 func (d *DaemonConfig) handleRuntime(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	policy := vars["policy"]
@@ -467,6 +674,12 @@ func (d *DaemonConfig) handleCopy(w http.ResponseWriter, r *http.Request) {
 
 	newVolConfig.VolumeName = req.Options["target"]
 
+	policy, err := d.Config.GetPolicy(req.Policy)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetPolicy.Combine(err))
+		return
+	}
+
 	do := storage.DriverOptions{
 		Volume: storage.Volume{
 			Name:   volConfig.String(),
@@ -503,13 +716,41 @@ func (d *DaemonConfig) handleCopy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock([]config.UseLocker{newUC, newSnapUC, snapUC}, d.Global.Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		// the usage is reserved before the operation is journaled, so rolling
+		// the operation back may release it.
+		if err := d.reserveQuota(policy, newVolConfig); err != nil {
+			return err
+		}
+
+		op := newOperation(config.OperationCopy, newVolConfig, host)
+		op.Source = volConfig.String()
+		op.Snapshot = req.Options["snapshot"]
+
+		opStop, err := d.startOperation(r.Context(), op)
+		if err != nil {
+			d.releaseQuota(r.Context(), newVolConfig, 0)
+			return err
+		}
+		defer d.finishOperation(r.Context(), op, opStop)
+
 		if err := d.Config.PublishVolume(newVolConfig); err != nil {
+			d.releaseQuota(r.Context(), newVolConfig, 0)
 			return err
 		}
 
+		d.stepOperation(r.Context(), op, config.StepPublished)
+
 		if err := driver.CopySnapshot(do, req.Options["snapshot"], newVolConfig.String()); err != nil {
+			// the copy has no image, so its record goes with its usage.
+			if rerr := d.Config.RemoveVolume(newVolConfig.PolicyName, newVolConfig.VolumeName); rerr != nil {
+				logging.WithContext(log, r.Context()).Errorf("Could not remove record of failed copy %q: %v", newVolConfig, rerr)
+			} else {
+				d.releaseQuota(r.Context(), newVolConfig, 0)
+			}
 			return err
 		}
+
+		d.Config.RecordEvent(config.EventCreated, newVolConfig.String(), host, "copied from %v snapshot %q", volConfig, req.Options["snapshot"])
 		return nil
 	})
 
@@ -536,8 +777,151 @@ func (d *DaemonConfig) handleCopy(w http.ResponseWriter, r *http.Request) {
 	w.Write(content)
 }
 
+func (d *DaemonConfig) handleMigrate(w http.ResponseWriter, r *http.Request) {
+	req, err := unmarshalRequest(r)
+	if err != nil {
+		api.RESTHTTPError(w, errors.UnmarshalRequest.Combine(err))
+		return
+	}
+
+	to := req.Options["to"]
+	if to == "" {
+		api.RESTHTTPError(w, errors.Handoff.Combine(errored.New("Could not find to option in request")))
+		return
+	}
+
+	grace := config.DefaultHandoffGrace
+	if req.Options["grace"] != "" {
+		if grace, err = time.ParseDuration(req.Options["grace"]); err != nil {
+			api.RESTHTTPError(w, errors.Handoff.Combine(err))
+			return
+		}
+	}
+
+	volConfig, err := d.Config.GetVolume(req.Policy, req.Name)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetVolume.Combine(err))
+		return
+	}
+
+	if volConfig.Unlocked {
+		api.RESTHTTPError(w, errors.Handoff.Combine(errored.Errorf("Volume %q is unlocked and may already be mounted on any host", volConfig)))
+		return
+	}
+
+	node, err := d.Config.GetNode(to)
+	if err != nil {
+		api.RESTHTTPError(w, errors.Handoff.Combine(errored.Errorf("Host %q is not registered", to)).Combine(err))
+		return
+	}
+
+	if !node.Satisfies(volConfig.Constraints) {
+		api.RESTHTTPError(w, errors.Handoff.Combine(errors.PlacementConstraint).Combine(errored.New(to)))
+		return
+	}
+
+	h := &config.Handoff{
+		Volume:    volConfig.String(),
+		To:        to,
+		Grace:     grace,
+		Status:    config.HandoffPending,
+		Requested: time.Now(),
+	}
+
+	toUse := &config.UseMount{Volume: volConfig.String(), Reason: lock.ReasonMount, Hostname: to}
+
+	use := &config.UseMount{}
+	err = d.Config.GetUse(use, volConfig)
+	if erd, ok := err.(*errored.Error); ok && erd.Contains(errors.NotExists) {
+		// nobody holds the volume, so there is nothing to drain; reserve it now.
+		if err := d.Config.ReserveUse(toUse, toUse, grace); err != nil {
+			api.RESTHTTPError(w, errors.Handoff.Combine(err))
+			return
+		}
+
+		h.Status = config.HandoffComplete
+		if err := d.Config.UpdateHandoff(h, grace); err != nil {
+			api.RESTHTTPError(w, errors.PublishHandoff.Combine(err))
+			return
+		}
+	} else if err != nil {
+		api.RESTHTTPError(w, errors.GetMount.Combine(err))
+		return
+	} else {
+		if use.Reason != lock.ReasonMount {
+			api.RESTHTTPError(w, errors.Handoff.Combine(errors.LockFailed).Combine(errored.Errorf("Volume %q is locked for %q", volConfig, use.Reason)))
+			return
+		}
+
+		if use.Hostname == to {
+			api.RESTHTTPError(w, errors.Handoff.Combine(errored.Errorf("Volume %q is already held by %q", volConfig, to)))
+			return
+		}
+
+		// only a live volplugin can drain the volume; a request for a host which
+		// is gone would never be answered.
+		if _, err := d.Config.GetNode(use.Hostname); err != nil {
+			api.RESTHTTPError(w, errors.Handoff.Combine(errored.Errorf("Host %q holding volume %q is not registered", use.Hostname, volConfig)).Combine(err))
+			return
+		}
+
+		h.From = use.Hostname
+		if err := d.Config.PublishHandoff(h, h.TTL(d.Global.Timeout)); err != nil {
+			api.RESTHTTPError(w, errors.PublishHandoff.Combine(err))
+			return
+		}
+	}
+
+	content, err := json.Marshal(h)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
+// handleHandoffCancel removes the handoff record of a volume. A host draining
+// the volume stops, and allows mounts again, once it sees the record is gone.
+func (d *DaemonConfig) handleHandoffCancel(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	volume := strings.Join([]string{vars["policy"], vars["volume"]}, "/")
+
+	err := d.Config.RemoveHandoff(volume)
+	if erd, ok := err.(*errored.Error); ok && erd.Contains(errors.NotExists) {
+		w.WriteHeader(404)
+		return
+	} else if err != nil {
+		api.RESTHTTPError(w, errors.PublishHandoff.Combine(err))
+		return
+	}
+}
+
+func (d *DaemonConfig) handleHandoff(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	policy := vars["policy"]
+	volumeName := vars["volume"]
+
+	h, err := d.Config.GetHandoff(strings.Join([]string{policy, volumeName}, "/"))
+	if erd, ok := err.(*errored.Error); ok && erd.Contains(errors.NotExists) {
+		w.WriteHeader(404)
+		return
+	} else if err != nil {
+		api.RESTHTTPError(w, errors.GetHandoff.Combine(err))
+		return
+	}
+
+	content, err := json.Marshal(h)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
 func (d *DaemonConfig) handleGlobal(w http.ResponseWriter, r *http.Request) {
-	content, err := json.Marshal(d.Global.Published())
+	content, err := json.Marshal(d.Global.Published().Redacted())
 	if err != nil {
 		api.RESTHTTPError(w, errors.MarshalGlobal.Combine(err))
 		return
@@ -586,6 +970,8 @@ func (d *DaemonConfig) handleListAll(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	visible := d.visibility(r)
+
 	response := []*config.Volume{}
 	for _, vol := range vols {
 		parts := strings.SplitN(vol, "/", 2)
@@ -593,6 +979,11 @@ func (d *DaemonConfig) handleListAll(w http.ResponseWriter, r *http.Request) {
 			api.RESTHTTPError(w, errors.InvalidVolume.Combine(errored.New(vol)))
 			return
 		}
+
+		if !visible(parts[0]) {
+			continue
+		}
+
 		// FIXME make this take a single string and not a split one
 		volConfig, err := d.Config.GetVolume(parts[0], parts[1])
 		if err != nil {
@@ -655,42 +1046,68 @@ func (d *DaemonConfig) createRemoveLocks(vc *config.Volume) ([]config.UseLocker,
 	return []config.UseLocker{uc, snapUC}, nil
 }
 
-func (d *DaemonConfig) removeVolume(req *config.VolumeRequest, vc *config.Volume) error {
+func (d *DaemonConfig) removeVolume(ctx context.Context, req *config.VolumeRequest, vc *config.Volume) error {
 	if err := d.Config.RemoveVolume(req.Policy, req.Name); err != nil {
 		return errors.ClearVolume.Combine(errored.New(vc.String())).Combine(err)
 	}
 
+	d.releaseQuota(ctx, vc, 0)
+	d.recordEvent(config.EventRemoved, vc, "")
 	return nil
 }
 
-func (d *DaemonConfig) completeRemove(req *config.VolumeRequest, vc *config.Volume) error {
+func (d *DaemonConfig) completeRemove(ctx context.Context, req *config.VolumeRequest, vc *config.Volume) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return errors.GetHostname.Combine(err)
+	}
+
+	op := newOperation(config.OperationRemove, vc, hostname)
+	opStop, err := d.startOperation(ctx, op)
+	if err != nil {
+		return err
+	}
+	defer d.finishOperation(ctx, op, opStop)
+
+	logger := logging.WithContext(log, ctx)
+
+	snapshots := d.snapshotCount(ctx, vc)
 	if err := control.RemoveVolume(vc, d.Global.Timeout); err != nil && err != errors.NoActionTaken {
-		logrus.Warn(errors.RemoveImage.Combine(errored.New(vc.String())).Combine(err))
+		logger.Warn(errors.RemoveImage.Combine(errored.New(vc.String())).Combine(err))
+	} else if snapshots > 0 {
+		if err := d.Config.ReleasePolicyUsage(vc.PolicyName, config.PolicyUsage{Snapshots: snapshots}); err != nil {
+			logger.Warnf("Could not release snapshot quota of volume %q: %v", vc, err)
+		}
 	}
 
-	return d.removeVolume(req, vc)
+	d.stepOperation(ctx, op, config.StepDestroyed)
+
+	return d.removeVolume(ctx, req, vc)
 }
 
 // this cleans up uses when forcing the removal
-func (d *DaemonConfig) removeVolumeUse(lock config.UseLocker, vc *config.Volume) {
+func (d *DaemonConfig) removeVolumeUse(ctx context.Context, lock config.UseLocker, vc *config.Volume) {
 	// locks[0] is the usemount lock
 	if err := d.Config.RemoveUse(lock, true); err != nil {
-		logrus.Warn(errors.RemoveImage.Combine(errored.New(vc.String())).Combine(err))
+		logging.WithContext(log, ctx).Warn(errors.RemoveImage.Combine(errored.New(vc.String())).Combine(err))
+		return
 	}
+
+	d.recordEvent(config.EventLockStolen, vc, "%s lock removed by forced removal", lock.Type())
 }
 
-func (d *DaemonConfig) handleForceRemoveLock(req *config.VolumeRequest, vc *config.Volume, locks []config.UseLocker) error {
+func (d *DaemonConfig) handleForceRemoveLock(ctx context.Context, req *config.VolumeRequest, vc *config.Volume, locks []config.UseLocker) error {
 	exists, err := control.ExistsVolume(vc, d.Global.Timeout)
 	if err != nil && err != errors.NoActionTaken {
 		return errors.RemoveVolume.Combine(errored.New(vc.String())).Combine(err)
 	}
 
 	if err == errors.NoActionTaken {
-		if err := d.completeRemove(req, vc); err != nil {
+		if err := d.completeRemove(ctx, req, vc); err != nil {
 			return err
 		}
 
-		d.removeVolumeUse(locks[0], vc)
+		d.removeVolumeUse(ctx, locks[0], vc)
 	}
 
 	if err != nil {
@@ -698,16 +1115,16 @@ func (d *DaemonConfig) handleForceRemoveLock(req *config.VolumeRequest, vc *conf
 	}
 
 	if !exists {
-		d.removeVolume(req, vc)
+		d.removeVolume(ctx, req, vc)
 		return errors.RemoveVolume.Combine(errored.New(vc.String())).Combine(errors.NotExists)
 	}
 
-	err = d.completeRemove(req, vc)
+	err = d.completeRemove(ctx, req, vc)
 	if err != nil {
 		return errors.RemoveVolume.Combine(errored.New(vc.String())).Combine(errors.NotExists)
 	}
 
-	d.removeVolumeUse(locks[0], vc)
+	d.removeVolumeUse(ctx, locks[0], vc)
 	return nil
 }
 
@@ -741,29 +1158,37 @@ func (d *DaemonConfig) handleRemove(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx := api.Detach(r.Context())
+
 	if req.Options["force"] == "true" {
-		if err := d.handleForceRemoveLock(req, vc, locks); err != nil {
+		if err := d.handleForceRemoveLock(ctx, req, vc, locks); err != nil {
 			api.RESTHTTPError(w, err)
 			return
 		}
 	}
 
-	err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock(locks, timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+	err = lock.NewDriver(d.Config.WithContext(ctx)).ExecuteWithMultiUseLock(locks, timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		// record-only removals leave the image in place; fsck reports it as an
+		// orphan, which can be adopted again.
+		if req.Options["record-only"] == "true" {
+			return d.removeVolume(ctx, req, vc)
+		}
+
 		exists, err := control.ExistsVolume(vc, timeout)
 		if err != nil && err != errors.NoActionTaken {
 			return err
 		}
 
 		if err == errors.NoActionTaken {
-			return d.completeRemove(req, vc)
+			return d.completeRemove(ctx, req, vc)
 		}
 
 		if !exists {
-			d.removeVolume(req, vc)
+			d.removeVolume(ctx, req, vc)
 			return errors.NotExists
 		}
 
-		return d.completeRemove(req, vc)
+		return d.completeRemove(ctx, req, vc)
 	})
 
 	if err == errors.NotExists {
@@ -784,6 +1209,8 @@ func (d *DaemonConfig) handleRemoveForce(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	vc, getErr := d.Config.GetVolume(req.Policy, req.Name)
+
 	err = d.Config.RemoveVolume(req.Policy, req.Name)
 	if err == errors.NotExists {
 		w.WriteHeader(404)
@@ -794,6 +1221,11 @@ func (d *DaemonConfig) handleRemoveForce(w http.ResponseWriter, r *http.Request)
 		api.RESTHTTPError(w, errors.RemoveVolume.Combine(errored.Errorf("%v/%v", req.Policy, req.Name)).Combine(err))
 		return
 	}
+
+	if getErr == nil {
+		d.releaseQuota(r.Context(), vc, 0)
+		d.recordEvent(config.EventRemoved, vc, "record removed; image left in place")
+	}
 }
 
 func (d *DaemonConfig) handleRequest(w http.ResponseWriter, r *http.Request) {
@@ -868,10 +1300,10 @@ func (d *DaemonConfig) handleCreate(w http.ResponseWriter, r *http.Request) {
 		Reason: lock.ReasonCreate,
 	}
 
-	err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock(
+	err = lock.NewDriver(d.Config.WithContext(api.Detach(r.Context()))).ExecuteWithMultiUseLock(
 		[]config.UseLocker{uc, snapUC},
 		d.Global.Timeout,
-		d.createVolume(w, req, policy),
+		d.createVolume(w, req, policy, hostname),
 	)
 	if err != nil && err != errors.Exists {
 		api.RESTHTTPError(w, errors.CreateVolume.Combine(err))
@@ -879,16 +1311,44 @@ func (d *DaemonConfig) handleCreate(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (d *DaemonConfig) createVolume(w http.ResponseWriter, req *config.VolumeRequest, policy *config.Policy) func(ld *lock.Driver, ul []config.UseLocker) error {
+func (d *DaemonConfig) createVolume(w http.ResponseWriter, req *config.VolumeRequest, policy *config.Policy, hostname string) func(ld *lock.Driver, ul []config.UseLocker) error {
 	return func(ld *lock.Driver, ucs []config.UseLocker) error {
 		volConfig, err := d.Config.CreateVolume(req)
 		if err != nil {
 			return err
 		}
 
-		logrus.Debugf("Volume Create: %#v", *volConfig)
+		logger := logging.WithContext(log, ld.Config.Context())
+		logger.Debugf("Volume Create: %#v", *volConfig)
 
-		do, err := control.CreateVolume(policy, volConfig, d.Global.Timeout)
+		// creating a volume which already exists does not count against the
+		// quota again.
+		published := true
+		if _, err := d.Config.GetVolume(volConfig.PolicyName, volConfig.VolumeName); err != nil {
+			if er, ok := err.(*errored.Error); !ok || !er.Contains(errors.NotExists) {
+				return errors.GetVolume.Combine(err)
+			}
+
+			if err := d.reserveQuota(policy, volConfig); err != nil {
+				return err
+			}
+
+			published = false
+			defer func() {
+				if !published {
+					d.releaseQuota(ld.Config.Context(), volConfig, 0)
+				}
+			}()
+		}
+
+		op := newOperation(config.OperationCreate, volConfig, hostname)
+		opStop, err := d.startOperation(ld.Config.Context(), op)
+		if err != nil {
+			return err
+		}
+		defer d.finishOperation(ld.Config.Context(), op, opStop)
+
+		do, err := control.CreateVolume(ld.Config.Context(), policy, volConfig, d.Global.Timeout)
 		if err == errors.NoActionTaken {
 			goto publish
 		}
@@ -897,13 +1357,17 @@ func (d *DaemonConfig) createVolume(w http.ResponseWriter, req *config.VolumeReq
 			return errors.CreateVolume.Combine(err)
 		}
 
+		d.stepOperation(ld.Config.Context(), op, config.StepCreated)
+
 		if err := control.FormatVolume(volConfig, do); err != nil {
 			if err := control.RemoveVolume(volConfig, d.Global.Timeout); err != nil {
-				logrus.Errorf("Error during cleanup of failed format: %v", err)
+				logger.Errorf("Error during cleanup of failed format: %v", err)
 			}
 			return errors.FormatVolume.Combine(err)
 		}
 
+		d.stepOperation(ld.Config.Context(), op, config.StepFormatted)
+
 	publish:
 		if err := ld.Config.PublishVolume(volConfig); err != nil && err != errors.Exists {
 			// FIXME this shouldn't leak down to the client.
@@ -912,6 +1376,9 @@ func (d *DaemonConfig) createVolume(w http.ResponseWriter, req *config.VolumeReq
 			}
 			return err
 		}
+		published = true
+
+		d.Config.RecordEvent(config.EventCreated, volConfig.String(), hostname, "")
 
 		content, err := json.Marshal(volConfig)
 		if err != nil {
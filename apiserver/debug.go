@@ -0,0 +1,122 @@
+package apiserver
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/info"
+	"github.com/contiv/volplugin/logging"
+)
+
+// defaultDebugWait is how long the apiserver waits for the volplugins to
+// answer a debug bundle request, unless the request gives ?wait=.
+const defaultDebugWait = 10 * time.Second
+
+// handleDebugBundle responds with a debug bundle: the etcd namespace, the
+// apiserver's own debug files, and the debug report of each volplugin which
+// answered in time. Secrets are redacted throughout, and the logs of the
+// daemons are only included with ?logs=true.
+func (d *DaemonConfig) handleDebugBundle(w http.ResponseWriter, r *http.Request) {
+	logs := r.URL.Query().Get("logs") == "true"
+
+	wait := defaultDebugWait
+	if param := r.URL.Query().Get("wait"); param != "" {
+		var err error
+		if wait, err = time.ParseDuration(param); err != nil {
+			api.RESTHTTPError(w, errors.DebugReport.Combine(err))
+			return
+		}
+	}
+
+	nodes, err := d.Config.ListNodes()
+	if err != nil {
+		api.RESTHTTPError(w, errors.ListNode.Combine(err))
+		return
+	}
+
+	name := info.BundleName("volplugin")
+	buf := new(bytes.Buffer)
+	bundle := info.NewBundle(buf, name)
+
+	if err := bundle.AddEtcd(d.Config); err != nil {
+		api.RESTHTTPError(w, errors.DebugReport.Combine(err))
+		return
+	}
+
+	if err := bundle.AddFiles("apiserver", info.Collect("apiserver", d.Version, logs)); err != nil {
+		api.RESTHTTPError(w, errors.DebugReport.Combine(err))
+		return
+	}
+
+	reports, err := d.collectDebugReports(len(nodes), wait, logs)
+	if err != nil {
+		api.RESTHTTPError(w, err)
+		return
+	}
+
+	reported := map[string]bool{}
+	for _, report := range reports {
+		reported[report.Hostname] = true
+		if err := bundle.AddFiles(path.Join("volplugin", report.Hostname), report.Files); err != nil {
+			api.RESTHTTPError(w, errors.DebugReport.Combine(err))
+			return
+		}
+	}
+
+	missing := []string{}
+	for _, node := range nodes {
+		if !reported[node.Hostname] {
+			missing = append(missing, node.Hostname)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		logging.WithContext(log, r.Context()).Warnf("Debug bundle %s is missing the reports of %s", name, strings.Join(missing, ", "))
+		if err := bundle.Add("missing-reports.txt", []byte(strings.Join(missing, "\n")+"\n")); err != nil {
+			api.RESTHTTPError(w, errors.DebugReport.Combine(err))
+			return
+		}
+	}
+
+	if err := bundle.Close(); err != nil {
+		api.RESTHTTPError(w, errors.DebugReport.Combine(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".tar.gz"))
+	w.Write(buf.Bytes())
+}
+
+// collectDebugReports requests the volplugins' debug reports and waits until
+// the expected number have been published, or the wait is over.
+func (d *DaemonConfig) collectDebugReports(expected int, wait time.Duration, logs bool) ([]*config.DebugReport, error) {
+	id, err := d.Config.RequestDebugReports(logs)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(wait)
+
+	for {
+		reports, err := d.Config.ListDebugReports(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(reports) >= expected || time.Now().After(deadline) {
+			return reports, nil
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+}
@@ -0,0 +1,99 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/logging"
+	"github.com/gorilla/mux"
+
+	"golang.org/x/net/context"
+)
+
+// recordEvent records an event for the volume which happened on this host.
+func (d *DaemonConfig) recordEvent(typ string, vc *config.Volume, format string, args ...interface{}) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Warnf("Could not record %s event for volume %q: %v", typ, vc, err)
+		return
+	}
+
+	d.Config.RecordEvent(typ, vc.String(), hostname, format, args...)
+}
+
+func (d *DaemonConfig) handleEventList(w http.ResponseWriter, r *http.Request) {
+	d.streamEvents(w, r, "")
+}
+
+func (d *DaemonConfig) handleEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	d.streamEvents(w, r, strings.Join([]string{vars["policy"], vars["volume"]}, "/"))
+}
+
+// streamEvents writes the events of the volume (or of all volumes, if volume
+// is empty) as newline-delimited JSON. With ?follow=true the response stays
+// open and new events are written as they are published, until the client
+// goes away.
+func (d *DaemonConfig) streamEvents(w http.ResponseWriter, r *http.Request, volume string) {
+	events, index, err := d.Config.ListEvents(volume)
+	if err != nil {
+		api.RESTHTTPError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			return
+		}
+	}
+
+	if r.URL.Query().Get("follow") != "true" {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return
+	}
+	flusher.Flush()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if cn, ok := w.(http.CloseNotifier); ok {
+		closed := cn.CloseNotify()
+		go func() {
+			select {
+			case <-closed:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	followed := make(chan *config.Event)
+	errChan := make(chan error, 1)
+	go func() { errChan <- d.Config.WatchEvents(ctx, index, volume, followed) }()
+
+	for {
+		select {
+		case ev := <-followed:
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+			flusher.Flush()
+		case err := <-errChan:
+			if err != nil {
+				logging.WithContext(log, r.Context()).Warnf("Could not follow events: %v", err)
+			}
+			return
+		}
+	}
+}
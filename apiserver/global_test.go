@@ -0,0 +1,49 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/config"
+)
+
+func (s *apiserverSuite) TestGlobalSecrets(c *C) {
+	global := config.NewGlobalConfig()
+	global.Webhooks = []*config.Webhook{
+		{URL: "https://example.com/signed", Secret: "s3cret"},
+		{URL: "https://example.com/unsigned"},
+	}
+
+	w := request(s.d.handleGlobalUpload, "POST", "/global", global)
+	c.Assert(w.Code, Equals, http.StatusOK, Commentf("%s", w.Body))
+
+	var err error
+	s.d.Global, err = s.d.Config.GetGlobal()
+	c.Assert(err, IsNil)
+
+	w = request(s.d.handleGlobal, "GET", "/global", nil)
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.String(), Not(Matches), `.*s3cret.*`)
+
+	read := config.NewGlobalConfig()
+	c.Assert(json.Unmarshal(w.Body.Bytes(), read), IsNil)
+	c.Assert(read.Webhooks[0].Secret, Equals, config.RedactedSecret)
+	c.Assert(read.Webhooks[1].Secret, Equals, "")
+	c.Assert(s.d.Global.Webhooks[0].Secret, Equals, "s3cret")
+
+	// uploading the global as it was read keeps the secret.
+	w = request(s.d.handleGlobalUpload, "POST", "/global", read)
+	c.Assert(w.Code, Equals, http.StatusOK, Commentf("%s", w.Body))
+
+	stored, err := s.d.Config.GetGlobal()
+	c.Assert(err, IsNil)
+	c.Assert(stored.Webhooks[0].Secret, Equals, "s3cret")
+	c.Assert(stored.Webhooks[1].Secret, Equals, "")
+
+	// a redacted secret for a new receiver has nothing to keep.
+	read.Webhooks = append(read.Webhooks, &config.Webhook{URL: "https://example.com/new", Secret: config.RedactedSecret})
+	w = request(s.d.handleGlobalUpload, "POST", "/global", read)
+	c.Assert(w.Code, Equals, http.StatusInternalServerError)
+}
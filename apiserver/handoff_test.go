@@ -0,0 +1,44 @@
+package apiserver
+
+import (
+	"net/http"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/lock"
+)
+
+func (s *apiserverSuite) TestMigrate(c *C) {
+	vc := s.publish(c, "foo")
+	c.Assert(s.d.Config.PublishUse(&config.UseMount{Volume: vc.String(), Reason: lock.ReasonMount, Hostname: "host1"}), IsNil)
+	c.Assert(s.d.Config.PublishNode(&config.Node{Hostname: "host2"}, time.Minute), IsNil)
+
+	r, err := s.d.router()
+	c.Assert(err, IsNil)
+
+	migrate := &config.VolumeRequest{Policy: "policy1", Name: "foo", Options: map[string]string{"to": "host2"}}
+
+	// nothing would drain the volume on a host which is gone.
+	c.Assert(routed(r, "POST", "/volumes/migrate", "", migrate).Code, Not(Equals), http.StatusOK)
+	_, err = s.d.Config.GetHandoff(vc.String())
+	c.Assert(err, NotNil)
+
+	c.Assert(s.d.Config.PublishNode(&config.Node{Hostname: "host1"}, time.Minute), IsNil)
+	w := routed(r, "POST", "/volumes/migrate", "", migrate)
+	c.Assert(w.Code, Equals, http.StatusOK, Commentf("%s", w.Body))
+
+	h, err := s.d.Config.GetHandoff(vc.String())
+	c.Assert(err, IsNil)
+	c.Assert(h.Status, Equals, config.HandoffPending)
+	c.Assert(h.From, Equals, "host1")
+
+	c.Assert(routed(r, "POST", "/volumes/migrate", "", migrate).Code, Not(Equals), http.StatusOK)
+
+	// a cancelled handoff may be requested again.
+	c.Assert(routed(r, "DELETE", "/handoffs/policy1/foo", "", nil).Code, Equals, http.StatusOK)
+	c.Assert(routed(r, "DELETE", "/handoffs/policy1/foo", "", nil).Code, Equals, http.StatusNotFound)
+	c.Assert(routed(r, "GET", "/handoffs/policy1/foo", "", nil).Code, Equals, http.StatusNotFound)
+	c.Assert(routed(r, "POST", "/volumes/migrate", "", migrate).Code, Equals, http.StatusOK)
+}
@@ -0,0 +1,50 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/logging"
+)
+
+// handleHealthz reports that the apiserver is running.
+func (d *DaemonConfig) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+// handleReadyz reports whether the apiserver can serve requests: etcd must be
+// reachable and the global configuration must load. Whether volsupervisor is
+// running, and on which host, is reported but does not make the apiserver
+// unready. It responds 503 if the apiserver is not ready.
+func (d *DaemonConfig) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		logging.WithContext(log, r.Context()).Warnf("Could not retrieve hostname: %v", err)
+	}
+
+	health := config.NewHealth(hostname)
+	health.Add("etcd", d.Config.CheckEtcd())
+	health.Add("global", d.Config.CheckGlobal())
+
+	holder, err := d.Config.VolsupervisorHolder()
+	check := health.Add("volsupervisor", err)
+	check.Optional = true
+	if err == nil {
+		check.Message = "lock held by " + holder
+	}
+
+	content, err := json.Marshal(health)
+	if err != nil {
+		api.RESTHTTPError(w, err)
+		return
+	}
+
+	if !health.Healthy() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	w.Write(content)
+}
@@ -0,0 +1,209 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/logging"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/backend"
+
+	"golang.org/x/net/context"
+)
+
+// handleImport adopts an existing image as a volume. The image is given as
+// pool/name in the "image" option; if it is not already named after the
+// volume, the "rename" option must be set to rename it. The image is neither
+// created nor formatted, and the volume is recorded, and counted against the
+// policy's quota, with the image's size.
+func (d *DaemonConfig) handleImport(w http.ResponseWriter, r *http.Request) {
+	req, err := unmarshalRequest(r)
+	if err != nil {
+		api.RESTHTTPError(w, errors.UnmarshalRequest.Combine(err))
+		return
+	}
+
+	if req.Options == nil {
+		req.Options = map[string]string{}
+	}
+
+	image := req.Options["image"]
+	rename := req.Options["rename"] == "true"
+	delete(req.Options, "image")
+	delete(req.Options, "rename")
+
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.Contains(parts[1], "/") {
+		api.RESTHTTPError(w, errors.ImportVolume.Combine(errored.Errorf("Invalid image %q, must be in the form of pool/name", image)))
+		return
+	}
+
+	pool, imageName := parts[0], parts[1]
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetHostname.Combine(err))
+		return
+	}
+
+	policy, err := d.Config.GetPolicy(req.Policy)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetPolicy.Combine(err))
+		return
+	}
+
+	volConfig, err := d.Config.CreateVolume(req)
+	if err != nil {
+		api.RESTHTTPError(w, errors.ImportVolume.Combine(err))
+		return
+	}
+
+	if volConfig.Backends == nil || volConfig.Backends.CRUD == "" {
+		api.RESTHTTPError(w, errors.ImportVolume.Combine(errored.Errorf("Policy %q has no CRUD backend to import from", req.Policy)))
+		return
+	}
+
+	driverOpts := map[string]string{}
+	for key, value := range volConfig.DriverOptions {
+		driverOpts[key] = value
+	}
+
+	driverOpts["pool"] = pool
+	volConfig.DriverOptions = driverOpts
+
+	locks := []config.UseLocker{
+		&config.UseMount{Volume: volConfig.String(), Reason: lock.ReasonImport, Hostname: hostname},
+		&config.UseSnapshot{Volume: volConfig.String(), Reason: lock.ReasonImport},
+	}
+
+	err = lock.NewDriver(d.Config).ExecuteWithMultiUseLock(locks, d.Global.Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		if _, err := d.Config.GetVolume(volConfig.PolicyName, volConfig.VolumeName); err == nil {
+			return errors.Exists.Combine(errored.New(volConfig.String()))
+		}
+
+		size, err := d.imageSize(r.Context(), volConfig, imageName)
+		if err != nil {
+			return err
+		}
+
+		volConfig.CreateOptions.Size = fmt.Sprintf("%dMB", size)
+
+		if err := d.reserveQuota(policy, volConfig); err != nil {
+			return err
+		}
+
+		if err := d.importImage(r.Context(), volConfig, imageName, rename); err != nil {
+			d.releaseQuota(r.Context(), volConfig, 0)
+			return err
+		}
+
+		// if the record cannot be published after a rename, the image is left
+		// under the volume's name; fsck reports it as an orphan to adopt.
+		if err := d.Config.PublishVolume(volConfig); err != nil {
+			d.releaseQuota(r.Context(), volConfig, 0)
+			return errors.PublishVolume.Combine(err)
+		}
+
+		d.Config.RecordEvent(config.EventCreated, volConfig.String(), hostname, "imported from image %q", imageName)
+		return nil
+	})
+
+	if err != nil {
+		api.RESTHTTPError(w, errors.ImportVolume.Combine(err))
+		return
+	}
+
+	content, err := json.Marshal(volConfig)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
+// importDriver yields the volume's CRUD driver, which must be able to rename
+// images, and the options addressing the image in it.
+func (d *DaemonConfig) importDriver(ctx context.Context, volConfig *config.Volume, image string) (storage.CRUDDriver, storage.RenamingDriver, storage.DriverOptions, error) {
+	do := storage.DriverOptions{
+		Volume:  storage.Volume{Name: image, Params: volConfig.DriverOptions},
+		Timeout: d.Global.Timeout,
+		Context: ctx,
+	}
+
+	driver, err := backend.NewCRUDDriver(volConfig.Backends.CRUD)
+	if err != nil {
+		return nil, nil, do, err
+	}
+
+	renamer, ok := driver.(storage.RenamingDriver)
+	if !ok {
+		return nil, nil, do, errored.Errorf("Backend %q does not support importing images", volConfig.Backends.CRUD)
+	}
+
+	return driver, renamer, do, nil
+}
+
+// imageSize validates the image exists and yields its size.
+func (d *DaemonConfig) imageSize(ctx context.Context, volConfig *config.Volume, image string) (uint64, error) {
+	driver, renamer, do, err := d.importDriver(ctx, volConfig, image)
+	if err != nil {
+		return 0, err
+	}
+
+	exists, err := driver.Exists(do)
+	if err != nil {
+		return 0, err
+	}
+
+	if !exists {
+		return 0, errors.NotExists.Combine(errored.Errorf("Image %q in pool %q", image, volConfig.DriverOptions["pool"]))
+	}
+
+	return renamer.Size(do, image)
+}
+
+// importImage renames the image to the image name of the volume, if required
+// and requested.
+func (d *DaemonConfig) importImage(ctx context.Context, volConfig *config.Volume, image string, rename bool) error {
+	driver, renamer, do, err := d.importDriver(ctx, volConfig, image)
+	if err != nil {
+		return err
+	}
+
+	intName, err := renamer.InternalName(volConfig.String())
+	if err != nil {
+		return err
+	}
+
+	if image == intName {
+		return nil
+	}
+
+	if !rename {
+		return errored.Errorf("Image %q must be renamed to %q to be managed as volume %q; use the rename option", image, intName, volConfig)
+	}
+
+	do.Volume.Name = volConfig.String()
+
+	exists, err := driver.Exists(do)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return errors.Exists.Combine(errored.Errorf("Image %q in pool %q", intName, volConfig.DriverOptions["pool"]))
+	}
+
+	logging.WithContext(log, ctx).Infof("Renaming image %q to %q for volume %q", image, intName, volConfig)
+
+	return renamer.Rename(do, image)
+}
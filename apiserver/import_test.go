@@ -0,0 +1,96 @@
+package apiserver
+
+import (
+	"net/http"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/config"
+)
+
+func importRequest(name, image string, rename bool) *config.VolumeRequest {
+	req := &config.VolumeRequest{Policy: "policy1", Name: name, Options: map[string]string{"image": image}}
+	if rename {
+		req.Options["rename"] = "true"
+	}
+
+	return req
+}
+
+func (s *apiserverSuite) TestImport(c *C) {
+	s.driver.addSized("rbd", "policy1.adopted", 2048)
+
+	w := request(s.d.handleImport, "POST", "/volumes/import", importRequest("adopted", "rbd/policy1.adopted", false))
+	c.Assert(w.Code, Equals, http.StatusOK, Commentf("%s", w.Body))
+
+	vol, err := s.d.Config.GetVolume("policy1", "adopted")
+	c.Assert(err, IsNil)
+	c.Assert(vol.DriverOptions["pool"], Equals, "rbd")
+
+	// the image's size is recorded and counted, not the policy's default.
+	c.Assert(vol.CreateOptions.Size, Equals, "2048MB")
+	c.Assert(s.usage(c), DeepEquals, config.PolicyUsage{Volumes: 1, Size: 2048})
+}
+
+func (s *apiserverSuite) TestImportQuota(c *C) {
+	policy := *testPolicy
+	policy.Quota = &config.Quota{Size: "1GB"}
+	c.Assert(s.d.Config.PublishPolicy(policy.Name, &policy), IsNil)
+
+	s.driver.addSized("rbd", "legacy", 2048)
+
+	// images larger than the quota allows are refused, and left alone.
+	w := request(s.d.handleImport, "POST", "/volumes/import", importRequest("big", "rbd/legacy", true))
+	c.Assert(w.Code, Equals, http.StatusInternalServerError)
+	c.Assert(s.driver.has("rbd", "legacy"), Equals, true)
+	c.Assert(s.usage(c), DeepEquals, config.PolicyUsage{})
+
+	_, err := s.d.Config.GetVolume("policy1", "big")
+	c.Assert(err, NotNil)
+
+	s.driver.addSized("rbd", "small", 512)
+	w = request(s.d.handleImport, "POST", "/volumes/import", importRequest("small", "rbd/small", true))
+	c.Assert(w.Code, Equals, http.StatusOK, Commentf("%s", w.Body))
+	c.Assert(s.usage(c), DeepEquals, config.PolicyUsage{Volumes: 1, Size: 512})
+}
+
+func (s *apiserverSuite) TestImportRename(c *C) {
+	s.driver.add("other", "legacy")
+
+	// images not named after the volume are only renamed on request.
+	w := request(s.d.handleImport, "POST", "/volumes/import", importRequest("renamed", "other/legacy", false))
+	c.Assert(w.Code, Equals, http.StatusInternalServerError)
+	c.Assert(s.driver.has("other", "legacy"), Equals, true)
+
+	w = request(s.d.handleImport, "POST", "/volumes/import", importRequest("renamed", "other/legacy", true))
+	c.Assert(w.Code, Equals, http.StatusOK, Commentf("%s", w.Body))
+	c.Assert(s.driver.has("other", "legacy"), Equals, false)
+	c.Assert(s.driver.has("other", "policy1.renamed"), Equals, true)
+
+	vol, err := s.d.Config.GetVolume("policy1", "renamed")
+	c.Assert(err, IsNil)
+	c.Assert(vol.DriverOptions["pool"], Equals, "other")
+}
+
+func (s *apiserverSuite) TestImportCollision(c *C) {
+	s.driver.add("rbd", "policy1.taken")
+	s.driver.add("rbd", "legacy")
+
+	w := request(s.d.handleImport, "POST", "/volumes/import", importRequest("taken", "rbd/policy1.taken", false))
+	c.Assert(w.Code, Equals, http.StatusOK, Commentf("%s", w.Body))
+
+	// the volume exists.
+	s.driver.add("rbd", "other")
+	w = request(s.d.handleImport, "POST", "/volumes/import", importRequest("taken", "rbd/other", true))
+	c.Assert(w.Code, Equals, http.StatusInternalServerError)
+	c.Assert(s.driver.has("rbd", "other"), Equals, true)
+
+	// an image already has the volume's name.
+	c.Assert(s.d.Config.RemoveVolume("policy1", "taken"), IsNil)
+	w = request(s.d.handleImport, "POST", "/volumes/import", importRequest("taken", "rbd/legacy", true))
+	c.Assert(w.Code, Equals, http.StatusInternalServerError)
+	c.Assert(s.driver.has("rbd", "legacy"), Equals, true)
+
+	_, err := s.d.Config.GetVolume("policy1", "taken")
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,272 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/logging"
+	"github.com/contiv/volplugin/storage/control"
+	"github.com/jbeda/go-wait"
+
+	"golang.org/x/net/context"
+)
+
+// operationPollInterval is how often the journal is checked for operations
+// abandoned by other apiservers.
+const operationPollInterval = time.Minute
+
+func newOperation(typ string, vc *config.Volume, hostname string) *config.Operation {
+	return &config.Operation{
+		Type:     typ,
+		Volume:   vc,
+		Step:     config.StepStarted,
+		Hostname: hostname,
+		Started:  time.Now(),
+	}
+}
+
+// startOperation journals the operation and keeps its heartbeat alive until
+// the returned channel is closed by finishOperation. The heartbeat is
+// published again every quarter of the global TTL, like a lock.
+func (d *DaemonConfig) startOperation(ctx context.Context, op *config.Operation) (chan struct{}, error) {
+	ttl := d.Global.TTL
+
+	if err := d.Config.HeartbeatOperation(op, ttl); err != nil {
+		return nil, err
+	}
+
+	if err := d.Config.PublishOperation(op); err != nil {
+		return nil, err
+	}
+
+	stopChan := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-stopChan:
+				return
+			case <-time.After(wait.Jitter(ttl/4, 0)):
+				if err := d.Config.HeartbeatOperation(op, ttl); err != nil {
+					logging.WithContext(log, ctx).Errorf("Could not renew the heartbeat of %s for volume %q: %v", op.Type, op.Volume, err)
+				}
+			}
+		}
+	}()
+
+	return stopChan, nil
+}
+
+// stepOperation records progress. A failure here only costs precision during
+// recovery, so the operation itself carries on.
+func (d *DaemonConfig) stepOperation(ctx context.Context, op *config.Operation, step string) {
+	if err := d.Config.StepOperation(op, step); err != nil {
+		logging.WithContext(log, ctx).Errorf("Could not journal step %q of %s for volume %q: %v", step, op.Type, op.Volume, err)
+	}
+}
+
+func (d *DaemonConfig) finishOperation(ctx context.Context, op *config.Operation, stopChan chan struct{}) {
+	close(stopChan)
+
+	if err := d.Config.RemoveOperation(op); err != nil {
+		logging.WithContext(log, ctx).Errorf("Could not remove journal entry of %s for volume %q: %v", op.Type, op.Volume, err)
+	}
+}
+
+// operationLocks yields the locks an operation of this type holds.
+func operationLocks(op *config.Operation, reason, hostname string) []config.UseLocker {
+	locks := []config.UseLocker{
+		&config.UseMount{Volume: op.Volume.String(), Reason: reason, Hostname: hostname},
+		&config.UseSnapshot{Volume: op.Volume.String(), Reason: reason},
+	}
+
+	if op.Type == config.OperationCopy && op.Source != "" {
+		locks = append(locks, &config.UseSnapshot{Volume: op.Source, Reason: reason})
+	}
+
+	return locks
+}
+
+func operationReason(op *config.Operation) string {
+	switch op.Type {
+	case config.OperationCreate:
+		return lock.ReasonCreate
+	case config.OperationCopy:
+		return lock.ReasonCopy
+	default:
+		return lock.ReasonRemove
+	}
+}
+
+// recoverOperations resumes or rolls back incomplete operations. At startup,
+// every operation journaled by this host was interrupted; otherwise only
+// operations whose heartbeat has expired are considered abandoned.
+func (d *DaemonConfig) recoverOperations(startup bool) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Error(errors.GetHostname.Combine(err))
+		return
+	}
+
+	ops, err := d.Config.ListOperations()
+	if err != nil {
+		log.Errorf("Could not list journaled operations: %v", err)
+		return
+	}
+
+	for _, op := range ops {
+		if !(startup && op.Hostname == hostname) {
+			alive, err := d.Config.OperationAlive(op)
+			if err != nil {
+				log.Errorf("Could not check whether %s of volume %q is running: %v", op.Type, op.Volume, err)
+				continue
+			}
+
+			if alive {
+				continue
+			}
+		}
+
+		log.Infof("Recovering incomplete %s of volume %q (last step %q, host %q)", op.Type, op.Volume, op.Step, op.Hostname)
+
+		if err := d.recoverOperation(op, hostname); err != nil {
+			log.Error(errors.RecoverOperation.Combine(errored.Errorf("%s of %q", op.Type, op.Volume)).Combine(err))
+		}
+	}
+}
+
+func (d *DaemonConfig) pollOperations() {
+	for {
+		time.Sleep(wait.Jitter(operationPollInterval, 0))
+		d.recoverOperations(false)
+	}
+}
+
+func (d *DaemonConfig) recoverOperation(op *config.Operation, hostname string) error {
+	// the interrupted operation's locks were never released. They are removed
+	// with a compare/swap so a new holder is never clobbered.
+	for _, ul := range operationLocks(op, operationReason(op), op.Hostname) {
+		if err := d.Config.RemoveUse(ul, false); err != nil {
+			log.Debugf("Could not remove lock %#v of interrupted operation: %v", ul, err)
+		}
+	}
+
+	locks := operationLocks(op, lock.ReasonRecover, hostname)
+
+	return lock.NewDriver(d.Config).ExecuteWithMultiUseLock(locks, 0, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		if err := d.rollOperation(op); err != nil {
+			return err
+		}
+
+		return d.Config.RemoveOperation(op)
+	})
+}
+
+// rollOperation resumes an operation if its side effects are complete enough
+// to finish it, and rolls it back otherwise.
+func (d *DaemonConfig) rollOperation(op *config.Operation) error {
+	vc := op.Volume
+
+	switch op.Type {
+	case config.OperationCreate:
+		switch op.Step {
+		case config.StepStarted:
+			// the image may or may not have been created, and may have existed
+			// before. It is not safe to destroy it here; fsck reports it instead.
+			log.Warnf("Create of %q was interrupted before the image was created; check for an orphaned image", vc)
+			return d.releaseUnpublished(vc)
+		case config.StepCreated:
+			if err := control.RemoveVolume(vc, d.Global.Timeout); err != nil && err != errors.NoActionTaken {
+				return errors.RemoveImage.Combine(errored.New(vc.String())).Combine(err)
+			}
+			return d.releaseUnpublished(vc)
+		case config.StepFormatted:
+			// the usage reserved for the volume is kept with its record.
+			if err := d.Config.PublishVolume(vc); err != nil && err != errors.Exists {
+				return errors.PublishVolume.Combine(err)
+			}
+		}
+	case config.OperationCopy:
+		if op.Step != config.StepPublished {
+			return d.releaseUnpublished(vc)
+		}
+
+		exists, err := control.ExistsVolume(vc, d.Global.Timeout)
+		if err != nil && err != errors.NoActionTaken {
+			return err
+		}
+
+		if !exists {
+			if err := d.Config.RemoveVolume(vc.PolicyName, vc.VolumeName); err != nil {
+				return errors.ClearVolume.Combine(errored.New(vc.String())).Combine(err)
+			}
+			d.releaseQuota(context.Background(), vc, 0)
+		}
+	case config.OperationRemove:
+		snapshots := uint64(0)
+		if op.Step == config.StepStarted {
+			snapshots = d.snapshotCount(context.Background(), vc)
+			if err := control.RemoveVolume(vc, d.Global.Timeout); err != nil && err != errors.NoActionTaken {
+				return errors.RemoveImage.Combine(errored.New(vc.String())).Combine(err)
+			}
+		}
+
+		err := d.Config.RemoveVolume(vc.PolicyName, vc.VolumeName)
+		if erd, ok := err.(*errored.Error); err != nil && !(ok && erd.Contains(errors.NotExists)) {
+			return errors.ClearVolume.Combine(errored.New(vc.String())).Combine(err)
+		} else if err == nil {
+			d.releaseQuota(context.Background(), vc, snapshots)
+		}
+	}
+
+	return nil
+}
+
+// releaseUnpublished releases the usage reserved by an interrupted create or
+// copy, unless the volume was published; a volume created over an existing
+// record reserves nothing.
+func (d *DaemonConfig) releaseUnpublished(vc *config.Volume) error {
+	_, err := d.Config.GetVolume(vc.PolicyName, vc.VolumeName)
+	if err == nil {
+		return nil
+	}
+
+	if erd, ok := err.(*errored.Error); !ok || !erd.Contains(errors.NotExists) {
+		return errors.GetVolume.Combine(err)
+	}
+
+	d.releaseQuota(context.Background(), vc, 0)
+	return nil
+}
+
+func (d *DaemonConfig) handleOperationList(w http.ResponseWriter, r *http.Request) {
+	ops, err := d.Config.ListOperations()
+	if err != nil {
+		api.RESTHTTPError(w, errors.ListOperation.Combine(err))
+		return
+	}
+
+	visible := d.visibility(r)
+
+	response := []*config.Operation{}
+	for _, op := range ops {
+		if op.Volume != nil && visible(op.Volume.PolicyName) {
+			response = append(response, op)
+		}
+	}
+
+	content, err := json.Marshal(response)
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
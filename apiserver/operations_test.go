@@ -0,0 +1,75 @@
+package apiserver
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/config"
+
+	"golang.org/x/net/context"
+)
+
+func (s *apiserverSuite) journal(c *C, name string, live bool) *config.Operation {
+	vc, err := s.d.Config.CreateVolume(&config.VolumeRequest{Policy: "policy1", Name: name})
+	c.Assert(err, IsNil)
+	s.driver.add("rbd", "policy1."+name)
+
+	op := newOperation(config.OperationCreate, vc, "other-host")
+	op.Step = config.StepCreated
+
+	if live {
+		c.Assert(s.d.Config.HeartbeatOperation(op, time.Minute), IsNil)
+	}
+	c.Assert(s.d.Config.PublishOperation(op), IsNil)
+
+	return op
+}
+
+func (s *apiserverSuite) TestRecoverOperations(c *C) {
+	live := s.journal(c, "live", true)
+	s.journal(c, "abandoned", false)
+
+	s.d.recoverOperations(false)
+
+	// the abandoned create is rolled back; the live one is left to finish.
+	c.Assert(s.driver.has("rbd", "policy1.abandoned"), Equals, false)
+	c.Assert(s.driver.has("rbd", "policy1.live"), Equals, true)
+
+	ops, err := s.d.Config.ListOperations()
+	c.Assert(err, IsNil)
+	c.Assert(ops, HasLen, 1)
+	c.Assert(ops[0].Volume.String(), Equals, "policy1/live")
+
+	// once the heartbeat is gone, it is abandoned too, however recently it
+	// progressed.
+	c.Assert(s.d.Config.StepOperation(live, config.StepCreated), IsNil)
+	c.Assert(s.d.Config.RemoveOperation(live), IsNil)
+	c.Assert(s.d.Config.PublishOperation(live), IsNil)
+
+	s.d.recoverOperations(false)
+	c.Assert(s.driver.has("rbd", "policy1.live"), Equals, false)
+
+	ops, err = s.d.Config.ListOperations()
+	c.Assert(err, IsNil)
+	c.Assert(ops, HasLen, 0)
+}
+
+func (s *apiserverSuite) TestStartOperation(c *C) {
+	vc, err := s.d.Config.CreateVolume(&config.VolumeRequest{Policy: "policy1", Name: "foo"})
+	c.Assert(err, IsNil)
+
+	op := newOperation(config.OperationCreate, vc, "mon0")
+	stopChan, err := s.d.startOperation(context.Background(), op)
+	c.Assert(err, IsNil)
+
+	alive, err := s.d.Config.OperationAlive(op)
+	c.Assert(err, IsNil)
+	c.Assert(alive, Equals, true)
+
+	s.d.finishOperation(context.Background(), op, stopChan)
+
+	alive, err = s.d.Config.OperationAlive(op)
+	c.Assert(err, IsNil)
+	c.Assert(alive, Equals, false)
+}
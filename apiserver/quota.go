@@ -0,0 +1,136 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"golang.org/x/net/context"
+
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/logging"
+	"github.com/contiv/volplugin/storage/control"
+	"github.com/gorilla/mux"
+)
+
+// policyUsage is the json response of a policy's usage.
+type policyUsage struct {
+	Usage *config.PolicyUsage `json:"usage"`
+	Quota *config.Quota       `json:"quota,omitempty"`
+}
+
+// reserveQuota counts the volume against its policy's quota.
+func (d *DaemonConfig) reserveQuota(policy *config.Policy, vc *config.Volume) error {
+	usage, err := config.VolumeUsage(vc)
+	if err != nil {
+		return err
+	}
+
+	return d.Config.ReservePolicyUsage(vc.PolicyName, policy.Quota, usage)
+}
+
+// releaseQuota stops counting the volume against its policy's quota. Failures
+// are only logged; the volume is gone either way.
+func (d *DaemonConfig) releaseQuota(ctx context.Context, vc *config.Volume, snapshots uint64) {
+	usage, err := config.VolumeUsage(vc)
+	if err != nil {
+		logging.WithContext(log, ctx).Warnf("Could not release quota of volume %q: %v", vc, err)
+		return
+	}
+	usage.Snapshots = snapshots
+
+	if err := d.Config.ReleasePolicyUsage(vc.PolicyName, usage); err != nil {
+		logging.WithContext(log, ctx).Warnf("Could not release quota of volume %q: %v", vc, err)
+	}
+}
+
+// snapshotCount returns the number of snapshots of the volume, which are
+// removed with its image.
+func (d *DaemonConfig) snapshotCount(ctx context.Context, vc *config.Volume) uint64 {
+	count, err := control.CountSnapshots(vc, d.Global.Timeout)
+	if err != nil {
+		logging.WithContext(log, ctx).Warnf("Could not count snapshots of volume %q: %v", vc, err)
+		return 0
+	}
+
+	return count
+}
+
+// countSnapshots counts the snapshots of a volume for a count of its policy's
+// usage.
+func (d *DaemonConfig) countSnapshots(vc *config.Volume) (uint64, error) {
+	return control.CountSnapshots(vc, d.Global.Timeout)
+}
+
+// seedQuotas counts the usage of the policies which do not have any yet, so
+// volumes created before quotas count against them.
+func (d *DaemonConfig) seedQuotas() {
+	policies, err := d.Config.ListPolicies()
+	if err != nil {
+		log.Errorf("Could not list policies to seed their usage: %v", err)
+		return
+	}
+
+	for _, policy := range policies {
+		seeded, err := d.Config.SeedPolicyUsage(policy.Name, d.countSnapshots)
+		if err != nil {
+			log.Errorf("Could not seed usage of policy %q: %v", policy.Name, err)
+			continue
+		}
+
+		if seeded {
+			log.Infof("Seeded usage of policy %q from its volumes", policy.Name)
+		}
+	}
+}
+
+func (d *DaemonConfig) handlePolicyUsage(w http.ResponseWriter, r *http.Request) {
+	policyName := mux.Vars(r)["policy"]
+
+	policy, err := d.Config.GetPolicy(policyName)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetPolicy.Combine(err))
+		return
+	}
+
+	usage, err := d.Config.GetPolicyUsage(policyName)
+	if err != nil {
+		api.RESTHTTPError(w, err)
+		return
+	}
+
+	content, err := json.Marshal(policyUsage{Usage: usage, Quota: policy.Quota})
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
+
+func (d *DaemonConfig) handlePolicyUsageRecount(w http.ResponseWriter, r *http.Request) {
+	policyName := mux.Vars(r)["policy"]
+
+	policy, err := d.Config.GetPolicy(policyName)
+	if err != nil {
+		api.RESTHTTPError(w, errors.GetPolicy.Combine(err))
+		return
+	}
+
+	usage, err := d.Config.RecountPolicyUsage(policyName, d.countSnapshots)
+	if err != nil {
+		api.RESTHTTPError(w, err)
+		return
+	}
+
+	logging.WithContext(log, r.Context()).Infof("Recounted usage of policy %q: %v", policyName, usage)
+
+	content, err := json.Marshal(policyUsage{Usage: usage, Quota: policy.Quota})
+	if err != nil {
+		api.RESTHTTPError(w, errors.MarshalResponse.Combine(err))
+		return
+	}
+
+	w.Write(content)
+}
@@ -0,0 +1,82 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/storage"
+	"github.com/gorilla/mux"
+)
+
+// publish records a volume of policy1 with an image and some snapshots.
+func (s *apiserverSuite) publish(c *C, name string, snapshots ...string) *config.Volume {
+	vc, err := s.d.Config.CreateVolume(&config.VolumeRequest{Policy: "policy1", Name: name})
+	c.Assert(err, IsNil)
+	c.Assert(s.d.Config.PublishVolume(vc), IsNil)
+
+	s.driver.add("rbd", "policy1."+name)
+	for _, snap := range snapshots {
+		do := storage.DriverOptions{Volume: storage.Volume{Name: vc.String(), Params: vc.DriverOptions}}
+		c.Assert(s.driver.CreateSnapshot(snap, do), IsNil)
+	}
+
+	return vc
+}
+
+func (s *apiserverSuite) usage(c *C) config.PolicyUsage {
+	usage, err := s.d.Config.GetPolicyUsage("policy1")
+	c.Assert(err, IsNil)
+	return *usage
+}
+
+func (s *apiserverSuite) TestSeedQuotas(c *C) {
+	s.publish(c, "foo", "snap1", "snap2")
+	s.publish(c, "bar")
+
+	s.d.seedQuotas()
+	c.Assert(s.usage(c), DeepEquals, config.PolicyUsage{Volumes: 2, Size: 20, Snapshots: 2})
+
+	// a counter which is there already is left alone.
+	c.Assert(s.d.Config.ReleasePolicyUsage("policy1", config.PolicyUsage{Volumes: 1}), IsNil)
+	s.d.seedQuotas()
+	c.Assert(s.usage(c), DeepEquals, config.PolicyUsage{Volumes: 1, Size: 20, Snapshots: 2})
+
+	// until it is recounted.
+	r := mux.NewRouter()
+	r.HandleFunc("/policy-usage/{policy}", s.d.handlePolicyUsageRecount).Methods("POST")
+
+	req, err := http.NewRequest("POST", "/policy-usage/policy1", nil)
+	c.Assert(err, IsNil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	c.Assert(w.Code, Equals, http.StatusOK, Commentf("%s", w.Body))
+
+	result := policyUsage{}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &result), IsNil)
+	c.Assert(*result.Usage, DeepEquals, config.PolicyUsage{Volumes: 2, Size: 20, Snapshots: 2})
+	c.Assert(s.usage(c), DeepEquals, *result.Usage)
+}
+
+func (s *apiserverSuite) TestRollOperationQuota(c *C) {
+	// the create was interrupted before the volume was published.
+	op := s.journal(c, "interrupted", false)
+	c.Assert(s.d.reserveQuota(testPolicy, op.Volume), IsNil)
+
+	// the image of this one was formatted, so it is published.
+	formatted := s.journal(c, "formatted", false)
+	c.Assert(s.d.reserveQuota(testPolicy, formatted.Volume), IsNil)
+	c.Assert(s.d.Config.StepOperation(formatted, config.StepFormatted), IsNil)
+
+	s.d.recoverOperations(false)
+
+	c.Assert(s.driver.has("rbd", "policy1.interrupted"), Equals, false)
+	c.Assert(s.driver.has("rbd", "policy1.formatted"), Equals, true)
+	c.Assert(s.usage(c), DeepEquals, config.PolicyUsage{Volumes: 1, Size: 10})
+
+	_, err := s.d.Config.GetVolume("policy1", "formatted")
+	c.Assert(err, IsNil)
+}
@@ -0,0 +1,133 @@
+// Package auth provides the credentials volcli, volplugin and the other
+// clients present to the apiserver, and the TLS configuration the apiserver
+// serves with. Credentials are a bearer token, a client certificate, or both;
+// the identities they belong to and their roles are kept in etcd.
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/contiv/errored"
+)
+
+// Credentials are presented by clients of the apiserver. If a certificate or
+// CA is given, the apiserver is reached over TLS.
+type Credentials struct {
+	Token    string
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+// TLS is true if the apiserver is reached over TLS.
+func (c *Credentials) TLS() bool {
+	return c.CAFile != "" || c.CertFile != ""
+}
+
+// URL returns the URL of the path on the apiserver.
+func (c *Credentials) URL(apiserver, path string) string {
+	scheme := "http"
+	if c.TLS() {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s%s", scheme, apiserver, path)
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, errored.Errorf("No certificates found in %q", file)
+	}
+
+	return pool, nil
+}
+
+// Client returns an HTTP client presenting the credentials.
+func (c *Credentials) Client() (*http.Client, error) {
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+
+	if c.TLS() {
+		tlsConfig := &tls.Config{}
+
+		if c.CAFile != "" {
+			pool, err := loadCertPool(c.CAFile)
+			if err != nil {
+				return nil, errored.Errorf("Could not load CA: %v", err)
+			}
+			tlsConfig.RootCAs = pool
+		}
+
+		if c.CertFile != "" {
+			cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+			if err != nil {
+				return nil, errored.Errorf("Could not load client certificate: %v", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &http.Client{Transport: &tokenTransport{token: c.Token, base: transport}}, nil
+}
+
+// tokenTransport adds the bearer token to each request.
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.token == "" {
+		return t.base.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the request, so the headers are copied.
+	authReq := *req
+	authReq.Header = http.Header{}
+	for key, value := range req.Header {
+		authReq.Header[key] = value
+	}
+	authReq.Header.Set("Authorization", "Bearer "+t.token)
+
+	return t.base.RoundTrip(&authReq)
+}
+
+// BearerToken returns the bearer token of the request, if any.
+func BearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+}
+
+// ServerTLSConfig returns the TLS configuration of the apiserver. If a client
+// CA is given, client certificates are verified against it when presented.
+func ServerTLSConfig(clientCAFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	if clientCAFile != "" {
+		pool, err := loadCertPool(clientCAFile)
+		if err != nil {
+			return nil, errored.Errorf("Could not load client CA: %v", err)
+		}
+
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	. "testing"
+
+	. "gopkg.in/check.v1"
+)
+
+type authSuite struct{}
+
+var _ = Suite(&authSuite{})
+
+func TestAuth(t *T) { TestingT(t) }
+
+func (s *authSuite) TestURL(c *C) {
+	c.Assert((&Credentials{}).URL("127.0.0.1:9005", "/global"), Equals, "http://127.0.0.1:9005/global")
+	c.Assert((&Credentials{Token: "secret"}).URL("127.0.0.1:9005", "/global"), Equals, "http://127.0.0.1:9005/global")
+	c.Assert((&Credentials{CAFile: "/ca.pem"}).URL("127.0.0.1:9005", "/global"), Equals, "https://127.0.0.1:9005/global")
+}
+
+func (s *authSuite) TestToken(c *C) {
+	var token string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = BearerToken(r)
+	}))
+	defer server.Close()
+
+	client, err := (&Credentials{Token: "secret"}).Client()
+	c.Assert(err, IsNil)
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	c.Assert(err, IsNil)
+	_, err = client.Do(req)
+	c.Assert(err, IsNil)
+	c.Assert(token, Equals, "secret")
+	c.Assert(req.Header.Get("Authorization"), Equals, "")
+
+	client, err = (&Credentials{}).Client()
+	c.Assert(err, IsNil)
+	_, err = client.Get(server.URL)
+	c.Assert(err, IsNil)
+	c.Assert(token, Equals, "")
+
+	_, err = (&Credentials{CAFile: "/nonexistent"}).Client()
+	c.Assert(err, NotNil)
+}
@@ -9,7 +9,6 @@ import (
 	"github.com/contiv/volplugin/errors"
 	"github.com/contiv/volplugin/watch"
 	"github.com/coreos/etcd/client"
-	"golang.org/x/net/context"
 )
 
 func (c *Client) policyArchive(name string) string {
@@ -25,7 +24,7 @@ func (c *Client) CreatePolicyRevision(name string, policy string) error {
 	timestamp := fmt.Sprint(time.Now().Unix())
 	key := c.policyArchiveEntry(name, timestamp)
 
-	_, err := c.etcdClient.Set(context.Background(), key, policy, nil)
+	_, err := c.etcdClient.Set(c.Context(), key, policy, nil)
 	if err != nil {
 		return errors.EtcdToErrored(err)
 	}
@@ -37,7 +36,7 @@ func (c *Client) CreatePolicyRevision(name string, policy string) error {
 func (c *Client) ListPolicyRevisions(name string) ([]string, error) {
 	keyspace := c.policyArchive(name)
 
-	resp, err := c.etcdClient.Get(context.Background(), keyspace, &client.GetOptions{Sort: true, Recursive: false, Quorum: true})
+	resp, err := c.etcdClient.Get(c.Context(), keyspace, &client.GetOptions{Sort: true, Recursive: false, Quorum: true})
 	if err != nil {
 		return nil, errors.EtcdToErrored(err)
 	}
@@ -57,7 +56,7 @@ func (c *Client) ListPolicyRevisions(name string) ([]string, error) {
 func (c *Client) GetPolicyRevision(name, revision string) (string, error) {
 	keyspace := c.policyArchiveEntry(name, revision)
 
-	resp, err := c.etcdClient.Get(context.Background(), keyspace, &client.GetOptions{Sort: false, Recursive: false, Quorum: true})
+	resp, err := c.etcdClient.Get(c.Context(), keyspace, &client.GetOptions{Sort: false, Recursive: false, Quorum: true})
 	if err != nil {
 		return "", errors.EtcdToErrored(err)
 	}
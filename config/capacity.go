@@ -0,0 +1,97 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/contiv/volplugin/errors"
+	"github.com/coreos/etcd/client"
+)
+
+// VolumeCapacity is the usage of a volume. The filesystem figures are
+// measured by the volplugin which has the volume mounted; the provisioned and
+// actual sizes are reported by the storage backend, if it is able to.
+// Snapshots is the number of snapshots of the volume, if its backend takes
+// them.
+type VolumeCapacity struct {
+	Volume           string    `json:"volume"`
+	Hostname         string    `json:"hostname,omitempty"`
+	UsedBytes        uint64    `json:"used-bytes"`
+	AvailableBytes   uint64    `json:"available-bytes"`
+	TotalBytes       uint64    `json:"total-bytes"`
+	UsedInodes       uint64    `json:"used-inodes"`
+	FreeInodes       uint64    `json:"free-inodes"`
+	TotalInodes      uint64    `json:"total-inodes"`
+	ProvisionedBytes uint64    `json:"provisioned-bytes,omitempty"`
+	ActualBytes      uint64    `json:"actual-bytes,omitempty"`
+	Snapshots        *int      `json:"snapshots,omitempty"`
+	Alerts           []string  `json:"alerts,omitempty"`
+	Updated          time.Time `json:"updated"`
+}
+
+func percent(part, total uint64) uint64 {
+	if total == 0 {
+		return 0
+	}
+
+	return part * 100 / total
+}
+
+// UsedPercent is the percentage of the filesystem's space in use.
+func (vc *VolumeCapacity) UsedPercent() uint64 {
+	return percent(vc.UsedBytes, vc.UsedBytes+vc.AvailableBytes)
+}
+
+// InodesPercent is the percentage of the filesystem's inodes in use.
+func (vc *VolumeCapacity) InodesPercent() uint64 {
+	return percent(vc.UsedInodes, vc.TotalInodes)
+}
+
+// CheckAlerts sets the alerts for the thresholds the usage has reached.
+func (vc *VolumeCapacity) CheckAlerts(alerts AlertConfig) {
+	vc.Alerts = nil
+
+	if alerts.UsedPercent != 0 && vc.UsedPercent() >= uint64(alerts.UsedPercent) {
+		vc.Alerts = append(vc.Alerts, fmt.Sprintf("space %d%% used, threshold %d%%", vc.UsedPercent(), alerts.UsedPercent))
+	}
+
+	if alerts.InodesPercent != 0 && vc.InodesPercent() >= uint64(alerts.InodesPercent) {
+		vc.Alerts = append(vc.Alerts, fmt.Sprintf("inodes %d%% used, threshold %d%%", vc.InodesPercent(), alerts.InodesPercent))
+	}
+}
+
+func (c *Client) volumeCapacity(volume string) string {
+	return c.prefixed(rootVolumeUsage, volume)
+}
+
+// PublishVolumeCapacity publishes the usage of a volume with the provided
+// TTL, so that it disappears shortly after the volume is no longer mounted.
+func (c *Client) PublishVolumeCapacity(vc *VolumeCapacity, ttl time.Duration) error {
+	content, err := json.Marshal(vc)
+	if err != nil {
+		return errors.PublishVolumeUsage.Combine(err)
+	}
+
+	if _, err := c.etcdClient.Set(c.Context(), c.volumeCapacity(vc.Volume), string(content), &client.SetOptions{TTL: ttl}); err != nil {
+		return errors.PublishVolumeUsage.Combine(errors.EtcdToErrored(err))
+	}
+
+	return nil
+}
+
+// GetVolumeCapacity retrieves the usage of a volume. Volumes which are not
+// mounted have none.
+func (c *Client) GetVolumeCapacity(volume string) (*VolumeCapacity, error) {
+	resp, err := c.etcdClient.Get(c.Context(), c.volumeCapacity(volume), nil)
+	if err != nil {
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	vc := &VolumeCapacity{}
+	if err := json.Unmarshal([]byte(resp.Node.Value), vc); err != nil {
+		return nil, errors.GetVolumeUsage.Combine(err)
+	}
+
+	return vc, nil
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"time"
+
+	"github.com/contiv/volplugin/errors"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *configSuite) TestVolumeCapacityAlerts(c *C) {
+	vc := &VolumeCapacity{UsedBytes: 90, AvailableBytes: 10, UsedInodes: 10, TotalInodes: 100}
+	c.Assert(vc.UsedPercent(), Equals, uint64(90))
+	c.Assert(vc.InodesPercent(), Equals, uint64(10))
+
+	vc.CheckAlerts(AlertConfig{})
+	c.Assert(len(vc.Alerts), Equals, 0)
+
+	vc.CheckAlerts(AlertConfig{UsedPercent: 80, InodesPercent: 50})
+	c.Assert(len(vc.Alerts), Equals, 1)
+
+	vc.UsedInodes = 60
+	vc.CheckAlerts(AlertConfig{UsedPercent: 95, InodesPercent: 50})
+	c.Assert(len(vc.Alerts), Equals, 1)
+
+	c.Assert((&VolumeCapacity{}).UsedPercent(), Equals, uint64(0))
+}
+
+func (s *configSuite) TestVolumeCapacityPublish(c *C) {
+	_, err := s.tlc.GetVolumeCapacity("policy1/test")
+	c.Assert(err, Equals, errors.NotExists)
+
+	vc := &VolumeCapacity{Volume: "policy1/test", Hostname: "host1", UsedBytes: 10, AvailableBytes: 90}
+	c.Assert(s.tlc.PublishVolumeCapacity(vc, time.Minute), IsNil)
+
+	got, err := s.tlc.GetVolumeCapacity("policy1/test")
+	c.Assert(err, IsNil)
+	c.Assert(got.Hostname, Equals, "host1")
+	c.Assert(got.UsedBytes, Equals, uint64(10))
+}
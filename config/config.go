@@ -13,20 +13,34 @@ import (
 
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/logging"
 	"github.com/contiv/volplugin/watch"
 	"github.com/coreos/etcd/client"
 	"golang.org/x/net/context"
 )
 
+var log = logging.For("config")
+
 const (
 	rootVolume        = "volumes"
 	rootUse           = "users"
 	rootPolicy        = "policies"
 	rootPolicyArchive = "policy-archives"
 	rootSnapshots     = "snapshots"
+	rootNode          = "nodes"
+	rootHandoff       = "handoffs"
+	rootOperation     = "operations"
+	rootOperationLive = "operations-live"
+	rootIdentity      = "identities"
+	rootIdentityToken = "identity-tokens"
+	rootPolicyUsage   = "policy-usage"
+	rootVolumeUsage   = "volume-usage"
+	rootEvent         = "events"
+	rootDeadLetter    = "dead-letters"
+	rootDebug         = "debug"
 )
 
-var defaultPaths = []string{rootVolume, rootUse, rootPolicy, rootPolicyArchive, rootSnapshots}
+var defaultPaths = []string{rootVolume, rootUse, rootPolicy, rootPolicyArchive, rootSnapshots, rootNode, rootHandoff, rootOperation, rootOperationLive, rootIdentity, rootIdentityToken, rootPolicyUsage, rootVolumeUsage, rootEvent, rootDeadLetter, rootDebug}
 
 // VolumeRequest provides a request structure for communicating volumes to the
 // apiserver or internally. it is the basic representation of a volume.
@@ -44,6 +58,7 @@ func (v *VolumeRequest) String() string {
 type Client struct {
 	etcdClient client.KeysAPI
 	prefix     string
+	ctx        context.Context
 }
 
 // NewClient creates a Client struct which can drive communication
@@ -58,9 +73,69 @@ func NewClient(prefix string, etcdHosts []string) (*Client, error) {
 		return nil, err
 	}
 
+	return newClient(prefix, client.NewKeysAPI(etcdClient)), nil
+}
+
+// NewStoreClient creates a Client for the store given as a URL:
+// "consul://host:port" for the consul agent at host:port,
+// "etcd://host:port,..." for etcd, or "etcd3://host:port" for etcd through its
+// v3 API. If store is empty or has no hosts, etcd at etcdHosts is used, or
+// consul at localhost:8500.
+func NewStoreClient(prefix, store string, etcdHosts []string) (*Client, error) {
+	scheme, hosts := "etcd", ""
+	if store != "" {
+		parts := strings.SplitN(store, "://", 2)
+		if len(parts) != 2 {
+			return nil, errors.InvalidStore.Combine(errored.Errorf("%q is not a URL", store))
+		}
+		scheme, hosts = parts[0], strings.Trim(parts[1], "/")
+	}
+
+	switch scheme {
+	case "etcd":
+		if hosts != "" {
+			etcdHosts = []string{}
+			for _, host := range strings.Split(hosts, ",") {
+				etcdHosts = append(etcdHosts, "http://"+host)
+			}
+		}
+
+		return NewClient(prefix, etcdHosts)
+	case "consul":
+		if hosts == "" {
+			hosts = "localhost:8500"
+		}
+
+		keysAPI, err := newConsulKeysAPI(hosts)
+		if err != nil {
+			return nil, errors.InvalidStore.Combine(err)
+		}
+
+		return newClient(prefix, keysAPI), nil
+	case "etcd3":
+		if hosts == "" && len(etcdHosts) > 0 {
+			hosts = etcdHosts[0]
+		}
+
+		if strings.Contains(hosts, ",") {
+			return nil, errors.InvalidStore.Combine(errored.Errorf("etcd3 takes one host, not %q", hosts))
+		}
+
+		keysAPI, err := newEtcd3KeysAPI(hosts)
+		if err != nil {
+			return nil, errors.InvalidStore.Combine(err)
+		}
+
+		return newClient(prefix, keysAPI), nil
+	default:
+		return nil, errors.InvalidStore.Combine(errored.Errorf("unknown store %q", scheme))
+	}
+}
+
+func newClient(prefix string, keysAPI client.KeysAPI) *Client {
 	config := &Client{
 		prefix:     prefix,
-		etcdClient: client.NewKeysAPI(etcdClient),
+		etcdClient: tracedKeysAPI{keysAPI},
 	}
 
 	watch.Init(config.etcdClient)
@@ -70,7 +145,34 @@ func NewClient(prefix string, etcdHosts []string) (*Client, error) {
 		config.etcdClient.Set(context.Background(), config.prefixed(path), "", &client.SetOptions{Dir: true})
 	}
 
-	return config, nil
+	return config
+}
+
+// store returns the KeysAPI of the store, without tracing, so the interfaces
+// it implements beyond KeysAPI can be used.
+func (c *Client) store() client.KeysAPI {
+	if traced, ok := c.etcdClient.(tracedKeysAPI); ok {
+		return traced.KeysAPI
+	}
+
+	return c.etcdClient
+}
+
+// WithContext returns a copy of the client whose etcd calls are made with the
+// context, so they are traced as part of the request it carries.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	newClient := *c
+	newClient.ctx = ctx
+	return &newClient
+}
+
+// Context returns the context the client's etcd calls are made with.
+func (c *Client) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+
+	return c.ctx
 }
 
 func (c *Client) prefixed(strs ...string) string {
@@ -82,9 +184,14 @@ func (c *Client) prefixed(strs ...string) string {
 	return str
 }
 
-func addNodeToTarball(node *client.Node, writer *tar.Writer, baseDirectory string) error {
+func addNodeToTarball(node *client.Node, writer *tar.Writer, baseDirectory string, filter func(string) string) error {
 	now := time.Now()
 
+	value := node.Value
+	if filter != nil && !node.Dir {
+		value = filter(value)
+	}
+
 	header := &tar.Header{
 		AccessTime: now,
 		ChangeTime: now,
@@ -97,7 +204,7 @@ func addNodeToTarball(node *client.Node, writer *tar.Writer, baseDirectory strin
 		header.Typeflag = tar.TypeDir
 	} else {
 		header.Mode = 0600
-		header.Size = int64(len(node.Value))
+		header.Size = int64(len(value))
 		header.Typeflag = tar.TypeReg
 	}
 
@@ -108,27 +215,34 @@ func addNodeToTarball(node *client.Node, writer *tar.Writer, baseDirectory strin
 
 	// we don't have to write anything for directories except the header
 	if !node.Dir {
-		_, err = writer.Write([]byte(node.Value))
+		_, err = writer.Write([]byte(value))
 		if err != nil {
 			return errored.Errorf("Failed to write tar entry").Combine(err)
 		}
 	}
 
 	for _, n := range node.Nodes {
-		addNodeToTarball(n, writer, baseDirectory)
+		addNodeToTarball(n, writer, baseDirectory, filter)
 	}
 
 	return nil
 }
 
-// DumpTarball dumps all the keys under the current etcd prefix into a
-// gzip'd tarball'd directory-based representation of the namespace.
-func (c *Client) DumpTarball() (string, error) {
-	resp, err := c.etcdClient.Get(context.Background(), c.prefix, &client.GetOptions{Sort: true, Recursive: true, Quorum: true})
+// DumpNamespace writes all the keys under the current etcd prefix to the
+// tar writer, under the base directory. If filter is not nil, each value is
+// passed through it before it is written.
+func (c *Client) DumpNamespace(writer *tar.Writer, baseDirectory string, filter func(string) string) error {
+	resp, err := c.etcdClient.Get(c.Context(), c.prefix, &client.GetOptions{Sort: true, Recursive: true, Quorum: true})
 	if err != nil {
-		return "", errored.Errorf(`Failed to recursively GET "%s" namespace from etcd`, c.prefix).Combine(errors.EtcdToErrored(err))
+		return errored.Errorf(`Failed to recursively GET "%s" namespace from etcd`, c.prefix).Combine(errors.EtcdToErrored(err))
 	}
 
+	return addNodeToTarball(resp.Node, writer, baseDirectory, filter)
+}
+
+// DumpTarball dumps all the keys under the current etcd prefix into a
+// gzip'd tarball'd directory-based representation of the namespace.
+func (c *Client) DumpTarball() (string, error) {
 	now := time.Now()
 
 	// tar hangs during unpacking if the base directory has colons in it
@@ -153,7 +267,7 @@ func (c *Client) DumpTarball() (string, error) {
 	// ensure that the tarball extracts to a folder with the same name as the tarball
 	baseDirectory := filepath.Base(file.Name())
 
-	err = addNodeToTarball(resp.Node, tarWriter, baseDirectory)
+	err = c.DumpNamespace(tarWriter, baseDirectory, nil)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,663 @@
+package config
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db/impl/consul"
+	"github.com/contiv/volplugin/errors"
+	"github.com/coreos/etcd/client"
+
+	// see trace.go.
+	"github.com/coreos/etcd/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+// consulWatchWait is how long each blocking query of a watch waits for a
+// change before it is re-issued.
+const consulWatchWait = 5 * time.Minute
+
+// consulTxnRetries is how many times an unconditional set is retried when the
+// key changes between reading it and writing it.
+const consulTxnRetries = 5
+
+// consulMaxTxnOps is the number of operations consul allows in a transaction.
+const consulMaxTxnOps = 64
+
+// consulKeysAPI implements etcd's KeysAPI on top of consul, so the rest of
+// the package can use either store. Directories are laid out as described in
+// flat.go. TTLs are implemented with consul sessions, which delete the keys they
+// hold when they expire. Sessions live for at least consul.MinSessionTTL and
+// consul may take up to twice their TTL to expire them, so keys may outlive
+// the TTL they were set with. sessionMutex only guards the maps; it is never
+// held while talking to consul.
+type consulKeysAPI struct {
+	kv           *consul.KV
+	sessions     map[string]heldSession
+	ordered      map[time.Duration]string
+	sessionMutex sync.Mutex
+}
+
+// heldSession is the session a key was last written with by this client, and
+// the index of that write.
+type heldSession struct {
+	id    string
+	index uint64
+}
+
+func newConsulKeysAPI(address string) (*consulKeysAPI, error) {
+	kv, err := consul.NewKV(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &consulKeysAPI{kv: kv, sessions: map[string]heldSession{}, ordered: map[time.Duration]string{}}, nil
+}
+
+func consulKey(key string) string {
+	return strings.Trim(key, "/")
+}
+
+func consulError(code int, key string, index uint64) error {
+	return client.Error{Code: code, Message: errorMessages[code], Cause: "/" + key, Index: index}
+}
+
+func pairToNode(pair *consul.Pair) *client.Node {
+	node := &client.Node{
+		Key:           "/" + strings.TrimSuffix(pair.Key, "/"),
+		Value:         string(pair.Value),
+		CreatedIndex:  pair.CreateIndex,
+		ModifiedIndex: pair.ModifyIndex,
+	}
+
+	if strings.HasSuffix(pair.Key, "/") {
+		node.Dir = true
+		node.Value = ""
+	}
+
+	return node
+}
+
+// below returns the pairs which are the key itself or are under it.
+func below(key string, pairs []*consul.Pair) []*consul.Pair {
+	result := []*consul.Pair{}
+	for _, pair := range pairs {
+		if pair.Key == key || strings.HasPrefix(pair.Key, key+"/") {
+			result = append(result, pair)
+		}
+	}
+
+	return result
+}
+
+func (c *consulKeysAPI) get(ctx context.Context, key string) (*consul.Pair, uint64, error) {
+	pairs, index, err := c.kv.Get(ctx, key, nil)
+	if err == errors.NotExists {
+		return nil, index, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	return pairs[0], index, nil
+}
+
+// Get builds the node of the key out of it and the keys under it. Only the
+// immediate children of a directory are returned unless opts.Recursive is
+// set; see list.
+func (c *consulKeysAPI) Get(ctx context.Context, key string, opts *client.GetOptions) (*client.Response, error) {
+	if opts == nil {
+		opts = &client.GetOptions{}
+	}
+
+	key = consulKey(key)
+	if !opts.Recursive {
+		for i := 0; i < consulTxnRetries; i++ {
+			resp, retry, err := c.list(ctx, key)
+			if !retry {
+				return resp, err
+			}
+		}
+
+		return nil, errors.Consul.Combine(errored.Errorf("%q kept changing while it was read", "/"+key))
+	}
+
+	pairs, index, err := c.kv.Get(ctx, key, &consul.QueryOptions{Recurse: true})
+	if err != nil && err != errors.NotExists {
+		return nil, err
+	}
+
+	pairs = below(key, pairs)
+	if len(pairs) == 0 {
+		return nil, consulError(client.ErrorCodeKeyNotFound, key, index)
+	}
+
+	if len(pairs) == 1 && pairs[0].Key == key {
+		return &client.Response{Action: "get", Node: pairToNode(pairs[0]), Index: index}, nil
+	}
+
+	nodes := []*client.Node{}
+	for _, pair := range pairs {
+		nodes = append(nodes, pairToNode(pair))
+	}
+
+	return &client.Response{Action: "get", Node: nodeTree("/"+key, nodes, opts.Recursive), Index: index}, nil
+}
+
+// list makes one attempt at a non-recursive Get. The keys under the key are
+// listed one level deep without their values, and only the values of its
+// immediate children and of its directory are read. retry is true if one of
+// them was removed while they were being read.
+func (c *consulKeysAPI) list(ctx context.Context, key string) (*client.Response, bool, error) {
+	keys, index, err := c.kv.Keys(ctx, key+"/", "/")
+	if err == errors.NotExists {
+		pair, index, err := c.get(ctx, key)
+		if err != nil {
+			return nil, false, err
+		} else if pair == nil {
+			return nil, false, consulError(client.ErrorCodeKeyNotFound, key, index)
+		}
+
+		return &client.Response{Action: "get", Node: pairToNode(pair), Index: index}, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	nodes := []*client.Node{}
+	ops := []*consul.TxnOp{}
+	for _, name := range keys {
+		if name == key+"/" || !strings.HasSuffix(name, "/") {
+			ops = append(ops, &consul.TxnOp{Verb: consul.VerbGet, Key: name})
+		} else {
+			// a directory below, which may only be implied by the keys under it.
+			nodes = append(nodes, &client.Node{Key: "/" + strings.TrimSuffix(name, "/"), Dir: true})
+		}
+	}
+
+	for len(ops) > 0 {
+		batch := ops
+		if len(batch) > consulMaxTxnOps {
+			batch = batch[:consulMaxTxnOps]
+		}
+		ops = ops[len(batch):]
+
+		ok, pairs, err := c.kv.Txn(ctx, batch)
+		if err != nil {
+			return nil, false, err
+		} else if !ok {
+			return nil, true, nil
+		}
+
+		for _, pair := range pairs {
+			nodes = append(nodes, pairToNode(pair))
+		}
+	}
+
+	return &client.Response{Action: "get", Node: nodeTree("/"+key, nodes, false), Index: index}, false, nil
+}
+
+// Set writes the key after checking the conditions of opts against its
+// current value.
+func (c *consulKeysAPI) Set(ctx context.Context, key, value string, opts *client.SetOptions) (*client.Response, error) {
+	if opts == nil {
+		opts = &client.SetOptions{}
+	}
+
+	key = consulKey(key)
+	if opts.Dir {
+		return c.setDir(ctx, key, opts)
+	}
+
+	conditional := opts.PrevExist != client.PrevIgnore || opts.PrevValue != "" || opts.PrevIndex != 0
+
+	for i := 0; i < consulTxnRetries; i++ {
+		resp, retry, err := c.set(ctx, key, value, opts)
+		if !retry {
+			return resp, err
+		}
+
+		if conditional {
+			break
+		}
+	}
+
+	return nil, consulError(client.ErrorCodeTestFailed, key, 0)
+}
+
+func (c *consulKeysAPI) setDir(ctx context.Context, key string, opts *client.SetOptions) (*client.Response, error) {
+	ok, pairs, err := c.kv.Txn(ctx, []*consul.TxnOp{
+		{Verb: consul.VerbCheckNotExists, Key: key + "/"},
+		{Verb: consul.VerbSet, Key: key + "/"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		if opts.PrevExist == client.PrevNoExist {
+			return nil, consulError(client.ErrorCodeNodeExist, key, 0)
+		}
+
+		return &client.Response{Action: "set", Node: &client.Node{Key: "/" + key, Dir: true}}, nil
+	}
+
+	return &client.Response{Action: "create", Node: pairToNode(pairs[0]), Index: pairs[0].ModifyIndex}, nil
+}
+
+// set makes one attempt at writing the key. retry is true if the key changed
+// while it was being written.
+func (c *consulKeysAPI) set(ctx context.Context, key, value string, opts *client.SetOptions) (*client.Response, bool, error) {
+	current, index, err := c.get(ctx, key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch {
+	case current == nil && (opts.PrevExist == client.PrevExist || opts.PrevValue != "" || opts.PrevIndex != 0):
+		return nil, false, consulError(client.ErrorCodeKeyNotFound, key, index)
+	case current != nil && opts.PrevExist == client.PrevNoExist:
+		return nil, false, consulError(client.ErrorCodeNodeExist, key, index)
+	case current != nil && opts.PrevValue != "" && string(current.Value) != opts.PrevValue:
+		return nil, false, consulError(client.ErrorCodeTestFailed, key, index)
+	case current != nil && opts.PrevIndex != 0 && current.ModifyIndex != opts.PrevIndex:
+		return nil, false, consulError(client.ErrorCodeTestFailed, key, index)
+	}
+
+	ops := []*consul.TxnOp{{Verb: consul.VerbCheckNotExists, Key: key}}
+	if current != nil {
+		ops[0] = &consul.TxnOp{Verb: consul.VerbCheckIndex, Key: key, Index: current.ModifyIndex}
+	}
+
+	session, err := c.session(ctx, key, current, opts.TTL)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// a key held by another session has to be removed before it can be
+	// written, or it would still expire with that session.
+	if current != nil && current.Session != "" && current.Session != session {
+		ops[0].Verb = consul.VerbDeleteCAS
+	}
+
+	if session == "" {
+		ops = append(ops, &consul.TxnOp{Verb: consul.VerbSet, Key: key, Value: []byte(value)})
+	} else {
+		ops = append(ops, &consul.TxnOp{Verb: consul.VerbLock, Key: key, Value: []byte(value), Session: session})
+	}
+
+	ok, pairs, err := c.kv.Txn(ctx, ops)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !ok {
+		if current == nil || session != current.Session {
+			c.destroy(ctx, session)
+		}
+		return nil, true, nil
+	}
+
+	pair := pairs[len(pairs)-1]
+	c.destroy(ctx, c.hold(key, session, pair.ModifyIndex))
+
+	resp := &client.Response{Action: "set", Node: pairToNode(pair), Index: pair.ModifyIndex}
+	resp.Node.Value = value
+	if current != nil {
+		resp.PrevNode = pairToNode(current)
+	} else if opts.PrevExist == client.PrevNoExist {
+		resp.Action = "create"
+	}
+
+	return resp, false, nil
+}
+
+// session returns the session a key being set with the TTL should be held
+// by: the one this client already holds it with, renewed, or a new one. No
+// session is returned if the TTL is zero.
+func (c *consulKeysAPI) session(ctx context.Context, key string, current *consul.Pair, ttl time.Duration) (string, error) {
+	if ttl == 0 {
+		return "", nil
+	}
+
+	c.sessionMutex.Lock()
+	held, ok := c.sessions[key]
+	c.sessionMutex.Unlock()
+
+	if ok && current != nil && current.Session == held.id {
+		if err := c.kv.RenewSession(ctx, held.id); err == nil {
+			return held.id, nil
+		} else if err != errors.NotExists {
+			return "", err
+		}
+	}
+
+	return c.kv.CreateSession(ctx, ttl)
+}
+
+// hold records that the key was written at index with the session, which is
+// empty if the key was written without a TTL or removed. Writes older than
+// the one already recorded are ignored, as they raced with it and lost. The
+// session which no longer holds the key is returned, to be destroyed.
+func (c *consulKeysAPI) hold(key, session string, index uint64) string {
+	c.sessionMutex.Lock()
+	defer c.sessionMutex.Unlock()
+
+	held, ok := c.sessions[key]
+	switch {
+	case ok && held.index > index:
+		if session == held.id {
+			return ""
+		}
+		return session
+	case session == "":
+		delete(c.sessions, key)
+	default:
+		c.sessions[key] = heldSession{id: session, index: index}
+	}
+
+	if held.id == session {
+		return ""
+	}
+
+	return held.id
+}
+
+// destroy destroys the session, if there is one.
+func (c *consulKeysAPI) destroy(ctx context.Context, session string) {
+	if session != "" {
+		c.kv.DestroySession(ctx, session)
+	}
+}
+
+// Delete removes the key, or the key and everything under it if
+// opts.Recursive is set.
+func (c *consulKeysAPI) Delete(ctx context.Context, key string, opts *client.DeleteOptions) (*client.Response, error) {
+	if opts == nil {
+		opts = &client.DeleteOptions{}
+	}
+
+	key = consulKey(key)
+
+	if opts.Recursive {
+		pairs, index, err := c.kv.Get(ctx, key, &consul.QueryOptions{Recurse: true})
+		if err != nil && err != errors.NotExists {
+			return nil, err
+		}
+
+		if len(below(key, pairs)) == 0 {
+			return nil, consulError(client.ErrorCodeKeyNotFound, key, index)
+		}
+
+		ok, _, err := c.kv.Txn(ctx, []*consul.TxnOp{
+			{Verb: consul.VerbDelete, Key: key},
+			{Verb: consul.VerbDeleteTree, Key: key + "/"},
+		})
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, consulError(client.ErrorCodeTestFailed, key, index)
+		}
+
+		c.sessionMutex.Lock()
+		removed := []string{}
+		for held := range c.sessions {
+			if held == key || strings.HasPrefix(held, key+"/") {
+				removed = append(removed, held)
+			}
+		}
+		c.sessionMutex.Unlock()
+
+		for _, held := range removed {
+			c.destroy(ctx, c.hold(held, "", index))
+		}
+
+		return &client.Response{Action: "delete", Node: &client.Node{Key: "/" + key, Dir: true}}, nil
+	}
+
+	if opts.Dir {
+		key += "/"
+	}
+
+	current, index, err := c.get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case current == nil:
+		return nil, consulError(client.ErrorCodeKeyNotFound, key, index)
+	case opts.PrevValue != "" && string(current.Value) != opts.PrevValue:
+		return nil, consulError(client.ErrorCodeTestFailed, key, index)
+	case opts.PrevIndex != 0 && current.ModifyIndex != opts.PrevIndex:
+		return nil, consulError(client.ErrorCodeTestFailed, key, index)
+	}
+
+	ok, _, err := c.kv.Txn(ctx, []*consul.TxnOp{{Verb: consul.VerbDeleteCAS, Key: key, Index: current.ModifyIndex}})
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, consulError(client.ErrorCodeTestFailed, key, index)
+	}
+
+	c.destroy(ctx, c.hold(key, "", current.ModifyIndex))
+
+	return &client.Response{Action: "delete", Node: &client.Node{Key: "/" + strings.TrimSuffix(key, "/")}, PrevNode: pairToNode(current)}, nil
+}
+
+// Create sets the key if it does not exist.
+func (c *consulKeysAPI) Create(ctx context.Context, key, value string) (*client.Response, error) {
+	return c.Set(ctx, key, value, &client.SetOptions{PrevExist: client.PrevNoExist})
+}
+
+// Update sets the key if it exists.
+func (c *consulKeysAPI) Update(ctx context.Context, key, value string) (*client.Response, error) {
+	return c.Set(ctx, key, value, &client.SetOptions{PrevExist: client.PrevExist})
+}
+
+// CreateInOrder creates a key under the directory named as inOrderKey
+// describes, trying another name if the key exists. Keys created with the
+// same TTL share a session, which is renewed each time one is created; they
+// expire together once none has been created for the TTL.
+func (c *consulKeysAPI) CreateInOrder(ctx context.Context, dir, value string, opts *client.CreateInOrderOptions) (*client.Response, error) {
+	if opts == nil {
+		opts = &client.CreateInOrderOptions{}
+	}
+
+	session, err := c.orderedSession(ctx, opts.TTL)
+	if err != nil {
+		return nil, err
+	}
+
+	var key string
+	for i := 0; i < createInOrderRetries; i++ {
+		key = inOrderKey(consulKey(dir))
+
+		op := &consul.TxnOp{Verb: consul.VerbSet, Key: key, Value: []byte(value)}
+		if session != "" {
+			op = &consul.TxnOp{Verb: consul.VerbLock, Key: key, Value: []byte(value), Session: session}
+		}
+
+		ok, pairs, err := c.kv.Txn(ctx, []*consul.TxnOp{{Verb: consul.VerbCheckNotExists, Key: key}, op})
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+
+		resp := &client.Response{Action: "create", Node: pairToNode(pairs[0]), Index: pairs[0].ModifyIndex}
+		resp.Node.Value = value
+
+		return resp, nil
+	}
+
+	return nil, consulError(client.ErrorCodeNodeExist, key, 0)
+}
+
+// orderedSession returns the session shared by keys created in order with the
+// TTL, renewed, or a new one if it has expired. No session is returned if the
+// TTL is zero.
+func (c *consulKeysAPI) orderedSession(ctx context.Context, ttl time.Duration) (string, error) {
+	if ttl == 0 {
+		return "", nil
+	}
+
+	c.sessionMutex.Lock()
+	session, ok := c.ordered[ttl]
+	c.sessionMutex.Unlock()
+
+	if ok {
+		if err := c.kv.RenewSession(ctx, session); err == nil {
+			return session, nil
+		} else if err != errors.NotExists {
+			return "", err
+		}
+	}
+
+	session, err := c.kv.CreateSession(ctx, ttl)
+	if err != nil {
+		return "", err
+	}
+
+	c.sessionMutex.Lock()
+	c.ordered[ttl] = session
+	c.sessionMutex.Unlock()
+
+	return session, nil
+}
+
+// Watcher watches the key with consul blocking queries.
+func (c *consulKeysAPI) Watcher(key string, opts *client.WatcherOptions) client.Watcher {
+	if opts == nil {
+		opts = &client.WatcherOptions{}
+	}
+
+	return &consulWatcher{
+		kv:         c.kv,
+		key:        consulKey(key),
+		recursive:  opts.Recursive,
+		afterIndex: opts.AfterIndex,
+	}
+}
+
+// consulWatcher turns the differences between the results of successive
+// blocking queries into etcd watch responses. Keys which disappear while
+// held by a session are reported as expired, even if they were deleted.
+type consulWatcher struct {
+	kv         *consul.KV
+	key        string
+	recursive  bool
+	afterIndex uint64
+	index      uint64
+	pairs      map[string]*consul.Pair
+	pending    []*client.Response
+}
+
+func (w *consulWatcher) query(ctx context.Context, index uint64) (map[string]*consul.Pair, uint64, error) {
+	pairs, newIndex, err := w.kv.Get(ctx, w.key, &consul.QueryOptions{Recurse: w.recursive, Index: index, Wait: consulWatchWait})
+	if err != nil && err != errors.NotExists {
+		return nil, 0, err
+	}
+
+	if w.recursive {
+		pairs = below(w.key, pairs)
+	}
+
+	result := map[string]*consul.Pair{}
+	for _, pair := range pairs {
+		result[pair.Key] = pair
+	}
+
+	return result, newIndex, nil
+}
+
+// Next returns the next change to the watched keys.
+func (w *consulWatcher) Next(ctx context.Context) (*client.Response, error) {
+	for len(w.pending) == 0 {
+		if w.pairs == nil {
+			pairs, index, err := w.query(ctx, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			// with AfterIndex, changes made since it are sent first. Only the keys
+			// which still exist can be.
+			if w.afterIndex != 0 {
+				for _, key := range sortedKeys(pairs) {
+					if pairs[key].ModifyIndex > w.afterIndex {
+						w.pending = append(w.pending, w.response(nil, pairs[key], index))
+					}
+				}
+			}
+
+			w.pairs, w.index = pairs, index
+			continue
+		}
+
+		pairs, index, err := w.query(ctx, w.index)
+		if err != nil {
+			return nil, err
+		}
+
+		// consul's index may go backwards if its state is restored; start over
+		// in that case, as its documentation recommends.
+		if index < w.index {
+			w.pairs = nil
+			continue
+		}
+
+		for _, key := range sortedKeys(w.pairs) {
+			if _, ok := pairs[key]; !ok {
+				w.pending = append(w.pending, w.response(w.pairs[key], nil, index))
+			}
+		}
+
+		for _, key := range sortedKeys(pairs) {
+			prev := w.pairs[key]
+			if prev == nil || prev.ModifyIndex != pairs[key].ModifyIndex {
+				w.pending = append(w.pending, w.response(prev, pairs[key], index))
+			}
+		}
+
+		w.pairs, w.index = pairs, index
+	}
+
+	resp := w.pending[0]
+	w.pending = w.pending[1:]
+	return resp, nil
+}
+
+func (w *consulWatcher) response(prev, pair *consul.Pair, index uint64) *client.Response {
+	resp := &client.Response{Index: index}
+
+	if prev != nil {
+		resp.PrevNode = pairToNode(prev)
+	}
+
+	switch {
+	case pair == nil && prev.Session != "":
+		resp.Action = "expire"
+		resp.Node = &client.Node{Key: resp.PrevNode.Key, Dir: resp.PrevNode.Dir, ModifiedIndex: index}
+	case pair == nil:
+		resp.Action = "delete"
+		resp.Node = &client.Node{Key: resp.PrevNode.Key, Dir: resp.PrevNode.Dir, ModifiedIndex: index}
+	case prev == nil && pair.CreateIndex == pair.ModifyIndex:
+		resp.Action = "create"
+		resp.Node = pairToNode(pair)
+	default:
+		resp.Action = "set"
+		resp.Node = pairToNode(pair)
+	}
+
+	return resp
+}
+
+func sortedKeys(pairs map[string]*consul.Pair) []string {
+	keys := []string{}
+	for key := range pairs {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,284 @@
+package config
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/db/impl/consul/consultest"
+	"github.com/contiv/volplugin/watch"
+	"github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+type consulSuite struct {
+	server *consultest.Server
+	tlc    *Client
+}
+
+var _ = Suite(&consulSuite{})
+
+func (s *consulSuite) SetUpTest(c *C) {
+	s.server = consultest.NewServer()
+
+	var err error
+	s.tlc, err = NewStoreClient("/volplugin", "consul://"+strings.TrimPrefix(s.server.URL, "http://"), nil)
+	c.Assert(err, IsNil)
+}
+
+func (s *consulSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *consulSuite) keysAPI() *consulKeysAPI {
+	return s.tlc.etcdClient.(tracedKeysAPI).KeysAPI.(*consulKeysAPI)
+}
+
+func (s *consulSuite) TestNewStoreClient(c *C) {
+	for _, store := range []string{"localhost:8500", "zookeeper://localhost:2181", "consul://ftp://localhost"} {
+		_, err := NewStoreClient("/volplugin", store, nil)
+		c.Assert(err, NotNil, Commentf("%q", store))
+	}
+
+	_, err := NewStoreClient("/volplugin", "etcd://127.0.0.1:2379,127.0.0.2:2379", nil)
+	c.Assert(err, IsNil)
+}
+
+func (s *consulSuite) TestGetDirectories(c *C) {
+	ctx := context.Background()
+	api := s.keysAPI()
+
+	resp, err := api.Get(ctx, "/volplugin", nil)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Node.Dir, Equals, true)
+	c.Assert(len(resp.Node.Nodes), Equals, len(defaultPaths))
+
+	_, err = api.Set(ctx, "/volplugin/volumes/policy1/vol1/runtime", "foo", nil)
+	c.Assert(err, IsNil)
+
+	resp, err = api.Get(ctx, "/volplugin/volumes", &client.GetOptions{Recursive: true})
+	c.Assert(err, IsNil)
+	c.Assert(resp.Node.Nodes[0].Key, Equals, "/volplugin/volumes/policy1")
+	c.Assert(resp.Node.Nodes[0].Dir, Equals, true)
+	c.Assert(resp.Node.Nodes[0].Nodes[0].Nodes[0].Value, Equals, "foo")
+
+	resp, err = api.Get(ctx, "/volplugin/volumes", nil)
+	c.Assert(err, IsNil)
+	c.Assert(len(resp.Node.Nodes[0].Nodes), Equals, 0)
+
+	// only the values of the immediate children are read.
+	_, err = api.Set(ctx, "/volplugin/volumes/leaf", "baz", nil)
+	c.Assert(err, IsNil)
+
+	read := s.server.ValuesRead()
+	resp, err = api.Get(ctx, "/volplugin/volumes", nil)
+	c.Assert(err, IsNil)
+	c.Assert(s.server.ValuesRead()-read, Equals, 2)
+	c.Assert(resp.Node.Nodes, HasLen, 2)
+	c.Assert(resp.Node.Nodes[0].Key, Equals, "/volplugin/volumes/leaf")
+	c.Assert(resp.Node.Nodes[0].Value, Equals, "baz")
+	c.Assert(resp.Node.Nodes[1].Key, Equals, "/volplugin/volumes/policy1")
+	c.Assert(resp.Node.Nodes[1].Dir, Equals, true)
+
+	resp, err = api.Get(ctx, "/volplugin/volumes/leaf", nil)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Node.Value, Equals, "baz")
+
+	_, err = api.Get(ctx, "/volplugin/volumes/policy2", nil)
+	c.Assert(err.(client.Error).Code, Equals, client.ErrorCodeKeyNotFound)
+
+	_, err = api.Delete(ctx, "/volplugin/volumes/policy1", &client.DeleteOptions{Recursive: true})
+	c.Assert(err, IsNil)
+	_, err = api.Get(ctx, "/volplugin/volumes/policy1/vol1/runtime", nil)
+	c.Assert(err.(client.Error).Code, Equals, client.ErrorCodeKeyNotFound)
+}
+
+func (s *consulSuite) TestSetConditions(c *C) {
+	ctx := context.Background()
+	api := s.keysAPI()
+
+	_, err := api.Set(ctx, "/volplugin/foo", "bar", &client.SetOptions{PrevExist: client.PrevNoExist})
+	c.Assert(err, IsNil)
+	_, err = api.Set(ctx, "/volplugin/foo", "bar", &client.SetOptions{PrevExist: client.PrevNoExist})
+	c.Assert(err.(client.Error).Code, Equals, client.ErrorCodeNodeExist)
+
+	_, err = api.Set(ctx, "/volplugin/foo", "baz", &client.SetOptions{PrevValue: "quux"})
+	c.Assert(err.(client.Error).Code, Equals, client.ErrorCodeTestFailed)
+	resp, err := api.Set(ctx, "/volplugin/foo", "baz", &client.SetOptions{PrevValue: "bar"})
+	c.Assert(err, IsNil)
+
+	_, err = api.Set(ctx, "/volplugin/foo", "quux", &client.SetOptions{PrevIndex: resp.Node.ModifiedIndex - 1})
+	c.Assert(err.(client.Error).Code, Equals, client.ErrorCodeTestFailed)
+	_, err = api.Set(ctx, "/volplugin/foo", "quux", &client.SetOptions{PrevIndex: resp.Node.ModifiedIndex})
+	c.Assert(err, IsNil)
+
+	_, err = api.Update(ctx, "/volplugin/bar", "quux")
+	c.Assert(err.(client.Error).Code, Equals, client.ErrorCodeKeyNotFound)
+
+	_, err = api.Delete(ctx, "/volplugin/foo", &client.DeleteOptions{PrevValue: "baz"})
+	c.Assert(err.(client.Error).Code, Equals, client.ErrorCodeTestFailed)
+	_, err = api.Delete(ctx, "/volplugin/foo", &client.DeleteOptions{PrevValue: "quux"})
+	c.Assert(err, IsNil)
+	_, err = api.Delete(ctx, "/volplugin/foo", nil)
+	c.Assert(err.(client.Error).Code, Equals, client.ErrorCodeKeyNotFound)
+}
+
+func (s *consulSuite) TestUseCRUD(c *C) {
+	c.Assert(s.tlc.PublishUse(testUseMounts["basic"]), IsNil)
+	c.Assert(s.tlc.PublishUse(testUseMounts["basic"]), IsNil)
+	c.Assert(s.tlc.PublishUse(testUseMounts["basic-newhost"]), NotNil)
+	c.Assert(s.tlc.PublishUse(testUseMounts["basic2"]), IsNil)
+
+	mt := &UseMount{}
+	c.Assert(s.tlc.GetUse(mt, testUseVolumes["basic"]), IsNil)
+	c.Assert(mt, DeepEquals, testUseMounts["basic"])
+
+	mounts, err := s.tlc.ListUses("mount")
+	c.Assert(err, IsNil)
+	sort.Strings(mounts)
+	c.Assert(mounts, DeepEquals, []string{"policy1/quux", "policy2/baz"})
+
+	c.Assert(s.tlc.RemoveUse(testUseMounts["basic-newhost"], false), NotNil)
+	c.Assert(s.tlc.RemoveUse(testUseMounts["basic"], false), IsNil)
+	c.Assert(s.tlc.GetUse(mt, testUseVolumes["basic"]), NotNil)
+}
+
+func (s *consulSuite) TestUseWithTTL(c *C) {
+	c.Assert(s.tlc.PublishUseWithTTL(testUseMounts["basic"], time.Second), IsNil)
+	c.Assert(s.tlc.PublishUseWithTTL(testUseMounts["basic"], time.Second), IsNil)
+	c.Assert(s.tlc.PublishUseWithTTL(testUseMounts["basic-newhost"], time.Second), NotNil)
+
+	// the same session is renewed while the lock is refreshed.
+	sessions := s.server.Sessions()
+	c.Assert(len(sessions), Equals, 1)
+
+	s.server.Expire(sessions[0])
+	c.Assert(s.tlc.GetUse(&UseMount{}, testUseVolumes["basic"]), NotNil)
+
+	c.Assert(s.tlc.PublishUseWithTTL(testUseMounts["basic-newhost"], time.Second), IsNil)
+	c.Assert(s.tlc.RemoveUse(testUseMounts["basic-newhost"], false), IsNil)
+	c.Assert(len(s.server.Sessions()), Equals, 0)
+
+	// a key set without a TTL no longer expires.
+	c.Assert(s.tlc.PublishUseWithTTL(testUseMounts["basic"], time.Second), IsNil)
+	c.Assert(s.tlc.PublishUse(testUseMounts["basic"]), IsNil)
+	c.Assert(len(s.server.Sessions()), Equals, 0)
+	c.Assert(s.tlc.GetUse(&UseMount{}, testUseVolumes["basic"]), IsNil)
+}
+
+func (s *consulSuite) TestWatcher(c *C) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	api := s.keysAPI()
+	_, err := api.Set(ctx, "/volplugin/nodes/host1", "before", nil)
+	c.Assert(err, IsNil)
+
+	watcher := api.Watcher("/volplugin/nodes", &client.WatcherOptions{Recursive: true})
+	next := make(chan *client.Response)
+	go func() {
+		for {
+			resp, err := watcher.Next(ctx)
+			if err != nil {
+				close(next)
+				return
+			}
+			next <- resp
+		}
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	_, err = api.Set(ctx, "/volplugin/nodes/host1", "after", nil)
+	c.Assert(err, IsNil)
+	resp := <-next
+	c.Assert(resp.Action, Equals, "set")
+	c.Assert(resp.Node.Value, Equals, "after")
+	c.Assert(resp.PrevNode.Value, Equals, "before")
+
+	_, err = api.Set(ctx, "/volplugin/nodes/host2", "new", &client.SetOptions{TTL: time.Second})
+	c.Assert(err, IsNil)
+	resp = <-next
+	c.Assert(resp.Action, Equals, "create")
+	c.Assert(resp.Node.Key, Equals, "/volplugin/nodes/host2")
+
+	s.server.Expire(s.server.Sessions()[0])
+	resp = <-next
+	c.Assert(resp.Action, Equals, "expire")
+	c.Assert(resp.Node.Key, Equals, "/volplugin/nodes/host2")
+
+	_, err = api.Delete(ctx, "/volplugin/nodes/host1", nil)
+	c.Assert(err, IsNil)
+	resp = <-next
+	c.Assert(resp.Action, Equals, "delete")
+
+	cancel()
+	_, ok := <-next
+	c.Assert(ok, Equals, false)
+}
+
+func (s *consulSuite) TestEventLog(c *C) {
+	_, index, err := s.tlc.ListEvents("")
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	followed := make(chan *Event, 2)
+	go s.tlc.WatchEvents(ctx, index, "policy1/bar", followed)
+
+	c.Assert(s.tlc.PublishEvent(NewEvent(EventCreated, "policy1/foo", "host1", "")), IsNil)
+	c.Assert(s.tlc.PublishEvent(NewEvent(EventCreated, "policy1/bar", "host1", "")), IsNil)
+
+	events, _, err := s.tlc.ListEvents("")
+	c.Assert(err, IsNil)
+	c.Assert(len(events), Equals, 2)
+	c.Assert(events[0].Volume, Equals, "policy1/foo")
+
+	select {
+	case ev := <-followed:
+		c.Assert(ev.Volume, Equals, "policy1/bar")
+	case <-time.After(5 * time.Second):
+		c.Fatal("event was not followed")
+	}
+
+	// events from a host whose clock is behind are still listed in the order
+	// they were published.
+	_, err = s.keysAPI().Set(ctx, "/volplugin/events/00000000000000000001", `{"volume":"policy1/baz"}`, nil)
+	c.Assert(err, IsNil)
+
+	events, _, err = s.tlc.ListEvents("")
+	c.Assert(err, IsNil)
+	c.Assert(len(events), Equals, 3)
+	c.Assert(events[0].Volume, Equals, "policy1/foo")
+	c.Assert(events[2].Volume, Equals, "policy1/baz")
+
+	// events share one session, which is replaced once it expires.
+	sessions := s.server.Sessions()
+	c.Assert(len(sessions), Equals, 1)
+
+	s.server.Expire(sessions[0])
+	c.Assert(s.tlc.PublishEvent(NewEvent(EventCreated, "policy1/foo", "host1", "")), IsNil)
+	c.Assert(len(s.server.Sessions()), Equals, 1)
+	c.Assert(s.server.Sessions()[0], Not(Equals), sessions[0])
+}
+
+func (s *consulSuite) TestWatchVolumes(c *C) {
+	c.Assert(s.tlc.PublishPolicy("policy1", testPolicies["basic"]), IsNil)
+	volumeChan := make(chan *watch.Watch)
+	s.tlc.WatchVolumeRuntimes(volumeChan)
+	defer watch.Stop(s.tlc.prefixed(rootVolume))
+
+	vol, err := s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "test"})
+	c.Assert(err, IsNil)
+	c.Assert(s.tlc.PublishVolume(vol), IsNil)
+
+	select {
+	case vol2 := <-volumeChan:
+		c.Assert(vol2.Key, Equals, "policy1/test")
+	case <-time.After(5 * time.Second):
+		c.Fatal("volume was not watched")
+	}
+}
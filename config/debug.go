@@ -0,0 +1,119 @@
+package config
+
+import (
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/contiv/volplugin/errors"
+	"github.com/coreos/etcd/client"
+
+	"golang.org/x/net/context"
+)
+
+// DebugTTL is how long debug bundle requests, and the reports answering
+// them, are kept.
+const DebugTTL = 5 * time.Minute
+
+// DebugReport is a host's answer to a debug bundle request: the files it
+// contributes to the bundle, by name.
+type DebugReport struct {
+	Hostname string            `json:"hostname"`
+	Files    map[string]string `json:"files"`
+	Time     time.Time         `json:"time"`
+}
+
+// DebugRequest asks the volplugins for their debug reports. Their recent log
+// lines are only included if Logs is set.
+type DebugRequest struct {
+	ID   string    `json:"-"`
+	Time time.Time `json:"time"`
+	Logs bool      `json:"logs"`
+}
+
+// RequestDebugReports asks the volplugins watching for debug bundle requests
+// to publish their reports, and returns the ID of the request.
+func (c *Client) RequestDebugReports(logs bool) (string, error) {
+	content, err := json.Marshal(&DebugRequest{Time: time.Now(), Logs: logs})
+	if err != nil {
+		return "", errors.DebugReport.Combine(err)
+	}
+
+	resp, err := c.etcdClient.CreateInOrder(c.Context(), c.prefixed(rootDebug, "requests"), string(content), &client.CreateInOrderOptions{TTL: DebugTTL})
+	if err != nil {
+		return "", errors.DebugReport.Combine(errors.EtcdToErrored(err))
+	}
+
+	return path.Base(resp.Node.Key), nil
+}
+
+// WatchDebugRequests sends the debug bundle requests made from now on to the
+// channel until the context is canceled.
+func (c *Client) WatchDebugRequests(ctx context.Context, requests chan<- *DebugRequest) error {
+	watcher := c.etcdClient.Watcher(c.prefixed(rootDebug, "requests"), &client.WatcherOptions{Recursive: true})
+
+	for {
+		resp, err := watcher.Next(ctx)
+		if err != nil {
+			if err == context.Canceled {
+				return nil
+			}
+
+			return errors.DebugReport.Combine(errors.EtcdToErrored(err))
+		}
+
+		if resp.Action != "create" {
+			continue
+		}
+
+		// requests of older apiservers hold just the time, and get no logs.
+		request := &DebugRequest{}
+		if err := json.Unmarshal([]byte(resp.Node.Value), request); err != nil {
+			request = &DebugRequest{}
+		}
+		request.ID = path.Base(resp.Node.Key)
+
+		select {
+		case requests <- request:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// PublishDebugReport publishes the host's report for the debug bundle request.
+func (c *Client) PublishDebugReport(id string, report *DebugReport) error {
+	content, err := json.Marshal(report)
+	if err != nil {
+		return errors.DebugReport.Combine(err)
+	}
+
+	if _, err := c.etcdClient.Set(c.Context(), c.prefixed(rootDebug, "reports", id, report.Hostname), string(content), &client.SetOptions{TTL: DebugTTL}); err != nil {
+		return errors.DebugReport.Combine(errors.EtcdToErrored(err))
+	}
+
+	return nil
+}
+
+// ListDebugReports lists the reports published for the debug bundle request.
+func (c *Client) ListDebugReports(id string) ([]*DebugReport, error) {
+	resp, err := c.etcdClient.Get(c.Context(), c.prefixed(rootDebug, "reports", id), &client.GetOptions{Sort: true, Recursive: true})
+	if er, ok := err.(client.Error); ok && er.Code == client.ErrorCodeKeyNotFound {
+		return []*DebugReport{}, nil
+	} else if err != nil {
+		return nil, errors.DebugReport.Combine(errors.EtcdToErrored(err))
+	}
+
+	reports := []*DebugReport{}
+
+	for _, node := range resp.Node.Nodes {
+		report := &DebugReport{}
+		if err := json.Unmarshal([]byte(node.Value), report); err != nil {
+			return nil, errors.DebugReport.Combine(err)
+		}
+
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"golang.org/x/net/context"
+)
+
+func (s *configSuite) TestDebugReports(c *C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	requests := make(chan *DebugRequest, 1)
+	errChan := make(chan error, 1)
+	go func() { errChan <- s.tlc.WatchDebugRequests(ctx, requests) }()
+	time.Sleep(100 * time.Millisecond)
+
+	id, err := s.tlc.RequestDebugReports(true)
+	c.Assert(err, IsNil)
+
+	select {
+	case got := <-requests:
+		c.Assert(got.ID, Equals, id)
+		c.Assert(got.Logs, Equals, true)
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out watching debug requests")
+	}
+
+	reports, err := s.tlc.ListDebugReports(id)
+	c.Assert(err, IsNil)
+	c.Assert(len(reports), Equals, 0)
+
+	for _, host := range []string{"host1", "host2"} {
+		report := &DebugReport{Hostname: host, Files: map[string]string{"version": "1.0"}, Time: time.Now()}
+		c.Assert(s.tlc.PublishDebugReport(id, report), IsNil)
+	}
+
+	reports, err = s.tlc.ListDebugReports(id)
+	c.Assert(err, IsNil)
+	c.Assert(len(reports), Equals, 2)
+	c.Assert(reports[0].Hostname, Equals, "host1")
+	c.Assert(reports[1].Files["version"], Equals, "1.0")
+
+	cancel()
+	c.Assert(<-errChan, IsNil)
+}
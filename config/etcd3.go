@@ -0,0 +1,598 @@
+package config
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/contiv/volplugin/db/impl/etcd3"
+	"github.com/contiv/volplugin/errors"
+	"github.com/coreos/etcd/client"
+
+	// see trace.go.
+	"github.com/coreos/etcd/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+// etcd3KeysAPI implements etcd's v2 KeysAPI on top of its v3 API, so the
+// rest of the package can use either. Keys are the same as in v2 and
+// directories are laid out as described in flat.go.
+//
+// Each key set with a TTL gets a lease of its own, which is not kept alive.
+// It is revoked once this client overwrites or removes the key. Keys set with
+// SetLeased share one lease per TTL which is kept alive for as long as the
+// process runs. grantedMutex only guards the map; it is never held while
+// talking to etcd.
+type etcd3KeysAPI struct {
+	kv           *etcd3.KV
+	leases       *etcd3.Leases
+	granted      map[string]grantedLease
+	grantedMutex sync.Mutex
+}
+
+// grantedLease is the lease a key was last set with by this client, and the
+// revision of that write.
+type grantedLease struct {
+	id       int64
+	revision int64
+}
+
+func newEtcd3KeysAPI(address string) (*etcd3KeysAPI, error) {
+	kv, err := etcd3.NewKV(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &etcd3KeysAPI{kv: kv, leases: etcd3.NewLeases(kv), granted: map[string]grantedLease{}}, nil
+}
+
+func etcd3Key(key string) string {
+	return "/" + strings.Trim(key, "/")
+}
+
+func etcd3Error(code int, key string, revision int64) error {
+	return client.Error{Code: code, Message: errorMessages[code], Cause: key, Index: uint64(revision)}
+}
+
+func kvToNode(kv *etcd3.KeyValue) *client.Node {
+	node := &client.Node{
+		Key:           strings.TrimSuffix(string(kv.Key), "/"),
+		Value:         string(kv.Value),
+		CreatedIndex:  uint64(kv.CreateRevision),
+		ModifiedIndex: uint64(kv.ModRevision),
+	}
+
+	if strings.HasSuffix(string(kv.Key), "/") {
+		node.Dir = true
+		node.Value = ""
+	}
+
+	return node
+}
+
+// subtree returns the range of key and every key under it. Keys which only
+// share a prefix with key are in the range, too, and must be filtered out.
+func subtree(key string) *etcd3.RangeRequest {
+	return &etcd3.RangeRequest{Key: []byte(key), RangeEnd: etcd3.PrefixEnd([]byte(key + "/"))}
+}
+
+func underKey(key string, kv *etcd3.KeyValue) bool {
+	return string(kv.Key) == key || strings.HasPrefix(string(kv.Key), key+"/")
+}
+
+// maxTxnOps is the number of operations etcd allows in a transaction by
+// default.
+const maxTxnOps = 128
+
+// Get builds the node of the key out of it and the keys under it. Only the
+// immediate children of a directory are returned unless opts.Recursive is
+// set; the keys under it are then listed without their values, and only the
+// values of the immediate children are read.
+func (e *etcd3KeysAPI) Get(ctx context.Context, key string, opts *client.GetOptions) (*client.Response, error) {
+	if opts == nil {
+		opts = &client.GetOptions{}
+	}
+
+	key = etcd3Key(key)
+	req := subtree(key)
+	req.KeysOnly = !opts.Recursive
+
+	resp, err := e.kv.Range(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	kvs := resp.Kvs
+	revision := resp.Header.Revision
+
+	if !opts.Recursive {
+		if kvs, revision, err = e.childValues(ctx, key, kvs, revision); err != nil {
+			return nil, err
+		}
+	}
+
+	nodes := []*client.Node{}
+	for _, kv := range kvs {
+		if underKey(key, kv) {
+			nodes = append(nodes, kvToNode(kv))
+		}
+	}
+
+	index := uint64(revision)
+
+	switch {
+	case len(nodes) == 0:
+		return nil, etcd3Error(client.ErrorCodeKeyNotFound, key, revision)
+	case len(nodes) == 1 && nodes[0].Key == key && !nodes[0].Dir:
+		return &client.Response{Action: "get", Node: nodes[0], Index: index}, nil
+	default:
+		return &client.Response{Action: "get", Node: nodeTree(key, nodes, opts.Recursive), Index: index}, nil
+	}
+}
+
+// childValues reads the values of the key and its immediate children out of
+// the keys of a range made without values. Adjacent children are read with
+// one range, in as few transactions as etcd allows. Children removed since
+// they were listed are left out.
+func (e *etcd3KeysAPI) childValues(ctx context.Context, key string, kvs []*etcd3.KeyValue, revision int64) ([]*etcd3.KeyValue, int64, error) {
+	isChild := func(kv *etcd3.KeyValue) bool {
+		name := string(kv.Key)
+		if !underKey(key, kv) || strings.HasSuffix(name, "/") {
+			return false
+		}
+
+		return name == key || !strings.Contains(strings.TrimPrefix(name, key+"/"), "/")
+	}
+
+	ranges := []*etcd3.RequestOp{}
+	var run *etcd3.RangeRequest
+	for _, kv := range kvs {
+		if !isChild(kv) {
+			run = nil
+			continue
+		}
+
+		if run == nil {
+			run = &etcd3.RangeRequest{Key: kv.Key}
+			ranges = append(ranges, &etcd3.RequestOp{RequestRange: run})
+		}
+		run.RangeEnd = append(append([]byte{}, kv.Key...), 0)
+	}
+
+	values := map[string]*etcd3.KeyValue{}
+	for len(ranges) > 0 {
+		ops := ranges
+		if len(ops) > maxTxnOps {
+			ops = ops[:maxTxnOps]
+		}
+		ranges = ranges[len(ops):]
+
+		resp, err := e.kv.Txn(ctx, &etcd3.TxnRequest{Success: ops})
+		if err != nil {
+			return nil, 0, err
+		}
+
+		revision = resp.Header.Revision
+		for _, op := range resp.Responses {
+			if op.ResponseRange == nil {
+				continue
+			}
+
+			for _, kv := range op.ResponseRange.Kvs {
+				values[string(kv.Key)] = kv
+			}
+		}
+	}
+
+	result := []*etcd3.KeyValue{}
+	for _, kv := range kvs {
+		if !isChild(kv) {
+			result = append(result, kv)
+		} else if value, ok := values[string(kv.Key)]; ok {
+			result = append(result, value)
+		}
+	}
+
+	return result, revision, nil
+}
+
+// compares returns the conditions of opts as a transaction's.
+func compares(key []byte, opts *client.SetOptions) []*etcd3.Compare {
+	cmps := []*etcd3.Compare{}
+
+	switch opts.PrevExist {
+	case client.PrevNoExist:
+		cmps = append(cmps, &etcd3.Compare{Key: key, Target: etcd3.TargetCreate, Result: etcd3.CompareEqual, CreateRevision: 0})
+	case client.PrevExist:
+		cmps = append(cmps, &etcd3.Compare{Key: key, Target: etcd3.TargetCreate, Result: etcd3.CompareGreater, CreateRevision: 0})
+	}
+
+	if opts.PrevValue != "" {
+		cmps = append(cmps, &etcd3.Compare{Key: key, Target: etcd3.TargetValue, Result: etcd3.CompareEqual, Value: []byte(opts.PrevValue)})
+	}
+
+	if opts.PrevIndex != 0 {
+		cmps = append(cmps, &etcd3.Compare{Key: key, Target: etcd3.TargetMod, Result: etcd3.CompareEqual, ModRevision: int64(opts.PrevIndex)})
+	}
+
+	return cmps
+}
+
+// txnError works out why a transaction guarded by compares failed, from the
+// range of the key it ran on failure.
+func txnError(key string, opts *client.SetOptions, resp *etcd3.TxnResponse) error {
+	exists := len(resp.Responses) > 0 && resp.Responses[0].ResponseRange != nil && len(resp.Responses[0].ResponseRange.Kvs) > 0
+
+	switch {
+	case exists && opts.PrevExist == client.PrevNoExist:
+		return etcd3Error(client.ErrorCodeNodeExist, key, resp.Header.Revision)
+	case !exists:
+		return etcd3Error(client.ErrorCodeKeyNotFound, key, resp.Header.Revision)
+	default:
+		return etcd3Error(client.ErrorCodeTestFailed, key, resp.Header.Revision)
+	}
+}
+
+// Set writes the key if the conditions of opts hold, in one transaction.
+func (e *etcd3KeysAPI) Set(ctx context.Context, key, value string, opts *client.SetOptions) (*client.Response, error) {
+	if opts == nil {
+		opts = &client.SetOptions{}
+	}
+
+	var lease int64
+	if opts.TTL != 0 {
+		var err error
+		if lease, err = e.kv.Grant(ctx, opts.TTL); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := e.set(ctx, key, value, lease, opts)
+	if err != nil {
+		e.revoke(ctx, lease)
+		return nil, err
+	}
+
+	// the key is no longer on a lease kept alive, nor on the one granted when
+	// it was last set.
+	e.leases.Release([]byte(etcd3Key(key)), false)
+	e.revoke(ctx, e.hold(etcd3Key(key), lease, int64(resp.Index)))
+
+	return resp, nil
+}
+
+// hold records that the key was written at revision with the lease granted
+// for it, which is zero if the key was written without one or removed. Writes
+// older than the one already recorded are ignored, as they raced with it and
+// lost. The lease which no longer holds the key is returned, to be revoked.
+func (e *etcd3KeysAPI) hold(key string, lease, revision int64) int64 {
+	e.grantedMutex.Lock()
+	defer e.grantedMutex.Unlock()
+
+	held, ok := e.granted[key]
+	switch {
+	case ok && held.revision > revision:
+		if lease == held.id {
+			return 0
+		}
+		return lease
+	case lease == 0:
+		delete(e.granted, key)
+	default:
+		e.granted[key] = grantedLease{id: lease, revision: revision}
+	}
+
+	if held.id == lease {
+		return 0
+	}
+
+	return held.id
+}
+
+// revoke revokes the lease, if there is one. A lease granted for a key holds
+// no other, so revoking it once the key is gone from it removes nothing.
+// Failures are ignored, as the lease expires after its TTL anyway.
+func (e *etcd3KeysAPI) revoke(ctx context.Context, lease int64) {
+	if lease != 0 {
+		e.kv.Revoke(ctx, lease)
+	}
+}
+
+// SetLeased is Set, but the key is attached to the lease kept alive for
+// opts.TTL instead of expiring after it.
+func (e *etcd3KeysAPI) SetLeased(ctx context.Context, key, value string, opts *client.SetOptions) (*client.Response, error) {
+	lease, err := e.leases.Get(opts.TTL)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := e.set(ctx, key, value, lease, opts)
+	if err == errors.NotExists {
+		// the lease expired before it was found to be gone; try again with a
+		// new one. The key is set below, so it is not put back with the others.
+		e.leases.Release([]byte(etcd3Key(key)), false)
+		if lease, err = e.leases.Renew(opts.TTL, lease); err != nil {
+			return nil, err
+		}
+
+		resp, err = e.set(ctx, key, value, lease, opts)
+	}
+
+	if err == nil {
+		e.leases.Hold(opts.TTL, []byte(etcd3Key(key)), []byte(value))
+		e.revoke(ctx, e.hold(etcd3Key(key), 0, int64(resp.Index)))
+	}
+
+	return resp, err
+}
+
+func (e *etcd3KeysAPI) set(ctx context.Context, key, value string, lease int64, opts *client.SetOptions) (*client.Response, error) {
+	key = etcd3Key(key)
+	if opts.Dir {
+		key += "/"
+		value = ""
+	}
+
+	put := &etcd3.PutRequest{Key: []byte(key), Value: []byte(value), Lease: lease, PrevKV: true}
+	cmps := compares(put.Key, opts)
+
+	// setting a directory which exists is not an error, but must not touch it.
+	if opts.Dir && len(cmps) == 0 {
+		cmps = compares(put.Key, &client.SetOptions{PrevExist: client.PrevNoExist})
+	}
+
+	resp, err := e.kv.Txn(ctx, &etcd3.TxnRequest{
+		Compare: cmps,
+		Success: []*etcd3.RequestOp{{RequestPut: put}},
+		Failure: []*etcd3.RequestOp{{RequestRange: &etcd3.RangeRequest{Key: put.Key}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Succeeded {
+		if opts.Dir && opts.PrevExist != client.PrevNoExist {
+			return &client.Response{Action: "set", Node: &client.Node{Key: strings.TrimSuffix(key, "/"), Dir: true}, Index: uint64(resp.Header.Revision)}, nil
+		}
+
+		return nil, txnError(key, opts, resp)
+	}
+
+	node := kvToNode(&etcd3.KeyValue{Key: put.Key, Value: put.Value, ModRevision: resp.Header.Revision})
+	result := &client.Response{Action: "set", Node: node, Index: uint64(resp.Header.Revision)}
+
+	if prev := resp.Responses[0].ResponsePut.PrevKV; prev != nil {
+		result.PrevNode = kvToNode(prev)
+		node.CreatedIndex = uint64(prev.CreateRevision)
+	} else {
+		node.CreatedIndex = node.ModifiedIndex
+		if opts.PrevExist == client.PrevNoExist {
+			result.Action = "create"
+		}
+	}
+
+	return result, nil
+}
+
+// Delete removes the key, or the key and everything under it if
+// opts.Recursive is set.
+func (e *etcd3KeysAPI) Delete(ctx context.Context, key string, opts *client.DeleteOptions) (*client.Response, error) {
+	if opts == nil {
+		opts = &client.DeleteOptions{}
+	}
+
+	key = etcd3Key(key)
+
+	if opts.Recursive {
+		resp, err := e.kv.Txn(ctx, &etcd3.TxnRequest{
+			Success: []*etcd3.RequestOp{
+				{RequestDeleteRange: &etcd3.DeleteRangeRequest{Key: []byte(key)}},
+				{RequestDeleteRange: &etcd3.DeleteRangeRequest{Key: []byte(key + "/"), RangeEnd: etcd3.PrefixEnd([]byte(key + "/"))}},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var deleted int64
+		for _, op := range resp.Responses {
+			deleted += op.ResponseDeleteRange.Deleted
+		}
+
+		if deleted == 0 {
+			return nil, etcd3Error(client.ErrorCodeKeyNotFound, key, resp.Header.Revision)
+		}
+
+		e.leases.Release([]byte(key), false)
+		e.leases.Release([]byte(key+"/"), true)
+
+		e.grantedMutex.Lock()
+		removed := []string{}
+		for held := range e.granted {
+			if held == key || strings.HasPrefix(held, key+"/") {
+				removed = append(removed, held)
+			}
+		}
+		e.grantedMutex.Unlock()
+
+		for _, held := range removed {
+			e.revoke(ctx, e.hold(held, 0, resp.Header.Revision))
+		}
+
+		return &client.Response{Action: "delete", Node: &client.Node{Key: key, Dir: true}, Index: uint64(resp.Header.Revision)}, nil
+	}
+
+	if opts.Dir {
+		key += "/"
+	}
+
+	setOpts := &client.SetOptions{PrevExist: client.PrevExist, PrevValue: opts.PrevValue, PrevIndex: opts.PrevIndex}
+	resp, err := e.kv.Txn(ctx, &etcd3.TxnRequest{
+		Compare: compares([]byte(key), setOpts),
+		Success: []*etcd3.RequestOp{{RequestDeleteRange: &etcd3.DeleteRangeRequest{Key: []byte(key), PrevKV: true}}},
+		Failure: []*etcd3.RequestOp{{RequestRange: &etcd3.RangeRequest{Key: []byte(key)}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Succeeded {
+		return nil, txnError(key, setOpts, resp)
+	}
+
+	e.leases.Release([]byte(key), false)
+	e.revoke(ctx, e.hold(key, 0, resp.Header.Revision))
+
+	result := &client.Response{Action: "delete", Node: &client.Node{Key: strings.TrimSuffix(key, "/"), Dir: opts.Dir}, Index: uint64(resp.Header.Revision)}
+	if prev := resp.Responses[0].ResponseDeleteRange.PrevKvs; len(prev) > 0 {
+		result.PrevNode = kvToNode(prev[0])
+	}
+
+	return result, nil
+}
+
+// Create sets the key if it does not exist.
+func (e *etcd3KeysAPI) Create(ctx context.Context, key, value string) (*client.Response, error) {
+	return e.Set(ctx, key, value, &client.SetOptions{PrevExist: client.PrevNoExist})
+}
+
+// Update sets the key if it exists.
+func (e *etcd3KeysAPI) Update(ctx context.Context, key, value string) (*client.Response, error) {
+	return e.Set(ctx, key, value, &client.SetOptions{PrevExist: client.PrevExist})
+}
+
+// CreateInOrder creates a key under the directory named as inOrderKey
+// describes, trying another name if the key exists.
+func (e *etcd3KeysAPI) CreateInOrder(ctx context.Context, dir, value string, opts *client.CreateInOrderOptions) (*client.Response, error) {
+	if opts == nil {
+		opts = &client.CreateInOrderOptions{}
+	}
+
+	var err error
+	for i := 0; i < createInOrderRetries; i++ {
+		var resp *client.Response
+		resp, err = e.Set(ctx, inOrderKey(etcd3Key(dir)), value, &client.SetOptions{PrevExist: client.PrevNoExist, TTL: opts.TTL})
+		if er, ok := err.(client.Error); !ok || er.Code != client.ErrorCodeNodeExist {
+			return resp, err
+		}
+	}
+
+	return nil, err
+}
+
+// CreateAll creates the keys in one transaction. A key which exists is only
+// allowed if it may exist and holds the value to be created.
+func (e *etcd3KeysAPI) CreateAll(ctx context.Context, creates []*createRequest) error {
+	txn := &etcd3.TxnRequest{}
+
+	for _, create := range creates {
+		key := []byte(etcd3Key(create.Key))
+
+		current, _, err := e.kv.Get(ctx, key)
+		switch {
+		case err == errors.NotExists:
+			txn.Compare = append(txn.Compare, &etcd3.Compare{Key: key, Target: etcd3.TargetCreate, Result: etcd3.CompareEqual, CreateRevision: 0})
+			txn.Success = append(txn.Success, &etcd3.RequestOp{RequestPut: &etcd3.PutRequest{Key: key, Value: []byte(create.Value)}})
+		case err != nil:
+			return err
+		case create.MayExist && string(current.Value) == create.Value:
+			txn.Compare = append(txn.Compare, &etcd3.Compare{Key: key, Target: etcd3.TargetMod, Result: etcd3.CompareEqual, ModRevision: current.ModRevision})
+		default:
+			return etcd3Error(client.ErrorCodeNodeExist, string(key), 0)
+		}
+	}
+
+	resp, err := e.kv.Txn(ctx, txn)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Succeeded {
+		return etcd3Error(client.ErrorCodeTestFailed, creates[0].Key, resp.Header.Revision)
+	}
+
+	return nil
+}
+
+// Watcher watches the key with a v3 watch.
+func (e *etcd3KeysAPI) Watcher(key string, opts *client.WatcherOptions) client.Watcher {
+	if opts == nil {
+		opts = &client.WatcherOptions{}
+	}
+
+	w := &etcd3Watcher{kv: e.kv, key: etcd3Key(key), recursive: opts.Recursive}
+	if opts.AfterIndex != 0 {
+		w.next = int64(opts.AfterIndex) + 1
+	}
+
+	return w
+}
+
+// etcd3Watcher turns the events of a v3 watch into v2 watch responses. Keys
+// attached to a lease which are deleted are reported as expired, even if
+// they were deleted before their lease expired.
+type etcd3Watcher struct {
+	kv        *etcd3.KV
+	key       string
+	recursive bool
+	next      int64
+	respChan  <-chan *etcd3.WatchResponse
+	errChan   <-chan error
+	pending   []*client.Response
+}
+
+// Next returns the next change to the watched keys. The watch is made with
+// the context of the first call, and again if it fails.
+func (w *etcd3Watcher) Next(ctx context.Context) (*client.Response, error) {
+	for len(w.pending) == 0 {
+		if w.respChan == nil {
+			req := &etcd3.RangeRequest{Key: []byte(w.key)}
+			if w.recursive {
+				req = subtree(w.key)
+			}
+			w.respChan, w.errChan = w.kv.Watch(ctx, req.Key, req.RangeEnd, w.next)
+		}
+
+		var resp *etcd3.WatchResponse
+		select {
+		case resp = <-w.respChan:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if resp == nil {
+			w.respChan = nil
+			return nil, <-w.errChan
+		}
+
+		for _, ev := range resp.Events {
+			if underKey(w.key, ev.Kv) {
+				w.pending = append(w.pending, eventToResponse(ev, resp.Header.Revision))
+			}
+		}
+
+		w.next = resp.Header.Revision + 1
+	}
+
+	resp := w.pending[0]
+	w.pending = w.pending[1:]
+	return resp, nil
+}
+
+func eventToResponse(ev *etcd3.Event, revision int64) *client.Response {
+	resp := &client.Response{Index: uint64(revision), Node: kvToNode(ev.Kv)}
+	if ev.PrevKv != nil {
+		resp.PrevNode = kvToNode(ev.PrevKv)
+	}
+
+	switch {
+	case ev.Type == etcd3.EventDelete && ev.PrevKv != nil && ev.PrevKv.Lease != 0:
+		resp.Action = "expire"
+	case ev.Type == etcd3.EventDelete:
+		resp.Action = "delete"
+	case ev.Kv.Version == 1:
+		resp.Action = "create"
+	default:
+		resp.Action = "set"
+	}
+
+	return resp
+}
@@ -0,0 +1,335 @@
+package config
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db/impl/etcd3/etcd3test"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/watch"
+	"github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+type etcd3Suite struct {
+	server *etcd3test.Server
+	tlc    *Client
+}
+
+var _ = Suite(&etcd3Suite{})
+
+func (s *etcd3Suite) SetUpTest(c *C) {
+	s.server = etcd3test.NewServer()
+
+	var err error
+	s.tlc, err = NewStoreClient("/volplugin", "etcd3://"+strings.TrimPrefix(s.server.URL, "http://"), nil)
+	c.Assert(err, IsNil)
+}
+
+func (s *etcd3Suite) TearDownTest(c *C) {
+	s.keysAPI().leases.Close()
+	s.server.Close()
+}
+
+func (s *etcd3Suite) keysAPI() *etcd3KeysAPI {
+	return s.tlc.etcdClient.(tracedKeysAPI).KeysAPI.(*etcd3KeysAPI)
+}
+
+func (s *etcd3Suite) TestNewStoreClient(c *C) {
+	_, err := NewStoreClient("/volplugin", "etcd3://127.0.0.1:2379,127.0.0.2:2379", nil)
+	c.Assert(err, NotNil)
+	c.Assert(s.tlc.KeepsUsesAlive(), Equals, true)
+}
+
+func (s *etcd3Suite) TestGetDirectories(c *C) {
+	ctx := context.Background()
+	api := s.keysAPI()
+
+	resp, err := api.Get(ctx, "/volplugin", nil)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Node.Dir, Equals, true)
+	c.Assert(len(resp.Node.Nodes), Equals, len(defaultPaths))
+
+	_, err = api.Set(ctx, "/volplugin/volumes/policy1/vol1/runtime", "foo", nil)
+	c.Assert(err, IsNil)
+
+	// a key which only shares a prefix with the directory is not in it.
+	_, err = api.Set(ctx, "/volplugin/volumes-old", "bar", nil)
+	c.Assert(err, IsNil)
+
+	resp, err = api.Get(ctx, "/volplugin/volumes", &client.GetOptions{Recursive: true})
+	c.Assert(err, IsNil)
+	c.Assert(len(resp.Node.Nodes), Equals, 1)
+	c.Assert(resp.Node.Nodes[0].Key, Equals, "/volplugin/volumes/policy1")
+	c.Assert(resp.Node.Nodes[0].Dir, Equals, true)
+	c.Assert(resp.Node.Nodes[0].Nodes[0].Nodes[0].Value, Equals, "foo")
+
+	resp, err = api.Get(ctx, "/volplugin/volumes", nil)
+	c.Assert(err, IsNil)
+	c.Assert(len(resp.Node.Nodes[0].Nodes), Equals, 0)
+
+	// only the values of the immediate children are read.
+	_, err = api.Set(ctx, "/volplugin/volumes/leaf", "baz", nil)
+	c.Assert(err, IsNil)
+
+	read := s.server.ValuesRead()
+	resp, err = api.Get(ctx, "/volplugin/volumes", nil)
+	c.Assert(err, IsNil)
+	c.Assert(s.server.ValuesRead()-read, Equals, 1)
+	c.Assert(resp.Node.Nodes, HasLen, 2)
+	c.Assert(resp.Node.Nodes[0].Key, Equals, "/volplugin/volumes/leaf")
+	c.Assert(resp.Node.Nodes[0].Value, Equals, "baz")
+	c.Assert(resp.Node.Nodes[1].Key, Equals, "/volplugin/volumes/policy1")
+	c.Assert(resp.Node.Nodes[1].Dir, Equals, true)
+
+	_, err = api.Get(ctx, "/volplugin/volumes/policy2", nil)
+	c.Assert(err.(client.Error).Code, Equals, client.ErrorCodeKeyNotFound)
+
+	_, err = api.Delete(ctx, "/volplugin/volumes/policy1", &client.DeleteOptions{Recursive: true})
+	c.Assert(err, IsNil)
+	_, err = api.Get(ctx, "/volplugin/volumes/policy1/vol1/runtime", nil)
+	c.Assert(err.(client.Error).Code, Equals, client.ErrorCodeKeyNotFound)
+
+	resp, err = api.Get(ctx, "/volplugin/volumes-old", nil)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Node.Value, Equals, "bar")
+}
+
+func (s *etcd3Suite) TestSetConditions(c *C) {
+	ctx := context.Background()
+	api := s.keysAPI()
+
+	_, err := api.Set(ctx, "/volplugin/foo", "bar", &client.SetOptions{PrevExist: client.PrevNoExist})
+	c.Assert(err, IsNil)
+	_, err = api.Set(ctx, "/volplugin/foo", "bar", &client.SetOptions{PrevExist: client.PrevNoExist})
+	c.Assert(err.(client.Error).Code, Equals, client.ErrorCodeNodeExist)
+
+	_, err = api.Set(ctx, "/volplugin/foo", "baz", &client.SetOptions{PrevValue: "quux"})
+	c.Assert(err.(client.Error).Code, Equals, client.ErrorCodeTestFailed)
+	resp, err := api.Set(ctx, "/volplugin/foo", "baz", &client.SetOptions{PrevValue: "bar"})
+	c.Assert(err, IsNil)
+	c.Assert(resp.PrevNode.Value, Equals, "bar")
+
+	_, err = api.Set(ctx, "/volplugin/foo", "quux", &client.SetOptions{PrevIndex: resp.Node.ModifiedIndex - 1})
+	c.Assert(err.(client.Error).Code, Equals, client.ErrorCodeTestFailed)
+	_, err = api.Set(ctx, "/volplugin/foo", "quux", &client.SetOptions{PrevIndex: resp.Node.ModifiedIndex})
+	c.Assert(err, IsNil)
+
+	_, err = api.Update(ctx, "/volplugin/bar", "quux")
+	c.Assert(err.(client.Error).Code, Equals, client.ErrorCodeKeyNotFound)
+
+	_, err = api.Delete(ctx, "/volplugin/foo", &client.DeleteOptions{PrevValue: "baz"})
+	c.Assert(err.(client.Error).Code, Equals, client.ErrorCodeTestFailed)
+	_, err = api.Delete(ctx, "/volplugin/foo", &client.DeleteOptions{PrevValue: "quux"})
+	c.Assert(err, IsNil)
+	_, err = api.Delete(ctx, "/volplugin/foo", nil)
+	c.Assert(err.(client.Error).Code, Equals, client.ErrorCodeKeyNotFound)
+}
+
+func (s *etcd3Suite) TestUseCRUD(c *C) {
+	c.Assert(s.tlc.PublishUse(testUseMounts["basic"]), IsNil)
+	c.Assert(s.tlc.PublishUse(testUseMounts["basic"]), IsNil)
+	c.Assert(s.tlc.PublishUse(testUseMounts["basic-newhost"]), NotNil)
+	c.Assert(s.tlc.PublishUse(testUseMounts["basic2"]), IsNil)
+
+	mt := &UseMount{}
+	c.Assert(s.tlc.GetUse(mt, testUseVolumes["basic"]), IsNil)
+	c.Assert(mt, DeepEquals, testUseMounts["basic"])
+
+	mounts, err := s.tlc.ListUses("mount")
+	c.Assert(err, IsNil)
+	sort.Strings(mounts)
+	c.Assert(mounts, DeepEquals, []string{"policy1/quux", "policy2/baz"})
+
+	c.Assert(s.tlc.RemoveUse(testUseMounts["basic-newhost"], false), NotNil)
+	c.Assert(s.tlc.RemoveUse(testUseMounts["basic"], false), IsNil)
+	c.Assert(s.tlc.GetUse(mt, testUseVolumes["basic"]), NotNil)
+}
+
+func (s *etcd3Suite) TestPublishUses(c *C) {
+	snapshot := &UseSnapshot{Volume: testUseMounts["basic"].Volume, Reason: "Snapshot"}
+	uses := []UseLocker{testUseMounts["basic"], snapshot}
+
+	c.Assert(s.tlc.PublishUses(uses), IsNil)
+	c.Assert(s.tlc.GetUse(&UseMount{}, testUseVolumes["basic"]), IsNil)
+	c.Assert(s.tlc.GetUse(&UseSnapshot{}, testUseVolumes["basic"]), IsNil)
+
+	// nothing is published if any of the uses is held.
+	err := s.tlc.PublishUses([]UseLocker{testUseMounts["basic2"], testUseMounts["basic-newhost"]})
+	c.Assert(err, NotNil)
+	c.Assert(err.(*errored.Error).Contains(errors.Exists), Equals, true)
+	c.Assert(s.tlc.GetUse(&UseMount{}, testUseVolumes["basic2"]), NotNil)
+
+	c.Assert(s.tlc.RemoveUse(snapshot, false), IsNil)
+	c.Assert(s.tlc.PublishUses(uses), IsNil)
+}
+
+func (s *etcd3Suite) TestUseWithTTL(c *C) {
+	c.Assert(s.tlc.PublishUseWithTTL(testUseMounts["basic"], time.Second), IsNil)
+	c.Assert(s.tlc.PublishUseWithTTL(testUseMounts["basic"], time.Second), IsNil)
+	c.Assert(s.tlc.PublishUseWithTTL(testUseMounts["basic-newhost"], time.Second), NotNil)
+	c.Assert(s.tlc.PublishUseWithTTL(testUseMounts["basic2"], time.Second), IsNil)
+
+	// every use shares the lease of the host.
+	leases := s.server.Leases()
+	c.Assert(len(leases), Equals, 1)
+
+	s.server.Expire(leases[0])
+	c.Assert(s.tlc.GetUse(&UseMount{}, testUseVolumes["basic"]), NotNil)
+	c.Assert(s.tlc.GetUse(&UseMount{}, testUseVolumes["basic2"]), NotNil)
+
+	// the expired lease is replaced, and the uses held with it are put back.
+	c.Assert(s.tlc.PublishUseWithTTL(testUseMounts["basic2"], time.Second), IsNil)
+	c.Assert(len(s.server.Leases()), Equals, 1)
+	c.Assert(s.tlc.GetUse(&UseMount{}, testUseVolumes["basic"]), IsNil)
+	c.Assert(s.tlc.PublishUseWithTTL(testUseMounts["basic-newhost"], time.Second), NotNil)
+
+	// removed uses are not.
+	c.Assert(s.tlc.RemoveUse(testUseMounts["basic"], false), IsNil)
+	s.server.Expire(s.server.Leases()[0])
+	c.Assert(s.tlc.PublishUseWithTTL(testUseMounts["basic-newhost"], time.Second), IsNil)
+	c.Assert(s.tlc.GetUse(&UseMount{}, testUseVolumes["basic2"]), IsNil)
+	c.Assert(s.tlc.RemoveUse(testUseMounts["basic-newhost"], false), IsNil)
+}
+
+func (s *etcd3Suite) TestSetLeases(c *C) {
+	ctx := context.Background()
+	api := s.keysAPI()
+	ttl := &client.SetOptions{TTL: time.Minute}
+
+	// the lease a key was set with is revoked when it is set again.
+	_, err := api.Set(ctx, "/volplugin/nodes/host1", "foo", ttl)
+	c.Assert(err, IsNil)
+	_, err = api.Set(ctx, "/volplugin/nodes/host1", "bar", ttl)
+	c.Assert(err, IsNil)
+	c.Assert(s.server.Leases(), HasLen, 1)
+
+	// or when the set fails.
+	_, err = api.Set(ctx, "/volplugin/nodes/host1", "baz", &client.SetOptions{TTL: time.Minute, PrevExist: client.PrevNoExist})
+	c.Assert(err, NotNil)
+	c.Assert(s.server.Leases(), HasLen, 1)
+
+	resp, err := api.Get(ctx, "/volplugin/nodes/host1", nil)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Node.Value, Equals, "bar")
+
+	_, err = api.Set(ctx, "/volplugin/nodes/host1", "quux", nil)
+	c.Assert(err, IsNil)
+	c.Assert(s.server.Leases(), HasLen, 0)
+
+	_, err = api.Set(ctx, "/volplugin/nodes/host2", "foo", ttl)
+	c.Assert(err, IsNil)
+	_, err = api.Delete(ctx, "/volplugin/nodes", &client.DeleteOptions{Recursive: true})
+	c.Assert(err, IsNil)
+	c.Assert(s.server.Leases(), HasLen, 0)
+}
+
+func (s *etcd3Suite) TestWatcher(c *C) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	api := s.keysAPI()
+	_, err := api.Set(ctx, "/volplugin/nodes/host1", "before", nil)
+	c.Assert(err, IsNil)
+
+	watcher := api.Watcher("/volplugin/nodes", &client.WatcherOptions{Recursive: true})
+	next := make(chan *client.Response)
+	go func() {
+		for {
+			resp, err := watcher.Next(ctx)
+			if err != nil {
+				close(next)
+				return
+			}
+			next <- resp
+		}
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	_, err = api.Set(ctx, "/volplugin/nodes/host1", "after", nil)
+	c.Assert(err, IsNil)
+	resp := <-next
+	c.Assert(resp.Action, Equals, "set")
+	c.Assert(resp.Node.Value, Equals, "after")
+	c.Assert(resp.PrevNode.Value, Equals, "before")
+
+	_, err = api.Set(ctx, "/volplugin/nodes/host2", "new", &client.SetOptions{TTL: time.Second})
+	c.Assert(err, IsNil)
+	resp = <-next
+	c.Assert(resp.Action, Equals, "create")
+	c.Assert(resp.Node.Key, Equals, "/volplugin/nodes/host2")
+
+	s.server.Expire(s.server.Leases()[0])
+	resp = <-next
+	c.Assert(resp.Action, Equals, "expire")
+	c.Assert(resp.Node.Key, Equals, "/volplugin/nodes/host2")
+
+	_, err = api.Delete(ctx, "/volplugin/nodes/host1", nil)
+	c.Assert(err, IsNil)
+	resp = <-next
+	c.Assert(resp.Action, Equals, "delete")
+
+	cancel()
+	_, ok := <-next
+	c.Assert(ok, Equals, false)
+}
+
+func (s *etcd3Suite) TestEventLog(c *C) {
+	_, index, err := s.tlc.ListEvents("")
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	followed := make(chan *Event, 2)
+	go s.tlc.WatchEvents(ctx, index, "policy1/bar", followed)
+
+	c.Assert(s.tlc.PublishEvent(NewEvent(EventCreated, "policy1/foo", "host1", "")), IsNil)
+	c.Assert(s.tlc.PublishEvent(NewEvent(EventCreated, "policy1/bar", "host1", "")), IsNil)
+
+	events, _, err := s.tlc.ListEvents("")
+	c.Assert(err, IsNil)
+	c.Assert(len(events), Equals, 2)
+	c.Assert(events[0].Volume, Equals, "policy1/foo")
+
+	select {
+	case ev := <-followed:
+		c.Assert(ev.Volume, Equals, "policy1/bar")
+	case <-time.After(5 * time.Second):
+		c.Fatal("event was not followed")
+	}
+
+	// events from a host whose clock is behind are still listed in the order
+	// they were published.
+	_, err = s.keysAPI().Set(ctx, "/volplugin/events/00000000000000000001", `{"volume":"policy1/baz"}`, nil)
+	c.Assert(err, IsNil)
+
+	events, _, err = s.tlc.ListEvents("")
+	c.Assert(err, IsNil)
+	c.Assert(len(events), Equals, 3)
+	c.Assert(events[0].Volume, Equals, "policy1/foo")
+	c.Assert(events[2].Volume, Equals, "policy1/baz")
+}
+
+func (s *etcd3Suite) TestWatchVolumes(c *C) {
+	c.Assert(s.tlc.PublishPolicy("policy1", testPolicies["basic"]), IsNil)
+	volumeChan := make(chan *watch.Watch)
+	s.tlc.WatchVolumeRuntimes(volumeChan)
+	defer watch.Stop(s.tlc.prefixed(rootVolume))
+
+	vol, err := s.tlc.CreateVolume(&VolumeRequest{Policy: "policy1", Name: "test"})
+	c.Assert(err, IsNil)
+	c.Assert(s.tlc.PublishVolume(vol), IsNil)
+
+	select {
+	case vol2 := <-volumeChan:
+		c.Assert(vol2.Key, Equals, "policy1/test")
+	case <-time.After(5 * time.Second):
+		c.Fatal("volume was not watched")
+	}
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/contiv/volplugin/errors"
+	"github.com/coreos/etcd/client"
+
+	"golang.org/x/net/context"
+)
+
+// EventTTL is how long events are kept in the event log.
+const EventTTL = 24 * time.Hour
+
+// Event types recorded in the event log.
+const (
+	EventCreated        = "created"
+	EventMounted        = "mounted"
+	EventUnmounted      = "unmounted"
+	EventSnapshotTaken  = "snapshot-taken"
+	EventSnapshotPruned = "snapshot-pruned"
+	EventSnapshotFailed = "snapshot-failed"
+	EventLockStolen     = "lock-stolen"
+	EventRemoved        = "removed"
+)
+
+// Event is an entry in the volume event log. Events are appended in order and
+// expire after EventTTL.
+type Event struct {
+	Index    uint64    `json:"index"`
+	Type     string    `json:"type"`
+	Volume   string    `json:"volume"`
+	Hostname string    `json:"hostname"`
+	Message  string    `json:"message,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// NewEvent constructs an event of the type for the volume, which happened now.
+func NewEvent(typ, volume, hostname, message string) *Event {
+	return &Event{
+		Type:     typ,
+		Volume:   volume,
+		Hostname: hostname,
+		Message:  message,
+		Time:     time.Now(),
+	}
+}
+
+func (e *Event) String() string {
+	return fmt.Sprintf("%s %s %s on %s", e.Time.Format(time.RFC3339), e.Volume, e.Type, e.Hostname)
+}
+
+// PublishEvent appends the event to the event log.
+func (c *Client) PublishEvent(ev *Event) error {
+	content, err := json.Marshal(ev)
+	if err != nil {
+		return errors.PublishEvent.Combine(err)
+	}
+
+	resp, err := c.etcdClient.CreateInOrder(c.Context(), c.prefixed(rootEvent), string(content), &client.CreateInOrderOptions{TTL: EventTTL})
+	if err != nil {
+		return errors.PublishEvent.Combine(errors.EtcdToErrored(err))
+	}
+
+	ev.Index = resp.Node.CreatedIndex
+	return nil
+}
+
+// RecordEvent publishes an event of the type for the volume. Events are
+// advisory, so failures are only logged.
+func (c *Client) RecordEvent(typ, volume, hostname, format string, args ...interface{}) {
+	ev := NewEvent(typ, volume, hostname, fmt.Sprintf(format, args...))
+	if err := c.PublishEvent(ev); err != nil {
+		log.Warnf("Could not record %s event for volume %q: %v", typ, volume, err)
+	}
+}
+
+func (c *Client) unmarshalEvent(node *client.Node) (*Event, error) {
+	ev := &Event{}
+	if err := json.Unmarshal([]byte(node.Value), ev); err != nil {
+		return nil, errors.ListEvents.Combine(err)
+	}
+	ev.Index = node.CreatedIndex
+
+	return ev, nil
+}
+
+// byCreation sorts nodes in the order they were created in. Keys created in
+// order are named after the clock of the host which created them, which may
+// be off, so they are sorted by the store's index instead.
+type byCreation client.Nodes
+
+func (b byCreation) Len() int           { return len(b) }
+func (b byCreation) Less(i, j int) bool { return b[i].CreatedIndex < b[j].CreatedIndex }
+func (b byCreation) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// ListEvents lists the events in the log, oldest first. If volume is not
+// empty, only the volume's events are returned. The etcd index of the listing
+// is returned so WatchEvents can pick up where it left off.
+func (c *Client) ListEvents(volume string) ([]*Event, uint64, error) {
+	resp, err := c.etcdClient.Get(c.Context(), c.prefixed(rootEvent), &client.GetOptions{Sort: true, Recursive: true})
+	if er, ok := err.(client.Error); ok && er.Code == client.ErrorCodeKeyNotFound {
+		return []*Event{}, er.Index, nil
+	} else if err != nil {
+		return nil, 0, errors.ListEvents.Combine(errors.EtcdToErrored(err))
+	}
+
+	events := []*Event{}
+
+	sort.Sort(byCreation(resp.Node.Nodes))
+	for _, node := range resp.Node.Nodes {
+		ev, err := c.unmarshalEvent(node)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if volume == "" || ev.Volume == volume {
+			events = append(events, ev)
+		}
+	}
+
+	return events, resp.Index, nil
+}
+
+// WatchEvents sends the events published after the etcd index to the channel
+// until the context is canceled. If volume is not empty, only the volume's
+// events are sent.
+func (c *Client) WatchEvents(ctx context.Context, index uint64, volume string, events chan<- *Event) error {
+	watcher := c.etcdClient.Watcher(c.prefixed(rootEvent), &client.WatcherOptions{AfterIndex: index, Recursive: true})
+
+	for {
+		resp, err := watcher.Next(ctx)
+		if err != nil {
+			if err == context.Canceled {
+				return nil
+			}
+
+			return errors.ListEvents.Combine(errors.EtcdToErrored(err))
+		}
+
+		if resp.Action != "create" {
+			continue
+		}
+
+		ev, err := c.unmarshalEvent(resp.Node)
+		if err != nil {
+			return err
+		}
+
+		if volume != "" && ev.Volume != volume {
+			continue
+		}
+
+		select {
+		case events <- ev:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"golang.org/x/net/context"
+)
+
+func (s *configSuite) TestEventLog(c *C) {
+	events, index, err := s.tlc.ListEvents("")
+	c.Assert(err, IsNil)
+	c.Assert(len(events), Equals, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	followed := make(chan *Event, 2)
+	errChan := make(chan error, 1)
+	go func() { errChan <- s.tlc.WatchEvents(ctx, index, "policy1/bar", followed) }()
+
+	c.Assert(s.tlc.PublishEvent(NewEvent(EventCreated, "policy1/foo", "host1", "")), IsNil)
+	c.Assert(s.tlc.PublishEvent(NewEvent(EventCreated, "policy1/bar", "host1", "")), IsNil)
+	c.Assert(s.tlc.PublishEvent(NewEvent(EventMounted, "policy1/bar", "host2", "")), IsNil)
+
+	events, _, err = s.tlc.ListEvents("")
+	c.Assert(err, IsNil)
+	c.Assert(len(events), Equals, 3)
+
+	events, _, err = s.tlc.ListEvents("policy1/bar")
+	c.Assert(err, IsNil)
+	c.Assert(len(events), Equals, 2)
+	c.Assert(events[0].Type, Equals, EventCreated)
+	c.Assert(events[1].Type, Equals, EventMounted)
+	c.Assert(events[0].Index < events[1].Index, Equals, true)
+
+	for _, typ := range []string{EventCreated, EventMounted} {
+		select {
+		case ev := <-followed:
+			c.Assert(ev.Type, Equals, typ)
+			c.Assert(ev.Volume, Equals, "policy1/bar")
+		case <-time.After(5 * time.Second):
+			c.Fatal("timed out following events")
+		}
+	}
+
+	cancel()
+	c.Assert(<-errChan, IsNil)
+}
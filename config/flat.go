@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd/client"
+)
+
+// consul and etcd v3 store keys without directories. The KeysAPIs built on
+// them store a directory created with Set as an empty key ending in a slash,
+// and list any key with others below it as a directory.
+
+// errorMessages are the messages etcd gives the errors the KeysAPIs built on
+// flat-key stores return.
+var errorMessages = map[int]string{
+	client.ErrorCodeKeyNotFound: "Key not found",
+	client.ErrorCodeTestFailed:  "Compare failed",
+	client.ErrorCodeNodeExist:   "Key already exists",
+}
+
+// createInOrderRetries is how many names the KeysAPIs built on flat-key
+// stores try for a key created in order. Keys are named after the time they
+// are created at, which another host may have used for one too.
+const createInOrderRetries = 5
+
+// inOrderKey names a key created in order under dir after the current time.
+// Clocks differ between hosts, so the keys only sort roughly in the order
+// they were created; their CreatedIndex gives the exact order.
+func inOrderKey(dir string) string {
+	return fmt.Sprintf("%s/%020d", dir, time.Now().UnixNano())
+}
+
+// nodeTree builds the directory node of key out of the nodes of the keys
+// under it, as etcd v2 would return it. Directories created with Set are
+// among the nodes with Dir set. Only the immediate children of key are
+// returned unless recursive is set.
+func nodeTree(key string, nodes []*client.Node, recursive bool) *client.Node {
+	root := &client.Node{Key: key, Dir: true}
+	dirs := map[string]*client.Node{key: root}
+
+	for _, node := range nodes {
+		if node.Key == key && !node.Dir {
+			// a value stored at a key which also has keys under it is shadowed,
+			// as it cannot exist in etcd v2.
+			continue
+		}
+
+		if dir, ok := dirs[node.Key]; ok {
+			dir.CreatedIndex, dir.ModifiedIndex = node.CreatedIndex, node.ModifiedIndex
+			continue
+		}
+
+		parent := root
+		parts := strings.Split(strings.TrimPrefix(node.Key, key+"/"), "/")
+		for i := range parts[:len(parts)-1] {
+			dirName := key + "/" + strings.Join(parts[:i+1], "/")
+			dir, ok := dirs[dirName]
+			if !ok {
+				dir = &client.Node{Key: dirName, Dir: true}
+				dirs[dirName] = dir
+				if parent == root || recursive {
+					parent.Nodes = append(parent.Nodes, dir)
+				}
+			}
+			parent = dir
+		}
+
+		if node.Dir {
+			dirs[node.Key] = node
+		}
+
+		if parent == root || recursive {
+			parent.Nodes = append(parent.Nodes, node)
+		}
+	}
+
+	sortNodes(root)
+
+	return root
+}
+
+func sortNodes(node *client.Node) {
+	sort.Sort(node.Nodes)
+	for _, inner := range node.Nodes {
+		sortNodes(inner)
+	}
+}
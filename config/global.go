@@ -4,11 +4,11 @@ import (
 	"encoding/json"
 	"time"
 
-	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/logging"
 	"github.com/contiv/volplugin/watch"
 	"github.com/coreos/etcd/client"
-	"golang.org/x/net/context"
 )
 
 const (
@@ -28,6 +28,8 @@ type Global struct {
 	Timeout   time.Duration
 	TTL       time.Duration
 	MountPath string
+	Webhooks  []*Webhook        `json:",omitempty"`
+	LogLevels map[string]string `json:",omitempty"`
 }
 
 // NewGlobalConfigFromJSON transforms json into a global.
@@ -50,6 +52,21 @@ func NewGlobalConfig() *Global {
 	}
 }
 
+// Validate ensures the webhook receivers and log levels are valid.
+func (global *Global) Validate() error {
+	if _, err := logging.ParseLevels(global.LogLevels); err != nil {
+		return err
+	}
+
+	for _, wh := range global.Webhooks {
+		if err := wh.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // PublishGlobal publishes the global configuration.
 func (tlc *Client) PublishGlobal(g *Global) error {
 	gcPath := tlc.prefixed("global-config")
@@ -59,7 +76,7 @@ func (tlc *Client) PublishGlobal(g *Global) error {
 		return err
 	}
 
-	if _, err := tlc.etcdClient.Set(context.Background(), gcPath, string(value), &client.SetOptions{PrevExist: client.PrevIgnore}); err != nil {
+	if _, err := tlc.etcdClient.Set(tlc.Context(), gcPath, string(value), &client.SetOptions{PrevExist: client.PrevIgnore}); err != nil {
 		return errors.EtcdToErrored(err)
 	}
 
@@ -68,7 +85,7 @@ func (tlc *Client) PublishGlobal(g *Global) error {
 
 // GetGlobal retrieves the global configuration.
 func (tlc *Client) GetGlobal() (*Global, error) {
-	resp, err := tlc.etcdClient.Get(context.Background(), tlc.prefixed("global-config"), nil)
+	resp, err := tlc.etcdClient.Get(tlc.Context(), tlc.prefixed("global-config"), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -96,6 +113,50 @@ func (global *Global) Published() *Global {
 	return &newGlobal
 }
 
+// Redacted returns a copy of the current global with the webhook secrets
+// replaced by RedactedSecret, for showing the global to clients.
+func (global *Global) Redacted() *Global {
+	newGlobal := *global
+	newGlobal.Webhooks = make([]*Webhook, len(global.Webhooks))
+
+	for i, wh := range global.Webhooks {
+		newWebhook := *wh
+		if newWebhook.Secret != "" {
+			newWebhook.Secret = RedactedSecret
+		}
+		newGlobal.Webhooks[i] = &newWebhook
+	}
+
+	return &newGlobal
+}
+
+// KeepSecrets replaces each webhook secret which is RedactedSecret with the
+// secret of the webhook with the same URL in the current global, so a global
+// which was read with its secrets redacted can be uploaded again.
+func (global *Global) KeepSecrets(current *Global) error {
+	secrets := map[string]string{}
+	if current != nil {
+		for _, wh := range current.Webhooks {
+			secrets[wh.URL] = wh.Secret
+		}
+	}
+
+	for _, wh := range global.Webhooks {
+		if wh.Secret != RedactedSecret {
+			continue
+		}
+
+		secret, ok := secrets[wh.URL]
+		if !ok {
+			return errors.InvalidWebhook.Combine(errored.Errorf("The secret for %q is redacted and there is no secret to keep", wh.URL))
+		}
+
+		wh.Secret = secret
+	}
+
+	return nil
+}
+
 // Canonical returns a copy of the current global with the parameters adjusted
 // to fit the internal (or canonical) representation. To see the published
 // version, see Published() above.
@@ -145,7 +206,7 @@ func (tlc *Client) WatchGlobal(activity chan *watch.Watch) {
 			global = NewGlobalConfig()
 		} else {
 			if err := json.Unmarshal([]byte(resp.Node.Value), global); err != nil {
-				logrus.Error("Error decoding global config, not updating")
+				log.Error("Error decoding global config, not updating")
 				time.Sleep(time.Second)
 				return
 			}
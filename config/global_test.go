@@ -35,6 +35,15 @@ func (s *configSuite) TestGlobalEmpty(c *C) {
 	})
 }
 
+func (s *configSuite) TestGlobalLogLevels(c *C) {
+	global := NewGlobalConfig()
+	global.LogLevels = map[string]string{"default": "info", "lock": "debug"}
+	c.Assert(global.Validate(), IsNil)
+
+	global.LogLevels["storage"] = "chatty"
+	c.Assert(global.Validate(), NotNil)
+}
+
 func (s *configSuite) TestGlobalWatch(c *C) {
 	activity := make(chan *watch.Watch)
 
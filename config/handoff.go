@@ -0,0 +1,188 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/watch"
+	"github.com/coreos/etcd/client"
+)
+
+// DefaultHandoffGrace is the window a volume stays reserved for the receiving
+// host after the handoff completes, if none is requested.
+const DefaultHandoffGrace = time.Minute
+
+// Handoff states. A handoff starts pending, moves to draining when the
+// current host picks it up, and finishes as either complete or failed.
+const (
+	HandoffPending  = "pending"
+	HandoffDraining = "draining"
+	HandoffComplete = "complete"
+	HandoffFailed   = "failed"
+)
+
+// Handoff is a request to move a locked volume from the host currently
+// holding its mount lock to another host.
+type Handoff struct {
+	Volume    string        `json:"volume"`
+	From      string        `json:"from"`
+	To        string        `json:"to"`
+	Grace     time.Duration `json:"grace"`
+	Status    string        `json:"status"`
+	Error     string        `json:"error,omitempty"`
+	Requested time.Time     `json:"requested"`
+}
+
+func (c *Client) handoff(volume string) string {
+	return c.prefixed(rootHandoff, volume)
+}
+
+// PublishHandoff publishes a new handoff request, which expires after the TTL
+// unless it is finished first. It fails if a handoff is already in progress
+// for the volume.
+func (c *Client) PublishHandoff(h *Handoff, ttl time.Duration) error {
+	content, err := json.Marshal(h)
+	if err != nil {
+		return errors.PublishHandoff.Combine(err)
+	}
+
+	resp, err := c.etcdClient.Get(c.Context(), c.handoff(h.Volume), nil)
+	if err == nil {
+		existing := &Handoff{}
+		if err := json.Unmarshal([]byte(resp.Node.Value), existing); err == nil && !existing.Finished() {
+			return errors.Exists
+		}
+
+		// finished handoffs are only kept around for inspection; replace them.
+		_, err = c.etcdClient.Set(c.Context(), c.handoff(h.Volume), string(content), &client.SetOptions{PrevValue: resp.Node.Value, TTL: ttl})
+		return errors.EtcdToErrored(err)
+	}
+
+	_, err = c.etcdClient.Set(c.Context(), c.handoff(h.Volume), string(content), &client.SetOptions{PrevExist: client.PrevNoExist, TTL: ttl})
+	if er, ok := err.(client.Error); ok && er.Code == client.ErrorCodeNodeExist {
+		return errors.Exists
+	}
+
+	return errors.EtcdToErrored(err)
+}
+
+// UpdateHandoff overwrites the handoff record. A non-zero TTL expires the
+// record after that duration.
+func (c *Client) UpdateHandoff(h *Handoff, ttl time.Duration) error {
+	content, err := json.Marshal(h)
+	if err != nil {
+		return errors.PublishHandoff.Combine(err)
+	}
+
+	_, err = c.etcdClient.Set(c.Context(), c.handoff(h.Volume), string(content), &client.SetOptions{TTL: ttl})
+	return errors.EtcdToErrored(err)
+}
+
+// GetHandoff retrieves the handoff record for the volume.
+func (c *Client) GetHandoff(volume string) (*Handoff, error) {
+	resp, err := c.etcdClient.Get(c.Context(), c.handoff(volume), nil)
+	if err != nil {
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	h := &Handoff{}
+	if err := json.Unmarshal([]byte(resp.Node.Value), h); err != nil {
+		return nil, errors.GetHandoff.Combine(err)
+	}
+
+	return h, nil
+}
+
+// RemoveHandoff removes the handoff record for the volume, cancelling the
+// handoff if it has not finished.
+func (c *Client) RemoveHandoff(volume string) error {
+	_, err := c.etcdClient.Delete(c.Context(), c.handoff(volume), nil)
+	return errors.EtcdToErrored(err)
+}
+
+// ListHandoffs lists all the known handoffs.
+func (c *Client) ListHandoffs() ([]*Handoff, error) {
+	resp, err := c.etcdClient.Get(c.Context(), c.prefixed(rootHandoff), &client.GetOptions{Sort: true, Recursive: true})
+	if err != nil {
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	handoffs := []*Handoff{}
+
+	for _, policy := range resp.Node.Nodes {
+		for _, node := range policy.Nodes {
+			h := &Handoff{}
+			if err := json.Unmarshal([]byte(node.Value), h); err != nil {
+				return nil, errors.GetHandoff.Combine(err)
+			}
+
+			handoffs = append(handoffs, h)
+		}
+	}
+
+	return handoffs, nil
+}
+
+// WatchHandoffs watches the handoff requests and yields each changed
+// *Handoff through the activity channel.
+func (c *Client) WatchHandoffs(activity chan *watch.Watch) {
+	w := watch.NewWatcher(activity, c.prefixed(rootHandoff), func(resp *client.Response, w *watch.Watcher) {
+		if resp.Node.Dir || resp.Action == "delete" || resp.Action == "expire" {
+			return
+		}
+
+		h := &Handoff{}
+		if err := json.Unmarshal([]byte(resp.Node.Value), h); err != nil {
+			log.Errorf("Could not decode handoff %q: %v", resp.Node.Key, err)
+			return
+		}
+
+		w.Channel <- &watch.Watch{Key: strings.TrimPrefix(resp.Node.Key, c.prefixed(rootHandoff)+"/"), Config: h}
+	})
+
+	watch.Create(w)
+}
+
+// TTL is how long the handoff may stay unfinished: the holding host waits up
+// to the timeout for the volume to be unmounted, then reserves it for the
+// grace window. Requests the holding host never answers expire after this, so
+// they do not block the volume forever.
+func (h *Handoff) TTL(timeout time.Duration) time.Duration {
+	return h.Grace + timeout
+}
+
+// Finished returns true if the handoff has completed or failed.
+func (h *Handoff) Finished() bool {
+	return h.Status == HandoffComplete || h.Status == HandoffFailed
+}
+
+// ReserveUse replaces the use lock held by `from` with `to`, expiring it
+// after the TTL unless `to` refreshes or takes it permanently. If no lock is
+// held at all, `to` is simply published. This is used to hand a lock between
+// hosts without a window in which a third party could take it.
+func (c *Client) ReserveUse(from, to UseLocker, ttl time.Duration) error {
+	fromContent, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+
+	toContent, err := json.Marshal(to)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Reserving use %#v (previously %#v) for %v", to, from, ttl)
+
+	_, err = c.etcdClient.Set(c.Context(), c.use(to.Type(), to.GetVolume()), string(toContent), &client.SetOptions{TTL: ttl, PrevValue: string(fromContent)})
+	if er, ok := err.(client.Error); ok && er.Code == client.ErrorCodeKeyNotFound {
+		_, err = c.etcdClient.Set(c.Context(), c.use(to.Type(), to.GetVolume()), string(toContent), &client.SetOptions{TTL: ttl, PrevExist: client.PrevNoExist})
+	}
+
+	if err != nil {
+		return errors.PublishMount.Combine(errors.EtcdToErrored(err))
+	}
+
+	return nil
+}
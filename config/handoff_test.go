@@ -0,0 +1,73 @@
+package config
+
+import (
+	"time"
+
+	"github.com/contiv/volplugin/errors"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *configSuite) TestHandoffCRUD(c *C) {
+	h := &Handoff{
+		Volume: "policy1/quux",
+		From:   "host1",
+		To:     "host2",
+		Grace:  time.Minute,
+		Status: HandoffPending,
+	}
+
+	c.Assert(s.tlc.PublishHandoff(h, time.Minute), IsNil)
+	c.Assert(s.tlc.PublishHandoff(h, time.Minute), Equals, errors.Exists)
+
+	got, err := s.tlc.GetHandoff(h.Volume)
+	c.Assert(err, IsNil)
+	c.Assert(got.From, Equals, "host1")
+	c.Assert(got.Finished(), Equals, false)
+
+	h.Status = HandoffComplete
+	c.Assert(s.tlc.UpdateHandoff(h, time.Minute), IsNil)
+	handoffs, err := s.tlc.ListHandoffs()
+	c.Assert(err, IsNil)
+	c.Assert(len(handoffs), Equals, 1)
+	c.Assert(handoffs[0].Finished(), Equals, true)
+
+	// finished handoffs may be replaced by new requests.
+	h.Status = HandoffPending
+	c.Assert(s.tlc.PublishHandoff(h, 2*time.Second), IsNil)
+
+	// unfinished ones expire, so a host which never answers does not block
+	// the volume.
+	time.Sleep(5 * time.Second)
+	_, err = s.tlc.GetHandoff(h.Volume)
+	c.Assert(err, NotNil)
+
+	// and may be cancelled.
+	c.Assert(s.tlc.PublishHandoff(h, time.Minute), IsNil)
+	c.Assert(s.tlc.RemoveHandoff(h.Volume), IsNil)
+	c.Assert(s.tlc.PublishHandoff(h, time.Minute), IsNil)
+}
+
+func (s *configSuite) TestReserveUse(c *C) {
+	from := &UseMount{Volume: "policy1/quux", Hostname: "host1", Reason: "Mount"}
+	to := &UseMount{Volume: "policy1/quux", Hostname: "host2", Reason: "Mount"}
+	other := &UseMount{Volume: "policy1/quux", Hostname: "host3", Reason: "Mount"}
+	vol := &Volume{PolicyName: "policy1", VolumeName: "quux"}
+
+	c.Assert(s.tlc.PublishUse(from), IsNil)
+	c.Assert(s.tlc.ReserveUse(other, to, time.Minute), NotNil)
+	c.Assert(s.tlc.ReserveUse(from, to, 2*time.Second), IsNil)
+
+	use := &UseMount{}
+	c.Assert(s.tlc.GetUse(use, vol), IsNil)
+	c.Assert(use, DeepEquals, to)
+
+	// the reservation is taken permanently by the receiving host's mount.
+	c.Assert(s.tlc.PublishUse(to), IsNil)
+	c.Assert(s.tlc.PublishUse(from), NotNil)
+	c.Assert(s.tlc.RemoveUse(to, false), IsNil)
+
+	c.Assert(s.tlc.ReserveUse(from, to, 2*time.Second), IsNil)
+	time.Sleep(5 * time.Second)
+	c.Assert(s.tlc.GetUse(use, vol), NotNil)
+}
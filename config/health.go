@@ -0,0 +1,98 @@
+package config
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+)
+
+// Check is the result of a single health check.
+type Check struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+	// Optional checks are reported, but do not make the daemon unhealthy.
+	Optional bool `json:"optional,omitempty"`
+}
+
+// Health is the health report of a daemon: the result of checking each of
+// the things it depends on.
+type Health struct {
+	Hostname string    `json:"hostname"`
+	Checks   []*Check  `json:"checks"`
+	Time     time.Time `json:"time"`
+}
+
+// NewHealth returns an empty health report for the host.
+func NewHealth(hostname string) *Health {
+	return &Health{Hostname: hostname, Checks: []*Check{}, Time: time.Now()}
+}
+
+// Add records the result of a check; a nil error passes it.
+func (h *Health) Add(name string, err error) *Check {
+	check := &Check{Name: name, OK: err == nil}
+	if err != nil {
+		check.Message = err.Error()
+	}
+
+	h.Checks = append(h.Checks, check)
+	return check
+}
+
+// Healthy is true if every check which is not optional passed.
+func (h *Health) Healthy() bool {
+	for _, check := range h.Checks {
+		if !check.OK && !check.Optional {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CheckEtcd ensures etcd can be read.
+func (c *Client) CheckEtcd() error {
+	if _, err := c.etcdClient.Get(c.Context(), c.prefixed(), nil); err != nil {
+		return errors.Unhealthy.Combine(errors.EtcdToErrored(err))
+	}
+
+	return nil
+}
+
+// CheckGlobal ensures the global configuration can be loaded. An unpublished
+// global configuration passes, as the defaults are used in its place.
+func (c *Client) CheckGlobal() error {
+	global, err := c.GetGlobal()
+	if err != nil {
+		if errors.EtcdToErrored(err) == errors.NotExists {
+			return nil
+		}
+
+		return errors.Unhealthy.Combine(errors.EtcdToErrored(err))
+	}
+
+	return global.Validate()
+}
+
+// VolsupervisorHolder returns the host holding the volsupervisor lock, which
+// volsupervisor holds for as long as it is running.
+func (c *Client) VolsupervisorHolder() (string, error) {
+	us := &UseVolsupervisor{}
+
+	resp, err := c.etcdClient.Get(c.Context(), c.use(us.Type(), us.GetVolume()), nil)
+	if err != nil {
+		if errors.EtcdToErrored(err) == errors.NotExists {
+			return "", errors.Unhealthy.Combine(errored.New("volsupervisor is not running"))
+		}
+
+		return "", errors.Unhealthy.Combine(errors.EtcdToErrored(err))
+	}
+
+	if err := json.Unmarshal([]byte(resp.Node.Value), us); err != nil {
+		return "", errors.Unhealthy.Combine(err)
+	}
+
+	return us.Hostname, nil
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"errors"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *configSuite) TestHealth(c *C) {
+	health := NewHealth("host1")
+	health.Add("etcd", nil)
+	c.Assert(health.Healthy(), Equals, true)
+
+	health.Add("volsupervisor", errors.New("not running")).Optional = true
+	c.Assert(health.Healthy(), Equals, true)
+
+	check := health.Add("docker", errors.New("connection refused"))
+	c.Assert(check.OK, Equals, false)
+	c.Assert(check.Message, Equals, "connection refused")
+	c.Assert(health.Healthy(), Equals, false)
+}
+
+func (s *configSuite) TestHealthChecks(c *C) {
+	c.Assert(s.tlc.CheckEtcd(), IsNil)
+	c.Assert(s.tlc.CheckGlobal(), IsNil)
+
+	_, err := s.tlc.VolsupervisorHolder()
+	c.Assert(err, NotNil)
+
+	c.Assert(s.tlc.PublishUse(&UseVolsupervisor{Hostname: "host1"}), IsNil)
+	holder, err := s.tlc.VolsupervisorHolder()
+	c.Assert(err, IsNil)
+	c.Assert(holder, Equals, "host1")
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/coreos/etcd/client"
+)
+
+// Roles an identity may be granted. Admin and node are granted on all
+// policies; consumer and policy-owner are granted per policy, or on all
+// policies with the AllPolicies wildcard.
+const (
+	// RoleConsumer may read volumes and policies, and create, copy, snapshot
+	// and remove volumes.
+	RoleConsumer = "consumer"
+	// RolePolicyOwner may additionally upload and delete the policy, change
+	// runtime parameters, and import, migrate and force-remove volumes.
+	RolePolicyOwner = "policy-owner"
+	// RoleAdmin may do anything, including changing the global configuration.
+	RoleAdmin = "admin"
+	// RoleNode is the role of volplugin hosts. It has the rights of a consumer
+	// on all policies.
+	RoleNode = "node"
+)
+
+// AllPolicies is the grant key applying to every policy.
+const AllPolicies = "*"
+
+var roleLevels = map[string]int{
+	RoleConsumer:    1,
+	RoleNode:        1,
+	RolePolicyOwner: 2,
+	RoleAdmin:       3,
+}
+
+// Identity is a principal of the apiserver. It authenticates with a bearer
+// token, whose hash is stored, or a client certificate whose common name is
+// the identity's name. Grants map policy names, or AllPolicies, to roles.
+type Identity struct {
+	Name      string            `json:"name"`
+	TokenHash string            `json:"token-hash,omitempty"`
+	Grants    map[string]string `json:"grants"`
+}
+
+// HashToken returns the hash of a bearer token as it is stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// MatchToken is true if the token is the identity's.
+func (id *Identity) MatchToken(token string) bool {
+	if id.TokenHash == "" || token == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(id.TokenHash), []byte(HashToken(token))) == 1
+}
+
+// Validate ensures the identity has a name and only known roles.
+func (id *Identity) Validate() error {
+	if id.Name == "" {
+		return errors.InvalidIdentity.Combine(errored.Errorf("Name is missing"))
+	}
+
+	for policy, role := range id.Grants {
+		if _, ok := roleLevels[role]; !ok {
+			return errors.InvalidIdentity.Combine(errored.Errorf("Invalid role %q for policy %q", role, policy))
+		}
+
+		if (role == RoleAdmin || role == RoleNode) && policy != AllPolicies {
+			return errors.InvalidIdentity.Combine(errored.Errorf("Role %q may only be granted on %q", role, AllPolicies))
+		}
+	}
+
+	return nil
+}
+
+// Allowed is true if the identity holds the role, or a greater one, on the
+// policy. An empty policy requires the role on all policies.
+func (id *Identity) Allowed(policy, role string) bool {
+	want := roleLevels[role]
+
+	if roleLevels[id.Grants[AllPolicies]] >= want {
+		return true
+	}
+
+	return policy != "" && roleLevels[id.Grants[policy]] >= want
+}
+
+func (c *Client) identity(name string) string {
+	return c.prefixed(rootIdentity, name)
+}
+
+func (c *Client) identityToken(hash string) string {
+	return c.prefixed(rootIdentityToken, hash)
+}
+
+// PublishIdentity publishes the identity, replacing any identity of the same
+// name. Identities are indexed by the hash of their token, which must not be
+// another identity's.
+func (c *Client) PublishIdentity(id *Identity) error {
+	if err := id.Validate(); err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(id)
+	if err != nil {
+		return errors.PublishIdentity.Combine(err)
+	}
+
+	old, err := c.GetIdentity(id.Name)
+	if er, ok := err.(*errored.Error); err != nil && !(ok && er.Contains(errors.NotExists)) {
+		return errors.PublishIdentity.Combine(err)
+	}
+
+	if id.TokenHash != "" {
+		_, err := c.etcdClient.Set(c.Context(), c.identityToken(id.TokenHash), id.Name, &client.SetOptions{PrevExist: client.PrevNoExist})
+		if er, ok := err.(client.Error); ok && er.Code == client.ErrorCodeNodeExist {
+			resp, err := c.etcdClient.Get(c.Context(), c.identityToken(id.TokenHash), nil)
+			if err != nil {
+				return errors.PublishIdentity.Combine(errors.EtcdToErrored(err))
+			}
+
+			if resp.Node.Value != id.Name {
+				return errors.InvalidIdentity.Combine(errored.Errorf("The token is already used by identity %q", resp.Node.Value))
+			}
+		} else if err != nil {
+			return errors.PublishIdentity.Combine(errors.EtcdToErrored(err))
+		}
+	}
+
+	if _, err := c.etcdClient.Set(c.Context(), c.identity(id.Name), string(content), nil); err != nil {
+		return errors.PublishIdentity.Combine(errors.EtcdToErrored(err))
+	}
+
+	if old != nil && old.TokenHash != "" && old.TokenHash != id.TokenHash {
+		c.removeIdentityToken(old)
+	}
+
+	return nil
+}
+
+// removeIdentityToken removes the token index entry of the identity, if it
+// is still the identity's.
+func (c *Client) removeIdentityToken(id *Identity) {
+	_, err := c.etcdClient.Delete(c.Context(), c.identityToken(id.TokenHash), &client.DeleteOptions{PrevValue: id.Name})
+	if er, ok := err.(client.Error); err != nil && !(ok && (er.Code == client.ErrorCodeKeyNotFound || er.Code == client.ErrorCodeTestFailed)) {
+		log.Warnf("Could not remove the token index of identity %q: %v", id.Name, err)
+	}
+}
+
+// GetIdentity retrieves the named identity.
+func (c *Client) GetIdentity(name string) (*Identity, error) {
+	resp, err := c.etcdClient.Get(c.Context(), c.identity(name), nil)
+	if err != nil {
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	id := &Identity{}
+	if err := json.Unmarshal([]byte(resp.Node.Value), id); err != nil {
+		return nil, errors.GetIdentity.Combine(err)
+	}
+
+	return id, nil
+}
+
+// RemoveIdentity removes the named identity.
+func (c *Client) RemoveIdentity(name string) error {
+	id, err := c.GetIdentity(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.etcdClient.Delete(c.Context(), c.identity(name), nil); err != nil {
+		return errors.EtcdToErrored(err)
+	}
+
+	if id.TokenHash != "" {
+		c.removeIdentityToken(id)
+	}
+
+	return nil
+}
+
+// ListIdentities lists all identities.
+func (c *Client) ListIdentities() ([]*Identity, error) {
+	resp, err := c.etcdClient.Get(c.Context(), c.prefixed(rootIdentity), &client.GetOptions{Sort: true, Recursive: true})
+	if err != nil {
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	ids := []*Identity{}
+	for _, node := range resp.Node.Nodes {
+		id := &Identity{}
+		if err := json.Unmarshal([]byte(node.Value), id); err != nil {
+			return nil, errors.GetIdentity.Combine(err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// IdentityByToken finds the identity the bearer token belongs to, by the
+// hash of the token.
+func (c *Client) IdentityByToken(token string) (*Identity, error) {
+	if token == "" {
+		return nil, errors.NotExists
+	}
+
+	resp, err := c.etcdClient.Get(c.Context(), c.identityToken(HashToken(token)), nil)
+	if err != nil {
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	id, err := c.GetIdentity(resp.Node.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	// the index may be stale if the identity was replaced meanwhile.
+	if !id.MatchToken(token) {
+		return nil, errors.NotExists
+	}
+
+	return id, nil
+}
@@ -0,0 +1,65 @@
+package config
+
+import . "gopkg.in/check.v1"
+
+func (s *configSuite) TestIdentityAllowed(c *C) {
+	admin := &Identity{Name: "admin", Grants: map[string]string{AllPolicies: RoleAdmin}}
+	node := &Identity{Name: "host1", Grants: map[string]string{AllPolicies: RoleNode}}
+	owner := &Identity{Name: "team", Grants: map[string]string{"policy1": RolePolicyOwner, "policy2": RoleConsumer}}
+
+	for _, id := range []*Identity{admin, node, owner} {
+		c.Assert(id.Validate(), IsNil)
+	}
+
+	c.Assert(admin.Allowed("", RoleAdmin), Equals, true)
+	c.Assert(admin.Allowed("policy1", RolePolicyOwner), Equals, true)
+
+	c.Assert(node.Allowed("policy1", RoleConsumer), Equals, true)
+	c.Assert(node.Allowed("policy1", RolePolicyOwner), Equals, false)
+	c.Assert(node.Allowed("", RoleAdmin), Equals, false)
+
+	c.Assert(owner.Allowed("policy1", RolePolicyOwner), Equals, true)
+	c.Assert(owner.Allowed("policy1", RoleConsumer), Equals, true)
+	c.Assert(owner.Allowed("policy2", RoleConsumer), Equals, true)
+	c.Assert(owner.Allowed("policy2", RolePolicyOwner), Equals, false)
+	c.Assert(owner.Allowed("policy3", RoleConsumer), Equals, false)
+	c.Assert(owner.Allowed("", RoleConsumer), Equals, false)
+
+	for _, id := range []*Identity{
+		{},
+		{Name: "bad", Grants: map[string]string{"policy1": "superuser"}},
+		{Name: "bad", Grants: map[string]string{"policy1": RoleAdmin}},
+		{Name: "bad", Grants: map[string]string{"policy1": RoleNode}},
+	} {
+		c.Assert(id.Validate(), NotNil, Commentf("%#v", id))
+	}
+}
+
+func (s *configSuite) TestIdentityCRUD(c *C) {
+	id := &Identity{Name: "team", TokenHash: HashToken("secret"), Grants: map[string]string{"policy1": RoleConsumer}}
+
+	c.Assert(s.tlc.PublishIdentity(&Identity{}), NotNil)
+	c.Assert(s.tlc.PublishIdentity(id), IsNil)
+
+	got, err := s.tlc.GetIdentity("team")
+	c.Assert(err, IsNil)
+	c.Assert(got, DeepEquals, id)
+	c.Assert(got.MatchToken("secret"), Equals, true)
+	c.Assert(got.MatchToken("wrong"), Equals, false)
+	c.Assert(got.MatchToken(""), Equals, false)
+
+	got, err = s.tlc.IdentityByToken("secret")
+	c.Assert(err, IsNil)
+	c.Assert(got.Name, Equals, "team")
+
+	_, err = s.tlc.IdentityByToken("wrong")
+	c.Assert(err, NotNil)
+
+	ids, err := s.tlc.ListIdentities()
+	c.Assert(err, IsNil)
+	c.Assert(len(ids), Equals, 1)
+
+	c.Assert(s.tlc.RemoveIdentity("team"), IsNil)
+	_, err = s.tlc.GetIdentity("team")
+	c.Assert(err, NotNil)
+}
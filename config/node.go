@@ -0,0 +1,141 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/coreos/etcd/client"
+)
+
+// Node is the registration record for a single volplugin host. It is
+// published with a TTL and refreshed periodically; if the host stops
+// heartbeating the record expires and the node disappears from the inventory.
+type Node struct {
+	Hostname      string            `json:"hostname"`
+	Version       string            `json:"version"`
+	Backends      []string          `json:"backends"`
+	KernelRBD     bool              `json:"kernel-rbd"`
+	MountPath     string            `json:"mount-path"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	LastHeartbeat time.Time         `json:"last-heartbeat"`
+	Health        *Health           `json:"health,omitempty"`
+}
+
+// ParseLabels parses a list of `key=value` strings into a label map.
+func ParseLabels(pairs []string) (map[string]string, error) {
+	labels := map[string]string{}
+
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, errored.Errorf("Invalid label %q: must be in the form of key=value", pair)
+		}
+
+		labels[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return labels, nil
+}
+
+// MatchConstraints determines if a host's labels satisfy a set of placement
+// constraints. Every constraint key must be present in the labels; the
+// constraint value is a comma-separated list of acceptable label values. An
+// empty constraint value only requires the label to be present.
+func MatchConstraints(constraints, labels map[string]string) bool {
+	for key, want := range constraints {
+		have, ok := labels[key]
+		if !ok {
+			return false
+		}
+
+		if want == "" {
+			continue
+		}
+
+		var found bool
+		for _, value := range strings.Split(want, ",") {
+			if strings.TrimSpace(value) == have {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Satisfies determines if the node may mount a volume with the constraints.
+func (n *Node) Satisfies(constraints map[string]string) bool {
+	return MatchConstraints(constraints, n.Labels)
+}
+
+func (c *Client) node(hostname string) string {
+	return c.prefixed(rootNode, hostname)
+}
+
+// PublishNode publishes the node record with the provided TTL. Publishing an
+// existing node refreshes it.
+func (c *Client) PublishNode(node *Node, ttl time.Duration) error {
+	if node.Hostname == "" {
+		return errors.InvalidNode
+	}
+
+	content, err := json.Marshal(node)
+	if err != nil {
+		return errors.PublishNode.Combine(err)
+	}
+
+	if _, err := c.etcdClient.Set(c.Context(), c.node(node.Hostname), string(content), &client.SetOptions{TTL: ttl}); err != nil {
+		return errors.PublishNode.Combine(errors.EtcdToErrored(err))
+	}
+
+	return nil
+}
+
+// GetNode retrieves the node record for the hostname.
+func (c *Client) GetNode(hostname string) (*Node, error) {
+	resp, err := c.etcdClient.Get(c.Context(), c.node(hostname), nil)
+	if err != nil {
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	node := &Node{}
+	if err := json.Unmarshal([]byte(resp.Node.Value), node); err != nil {
+		return nil, errors.GetNode.Combine(err)
+	}
+
+	return node, nil
+}
+
+// RemoveNode removes the node record for the hostname.
+func (c *Client) RemoveNode(hostname string) error {
+	_, err := c.etcdClient.Delete(c.Context(), c.node(hostname), nil)
+	return errors.EtcdToErrored(err)
+}
+
+// ListNodes lists all the nodes which are currently heartbeating.
+func (c *Client) ListNodes() ([]*Node, error) {
+	resp, err := c.etcdClient.Get(c.Context(), c.prefixed(rootNode), &client.GetOptions{Sort: true, Recursive: true})
+	if err != nil {
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	nodes := []*Node{}
+	for _, n := range resp.Node.Nodes {
+		node := &Node{}
+		if err := json.Unmarshal([]byte(n.Value), node); err != nil {
+			return nil, errors.GetNode.Combine(err)
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *configSuite) TestNodeCRUD(c *C) {
+	node := &Node{
+		Hostname:  "host1",
+		Version:   "1.0",
+		Backends:  []string{"ceph", "nfs"},
+		MountPath: "/mnt/ceph",
+	}
+
+	c.Assert(s.tlc.PublishNode(&Node{}, time.Minute), NotNil)
+	c.Assert(s.tlc.PublishNode(node, time.Minute), IsNil)
+	c.Assert(s.tlc.PublishNode(node, time.Minute), IsNil)
+
+	node2 := *node
+	node2.Hostname = "host2"
+	c.Assert(s.tlc.PublishNode(&node2, time.Minute), IsNil)
+
+	got, err := s.tlc.GetNode("host1")
+	c.Assert(err, IsNil)
+	c.Assert(got.Hostname, Equals, node.Hostname)
+	c.Assert(got.Backends, DeepEquals, node.Backends)
+
+	nodes, err := s.tlc.ListNodes()
+	c.Assert(err, IsNil)
+	c.Assert(len(nodes), Equals, 2)
+	c.Assert(nodes[0].Hostname, Equals, "host1")
+	c.Assert(nodes[1].Hostname, Equals, "host2")
+
+	c.Assert(s.tlc.RemoveNode("host2"), IsNil)
+	_, err = s.tlc.GetNode("host2")
+	c.Assert(err, NotNil)
+}
+
+func (s *configSuite) TestNodeTTL(c *C) {
+	c.Assert(s.tlc.PublishNode(&Node{Hostname: "host1"}, 2*time.Second), IsNil)
+	_, err := s.tlc.GetNode("host1")
+	c.Assert(err, IsNil)
+	time.Sleep(5 * time.Second)
+	_, err = s.tlc.GetNode("host1")
+	c.Assert(err, NotNil)
+}
+
+func (s *configSuite) TestMatchConstraints(c *C) {
+	labels, err := ParseLabels([]string{"rack=r1", "ceph-pool = rbd", "ssd="})
+	c.Assert(err, IsNil)
+	c.Assert(labels, DeepEquals, map[string]string{"rack": "r1", "ceph-pool": "rbd", "ssd": ""})
+
+	_, err = ParseLabels([]string{"rack"})
+	c.Assert(err, NotNil)
+	_, err = ParseLabels([]string{"=r1"})
+	c.Assert(err, NotNil)
+
+	node := &Node{Hostname: "host1", Labels: labels}
+
+	c.Assert(node.Satisfies(nil), Equals, true)
+	c.Assert(node.Satisfies(map[string]string{"rack": "r1"}), Equals, true)
+	c.Assert(node.Satisfies(map[string]string{"rack": "r2, r1"}), Equals, true)
+	c.Assert(node.Satisfies(map[string]string{"rack": "r2"}), Equals, false)
+	c.Assert(node.Satisfies(map[string]string{"ssd": ""}), Equals, true)
+	c.Assert(node.Satisfies(map[string]string{"rack": "r1", "zone": ""}), Equals, false)
+	c.Assert((&Node{}).Satisfies(map[string]string{"rack": "r1"}), Equals, false)
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/coreos/etcd/client"
+)
+
+// Operation types recorded in the journal.
+const (
+	OperationCreate = "create"
+	OperationCopy   = "copy"
+	OperationRemove = "remove"
+)
+
+// Operation steps. Each step is recorded after the work it describes has
+// completed, so recovery knows exactly what has been done.
+const (
+	// StepStarted is recorded before any work is done.
+	StepStarted = "started"
+	// StepCreated is recorded after the image has been created.
+	StepCreated = "created"
+	// StepFormatted is recorded after the image has been formatted.
+	StepFormatted = "formatted"
+	// StepPublished is recorded after the volume record has been published.
+	StepPublished = "published"
+	// StepDestroyed is recorded after the image has been destroyed.
+	StepDestroyed = "destroyed"
+)
+
+// Operation is a journal entry for a multi-step volume operation. It is
+// written before the operation starts, updated after each step, and removed
+// when the operation completes. Entries left behind belong to operations
+// which did not finish, and are resumed or rolled back by the apiserver.
+//
+// While an operation runs, the apiserver running it keeps its heartbeat
+// alive; see HeartbeatOperation.
+type Operation struct {
+	Type     string    `json:"type"`
+	Volume   *Volume   `json:"volume"`
+	Source   string    `json:"source,omitempty"`
+	Snapshot string    `json:"snapshot,omitempty"`
+	Step     string    `json:"step"`
+	Hostname string    `json:"hostname"`
+	Started  time.Time `json:"started"`
+	Updated  time.Time `json:"updated"`
+}
+
+func (c *Client) operation(volume string) string {
+	return c.prefixed(rootOperation, volume)
+}
+
+// PublishOperation records the operation and its current step.
+func (c *Client) PublishOperation(op *Operation) error {
+	op.Updated = time.Now()
+
+	content, err := json.Marshal(op)
+	if err != nil {
+		return errors.PublishOperation.Combine(err)
+	}
+
+	if _, err := c.etcdClient.Set(c.Context(), c.operation(op.Volume.String()), string(content), nil); err != nil {
+		return errors.PublishOperation.Combine(errors.EtcdToErrored(err))
+	}
+
+	return nil
+}
+
+// StepOperation records that the operation has completed the step.
+func (c *Client) StepOperation(op *Operation, step string) error {
+	op.Step = step
+	return c.PublishOperation(op)
+}
+
+// HeartbeatOperation marks the operation as running for the TTL. The
+// apiserver running it publishes the heartbeat again before the TTL runs out;
+// once it has expired, the operation was abandoned.
+func (c *Client) HeartbeatOperation(op *Operation, ttl time.Duration) error {
+	if _, err := c.etcdClient.Set(c.Context(), c.prefixed(rootOperationLive, op.Volume.String()), op.Hostname, &client.SetOptions{TTL: ttl}); err != nil {
+		return errors.PublishOperation.Combine(errors.EtcdToErrored(err))
+	}
+
+	return nil
+}
+
+// OperationAlive is true if the operation's heartbeat has not expired.
+func (c *Client) OperationAlive(op *Operation) (bool, error) {
+	_, err := c.etcdClient.Get(c.Context(), c.prefixed(rootOperationLive, op.Volume.String()), nil)
+	if err == nil {
+		return true, nil
+	}
+
+	if er, ok := errors.EtcdToErrored(err).(*errored.Error); ok && er.Contains(errors.NotExists) {
+		return false, nil
+	}
+
+	return false, errors.EtcdToErrored(err)
+}
+
+// RemoveOperation removes the journal entry for the volume's operation, and
+// its heartbeat.
+func (c *Client) RemoveOperation(op *Operation) error {
+	_, err := c.etcdClient.Delete(c.Context(), c.prefixed(rootOperationLive, op.Volume.String()), nil)
+	if er, ok := errors.EtcdToErrored(err).(*errored.Error); err != nil && !(ok && er.Contains(errors.NotExists)) {
+		return errors.EtcdToErrored(err)
+	}
+
+	_, err = c.etcdClient.Delete(c.Context(), c.operation(op.Volume.String()), nil)
+	return errors.EtcdToErrored(err)
+}
+
+// ListOperations lists the operations in the journal.
+func (c *Client) ListOperations() ([]*Operation, error) {
+	resp, err := c.etcdClient.Get(c.Context(), c.prefixed(rootOperation), &client.GetOptions{Sort: true, Recursive: true})
+	if err != nil {
+		return nil, errors.EtcdToErrored(err)
+	}
+
+	ops := []*Operation{}
+
+	for _, policy := range resp.Node.Nodes {
+		for _, node := range policy.Nodes {
+			op := &Operation{}
+			if err := json.Unmarshal([]byte(node.Value), op); err != nil {
+				return nil, errors.ListOperation.Combine(err)
+			}
+
+			ops = append(ops, op)
+		}
+	}
+
+	return ops, nil
+}
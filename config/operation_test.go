@@ -0,0 +1,23 @@
+package config
+
+import . "gopkg.in/check.v1"
+
+func (s *configSuite) TestOperationJournal(c *C) {
+	vol := &Volume{PolicyName: "policy1", VolumeName: "quux"}
+	op := &Operation{Type: OperationCreate, Volume: vol, Step: StepStarted, Hostname: "host1"}
+
+	c.Assert(s.tlc.PublishOperation(op), IsNil)
+	c.Assert(s.tlc.StepOperation(op, StepCreated), IsNil)
+
+	ops, err := s.tlc.ListOperations()
+	c.Assert(err, IsNil)
+	c.Assert(len(ops), Equals, 1)
+	c.Assert(ops[0].Step, Equals, StepCreated)
+	c.Assert(ops[0].Volume.String(), Equals, vol.String())
+	c.Assert(ops[0].Updated.IsZero(), Equals, false)
+
+	c.Assert(s.tlc.RemoveOperation(op), IsNil)
+	ops, err = s.tlc.ListOperations()
+	c.Assert(err, IsNil)
+	c.Assert(len(ops), Equals, 0)
+}
@@ -6,7 +6,6 @@ import (
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/errors"
 	"github.com/coreos/etcd/client"
-	"golang.org/x/net/context"
 )
 
 // Type definitions for backend drivers
@@ -26,8 +25,22 @@ type Policy struct {
 	FileSystems    map[string]string `json:"filesystems"`
 	Backends       *BackendDrivers   `json:"backends,omitempty"`
 	Backend        string            `json:"backend,omitempty"`
+	Constraints    map[string]string `json:"constraints,omitempty"`
+	Remove         string            `json:"remove,omitempty"`
+	Quota          *Quota            `json:"quota,omitempty"`
 }
 
+// Remove modes of a policy, which determine what happens to a volume when it
+// is removed through docker. The default is RemoveNever.
+const (
+	// RemoveNever leaves the volume in place.
+	RemoveNever = "never"
+	// RemoveRecordOnly removes the volume but leaves its image in place.
+	RemoveRecordOnly = "record-only"
+	// RemoveDestroy removes the volume and its image.
+	RemoveDestroy = "destroy"
+)
+
 // BackendDrivers is a struct containing all the drivers used under this policy
 type BackendDrivers struct {
 	CRUD     string `json:"crud"`
@@ -78,9 +91,9 @@ func (c *Client) PublishPolicy(name string, cfg *Policy) error {
 	// for example: /volplugin/policies/policy1 will create
 	// /volplugin/volumes/policy1 so that a volume of policy1/test can be created
 	// at /volplugin/volumes/policy1/test
-	c.etcdClient.Set(context.Background(), c.prefixed(rootVolume, name), "", &client.SetOptions{Dir: true})
+	c.etcdClient.Set(c.Context(), c.prefixed(rootVolume, name), "", &client.SetOptions{Dir: true})
 
-	if _, err := c.etcdClient.Set(context.Background(), c.policy(name), string(value), &client.SetOptions{PrevExist: client.PrevIgnore}); err != nil {
+	if _, err := c.etcdClient.Set(c.Context(), c.policy(name), string(value), &client.SetOptions{PrevExist: client.PrevIgnore}); err != nil {
 		return errors.EtcdToErrored(err)
 	}
 
@@ -89,7 +102,7 @@ func (c *Client) PublishPolicy(name string, cfg *Policy) error {
 
 // DeletePolicy removes a policy from the configuration store.
 func (c *Client) DeletePolicy(name string) error {
-	_, err := c.etcdClient.Delete(context.Background(), c.policy(name), nil)
+	_, err := c.etcdClient.Delete(c.Context(), c.policy(name), nil)
 	return errors.EtcdToErrored(err)
 }
 
@@ -99,7 +112,7 @@ func (c *Client) GetPolicy(name string) (*Policy, error) {
 		return nil, errored.Errorf("Policy invalid: empty string for name")
 	}
 
-	resp, err := c.etcdClient.Get(context.Background(), c.policy(name), nil)
+	resp, err := c.etcdClient.Get(c.Context(), c.policy(name), nil)
 	if err != nil {
 		return nil, errors.EtcdToErrored(err)
 	}
@@ -118,7 +131,7 @@ func (c *Client) GetPolicy(name string) (*Policy, error) {
 // ListPolicies provides an array of strings corresponding to the name of each
 // policy.
 func (c *Client) ListPolicies() ([]Policy, error) {
-	resp, err := c.etcdClient.Get(context.Background(), c.prefixed(rootPolicy), &client.GetOptions{Recursive: true, Sort: true})
+	resp, err := c.etcdClient.Get(c.Context(), c.prefixed(rootPolicy), &client.GetOptions{Recursive: true, Sort: true})
 	if err != nil {
 		return nil, errors.EtcdToErrored(err)
 	}
@@ -159,9 +172,24 @@ func (cfg *Policy) Validate() error {
 		return errored.Errorf("Size set to zero for non-empty CRUD backend %v", cfg.Backends.CRUD).Combine(err)
 	}
 
+	if cfg.Quota != nil {
+		if _, err := cfg.Quota.ActualSize(); err != nil {
+			return errored.Errorf("Invalid quota size %q", cfg.Quota.Size).Combine(err)
+		}
+	}
+
 	return nil
 }
 
+// RemoveMode returns the remove mode of the policy.
+func (cfg *Policy) RemoveMode() string {
+	if cfg.Remove == "" {
+		return RemoveNever
+	}
+
+	return cfg.Remove
+}
+
 func (cfg *Policy) String() string {
 	return cfg.Name
 }
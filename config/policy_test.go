@@ -80,6 +80,26 @@ var testPolicies = map[string]*Policy{
 		},
 		FileSystems: defaultFilesystems,
 	},
+	"badremove": {
+		Name:          "badremove",
+		Backend:       "ceph",
+		DriverOptions: map[string]string{"pool": "rbd"},
+		CreateOptions: CreateOptions{
+			Size:       "10MB",
+			FileSystem: defaultFilesystem,
+		},
+		Remove: "sometimes",
+	},
+	"badquota": {
+		Name:          "badquota",
+		Backend:       "ceph",
+		DriverOptions: map[string]string{"pool": "rbd"},
+		CreateOptions: CreateOptions{
+			Size:       "10MB",
+			FileSystem: defaultFilesystem,
+		},
+		Quota: &Quota{Size: "lots"},
+	},
 	"badsnaps": {
 		Name: "badsnaps",
 		Backends: &BackendDrivers{
@@ -242,11 +262,22 @@ func (s *configSuite) TestPolicyValidate(c *C) {
 }
 
 func (s *configSuite) TestPolicyBadPublish(c *C) {
-	for _, key := range []string{"nobackend", "badsize3", "badsnaps", "blanksizewithcrud"} {
+	for _, key := range []string{"nobackend", "badsize3", "badsnaps", "blanksizewithcrud", "badremove", "badquota"} {
 		c.Assert(s.tlc.PublishPolicy("test", testPolicies[key]), NotNil, Commentf(key))
 	}
 }
 
+func (s *configSuite) TestPolicyRemoveMode(c *C) {
+	c.Assert(testPolicies["basic"].RemoveMode(), Equals, RemoveNever)
+
+	policy := *testPolicies["basic"]
+	for _, mode := range []string{RemoveNever, RemoveRecordOnly, RemoveDestroy} {
+		policy.Remove = mode
+		c.Assert(policy.RemoveMode(), Equals, mode)
+		c.Assert(policy.Validate(), IsNil)
+	}
+}
+
 func (s *configSuite) TestPolicyPublishEtcdDown(c *C) {
 	stopStartEtcd(c, func() {
 		for _, key := range []string{"basic", "basic2"} {
@@ -0,0 +1,257 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/coreos/etcd/client"
+	units "github.com/docker/go-units"
+)
+
+// Quota limits what the volumes of a policy may consume. Zero values are
+// unlimited.
+type Quota struct {
+	Volumes   uint64 `json:"volumes,omitempty"`
+	Size      string `json:"size,omitempty"`
+	Snapshots uint64 `json:"snapshots,omitempty"`
+}
+
+// ActualSize returns the size quota as an integer of megabytes.
+func (q *Quota) ActualSize() (uint64, error) {
+	if strings.TrimSpace(q.Size) == "" {
+		return 0, nil
+	}
+
+	size, err := units.FromHumanSize(q.Size)
+	return uint64(size) / units.MB, err
+}
+
+// PolicyUsage is what the volumes of a policy consume. Size is in megabytes.
+// It is kept as a counter which is updated with compare-and-swap as volumes
+// and snapshots are created and removed.
+type PolicyUsage struct {
+	Volumes   uint64 `json:"volumes"`
+	Size      uint64 `json:"size"`
+	Snapshots uint64 `json:"snapshots"`
+}
+
+// check returns an error if the usage exceeds the quota.
+func (u *PolicyUsage) check(quota *Quota) error {
+	if quota == nil {
+		return nil
+	}
+
+	if quota.Volumes != 0 && u.Volumes > quota.Volumes {
+		return errors.QuotaExceeded.Combine(errored.Errorf("%d volumes exceeds the quota of %d", u.Volumes, quota.Volumes))
+	}
+
+	size, err := quota.ActualSize()
+	if err != nil {
+		return err
+	}
+
+	if size != 0 && u.Size > size {
+		return errors.QuotaExceeded.Combine(errored.Errorf("%dMB exceeds the quota of %dMB", u.Size, size))
+	}
+
+	if quota.Snapshots != 0 && u.Snapshots > quota.Snapshots {
+		return errors.QuotaExceeded.Combine(errored.Errorf("%d snapshots exceeds the quota of %d", u.Snapshots, quota.Snapshots))
+	}
+
+	return nil
+}
+
+// release subtracts delta, without going below zero; usage which predates
+// the counter is not tracked.
+func (u *PolicyUsage) release(delta PolicyUsage) {
+	sub := func(from *uint64, n uint64) {
+		if *from < n {
+			*from = 0
+		} else {
+			*from -= n
+		}
+	}
+
+	sub(&u.Volumes, delta.Volumes)
+	sub(&u.Size, delta.Size)
+	sub(&u.Snapshots, delta.Snapshots)
+}
+
+func (u *PolicyUsage) String() string {
+	return fmt.Sprintf("%d volumes, %dMB, %d snapshots", u.Volumes, u.Size, u.Snapshots)
+}
+
+func (c *Client) policyUsage(policy string) string {
+	return c.prefixed(rootPolicyUsage, policy)
+}
+
+// GetPolicyUsage retrieves the usage of a policy. A policy without volumes
+// has zero usage.
+func (c *Client) GetPolicyUsage(policy string) (*PolicyUsage, error) {
+	usage, _, err := c.getPolicyUsage(policy)
+	return usage, err
+}
+
+func (c *Client) getPolicyUsage(policy string) (*PolicyUsage, *client.Node, error) {
+	usage := &PolicyUsage{}
+
+	resp, err := c.etcdClient.Get(c.Context(), c.policyUsage(policy), nil)
+	if er, ok := err.(client.Error); ok && er.Code == client.ErrorCodeKeyNotFound {
+		return usage, nil, nil
+	} else if err != nil {
+		return nil, nil, errors.PolicyUsage.Combine(errors.EtcdToErrored(err))
+	}
+
+	if err := json.Unmarshal([]byte(resp.Node.Value), usage); err != nil {
+		return nil, nil, errors.PolicyUsage.Combine(err)
+	}
+
+	return usage, resp.Node, nil
+}
+
+// updatePolicyUsage applies f to the usage of the policy and swaps the result
+// in, retrying when another update got there first.
+func (c *Client) updatePolicyUsage(policy string, f func(*PolicyUsage) error) error {
+	for {
+		usage, node, err := c.getPolicyUsage(policy)
+		if err != nil {
+			return err
+		}
+
+		if err := f(usage); err != nil {
+			return err
+		}
+
+		content, err := json.Marshal(usage)
+		if err != nil {
+			return errors.PolicyUsage.Combine(err)
+		}
+
+		opts := &client.SetOptions{PrevExist: client.PrevNoExist}
+		if node != nil {
+			opts = &client.SetOptions{PrevIndex: node.ModifiedIndex}
+		}
+
+		_, err = c.etcdClient.Set(c.Context(), c.policyUsage(policy), string(content), opts)
+		if er, ok := err.(client.Error); ok && (er.Code == client.ErrorCodeTestFailed || er.Code == client.ErrorCodeNodeExist) {
+			continue
+		}
+
+		if err != nil {
+			return errors.PolicyUsage.Combine(errors.EtcdToErrored(err))
+		}
+
+		return nil
+	}
+}
+
+// ReservePolicyUsage adds delta to the usage of the policy, failing with
+// errors.QuotaExceeded if that exceeds the quota.
+func (c *Client) ReservePolicyUsage(policy string, quota *Quota, delta PolicyUsage) error {
+	return c.updatePolicyUsage(policy, func(usage *PolicyUsage) error {
+		usage.Volumes += delta.Volumes
+		usage.Size += delta.Size
+		usage.Snapshots += delta.Snapshots
+		return usage.check(quota)
+	})
+}
+
+// ReleasePolicyUsage subtracts delta from the usage of the policy.
+func (c *Client) ReleasePolicyUsage(policy string, delta PolicyUsage) error {
+	return c.updatePolicyUsage(policy, func(usage *PolicyUsage) error {
+		usage.release(delta)
+		return nil
+	})
+}
+
+// VolumeUsage is the usage a volume counts against its policy's quota.
+func VolumeUsage(vc *Volume) (PolicyUsage, error) {
+	size, err := vc.CreateOptions.ActualSize()
+	if err != nil {
+		return PolicyUsage{}, err
+	}
+
+	return PolicyUsage{Volumes: 1, Size: size}, nil
+}
+
+// CountPolicyUsage counts the usage of a policy from its volume records.
+// snapshots counts the snapshots of a volume.
+func (c *Client) CountPolicyUsage(policy string, snapshots func(*Volume) (uint64, error)) (*PolicyUsage, error) {
+	usage := &PolicyUsage{}
+
+	volumes, err := c.ListVolumes(policy)
+	if er, ok := err.(*errored.Error); ok && er.Contains(errors.NotExists) {
+		return usage, nil
+	} else if err != nil {
+		return nil, errors.PolicyUsage.Combine(err)
+	}
+
+	for _, vc := range volumes {
+		vu, err := VolumeUsage(vc)
+		if err != nil {
+			return nil, errors.PolicyUsage.Combine(err)
+		}
+
+		count, err := snapshots(vc)
+		if err != nil {
+			return nil, errors.PolicyUsage.Combine(errored.New(vc.String())).Combine(err)
+		}
+
+		usage.Volumes += vu.Volumes
+		usage.Size += vu.Size
+		usage.Snapshots += count
+	}
+
+	return usage, nil
+}
+
+// RecountPolicyUsage replaces the usage of the policy with a count of its
+// volumes, see CountPolicyUsage. The count is redone if the usage is updated
+// while counting.
+func (c *Client) RecountPolicyUsage(policy string, snapshots func(*Volume) (uint64, error)) (*PolicyUsage, error) {
+	var counted *PolicyUsage
+
+	err := c.updatePolicyUsage(policy, func(usage *PolicyUsage) error {
+		var err error
+		counted, err = c.CountPolicyUsage(policy, snapshots)
+		if err != nil {
+			return err
+		}
+
+		*usage = *counted
+		return nil
+	})
+
+	return counted, err
+}
+
+// SeedPolicyUsage counts the usage of a policy which has none yet, such as
+// one whose volumes predate quotas. It returns true if the usage was seeded.
+func (c *Client) SeedPolicyUsage(policy string, snapshots func(*Volume) (uint64, error)) (bool, error) {
+	_, node, err := c.getPolicyUsage(policy)
+	if err != nil || node != nil {
+		return false, err
+	}
+
+	usage, err := c.CountPolicyUsage(policy, snapshots)
+	if err != nil {
+		return false, err
+	}
+
+	content, err := json.Marshal(usage)
+	if err != nil {
+		return false, errors.PolicyUsage.Combine(err)
+	}
+
+	_, err = c.etcdClient.Set(c.Context(), c.policyUsage(policy), string(content), &client.SetOptions{PrevExist: client.PrevNoExist})
+	if er, ok := err.(client.Error); ok && er.Code == client.ErrorCodeNodeExist {
+		return false, nil
+	} else if err != nil {
+		return false, errors.PolicyUsage.Combine(errors.EtcdToErrored(err))
+	}
+
+	return true, nil
+}
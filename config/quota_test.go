@@ -0,0 +1,44 @@
+package config
+
+import (
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *configSuite) TestPolicyUsage(c *C) {
+	usage, err := s.tlc.GetPolicyUsage("policy1")
+	c.Assert(err, IsNil)
+	c.Assert(*usage, DeepEquals, PolicyUsage{})
+
+	quota := &Quota{Volumes: 2, Size: "1GB", Snapshots: 1}
+	vol := PolicyUsage{Volumes: 1, Size: 400}
+
+	c.Assert(s.tlc.ReservePolicyUsage("policy1", quota, vol), IsNil)
+	c.Assert(s.tlc.ReservePolicyUsage("policy1", quota, vol), IsNil)
+
+	// a third volume exceeds both the volume and size quota and is not counted.
+	err = s.tlc.ReservePolicyUsage("policy1", quota, vol)
+	c.Assert(err, NotNil)
+	c.Assert(err.(*errored.Error).Contains(errors.QuotaExceeded), Equals, true)
+
+	c.Assert(s.tlc.ReservePolicyUsage("policy1", quota, PolicyUsage{Snapshots: 1}), IsNil)
+	c.Assert(s.tlc.ReservePolicyUsage("policy1", quota, PolicyUsage{Snapshots: 1}), NotNil)
+
+	usage, err = s.tlc.GetPolicyUsage("policy1")
+	c.Assert(err, IsNil)
+	c.Assert(*usage, DeepEquals, PolicyUsage{Volumes: 2, Size: 800, Snapshots: 1})
+
+	c.Assert(s.tlc.ReleasePolicyUsage("policy1", vol), IsNil)
+	c.Assert(s.tlc.ReservePolicyUsage("policy1", quota, vol), IsNil)
+
+	// releasing more than is counted stops at zero.
+	c.Assert(s.tlc.ReleasePolicyUsage("policy1", PolicyUsage{Volumes: 5, Size: 5000, Snapshots: 5}), IsNil)
+	usage, err = s.tlc.GetPolicyUsage("policy1")
+	c.Assert(err, IsNil)
+	c.Assert(*usage, DeepEquals, PolicyUsage{})
+
+	// no quota is unlimited.
+	c.Assert(s.tlc.ReservePolicyUsage("policy1", nil, PolicyUsage{Volumes: 100, Size: 1000000}), IsNil)
+}
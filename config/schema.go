@@ -5,6 +5,15 @@ var (
 	RuntimeSchema = `{
 		"title": "Runtime config validation",
 		"type": "object",
+		"properties": {
+			"alerts": {
+				"type": "object",
+				"properties": {
+					"used-percent": { "type": "number", "minimum": 0, "maximum": 100 },
+					"inodes-percent": { "type": "number", "minimum": 0, "maximum": 100 }
+				}
+			}
+		},
 		"oneOf": [ {
 			"properties": {
 				"snapshots": { "enum": [ true ] },
@@ -37,7 +46,17 @@ var (
 				},
 				"required": [ "mount" ]
 			}, 
-			"backend": { "enum": [ "ceph", "nfs" ] }
+			"backend": { "enum": [ "ceph", "nfs" ] },
+			"constraints": { "type": "object", "additionalProperties": { "type": "string" } },
+			"remove": { "enum": [ "never", "record-only", "destroy" ] },
+			"quota": {
+				"type": "object",
+				"properties": {
+					"volumes": { "type": "number", "minimum": 0 },
+					"size": { "type": "string" },
+					"snapshots": { "type": "number", "minimum": 0 }
+				}
+			}
 		},
 		"anyOf": [
 			{ "required": [ "backend" ] },
@@ -61,7 +80,8 @@ var (
 					"snapshot": { "type": "string", "enum": [ "ceph", "" ] }
 				},
 				"required": [ "mount" ]
-			}
+			},
+			"constraints": { "type": "object", "additionalProperties": { "type": "string" } }
 		},
 		"required": [ "name", "policy", "backends" ]
 	}`
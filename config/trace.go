@@ -0,0 +1,58 @@
+package config
+
+import (
+	"github.com/contiv/volplugin/trace"
+	"github.com/coreos/etcd/client"
+
+	// the etcd client is built against its own copy of the context package;
+	// KeysAPI's methods must be implemented with it.
+	"github.com/coreos/etcd/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+// tracedKeysAPI records a span for each etcd call made while a request is
+// being traced.
+type tracedKeysAPI struct {
+	client.KeysAPI
+}
+
+func startEtcdSpan(ctx context.Context, op, key string) (*trace.Span, context.Context) {
+	span, ctx := trace.StartChild(ctx, "etcd "+op)
+	span.SetTag("key", key)
+	return span, ctx
+}
+
+func (t tracedKeysAPI) Get(ctx context.Context, key string, opts *client.GetOptions) (resp *client.Response, err error) {
+	span, ctx := startEtcdSpan(ctx, "get", key)
+	defer func() { span.Finish(err) }()
+	return t.KeysAPI.Get(ctx, key, opts)
+}
+
+func (t tracedKeysAPI) Set(ctx context.Context, key, value string, opts *client.SetOptions) (resp *client.Response, err error) {
+	span, ctx := startEtcdSpan(ctx, "set", key)
+	defer func() { span.Finish(err) }()
+	return t.KeysAPI.Set(ctx, key, value, opts)
+}
+
+func (t tracedKeysAPI) Delete(ctx context.Context, key string, opts *client.DeleteOptions) (resp *client.Response, err error) {
+	span, ctx := startEtcdSpan(ctx, "delete", key)
+	defer func() { span.Finish(err) }()
+	return t.KeysAPI.Delete(ctx, key, opts)
+}
+
+func (t tracedKeysAPI) Create(ctx context.Context, key, value string) (resp *client.Response, err error) {
+	span, ctx := startEtcdSpan(ctx, "create", key)
+	defer func() { span.Finish(err) }()
+	return t.KeysAPI.Create(ctx, key, value)
+}
+
+func (t tracedKeysAPI) CreateInOrder(ctx context.Context, dir, value string, opts *client.CreateInOrderOptions) (resp *client.Response, err error) {
+	span, ctx := startEtcdSpan(ctx, "create-in-order", dir)
+	defer func() { span.Finish(err) }()
+	return t.KeysAPI.CreateInOrder(ctx, dir, value, opts)
+}
+
+func (t tracedKeysAPI) Update(ctx context.Context, key, value string) (resp *client.Response, err error) {
+	span, ctx := startEtcdSpan(ctx, "update", key)
+	defer func() { span.Finish(err) }()
+	return t.KeysAPI.Update(ctx, key, value)
+}
@@ -6,14 +6,34 @@ import (
 	"strings"
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/errors"
 	"github.com/coreos/etcd/client"
 
-	"golang.org/x/net/context"
+	// see trace.go.
+	"github.com/coreos/etcd/Godeps/_workspace/src/golang.org/x/net/context"
 )
 
+// leaser is implemented by stores which attach keys to a lease they keep
+// alive, instead of expiring them after their TTL.
+type leaser interface {
+	SetLeased(ctx context.Context, key, value string, opts *client.SetOptions) (*client.Response, error)
+}
+
+// atomicCreator is implemented by stores which can create several keys in one
+// transaction.
+type atomicCreator interface {
+	CreateAll(ctx context.Context, creates []*createRequest) error
+}
+
+// createRequest is a key for an atomicCreator to create. If MayExist is set,
+// the key may already hold the value.
+type createRequest struct {
+	Key      string
+	Value    string
+	MayExist bool
+}
+
 var (
 	// UseTypeMount is the string type of mount use locks
 	UseTypeMount = "mount"
@@ -133,16 +153,16 @@ func (c *Client) PublishUse(ut UseLocker) error {
 		return err
 	}
 
-	_, err = c.etcdClient.Set(context.Background(), c.use(ut.Type(), ut.GetVolume()), string(content), &client.SetOptions{PrevExist: client.PrevNoExist})
+	_, err = c.etcdClient.Set(c.Context(), c.use(ut.Type(), ut.GetVolume()), string(content), &client.SetOptions{PrevExist: client.PrevNoExist})
 	if _, ok := err.(client.Error); ok && err.(client.Error).Code == client.ErrorCodeNodeExist {
 		if ut.MayExist() {
-			_, err := c.etcdClient.Set(context.Background(), c.use(ut.Type(), ut.GetVolume()), string(content), &client.SetOptions{PrevExist: client.PrevExist, PrevValue: string(content)})
+			_, err := c.etcdClient.Set(c.Context(), c.use(ut.Type(), ut.GetVolume()), string(content), &client.SetOptions{PrevExist: client.PrevExist, PrevValue: string(content)})
 			return errors.EtcdToErrored(err)
 		}
 		return errors.Exists.Combine(err)
 	}
 
-	logrus.Debugf("Publishing use: (error: %v) %#v", err, ut)
+	log.Debugf("Publishing use: (error: %v) %#v", err, ut)
 	return errors.EtcdToErrored(err)
 }
 
@@ -156,18 +176,27 @@ func (c *Client) PublishUseWithTTL(ut UseLocker, ttl time.Duration) error {
 
 	if ttl < 0 {
 		err := errored.Errorf("TTL was less than 0 for locker %#v!!!! This should not happen!", ut)
-		logrus.Error(err)
+		log.Error(err)
 		return err
 	}
 
-	logrus.Debugf("Publishing use with TTL %v: %#v", ttl, ut)
+	log.Debugf("Publishing use with TTL %v: %#v", ttl, ut)
 	value := string(content)
 
+	set := c.etcdClient.Set
+	if l, ok := c.store().(leaser); ok {
+		set = func(ctx context.Context, key, value string, opts *client.SetOptions) (resp *client.Response, err error) {
+			span, ctx := startEtcdSpan(ctx, "set-leased", key)
+			defer func() { span.Finish(err) }()
+			return l.SetLeased(ctx, key, value, opts)
+		}
+	}
+
 	// attempt to set the lock. If the lock cannot be set and it is is empty, attempt to set it now.
-	_, err = c.etcdClient.Set(context.Background(), c.use(ut.Type(), ut.GetVolume()), string(content), &client.SetOptions{TTL: ttl, PrevValue: value})
+	_, err = set(c.Context(), c.use(ut.Type(), ut.GetVolume()), string(content), &client.SetOptions{TTL: ttl, PrevValue: value})
 	if err != nil {
 		if er, ok := errors.EtcdToErrored(err).(*errored.Error); ok && er.Contains(errors.NotExists) {
-			_, err := c.etcdClient.Set(context.Background(), c.use(ut.Type(), ut.GetVolume()), string(content), &client.SetOptions{TTL: ttl, PrevExist: client.PrevNoExist})
+			_, err := set(c.Context(), c.use(ut.Type(), ut.GetVolume()), string(content), &client.SetOptions{TTL: ttl, PrevExist: client.PrevNoExist})
 			if err != nil {
 				return errors.PublishMount.Combine(err)
 			}
@@ -179,6 +208,63 @@ func (c *Client) PublishUseWithTTL(ut UseLocker, ttl time.Duration) error {
 	return nil
 }
 
+// KeepsUsesAlive is true if the store keeps uses published with
+// PublishUseWithTTL alive itself for as long as the process runs, so they do
+// not need to be published again before the TTL runs out.
+func (c *Client) KeepsUsesAlive() bool {
+	_, ok := c.store().(leaser)
+	return ok
+}
+
+// PublishUses publishes all the uses or none of them. If any of the uses
+// cannot be published, errors.Exists is returned.
+func (c *Client) PublishUses(uts []UseLocker) error {
+	creator, ok := c.store().(atomicCreator)
+	if !ok {
+		return c.publishUses(uts)
+	}
+
+	creates := []*createRequest{}
+	for _, ut := range uts {
+		content, err := json.Marshal(ut)
+		if err != nil {
+			return err
+		}
+
+		creates = append(creates, &createRequest{Key: c.use(ut.Type(), ut.GetVolume()), Value: string(content), MayExist: ut.MayExist()})
+	}
+
+	log.Debugf("Publishing uses: %#v", uts)
+
+	span, ctx := startEtcdSpan(c.Context(), "create-all", c.prefixed(rootUse))
+	err := creator.CreateAll(ctx, creates)
+	span.Finish(err)
+
+	if _, ok := err.(client.Error); ok {
+		return errors.Exists.Combine(err)
+	}
+
+	return err
+}
+
+// publishUses publishes the uses one by one, removing those it published if
+// one fails.
+func (c *Client) publishUses(uts []UseLocker) error {
+	for i, ut := range uts {
+		if err := c.PublishUse(ut); err != nil {
+			for _, published := range uts[:i] {
+				if err := c.RemoveUse(published, false); err != nil {
+					log.Errorf("Could not remove use lock %#v: %v", published, err)
+				}
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
 // RemoveUse will remove a user from etcd. Does not fail if the user does
 // not exist.
 func (c *Client) RemoveUse(ut UseLocker, force bool) error {
@@ -187,20 +273,40 @@ func (c *Client) RemoveUse(ut UseLocker, force bool) error {
 		return err
 	}
 
-	logrus.Debugf("Removing Use Lock: %#v", ut)
+	log.Debugf("Removing Use Lock: %#v", ut)
 
 	opts := &client.DeleteOptions{PrevValue: string(content)}
 	if force {
 		opts = nil
 	}
 
-	_, err = c.etcdClient.Delete(context.Background(), c.use(ut.Type(), ut.GetVolume()), opts)
+	_, err = c.etcdClient.Delete(c.Context(), c.use(ut.Type(), ut.GetVolume()), opts)
 	return errors.EtcdToErrored(err)
 }
 
+// UseHeld is true if the use cannot be published because it is held by
+// someone else.
+func (c *Client) UseHeld(ut UseLocker) (bool, error) {
+	content, err := json.Marshal(ut)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.etcdClient.Get(c.Context(), c.use(ut.Type(), ut.GetVolume()), nil)
+	if err != nil {
+		if er, ok := errors.EtcdToErrored(err).(*errored.Error); ok && er.Contains(errors.NotExists) {
+			return false, nil
+		}
+
+		return false, errors.EtcdToErrored(err)
+	}
+
+	return !ut.MayExist() || resp.Node.Value != string(content), nil
+}
+
 // GetUse retrieves the UseMount for the given volume name.
 func (c *Client) GetUse(ut UseLocker, vc *Volume) error {
-	resp, err := c.etcdClient.Get(context.Background(), c.use(ut.Type(), vc.String()), nil)
+	resp, err := c.etcdClient.Get(c.Context(), c.use(ut.Type(), vc.String()), nil)
 	if err != nil {
 		return errors.EtcdToErrored(err)
 	}
@@ -214,7 +320,7 @@ func (c *Client) GetUse(ut UseLocker, vc *Volume) error {
 
 // ListUses lists the items in use.
 func (c *Client) ListUses(typ string) ([]string, error) {
-	resp, err := c.etcdClient.Get(context.Background(), c.prefixed(rootUse, typ), &client.GetOptions{Sort: true, Recursive: true})
+	resp, err := c.etcdClient.Get(c.Context(), c.prefixed(rootUse, typ), &client.GetOptions{Sort: true, Recursive: true})
 	if err != nil {
 		return nil, errors.EtcdToErrored(err)
 	}
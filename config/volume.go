@@ -6,7 +6,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/errors"
 	"github.com/contiv/volplugin/merge"
@@ -16,7 +15,6 @@ import (
 	"github.com/docker/go-units"
 
 	"github.com/coreos/etcd/client"
-	"golang.org/x/net/context"
 )
 
 // Volume is the configuration of the policy. It includes pool and
@@ -30,6 +28,7 @@ type Volume struct {
 	CreateOptions  CreateOptions     `json:"create"`
 	RuntimeOptions RuntimeOptions    `json:"runtime"`
 	Backends       *BackendDrivers   `json:"backends,omitempty"`
+	Constraints    map[string]string `json:"constraints,omitempty"`
 }
 
 // CreateOptions are the set of options used by apiserver during the volume
@@ -45,6 +44,14 @@ type RuntimeOptions struct {
 	UseSnapshots bool            `json:"snapshots" merge:"snapshots"`
 	Snapshot     SnapshotConfig  `json:"snapshot"`
 	RateLimit    RateLimitConfig `json:"rate-limit,omitempty"`
+	Alerts       AlertConfig     `json:"alerts,omitempty"`
+}
+
+// AlertConfig are the thresholds, in percent, past which the usage of a
+// mounted volume is reported as an alert. Zero disables a threshold.
+type AlertConfig struct {
+	UsedPercent   uint `json:"used-percent,omitempty" merge:"alerts.used-percent"`
+	InodesPercent uint `json:"inodes-percent,omitempty" merge:"alerts.inodes-percent"`
 }
 
 // RateLimitConfig is the configuration for limiting the rate of disk access.
@@ -74,8 +81,8 @@ func (c *Client) PublishVolumeRuntime(vo *Volume, ro RuntimeOptions) error {
 		return err
 	}
 
-	c.etcdClient.Set(context.Background(), c.prefixed(rootVolume, vo.PolicyName, vo.VolumeName), "", &client.SetOptions{Dir: true})
-	if _, err := c.etcdClient.Set(context.Background(), c.volume(vo.PolicyName, vo.VolumeName, "runtime"), string(content), nil); err != nil {
+	c.etcdClient.Set(c.Context(), c.prefixed(rootVolume, vo.PolicyName, vo.VolumeName), "", &client.SetOptions{Dir: true})
+	if _, err := c.etcdClient.Set(c.Context(), c.volume(vo.PolicyName, vo.VolumeName, "runtime"), string(content), nil); err != nil {
 		return errors.EtcdToErrored(err)
 	}
 
@@ -118,6 +125,7 @@ func (c *Client) CreateVolume(rc *VolumeRequest) (*Volume, error) {
 		PolicyName:     rc.Policy,
 		VolumeName:     rc.Name,
 		MountSource:    mount,
+		Constraints:    resp.Constraints,
 	}
 
 	if err := vc.Validate(); err != nil {
@@ -142,9 +150,9 @@ func (c *Client) PublishVolume(vc *Volume) error {
 		return err
 	}
 
-	c.etcdClient.Set(context.Background(), c.prefixed(rootVolume, vc.PolicyName, vc.VolumeName), "", &client.SetOptions{Dir: true})
+	c.etcdClient.Set(c.Context(), c.prefixed(rootVolume, vc.PolicyName, vc.VolumeName), "", &client.SetOptions{Dir: true})
 
-	if _, err := c.etcdClient.Set(context.Background(), c.volume(vc.PolicyName, vc.VolumeName, "create"), string(remarshal), &client.SetOptions{PrevExist: client.PrevNoExist}); err != nil {
+	if _, err := c.etcdClient.Set(c.Context(), c.volume(vc.PolicyName, vc.VolumeName, "create"), string(remarshal), &client.SetOptions{PrevExist: client.PrevNoExist}); err != nil {
 		return errors.Exists
 	}
 
@@ -167,7 +175,7 @@ func (co *CreateOptions) ActualSize() (uint64, error) {
 // GetVolume returns the Volume for a given volume.
 func (c *Client) GetVolume(policy, name string) (*Volume, error) {
 	// FIXME make this take a single string and not a split one
-	resp, err := c.etcdClient.Get(context.Background(), c.volume(policy, name, "create"), nil)
+	resp, err := c.etcdClient.Get(c.Context(), c.volume(policy, name, "create"), nil)
 	if err != nil {
 		return nil, errors.EtcdToErrored(err)
 	}
@@ -196,7 +204,7 @@ func (c *Client) GetVolume(policy, name string) (*Volume, error) {
 func (c *Client) GetVolumeRuntime(policy, name string) (RuntimeOptions, error) {
 	runtime := RuntimeOptions{}
 
-	resp, err := c.etcdClient.Get(context.Background(), c.volume(policy, name, "runtime"), nil)
+	resp, err := c.etcdClient.Get(c.Context(), c.volume(policy, name, "runtime"), nil)
 	if err != nil {
 		return runtime, errors.EtcdToErrored(err)
 	}
@@ -206,8 +214,8 @@ func (c *Client) GetVolumeRuntime(policy, name string) (RuntimeOptions, error) {
 
 // RemoveVolume removes a volume from configuration.
 func (c *Client) RemoveVolume(policy, name string) error {
-	logrus.Debugf("Removing volume %s/%s from database", policy, name)
-	_, err := c.etcdClient.Delete(context.Background(), c.prefixed(rootVolume, policy, name), &client.DeleteOptions{Recursive: true})
+	log.Debugf("Removing volume %s/%s from database", policy, name)
+	_, err := c.etcdClient.Delete(c.Context(), c.prefixed(rootVolume, policy, name), &client.DeleteOptions{Recursive: true})
 	return errors.EtcdToErrored(err)
 }
 
@@ -215,7 +223,7 @@ func (c *Client) RemoveVolume(policy, name string) error {
 func (c *Client) ListVolumes(policy string) (map[string]*Volume, error) {
 	policyPath := c.prefixed(rootVolume, policy)
 
-	resp, err := c.etcdClient.Get(context.Background(), policyPath, &client.GetOptions{Recursive: true, Sort: true})
+	resp, err := c.etcdClient.Get(c.Context(), policyPath, &client.GetOptions{Recursive: true, Sort: true})
 	if err != nil {
 		return nil, errors.EtcdToErrored(err)
 	}
@@ -271,7 +279,7 @@ func (c *Client) ListVolumes(policy string) (map[string]*Volume, error) {
 // apiserver knows about. Volumes have syntax: policy/volumeName which will be
 // reflected in the returned string.
 func (c *Client) ListAllVolumes() ([]string, error) {
-	resp, err := c.etcdClient.Get(context.Background(), c.prefixed(rootVolume), &client.GetOptions{Recursive: true, Sort: true})
+	resp, err := c.etcdClient.Get(c.Context(), c.prefixed(rootVolume), &client.GetOptions{Recursive: true, Sort: true})
 	if err != nil {
 		if er, ok := errors.EtcdToErrored(err).(*errored.Error); ok && er.Contains(errors.NotExists) {
 			return []string{}, nil
@@ -298,7 +306,7 @@ func (c *Client) WatchVolumeRuntimes(activity chan *watch.Watch) {
 		vw := &watch.Watch{Key: strings.TrimPrefix(resp.Node.Key, c.prefixed(rootVolume)+"/")}
 
 		if !resp.Node.Dir && path.Base(resp.Node.Key) == "runtime" {
-			logrus.Debugf("Handling watch event %q for volume %q", resp.Action, vw.Key)
+			log.Debugf("Handling watch event %q for volume %q", resp.Action, vw.Key)
 			if resp.Action != "delete" {
 				if resp.Node.Value != "" {
 					volName := strings.TrimPrefix(path.Dir(vw.Key), c.prefixed(rootVolume)+"/")
@@ -307,7 +315,7 @@ func (c *Client) WatchVolumeRuntimes(activity chan *watch.Watch) {
 					vw.Key = volName
 					volume, err := c.GetVolume(policy, vol)
 					if err != nil {
-						logrus.Errorf("Could not retrieve volume %q after watch notification: %v", volName, err)
+						log.Errorf("Could not retrieve volume %q after watch notification: %v", volName, err)
 						return
 					}
 					vw.Config = volume
@@ -323,13 +331,13 @@ func (c *Client) WatchVolumeRuntimes(activity chan *watch.Watch) {
 
 // TakeSnapshot immediately takes a snapshot by signaling the volsupervisor through etcd.
 func (c *Client) TakeSnapshot(name string) error {
-	_, err := c.etcdClient.Set(context.Background(), c.prefixed(rootSnapshots, name), "", nil)
+	_, err := c.etcdClient.Set(c.Context(), c.prefixed(rootSnapshots, name), "", nil)
 	return errors.EtcdToErrored(err)
 }
 
 // RemoveTakeSnapshot removes a reference to a taken snapshot, intended to be used by volsupervisor
 func (c *Client) RemoveTakeSnapshot(name string) error {
-	_, err := c.etcdClient.Delete(context.Background(), c.prefixed(rootSnapshots, name), nil)
+	_, err := c.etcdClient.Delete(c.Context(), c.prefixed(rootSnapshots, name), nil)
 	return errors.EtcdToErrored(err)
 }
 
@@ -431,7 +439,7 @@ func (c *Client) IsVolumeInUse(cfg *Volume, global *Global) (bool, error) {
 				return er.Contains(errors.Exists), c.RemoveUse(uc, false)
 			}
 
-			logrus.Errorf("Error received checking for volume in-use status: %v", err)
+			log.Errorf("Error received checking for volume in-use status: %v", err)
 
 			return false, c.RemoveUse(uc, false)
 		}
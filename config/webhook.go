@@ -0,0 +1,130 @@
+package config
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"github.com/coreos/etcd/client"
+)
+
+var eventTypes = map[string]struct{}{
+	EventCreated:        {},
+	EventMounted:        {},
+	EventUnmounted:      {},
+	EventSnapshotTaken:  {},
+	EventSnapshotPruned: {},
+	EventSnapshotFailed: {},
+	EventLockStolen:     {},
+	EventRemoved:        {},
+}
+
+// RedactedSecret stands in for webhook secrets in the global configuration
+// served by the apiserver.
+const RedactedSecret = "<redacted>"
+
+// Webhook is a receiver of volume events, configured in the global
+// configuration. Events are POSTed to the URL as JSON and signed with the
+// secret, if one is set. An empty Events or Policies list matches everything.
+type Webhook struct {
+	URL      string   `json:"url"`
+	Events   []string `json:"events,omitempty"`
+	Policies []string `json:"policies,omitempty"`
+	Secret   string   `json:"secret,omitempty"`
+}
+
+// Validate ensures the webhook has an http(s) URL and only filters on known
+// event types.
+func (wh *Webhook) Validate() error {
+	u, err := url.Parse(wh.URL)
+	if err != nil {
+		return errors.InvalidWebhook.Combine(err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.InvalidWebhook.Combine(errored.Errorf("URL %q is not an http or https URL", wh.URL))
+	}
+
+	for _, typ := range wh.Events {
+		if _, ok := eventTypes[typ]; !ok {
+			return errors.InvalidWebhook.Combine(errored.Errorf("Unknown event type %q for %q", typ, wh.URL))
+		}
+	}
+
+	return nil
+}
+
+// Matches is true if the event should be delivered to the webhook.
+func (wh *Webhook) Matches(ev *Event) bool {
+	return matchesFilter(wh.Events, ev.Type) && matchesFilter(wh.Policies, strings.SplitN(ev.Volume, "/", 2)[0])
+}
+
+func matchesFilter(filter []string, value string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+
+	for _, item := range filter {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DeadLetter is the record of an event which could not be delivered to a
+// webhook receiver. Dead letters are kept until removed.
+type DeadLetter struct {
+	Index    uint64    `json:"index"`
+	URL      string    `json:"url"`
+	Event    *Event    `json:"event"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	Time     time.Time `json:"time"`
+}
+
+// PublishDeadLetter records an undeliverable event.
+func (c *Client) PublishDeadLetter(dl *DeadLetter) error {
+	content, err := json.Marshal(dl)
+	if err != nil {
+		return errors.DeadLetter.Combine(err)
+	}
+
+	resp, err := c.etcdClient.CreateInOrder(c.Context(), c.prefixed(rootDeadLetter), string(content), nil)
+	if err != nil {
+		return errors.DeadLetter.Combine(errors.EtcdToErrored(err))
+	}
+
+	dl.Index = resp.Node.CreatedIndex
+	return nil
+}
+
+// ListDeadLetters lists the undeliverable events, oldest first.
+func (c *Client) ListDeadLetters() ([]*DeadLetter, error) {
+	resp, err := c.etcdClient.Get(c.Context(), c.prefixed(rootDeadLetter), &client.GetOptions{Sort: true, Recursive: true})
+	if er, ok := err.(client.Error); ok && er.Code == client.ErrorCodeKeyNotFound {
+		return []*DeadLetter{}, nil
+	} else if err != nil {
+		return nil, errors.DeadLetter.Combine(errors.EtcdToErrored(err))
+	}
+
+	letters := []*DeadLetter{}
+
+	sort.Sort(byCreation(resp.Node.Nodes))
+	for _, node := range resp.Node.Nodes {
+		dl := &DeadLetter{}
+		if err := json.Unmarshal([]byte(node.Value), dl); err != nil {
+			return nil, errors.DeadLetter.Combine(err)
+		}
+		dl.Index = node.CreatedIndex
+
+		letters = append(letters, dl)
+	}
+
+	return letters, nil
+}
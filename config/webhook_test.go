@@ -0,0 +1,40 @@
+package config
+
+import . "gopkg.in/check.v1"
+
+func (s *configSuite) TestWebhookValidate(c *C) {
+	c.Assert((&Webhook{URL: "https://example.com/hook"}).Validate(), IsNil)
+	c.Assert((&Webhook{URL: "http://example.com", Events: []string{EventCreated, EventLockStolen}}).Validate(), IsNil)
+	c.Assert((&Webhook{URL: "ftp://example.com"}).Validate(), NotNil)
+	c.Assert((&Webhook{URL: "example.com"}).Validate(), NotNil)
+	c.Assert((&Webhook{URL: "http://example.com", Events: []string{"exploded"}}).Validate(), NotNil)
+
+	global := NewGlobalConfig()
+	global.Webhooks = []*Webhook{{URL: "http://example.com"}, {URL: ""}}
+	c.Assert(global.Validate(), NotNil)
+}
+
+func (s *configSuite) TestWebhookMatches(c *C) {
+	ev := NewEvent(EventMounted, "policy1/foo", "host1", "")
+
+	c.Assert((&Webhook{}).Matches(ev), Equals, true)
+	c.Assert((&Webhook{Events: []string{EventMounted}}).Matches(ev), Equals, true)
+	c.Assert((&Webhook{Events: []string{EventCreated}}).Matches(ev), Equals, false)
+	c.Assert((&Webhook{Policies: []string{"policy1"}}).Matches(ev), Equals, true)
+	c.Assert((&Webhook{Events: []string{EventMounted}, Policies: []string{"policy2"}}).Matches(ev), Equals, false)
+}
+
+func (s *configSuite) TestDeadLetters(c *C) {
+	letters, err := s.tlc.ListDeadLetters()
+	c.Assert(err, IsNil)
+	c.Assert(len(letters), Equals, 0)
+
+	ev := NewEvent(EventRemoved, "policy1/foo", "host1", "")
+	c.Assert(s.tlc.PublishDeadLetter(&DeadLetter{URL: "http://example.com", Event: ev, Attempts: 6, Error: "refused"}), IsNil)
+
+	letters, err = s.tlc.ListDeadLetters()
+	c.Assert(err, IsNil)
+	c.Assert(len(letters), Equals, 1)
+	c.Assert(letters[0].Event.Type, Equals, EventRemoved)
+	c.Assert(letters[0].Attempts, Equals, 6)
+}
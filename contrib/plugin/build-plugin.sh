@@ -0,0 +1,19 @@
+#!/bin/bash
+#
+# Builds the docker managed plugin from the contiv/volplugin image.
+#
+# usage: build-plugin.sh [plugin name]
+
+set -e
+
+name=${1:-contiv/volplugin-plugin}
+dir=$(mktemp -d)
+trap "rm -rf ${dir}" EXIT
+
+id=$(docker create contiv/volplugin true)
+mkdir -p "${dir}/rootfs"
+docker export "${id}" | tar -x -C "${dir}/rootfs"
+docker rm -v "${id}"
+
+cp "$(dirname $0)/config.json" "${dir}"
+docker plugin create "${name}" "${dir}"
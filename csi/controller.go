@@ -0,0 +1,417 @@
+package csi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/auth"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/logging"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/backend"
+	units "github.com/docker/go-units"
+)
+
+// Controller is the CSI Controller service. Volumes are created and removed
+// by the apiserver at APIServer; snapshots are taken by the snapshot driver
+// of the volume's backend. Credentials, if set, are presented to the
+// apiserver.
+type Controller struct {
+	Client      *config.Client
+	APIServer   string
+	Credentials *auth.Credentials
+}
+
+// NewController returns the controller service.
+func NewController(client *config.Client, apiserver string) *Controller {
+	return &Controller{Client: client, APIServer: apiserver}
+}
+
+// ControllerGetCapabilities returns the capabilities of the controller.
+func (c *Controller) ControllerGetCapabilities() (*ControllerGetCapabilitiesResponse, error) {
+	return &ControllerGetCapabilitiesResponse{
+		Capabilities: []string{
+			CapabilityCreateDeleteVolume,
+			CapabilityCreateDeleteSnapshot,
+			CapabilityListSnapshots,
+		},
+	}, nil
+}
+
+func (c *Controller) request(method, path string, req interface{}) (int, []byte, error) {
+	content, err := json.Marshal(req)
+	if err != nil {
+		return 0, nil, errors.MarshalVolume.Combine(err)
+	}
+
+	creds := c.Credentials
+	if creds == nil {
+		creds = &auth.Credentials{}
+	}
+
+	client, err := creds.Client()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	httpReq, err := http.NewRequest(method, creds.URL(c.APIServer, path), bytes.NewBuffer(content))
+	if err != nil {
+		return 0, nil, err
+	}
+	httpReq.Header.Set(logging.RequestIDHeader, logging.NewRequestID())
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return 0, nil, errors.VolmasterRequest.Combine(err)
+	}
+	defer resp.Body.Close()
+
+	content, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, errors.ReadBody.Combine(err)
+	}
+
+	return resp.StatusCode, content, nil
+}
+
+func notExists(err error) bool {
+	erd, ok := err.(*errored.Error)
+	return ok && erd.Contains(errors.NotExists)
+}
+
+func toVolume(vol *config.Volume) (*Volume, error) {
+	size, err := vol.CreateOptions.ActualSize()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Volume{
+		VolumeID:      vol.String(),
+		CapacityBytes: int64(size) * units.MB,
+		VolumeContext: map[string]string{ParameterPolicy: vol.PolicyName},
+	}, nil
+}
+
+// CreateVolume creates the volume through the apiserver. The parameters are
+// merged into the policy the same way docker's driver options are, so invalid
+// options are refused before the apiserver is called. Creating a volume which
+// already exists with the same size returns the volume.
+func (c *Controller) CreateVolume(req *CreateVolumeRequest) (*CreateVolumeResponse, error) {
+	if req.Name == "" {
+		return nil, newError(InvalidArgument, errored.Errorf("Volume name is required"))
+	}
+
+	policy, opts, err := volumeOptions(req.Parameters, req.CapacityRange)
+	if err != nil {
+		return nil, err
+	}
+
+	vr := &config.VolumeRequest{Policy: policy, Name: req.Name, Options: opts}
+
+	// CreateVolume modifies the options, so it is handed a copy.
+	validate := &config.VolumeRequest{Policy: policy, Name: req.Name, Options: map[string]string{}}
+	for key, value := range opts {
+		validate.Options[key] = value
+	}
+
+	requested, err := c.Client.CreateVolume(validate)
+	if err != nil {
+		return nil, newError(InvalidArgument, errors.ConfiguringVolume.Combine(err))
+	}
+
+	existing, err := c.Client.GetVolume(policy, req.Name)
+	if err == nil {
+		if existing.CreateOptions.Size != requested.CreateOptions.Size {
+			return nil, newError(AlreadyExists, errors.Exists.Combine(errored.Errorf("Volume %q exists with size %q", existing, existing.CreateOptions.Size)))
+		}
+
+		vol, err := toVolume(existing)
+		if err != nil {
+			return nil, newError(Internal, err)
+		}
+
+		return &CreateVolumeResponse{Volume: vol}, nil
+	} else if !notExists(err) {
+		return nil, newError(Internal, errors.GetVolume.Combine(err))
+	}
+
+	status, content, err := c.request("POST", "/volumes/create", vr)
+	if err != nil {
+		return nil, newError(Internal, errors.CreateVolume.Combine(err))
+	}
+
+	if status != http.StatusOK {
+		return nil, newError(Internal, errors.CreateVolume.Combine(errored.Errorf("apiserver returned status %d: %s", status, strings.TrimSpace(string(content)))))
+	}
+
+	created := &config.Volume{}
+	if err := json.Unmarshal(content, created); err != nil {
+		return nil, newError(Internal, errors.UnmarshalVolume.Combine(err))
+	}
+
+	vol, err := toVolume(created)
+	if err != nil {
+		return nil, newError(Internal, err)
+	}
+
+	return &CreateVolumeResponse{Volume: vol}, nil
+}
+
+// DeleteVolume removes the volume through the apiserver. Removing a volume
+// which does not exist succeeds.
+func (c *Controller) DeleteVolume(req *DeleteVolumeRequest) error {
+	if req.VolumeID == "" {
+		return newError(InvalidArgument, errored.Errorf("Volume ID is required"))
+	}
+
+	policy, volume, err := parseVolumeID(req.VolumeID)
+	if err != nil {
+		return nil
+	}
+
+	status, content, err := c.request("DELETE", "/volumes/remove", &config.VolumeRequest{Policy: policy, Name: volume})
+	if err != nil {
+		return newError(Internal, errors.RemoveVolume.Combine(err))
+	}
+
+	switch status {
+	case http.StatusOK, http.StatusNotFound:
+		return nil
+	default:
+		// the volume may have been removed by the time the apiserver looked it up.
+		if _, err := c.Client.GetVolume(policy, volume); notExists(err) {
+			return nil
+		}
+
+		return newError(Internal, errors.RemoveVolume.Combine(errored.Errorf("apiserver returned status %d: %s", status, strings.TrimSpace(string(content)))))
+	}
+}
+
+func (c *Controller) snapshotDriver(volumeID string) (*config.Volume, storage.SnapshotDriver, storage.DriverOptions, error) {
+	policy, volume, err := parseVolumeID(volumeID)
+	if err != nil {
+		return nil, nil, storage.DriverOptions{}, err
+	}
+
+	vol, err := c.Client.GetVolume(policy, volume)
+	if notExists(err) {
+		return nil, nil, storage.DriverOptions{}, newError(NotFound, errors.GetVolume.Combine(err))
+	} else if err != nil {
+		return nil, nil, storage.DriverOptions{}, newError(Internal, errors.GetVolume.Combine(err))
+	}
+
+	if vol.Backends == nil || vol.Backends.Snapshot == "" {
+		return nil, nil, storage.DriverOptions{}, newError(FailedPrecondition, errors.SnapshotsUnsupported.Combine(errored.New(vol.String())))
+	}
+
+	driver, err := backend.NewSnapshotDriver(vol.Backends.Snapshot)
+	if err != nil {
+		return nil, nil, storage.DriverOptions{}, newError(Internal, errors.GetDriver.Combine(err))
+	}
+
+	global, err := c.Client.GetGlobal()
+	if err != nil {
+		return nil, nil, storage.DriverOptions{}, newError(Internal, errors.GetGlobal.Combine(err))
+	}
+
+	do, err := vol.ToDriverOptions(global.Timeout)
+	if err != nil {
+		return nil, nil, storage.DriverOptions{}, newError(Internal, errors.ConfiguringVolume.Combine(err))
+	}
+
+	return vol, driver, do, nil
+}
+
+func hasSnapshot(driver storage.SnapshotDriver, do storage.DriverOptions, name string) (bool, error) {
+	snaps, err := driver.ListSnapshots(do)
+	if err != nil {
+		return false, newError(Internal, errors.ListSnapshots.Combine(err))
+	}
+
+	for _, snap := range snaps {
+		if snap == name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// withSnapshotLock runs the function holding the volume's snapshot lock, as
+// volsupervisor does while snapshotting.
+func (c *Controller) withSnapshotLock(vol *config.Volume, do storage.DriverOptions, runFunc func() error) error {
+	uc := &config.UseSnapshot{
+		Volume: vol.String(),
+		Reason: lock.ReasonSnapshot,
+	}
+
+	err := lock.NewDriver(c.Client).ExecuteWithMultiUseLock([]config.UseLocker{uc}, do.Timeout, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		return runFunc()
+	})
+
+	if _, ok := err.(*Error); !ok && err != nil {
+		return newError(Aborted, errors.LockFailed.Combine(err))
+	}
+
+	return err
+}
+
+// CreateSnapshot takes a named snapshot of the volume. Taking a snapshot which
+// already exists returns it.
+func (c *Controller) CreateSnapshot(req *CreateSnapshotRequest) (*CreateSnapshotResponse, error) {
+	if req.Name == "" || req.SourceVolumeID == "" {
+		return nil, newError(InvalidArgument, errors.MissingSnapshotOption.Combine(errored.Errorf("Snapshot name and source volume ID are required")))
+	}
+
+	if strings.Contains(req.Name, "@") {
+		return nil, newError(InvalidArgument, errored.Errorf("Invalid snapshot name %q", req.Name))
+	}
+
+	vol, driver, do, err := c.snapshotDriver(req.SourceVolumeID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.withSnapshotLock(vol, do, func() error {
+		exists, err := hasSnapshot(driver, do, req.Name)
+		if err != nil || exists {
+			return err
+		}
+
+		policy, err := c.Client.GetPolicy(vol.PolicyName)
+		if err != nil {
+			return newError(Internal, errors.GetPolicy.Combine(err))
+		}
+
+		if err := c.Client.ReservePolicyUsage(vol.PolicyName, policy.Quota, config.PolicyUsage{Snapshots: 1}); err != nil {
+			if erd, ok := err.(*errored.Error); ok && erd.Contains(errors.QuotaExceeded) {
+				return newError(ResourceExhausted, err)
+			}
+			return newError(Internal, err)
+		}
+
+		if err := driver.CreateSnapshot(req.Name, do); err != nil {
+			c.Client.ReleasePolicyUsage(vol.PolicyName, config.PolicyUsage{Snapshots: 1})
+			return newError(Internal, errors.SnapshotFailed.Combine(err))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreateSnapshotResponse{
+		Snapshot: &Snapshot{
+			SnapshotID:     snapshotID(vol.String(), req.Name),
+			SourceVolumeID: vol.String(),
+			ReadyToUse:     true,
+		},
+	}, nil
+}
+
+// DeleteSnapshot removes the snapshot. Removing a snapshot which does not
+// exist succeeds.
+func (c *Controller) DeleteSnapshot(req *DeleteSnapshotRequest) error {
+	if req.SnapshotID == "" {
+		return newError(InvalidArgument, errored.Errorf("Snapshot ID is required"))
+	}
+
+	volID, name, err := parseSnapshotID(req.SnapshotID)
+	if err != nil {
+		return nil
+	}
+
+	vol, driver, do, err := c.snapshotDriver(volID)
+	if e, ok := err.(*Error); ok && e.Code == NotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return c.withSnapshotLock(vol, do, func() error {
+		exists, err := hasSnapshot(driver, do, name)
+		if err != nil || !exists {
+			return err
+		}
+
+		if err := driver.RemoveSnapshot(name, do); err != nil {
+			return newError(Internal, errors.SnapshotFailed.Combine(err))
+		}
+
+		if err := c.Client.ReleasePolicyUsage(vol.PolicyName, config.PolicyUsage{Snapshots: 1}); err != nil {
+			logrus.Warnf("Could not release snapshot quota of volume %q: %v", vol, err)
+		}
+
+		return nil
+	})
+}
+
+func (c *Controller) listSnapshots(volID string) ([]*Snapshot, error) {
+	_, driver, do, err := c.snapshotDriver(volID)
+	if err != nil {
+		return nil, err
+	}
+
+	snaps, err := driver.ListSnapshots(do)
+	if err != nil {
+		return nil, newError(Internal, errors.ListSnapshots.Combine(err))
+	}
+
+	entries := []*Snapshot{}
+	for _, snap := range snaps {
+		entries = append(entries, &Snapshot{SnapshotID: snapshotID(volID, snap), SourceVolumeID: volID, ReadyToUse: true})
+	}
+
+	return entries, nil
+}
+
+// ListSnapshots lists the snapshots of a volume, a single snapshot, or the
+// snapshots of all volumes supporting them. Unknown volumes and snapshots
+// yield an empty list.
+func (c *Controller) ListSnapshots(req *ListSnapshotsRequest) (*ListSnapshotsResponse, error) {
+	resp := &ListSnapshotsResponse{Entries: []*Snapshot{}}
+
+	var volumes []string
+
+	switch {
+	case req.SnapshotID != "":
+		volID, _, err := parseSnapshotID(req.SnapshotID)
+		if err != nil {
+			return resp, nil
+		}
+		volumes = []string{volID}
+	case req.SourceVolumeID != "":
+		volumes = []string{req.SourceVolumeID}
+	default:
+		all, err := c.Client.ListAllVolumes()
+		if err != nil {
+			return nil, newError(Internal, errors.ListVolume.Combine(err))
+		}
+		volumes = all
+	}
+
+	for _, volID := range volumes {
+		entries, err := c.listSnapshots(volID)
+		if e, ok := err.(*Error); ok && (e.Code == NotFound || e.Code == FailedPrecondition) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if req.SnapshotID == "" || entry.SnapshotID == req.SnapshotID {
+				resp.Entries = append(resp.Entries, entry)
+			}
+		}
+	}
+
+	return resp, nil
+}
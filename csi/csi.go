@@ -0,0 +1,133 @@
+// Package csi implements the Identity, Controller and Node services of the
+// Container Storage Interface on top of volplugin.
+//
+// The controller provisions and removes volumes through the apiserver's
+// create and remove calls, and takes snapshots through the snapshot driver
+// under the snapshot use lock. The node service runs inside volplugin and
+// mounts volumes through the same path as the docker frontend, so the mount
+// locks and counts are shared.
+//
+// The request and reply types mirror the messages of the CSI specification.
+// Server serves the services over gRPC on a unix socket: volplugin serves the
+// identity and node services and the apiserver the identity and controller
+// services, each on the socket given by its --csi-socket flag.
+package csi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/storage"
+	units "github.com/docker/go-units"
+)
+
+// PluginName is the name the plugin is registered under.
+const PluginName = "volplugin.contiv.io"
+
+// ParameterPolicy is the CSI parameter naming the policy to create volumes
+// with. All other parameters are policy options, as with docker's driver
+// options.
+const ParameterPolicy = "policy"
+
+// Identity is the CSI Identity service.
+type Identity struct {
+	Version    string
+	Controller bool
+}
+
+// NewIdentity returns the identity service. controller is true if the
+// controller service is served alongside it.
+func NewIdentity(version string, controller bool) *Identity {
+	return &Identity{Version: version, Controller: controller}
+}
+
+// GetPluginInfo returns the name and version of the plugin.
+func (i *Identity) GetPluginInfo() (*GetPluginInfoResponse, error) {
+	return &GetPluginInfoResponse{Name: PluginName, VendorVersion: i.Version}, nil
+}
+
+// GetPluginCapabilities returns the capabilities of the plugin.
+func (i *Identity) GetPluginCapabilities() (*GetPluginCapabilitiesResponse, error) {
+	resp := &GetPluginCapabilitiesResponse{Capabilities: []string{}}
+	if i.Controller {
+		resp.Capabilities = append(resp.Capabilities, CapabilityControllerService)
+	}
+
+	return resp, nil
+}
+
+// Probe reports the plugin is ready.
+func (i *Identity) Probe() (*ProbeResponse, error) {
+	return &ProbeResponse{Ready: true}, nil
+}
+
+// volumeOptions maps the CSI parameters and capacity range onto the policy
+// and the options which are merged into it. The required capacity is rounded
+// up to whole megabytes and takes precedence over a size parameter.
+func volumeOptions(params map[string]string, capacity *CapacityRange) (string, map[string]string, error) {
+	policy := params[ParameterPolicy]
+	if policy == "" {
+		return "", nil, newError(InvalidArgument, errored.Errorf("Parameter %q is required", ParameterPolicy))
+	}
+
+	opts := map[string]string{}
+	for key, value := range params {
+		if key != ParameterPolicy {
+			opts[key] = value
+		}
+	}
+
+	if capacity == nil {
+		return policy, opts, nil
+	}
+
+	if capacity.RequiredBytes < 0 || capacity.LimitBytes < 0 {
+		return "", nil, newError(InvalidArgument, errored.Errorf("Capacity range may not be negative"))
+	}
+
+	if capacity.RequiredBytes > 0 {
+		size := (capacity.RequiredBytes + units.MB - 1) / units.MB
+		if capacity.LimitBytes > 0 && size*units.MB > capacity.LimitBytes {
+			return "", nil, newError(OutOfRange, errored.Errorf("No size in megabytes between %d and %d bytes", capacity.RequiredBytes, capacity.LimitBytes))
+		}
+
+		opts["size"] = fmt.Sprintf("%dMB", size)
+	}
+
+	return policy, opts, nil
+}
+
+// volumeID returns the volume ID for the volume.
+func volumeID(policy, volume string) string {
+	return strings.Join([]string{policy, volume}, "/")
+}
+
+// parseVolumeID splits the volume ID into the policy and volume.
+func parseVolumeID(id string) (string, string, error) {
+	policy, volume, err := storage.SplitName(id)
+	if err != nil {
+		return "", "", newError(NotFound, errored.Errorf("Invalid volume ID %q: %v", id, err))
+	}
+
+	return policy, volume, nil
+}
+
+// snapshotID returns the snapshot ID for the named snapshot of the volume.
+func snapshotID(volumeID, snapshot string) string {
+	return volumeID + "@" + snapshot
+}
+
+// parseSnapshotID splits the snapshot ID into the volume ID and snapshot name.
+func parseSnapshotID(id string) (string, string, error) {
+	parts := strings.SplitN(id, "@", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", newError(NotFound, errored.Errorf("Invalid snapshot ID %q", id))
+	}
+
+	if _, _, err := parseVolumeID(parts[0]); err != nil {
+		return "", "", err
+	}
+
+	return parts[0], parts[1], nil
+}
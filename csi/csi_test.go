@@ -0,0 +1,102 @@
+package csi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	. "testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/logging"
+)
+
+type csiSuite struct{}
+
+var _ = Suite(&csiSuite{})
+
+func TestCSI(t *T) { TestingT(t) }
+
+func code(err error) Code {
+	if e, ok := err.(*Error); ok {
+		return e.Code
+	}
+
+	return OK
+}
+
+func (s *csiSuite) TestVolumeOptions(c *C) {
+	policy, opts, err := volumeOptions(map[string]string{"policy": "policy1", "filesystem": "xfs"}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(policy, Equals, "policy1")
+	c.Assert(opts, DeepEquals, map[string]string{"filesystem": "xfs"})
+
+	_, opts, err = volumeOptions(map[string]string{"policy": "policy1", "size": "10MB"}, &CapacityRange{RequiredBytes: 1000001})
+	c.Assert(err, IsNil)
+	c.Assert(opts["size"], Equals, "2MB")
+
+	_, opts, err = volumeOptions(map[string]string{"policy": "policy1"}, &CapacityRange{LimitBytes: 5000000})
+	c.Assert(err, IsNil)
+	c.Assert(opts["size"], Equals, "")
+
+	_, _, err = volumeOptions(map[string]string{"policy": "policy1"}, &CapacityRange{RequiredBytes: 1000001, LimitBytes: 1500000})
+	c.Assert(code(err), Equals, OutOfRange)
+
+	_, _, err = volumeOptions(map[string]string{"policy": "policy1"}, &CapacityRange{RequiredBytes: -1})
+	c.Assert(code(err), Equals, InvalidArgument)
+
+	_, _, err = volumeOptions(map[string]string{"size": "10MB"}, nil)
+	c.Assert(code(err), Equals, InvalidArgument)
+}
+
+func (s *csiSuite) TestIDs(c *C) {
+	id := volumeID("policy1", "test")
+	c.Assert(id, Equals, "policy1/test")
+
+	policy, volume, err := parseVolumeID(id)
+	c.Assert(err, IsNil)
+	c.Assert(policy, Equals, "policy1")
+	c.Assert(volume, Equals, "test")
+
+	for _, id := range []string{"", "test", "policy1/", "policy1/test/extra"} {
+		_, _, err := parseVolumeID(id)
+		c.Assert(code(err), Equals, NotFound, Commentf("%q", id))
+	}
+
+	volID, snap, err := parseSnapshotID(snapshotID(id, "snap1"))
+	c.Assert(err, IsNil)
+	c.Assert(volID, Equals, id)
+	c.Assert(snap, Equals, "snap1")
+
+	for _, id := range []string{"", "policy1/test", "policy1/test@", "test@snap1"} {
+		_, _, err := parseSnapshotID(id)
+		c.Assert(code(err), Equals, NotFound, Commentf("%q", id))
+	}
+}
+
+func (s *csiSuite) TestIdentity(c *C) {
+	resp, err := NewIdentity("1.0", true).GetPluginCapabilities()
+	c.Assert(err, IsNil)
+	c.Assert(resp.Capabilities, DeepEquals, []string{CapabilityControllerService})
+
+	resp, err = NewIdentity("1.0", false).GetPluginCapabilities()
+	c.Assert(err, IsNil)
+	c.Assert(resp.Capabilities, DeepEquals, []string{})
+
+	info, err := NewIdentity("1.0", false).GetPluginInfo()
+	c.Assert(err, IsNil)
+	c.Assert(info.Name, Equals, PluginName)
+	c.Assert(info.VendorVersion, Equals, "1.0")
+}
+
+func (s *csiSuite) TestRequestID(c *C) {
+	var id string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = r.Header.Get(logging.RequestIDHeader)
+	}))
+	defer server.Close()
+
+	controller := NewController(nil, strings.TrimPrefix(server.URL, "http://"))
+	c.Assert(controller.DeleteVolume(&DeleteVolumeRequest{VolumeID: "policy1/foo"}), IsNil)
+	c.Assert(id, Not(Equals), "")
+}
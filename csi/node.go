@@ -0,0 +1,211 @@
+package csi
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Node is the CSI Node service. Volumes are staged by mounting them through
+// the API, which takes the mount lock, and bind-mounting the result at the
+// staging path; they are then bind-mounted from there at each target path.
+type Node struct {
+	API *api.API
+}
+
+// NewNode returns the node service mounting volumes through the API.
+func NewNode(a *api.API) *Node {
+	return &Node{API: a}
+}
+
+// NodeGetCapabilities returns the capabilities of the node.
+func (n *Node) NodeGetCapabilities() (*NodeGetCapabilitiesResponse, error) {
+	return &NodeGetCapabilitiesResponse{Capabilities: []string{CapabilityStageUnstageVolume}}, nil
+}
+
+// NodeGetInfo returns the ID of the node, which is its volplugin hostname.
+func (n *Node) NodeGetInfo() (*NodeGetInfoResponse, error) {
+	return &NodeGetInfoResponse{NodeID: n.API.Hostname}, nil
+}
+
+// isMountPoint is true if the path is on a different device than its parent.
+func isMountPoint(path string) (bool, error) {
+	var st, parent unix.Stat_t
+
+	if err := unix.Stat(path, &st); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err := unix.Stat(filepath.Dir(filepath.Clean(path)), &parent); err != nil {
+		return false, err
+	}
+
+	return st.Dev != parent.Dev, nil
+}
+
+func bindMount(source, target string, readOnly bool) error {
+	if err := os.MkdirAll(target, 0750); err != nil {
+		return err
+	}
+
+	if err := unix.Mount(source, target, "", unix.MS_BIND, ""); err != nil {
+		return errored.Errorf("Could not bind mount %q at %q: %v", source, target, err)
+	}
+
+	if readOnly {
+		if err := unix.Mount("", target, "", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY, ""); err != nil {
+			unix.Unmount(target, 0)
+			return errored.Errorf("Could not remount %q read-only: %v", target, err)
+		}
+	}
+
+	return nil
+}
+
+func unmount(target string) error {
+	mounted, err := isMountPoint(target)
+	if err != nil {
+		return err
+	}
+
+	if mounted {
+		if err := unix.Unmount(target, 0); err != nil {
+			return errored.Errorf("Could not unmount %q: %v", target, err)
+		}
+	}
+
+	return nil
+}
+
+// NodeStageVolume mounts the volume and bind-mounts it at the staging path.
+// A volume which is already staged is left alone.
+func (n *Node) NodeStageVolume(req *NodeStageVolumeRequest) error {
+	if req.VolumeID == "" || req.StagingTargetPath == "" {
+		return newError(InvalidArgument, errored.Errorf("Volume ID and staging target path are required"))
+	}
+
+	policy, volume, err := parseVolumeID(req.VolumeID)
+	if err != nil {
+		return err
+	}
+
+	mounted, err := isMountPoint(req.StagingTargetPath)
+	if err != nil {
+		return newError(Internal, errors.MountFailed.Combine(err))
+	}
+
+	if mounted {
+		return nil
+	}
+
+	vol := &api.Volume{Policy: policy, Name: volume}
+
+	path, err := n.API.MountVolume(vol)
+	if erd, ok := err.(*errored.Error); ok && erd.Contains(errors.LockFailed) {
+		return newError(FailedPrecondition, err)
+	} else if err != nil {
+		return newError(Internal, err)
+	}
+
+	if err := bindMount(path, req.StagingTargetPath, false); err != nil {
+		if _, uerr := n.API.UnmountVolume(vol); uerr != nil {
+			return newError(Internal, errors.MountFailed.Combine(err).Combine(uerr))
+		}
+
+		return newError(Internal, errors.MountFailed.Combine(err))
+	}
+
+	return nil
+}
+
+// NodeUnstageVolume removes the bind mount at the staging path and unmounts
+// the volume. A volume which is not staged is left alone.
+func (n *Node) NodeUnstageVolume(req *NodeUnstageVolumeRequest) error {
+	if req.VolumeID == "" || req.StagingTargetPath == "" {
+		return newError(InvalidArgument, errored.Errorf("Volume ID and staging target path are required"))
+	}
+
+	policy, volume, err := parseVolumeID(req.VolumeID)
+	if err != nil {
+		return err
+	}
+
+	mounted, err := isMountPoint(req.StagingTargetPath)
+	if err != nil {
+		return newError(Internal, errors.UnmountFailed.Combine(err))
+	}
+
+	if !mounted {
+		return nil
+	}
+
+	if err := unmount(req.StagingTargetPath); err != nil {
+		return newError(Internal, errors.UnmountFailed.Combine(err))
+	}
+
+	if _, err := n.API.UnmountVolume(&api.Volume{Policy: policy, Name: volume}); err != nil {
+		return newError(Internal, err)
+	}
+
+	return nil
+}
+
+// NodePublishVolume bind-mounts the staged volume at the target path.
+func (n *Node) NodePublishVolume(req *NodePublishVolumeRequest) error {
+	if req.VolumeID == "" || req.StagingTargetPath == "" || req.TargetPath == "" {
+		return newError(InvalidArgument, errored.Errorf("Volume ID, staging target path and target path are required"))
+	}
+
+	if _, _, err := parseVolumeID(req.VolumeID); err != nil {
+		return err
+	}
+
+	staged, err := isMountPoint(req.StagingTargetPath)
+	if err != nil {
+		return newError(Internal, errors.MountFailed.Combine(err))
+	}
+
+	if !staged {
+		return newError(FailedPrecondition, errored.Errorf("Volume %q is not staged at %q", req.VolumeID, req.StagingTargetPath))
+	}
+
+	mounted, err := isMountPoint(req.TargetPath)
+	if err != nil {
+		return newError(Internal, errors.MountFailed.Combine(err))
+	}
+
+	if mounted {
+		return nil
+	}
+
+	if err := bindMount(req.StagingTargetPath, req.TargetPath, req.Readonly); err != nil {
+		return newError(Internal, errors.MountFailed.Combine(err))
+	}
+
+	return nil
+}
+
+// NodeUnpublishVolume removes the bind mount and the directory at the target
+// path.
+func (n *Node) NodeUnpublishVolume(req *NodeUnpublishVolumeRequest) error {
+	if req.VolumeID == "" || req.TargetPath == "" {
+		return newError(InvalidArgument, errored.Errorf("Volume ID and target path are required"))
+	}
+
+	if err := unmount(req.TargetPath); err != nil {
+		return newError(Internal, errors.UnmountFailed.Combine(err))
+	}
+
+	if err := os.Remove(req.TargetPath); err != nil && !os.IsNotExist(err) {
+		return newError(Internal, errors.UnmountFailed.Combine(err))
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package csi
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/contiv/errored"
+)
+
+// The CSI messages are few and small, so they are encoded to and decoded
+// from the protocol buffer wire format by hand instead of through generated
+// bindings. Only the fields the services use are read or written; unknown
+// fields are skipped, as the format requires.
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// encoder appends fields to a message. As in proto3, scalar fields with the
+// zero value are left out.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) tag(field, wire int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(field)<<3|uint64(wire))
+}
+
+func (e *encoder) uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+
+	e.tag(field, wireVarint)
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func (e *encoder) bool(field int, v bool) {
+	if v {
+		e.uint(field, 1)
+	}
+}
+
+func (e *encoder) string(field int, v string) {
+	if v != "" {
+		e.bytes(field, []byte(v))
+	}
+}
+
+func (e *encoder) bytes(field int, v []byte) {
+	e.tag(field, wireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// message appends an embedded message. It is written even if it is empty,
+// as its presence is significant.
+func (e *encoder) message(field int, m *encoder) {
+	e.bytes(field, m.buf)
+}
+
+// stringMap appends a map<string, string> field, sorted by key.
+func (e *encoder) stringMap(field int, m map[string]string) {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		entry := &encoder{}
+		entry.string(1, key)
+		entry.string(2, m[key])
+		e.message(field, entry)
+	}
+}
+
+// value is a decoded field. Varints are kept in num, length-delimited fields
+// in data.
+type value struct {
+	wire int
+	num  uint64
+	data []byte
+}
+
+// message is a decoded message: the values of each field, in order.
+type message map[int][]value
+
+func errMalformed(what string) error {
+	return newError(InvalidArgument, errored.Errorf("Malformed message: %s", what))
+}
+
+func decode(buf []byte) (message, error) {
+	m := message{}
+
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, errMalformed("invalid field key")
+		}
+		buf = buf[n:]
+
+		v := value{wire: int(key & 7)}
+
+		switch v.wire {
+		case wireVarint:
+			v.num, n = binary.Uvarint(buf)
+			if n <= 0 {
+				return nil, errMalformed("invalid varint")
+			}
+			buf = buf[n:]
+		case wireFixed64, wireFixed32:
+			size := 8
+			if v.wire == wireFixed32 {
+				size = 4
+			}
+			if len(buf) < size {
+				return nil, errMalformed("truncated fixed field")
+			}
+			buf = buf[size:]
+		case wireBytes:
+			size, n := binary.Uvarint(buf)
+			if n <= 0 || size > uint64(len(buf)-n) {
+				return nil, errMalformed("truncated length-delimited field")
+			}
+			v.data = buf[n : n+int(size)]
+			buf = buf[n+int(size):]
+		default:
+			return nil, errMalformed("unsupported wire type")
+		}
+
+		field := int(key >> 3)
+		m[field] = append(m[field], v)
+	}
+
+	return m, nil
+}
+
+// last returns the last value of the field, which is the one that counts for
+// a non-repeated field.
+func (m message) last(field, wire int) (value, bool) {
+	values := m[field]
+	for i := len(values) - 1; i >= 0; i-- {
+		if values[i].wire == wire {
+			return values[i], true
+		}
+	}
+
+	return value{}, false
+}
+
+func (m message) uint(field int) uint64 {
+	v, _ := m.last(field, wireVarint)
+	return v.num
+}
+
+func (m message) bool(field int) bool {
+	return m.uint(field) != 0
+}
+
+func (m message) string(field int) string {
+	v, _ := m.last(field, wireBytes)
+	return string(v.data)
+}
+
+// message returns the embedded message, or nil if it is not set.
+func (m message) message(field int) (message, error) {
+	v, ok := m.last(field, wireBytes)
+	if !ok {
+		return nil, nil
+	}
+
+	return decode(v.data)
+}
+
+func (m message) stringMap(field int) (map[string]string, error) {
+	res := map[string]string{}
+
+	for _, v := range m[field] {
+		if v.wire != wireBytes {
+			continue
+		}
+
+		entry, err := decode(v.data)
+		if err != nil {
+			return nil, err
+		}
+
+		res[entry.string(1)] = entry.string(2)
+	}
+
+	return res, nil
+}
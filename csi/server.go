@@ -0,0 +1,418 @@
+package csi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+)
+
+// maxMessageSize is the largest request accepted, the gRPC default.
+const maxMessageSize = 4 << 20
+
+// Values of the capability enums of the specification.
+var (
+	pluginCapabilities = map[string]uint64{
+		CapabilityControllerService: 1,
+	}
+
+	controllerCapabilities = map[string]uint64{
+		CapabilityCreateDeleteVolume:   1,
+		CapabilityCreateDeleteSnapshot: 5,
+		CapabilityListSnapshots:        6,
+	}
+
+	nodeCapabilities = map[string]uint64{
+		CapabilityStageUnstageVolume: 1,
+	}
+)
+
+// Server serves the services over gRPC: unencrypted HTTP/2 on a unix socket,
+// which is how COs reach CSI plugins. Controller and Node may be nil, in
+// which case their calls are unimplemented.
+type Server struct {
+	Identity   *Identity
+	Controller *Controller
+	Node       *Node
+}
+
+// NewServer returns a server for the services.
+func NewServer(identity *Identity, controller *Controller, node *Node) *Server {
+	return &Server{Identity: identity, Controller: controller, Node: node}
+}
+
+// ListenAndServe serves the services on the socket, replacing a stale one.
+func (s *Server) ListenAndServe(socket string) error {
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.MkdirAll(path.Dir(socket), 0700); err != nil {
+		return err
+	}
+
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: socket, Net: "unix"})
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	return s.Serve(l)
+}
+
+// Serve serves the services on the listener.
+func (s *Server) Serve(l net.Listener) error {
+	protocols := &http.Protocols{}
+	protocols.SetUnencryptedHTTP2(true)
+
+	srv := &http.Server{Handler: s, Protocols: protocols}
+	return srv.Serve(l)
+}
+
+type handler func(req message) (*encoder, error)
+
+// handlers returns the calls served, by gRPC method path.
+func (s *Server) handlers() map[string]handler {
+	handlers := map[string]handler{
+		"/csi.v1.Identity/GetPluginInfo":         s.getPluginInfo,
+		"/csi.v1.Identity/GetPluginCapabilities": s.getPluginCapabilities,
+		"/csi.v1.Identity/Probe":                 s.probe,
+	}
+
+	if s.Controller != nil {
+		handlers["/csi.v1.Controller/ControllerGetCapabilities"] = s.controllerGetCapabilities
+		handlers["/csi.v1.Controller/CreateVolume"] = s.createVolume
+		handlers["/csi.v1.Controller/DeleteVolume"] = s.deleteVolume
+		handlers["/csi.v1.Controller/CreateSnapshot"] = s.createSnapshot
+		handlers["/csi.v1.Controller/DeleteSnapshot"] = s.deleteSnapshot
+		handlers["/csi.v1.Controller/ListSnapshots"] = s.listSnapshots
+	}
+
+	if s.Node != nil {
+		handlers["/csi.v1.Node/NodeGetCapabilities"] = s.nodeGetCapabilities
+		handlers["/csi.v1.Node/NodeGetInfo"] = s.nodeGetInfo
+		handlers["/csi.v1.Node/NodeStageVolume"] = s.nodeStageVolume
+		handlers["/csi.v1.Node/NodeUnstageVolume"] = s.nodeUnstageVolume
+		handlers["/csi.v1.Node/NodePublishVolume"] = s.nodePublishVolume
+		handlers["/csi.v1.Node/NodeUnpublishVolume"] = s.nodeUnpublishVolume
+	}
+
+	return handlers
+}
+
+// ServeHTTP answers a gRPC call. The status of the call is returned in the
+// grpc-status and grpc-message trailers.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.WriteHeader(http.StatusOK)
+
+	resp, err := s.call(r)
+	if err == nil {
+		if _, err := w.Write(frame(resp.buf)); err != nil {
+			logrus.Warnf("Could not reply to CSI call %q: %v", r.URL.Path, err)
+			return
+		}
+	} else {
+		logrus.Errorf("CSI call %q failed: %v", r.URL.Path, err)
+	}
+
+	code, msg := status(err)
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(int(code)))
+	if msg != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", encodeGRPCMessage(msg))
+	}
+}
+
+func (s *Server) call(r *http.Request) (*encoder, error) {
+	h, ok := s.handlers()[r.URL.Path]
+	if !ok || r.Method != "POST" {
+		return nil, newError(Unimplemented, errored.Errorf("Unknown method %q", r.URL.Path))
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize+6))
+	if err != nil {
+		return nil, newError(Internal, errored.Errorf("Could not read request: %v", err))
+	}
+
+	req, err := unframe(body)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := decode(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return h(msg)
+}
+
+// frame prefixes the message with the uncompressed flag and its length.
+func frame(msg []byte) []byte {
+	buf := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(msg)))
+	return append(buf, msg...)
+}
+
+// unframe returns the message of a request holding exactly one.
+func unframe(body []byte) ([]byte, error) {
+	if len(body) < 5 {
+		return nil, errMalformed("truncated frame")
+	}
+
+	if body[0] != 0 {
+		return nil, newError(Unimplemented, errored.Errorf("Compressed messages are not supported"))
+	}
+
+	size := binary.BigEndian.Uint32(body[1:5])
+	if size > maxMessageSize {
+		return nil, newError(ResourceExhausted, errored.Errorf("Message of %d bytes exceeds the limit of %d", size, maxMessageSize))
+	}
+
+	if uint64(size) != uint64(len(body)-5) {
+		return nil, errMalformed("frame length does not match the request")
+	}
+
+	return body[5:], nil
+}
+
+// status returns the code and message of the call's error.
+func status(err error) (Code, string) {
+	if err == nil {
+		return OK, ""
+	}
+
+	if e, ok := err.(*Error); ok {
+		return e.Code, e.Err.Error()
+	}
+
+	return Internal, err.Error()
+}
+
+// encodeGRPCMessage percent-encodes the message as grpc-message requires.
+func encodeGRPCMessage(msg string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+func capabilities(caps []string, values map[string]uint64, wrap func(*encoder) *encoder) *encoder {
+	resp := &encoder{}
+	for _, c := range caps {
+		inner := &encoder{}
+		inner.uint(1, values[c])
+		resp.message(1, wrap(inner))
+	}
+
+	return resp
+}
+
+func (s *Server) getPluginInfo(req message) (*encoder, error) {
+	info, err := s.Identity.GetPluginInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &encoder{}
+	resp.string(1, info.Name)
+	resp.string(2, info.VendorVersion)
+	return resp, nil
+}
+
+func (s *Server) getPluginCapabilities(req message) (*encoder, error) {
+	caps, err := s.Identity.GetPluginCapabilities()
+	if err != nil {
+		return nil, err
+	}
+
+	return capabilities(caps.Capabilities, pluginCapabilities, func(svc *encoder) *encoder {
+		c := &encoder{}
+		c.message(1, svc)
+		return c
+	}), nil
+}
+
+func (s *Server) probe(req message) (*encoder, error) {
+	probe, err := s.Identity.Probe()
+	if err != nil {
+		return nil, err
+	}
+
+	ready := &encoder{}
+	ready.bool(1, probe.Ready)
+
+	resp := &encoder{}
+	resp.message(1, ready)
+	return resp, nil
+}
+
+func rpcCapability(rpc *encoder) *encoder {
+	c := &encoder{}
+	c.message(1, rpc)
+	return c
+}
+
+func (s *Server) controllerGetCapabilities(req message) (*encoder, error) {
+	caps, err := s.Controller.ControllerGetCapabilities()
+	if err != nil {
+		return nil, err
+	}
+
+	return capabilities(caps.Capabilities, controllerCapabilities, rpcCapability), nil
+}
+
+func (s *Server) createVolume(req message) (*encoder, error) {
+	create := &CreateVolumeRequest{Name: req.string(1)}
+
+	capacity, err := req.message(2)
+	if err != nil {
+		return nil, err
+	}
+
+	if capacity != nil {
+		create.CapacityRange = &CapacityRange{
+			RequiredBytes: int64(capacity.uint(1)),
+			LimitBytes:    int64(capacity.uint(2)),
+		}
+	}
+
+	if create.Parameters, err = req.stringMap(4); err != nil {
+		return nil, err
+	}
+
+	created, err := s.Controller.CreateVolume(create)
+	if err != nil {
+		return nil, err
+	}
+
+	vol := &encoder{}
+	vol.uint(1, uint64(created.Volume.CapacityBytes))
+	vol.string(2, created.Volume.VolumeID)
+	vol.stringMap(3, created.Volume.VolumeContext)
+
+	resp := &encoder{}
+	resp.message(1, vol)
+	return resp, nil
+}
+
+func (s *Server) deleteVolume(req message) (*encoder, error) {
+	return &encoder{}, s.Controller.DeleteVolume(&DeleteVolumeRequest{VolumeID: req.string(1)})
+}
+
+func encodeSnapshot(snap *Snapshot) *encoder {
+	e := &encoder{}
+	e.string(2, snap.SnapshotID)
+	e.string(3, snap.SourceVolumeID)
+	e.bool(5, snap.ReadyToUse)
+	return e
+}
+
+func (s *Server) createSnapshot(req message) (*encoder, error) {
+	created, err := s.Controller.CreateSnapshot(&CreateSnapshotRequest{
+		SourceVolumeID: req.string(1),
+		Name:           req.string(2),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &encoder{}
+	resp.message(1, encodeSnapshot(created.Snapshot))
+	return resp, nil
+}
+
+func (s *Server) deleteSnapshot(req message) (*encoder, error) {
+	return &encoder{}, s.Controller.DeleteSnapshot(&DeleteSnapshotRequest{SnapshotID: req.string(1)})
+}
+
+func (s *Server) listSnapshots(req message) (*encoder, error) {
+	list, err := s.Controller.ListSnapshots(&ListSnapshotsRequest{
+		SourceVolumeID: req.string(3),
+		SnapshotID:     req.string(4),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &encoder{}
+	for _, snap := range list.Entries {
+		entry := &encoder{}
+		entry.message(1, encodeSnapshot(snap))
+		resp.message(1, entry)
+	}
+
+	return resp, nil
+}
+
+func (s *Server) nodeGetCapabilities(req message) (*encoder, error) {
+	caps, err := s.Node.NodeGetCapabilities()
+	if err != nil {
+		return nil, err
+	}
+
+	return capabilities(caps.Capabilities, nodeCapabilities, rpcCapability), nil
+}
+
+func (s *Server) nodeGetInfo(req message) (*encoder, error) {
+	info, err := s.Node.NodeGetInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &encoder{}
+	resp.string(1, info.NodeID)
+	return resp, nil
+}
+
+func (s *Server) nodeStageVolume(req message) (*encoder, error) {
+	context, err := req.stringMap(6)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encoder{}, s.Node.NodeStageVolume(&NodeStageVolumeRequest{
+		VolumeID:          req.string(1),
+		StagingTargetPath: req.string(3),
+		VolumeContext:     context,
+	})
+}
+
+func (s *Server) nodeUnstageVolume(req message) (*encoder, error) {
+	return &encoder{}, s.Node.NodeUnstageVolume(&NodeUnstageVolumeRequest{
+		VolumeID:          req.string(1),
+		StagingTargetPath: req.string(2),
+	})
+}
+
+func (s *Server) nodePublishVolume(req message) (*encoder, error) {
+	return &encoder{}, s.Node.NodePublishVolume(&NodePublishVolumeRequest{
+		VolumeID:          req.string(1),
+		StagingTargetPath: req.string(3),
+		TargetPath:        req.string(4),
+		Readonly:          req.bool(6),
+	})
+}
+
+func (s *Server) nodeUnpublishVolume(req message) (*encoder, error) {
+	return &encoder{}, s.Node.NodeUnpublishVolume(&NodeUnpublishVolumeRequest{
+		VolumeID:   req.string(1),
+		TargetPath: req.string(2),
+	})
+}
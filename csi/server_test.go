@@ -0,0 +1,171 @@
+package csi
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *csiSuite) TestProto(c *C) {
+	inner := &encoder{}
+	inner.uint(1, 1000)
+	inner.uint(2, 0)
+
+	e := &encoder{}
+	e.string(1, "test")
+	e.message(2, inner)
+	e.stringMap(4, map[string]string{"policy": "policy1", "size": "10MB"})
+	e.bool(6, true)
+	e.string(7, "")
+	// unknown fixed-size fields are skipped
+	e.tag(8, wireFixed64)
+	e.buf = append(e.buf, 1, 2, 3, 4, 5, 6, 7, 8)
+	e.tag(9, wireFixed32)
+	e.buf = append(e.buf, 1, 2, 3, 4)
+
+	m, err := decode(e.buf)
+	c.Assert(err, IsNil)
+	c.Assert(m.string(1), Equals, "test")
+	c.Assert(m.bool(6), Equals, true)
+	c.Assert(m.string(7), Equals, "")
+	c.Assert(m.bool(10), Equals, false)
+
+	capacity, err := m.message(2)
+	c.Assert(err, IsNil)
+	c.Assert(capacity.uint(1), Equals, uint64(1000))
+	c.Assert(capacity.uint(2), Equals, uint64(0))
+
+	missing, err := m.message(3)
+	c.Assert(err, IsNil)
+	c.Assert(missing, IsNil)
+
+	params, err := m.stringMap(4)
+	c.Assert(err, IsNil)
+	c.Assert(params, DeepEquals, map[string]string{"policy": "policy1", "size": "10MB"})
+
+	for _, buf := range [][]byte{{0x0a}, {0x0a, 5, 'a'}, {0x08, 0x80}, {0x0b}, {0x09, 1}} {
+		_, err := decode(buf)
+		c.Assert(code(err), Equals, InvalidArgument, Commentf("%v", buf))
+	}
+
+	body, err := unframe(frame(e.buf))
+	c.Assert(err, IsNil)
+	c.Assert(body, DeepEquals, e.buf)
+
+	_, err = unframe([]byte{1, 0, 0, 0, 0})
+	c.Assert(code(err), Equals, Unimplemented)
+
+	_, err = unframe([]byte{0, 0, 0, 0, 2, 1})
+	c.Assert(code(err), Equals, InvalidArgument)
+
+	c.Assert(encodeGRPCMessage("100% done\n"), Equals, "100%25 done%0A")
+}
+
+// grpcCall calls the method over the socket, returning the reply, the status
+// code and the message.
+func grpcCall(c *C, socket, method string, req *encoder) (message, string, string) {
+	protocols := &http.Protocols{}
+	protocols.SetUnencryptedHTTP2(true)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Protocols: protocols,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+
+	httpReq, err := http.NewRequest("POST", "http://csi"+method, bytes.NewReader(frame(req.buf)))
+	c.Assert(err, IsNil)
+	httpReq.Header.Set("Content-Type", "application/grpc")
+
+	resp, err := client.Do(httpReq)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.ProtoMajor, Equals, 2)
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+
+	body, err := io.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+
+	var reply message
+	if len(body) > 0 {
+		msg, err := unframe(body)
+		c.Assert(err, IsNil)
+		reply, err = decode(msg)
+		c.Assert(err, IsNil)
+	}
+
+	return reply, resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+}
+
+func (s *csiSuite) TestServer(c *C) {
+	var removed string
+	apiserver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, _ := ioutil.ReadAll(r.Body)
+		removed = string(content)
+	}))
+	defer apiserver.Close()
+
+	dir, err := ioutil.TempDir("", "csi")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "sub", "csi.sock")
+	server := NewServer(NewIdentity("1.0", true), NewController(nil, strings.TrimPrefix(apiserver.URL, "http://")), nil)
+	go server.ListenAndServe(socket)
+
+	for i := 0; i < 50; i++ {
+		if _, err := os.Stat(socket); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	info, status, _ := grpcCall(c, socket, "/csi.v1.Identity/GetPluginInfo", &encoder{})
+	c.Assert(status, Equals, "0")
+	c.Assert(info.string(1), Equals, PluginName)
+	c.Assert(info.string(2), Equals, "1.0")
+
+	caps, status, _ := grpcCall(c, socket, "/csi.v1.Identity/GetPluginCapabilities", &encoder{})
+	c.Assert(status, Equals, "0")
+	capability, err := caps.message(1)
+	c.Assert(err, IsNil)
+	service, err := capability.message(1)
+	c.Assert(err, IsNil)
+	c.Assert(service.uint(1), Equals, uint64(1))
+
+	probe, status, _ := grpcCall(c, socket, "/csi.v1.Identity/Probe", &encoder{})
+	c.Assert(status, Equals, "0")
+	ready, err := probe.message(1)
+	c.Assert(err, IsNil)
+	c.Assert(ready.bool(1), Equals, true)
+
+	caps, status, _ = grpcCall(c, socket, "/csi.v1.Controller/ControllerGetCapabilities", &encoder{})
+	c.Assert(status, Equals, "0")
+	c.Assert(caps[1], HasLen, 3)
+
+	req := &encoder{}
+	req.string(1, "policy1/foo")
+	_, status, _ = grpcCall(c, socket, "/csi.v1.Controller/DeleteVolume", req)
+	c.Assert(status, Equals, "0")
+	c.Assert(removed, Matches, `.*"name":"foo".*"policy":"policy1".*`)
+
+	_, status, msg := grpcCall(c, socket, "/csi.v1.Controller/CreateVolume", &encoder{})
+	c.Assert(status, Equals, "3")
+	c.Assert(msg, Equals, "Volume name is required")
+
+	_, status, _ = grpcCall(c, socket, "/csi.v1.Node/NodeGetInfo", &encoder{})
+	c.Assert(status, Equals, "12")
+}
@@ -0,0 +1,178 @@
+package csi
+
+import "fmt"
+
+// Code is the status code of a failed call. The values are the gRPC status
+// codes the CSI specification prescribes for each failure.
+type Code int
+
+// Status codes used by the services.
+const (
+	OK                 Code = 0
+	InvalidArgument    Code = 3
+	NotFound           Code = 5
+	AlreadyExists      Code = 6
+	ResourceExhausted  Code = 8
+	FailedPrecondition Code = 9
+	Aborted            Code = 10
+	OutOfRange         Code = 11
+	Unimplemented      Code = 12
+	Internal           Code = 13
+)
+
+// Error is an error carrying the status code to return to the CO.
+type Error struct {
+	Code Code
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v (code %d)", e.Err, e.Code)
+}
+
+func newError(code Code, err error) *Error {
+	return &Error{Code: code, Err: err}
+}
+
+// Plugin capabilities.
+const (
+	CapabilityControllerService = "CONTROLLER_SERVICE"
+)
+
+// Controller capabilities.
+const (
+	CapabilityCreateDeleteVolume   = "CREATE_DELETE_VOLUME"
+	CapabilityCreateDeleteSnapshot = "CREATE_DELETE_SNAPSHOT"
+	CapabilityListSnapshots        = "LIST_SNAPSHOTS"
+)
+
+// Node capabilities.
+const (
+	CapabilityStageUnstageVolume = "STAGE_UNSTAGE_VOLUME"
+)
+
+// GetPluginInfoResponse is the reply to GetPluginInfo.
+type GetPluginInfoResponse struct {
+	Name          string
+	VendorVersion string
+}
+
+// GetPluginCapabilitiesResponse is the reply to GetPluginCapabilities.
+type GetPluginCapabilitiesResponse struct {
+	Capabilities []string
+}
+
+// ProbeResponse is the reply to Probe.
+type ProbeResponse struct {
+	Ready bool
+}
+
+// CapacityRange is the range of sizes, in bytes, acceptable for a volume. A
+// zero value is unset.
+type CapacityRange struct {
+	RequiredBytes int64
+	LimitBytes    int64
+}
+
+// Volume is a provisioned volume. VolumeID is the policy/volume name.
+type Volume struct {
+	VolumeID      string
+	CapacityBytes int64
+	VolumeContext map[string]string
+}
+
+// CreateVolumeRequest is a request to provision a volume.
+type CreateVolumeRequest struct {
+	Name          string
+	CapacityRange *CapacityRange
+	Parameters    map[string]string
+}
+
+// CreateVolumeResponse is the reply to CreateVolume.
+type CreateVolumeResponse struct {
+	Volume *Volume
+}
+
+// DeleteVolumeRequest is a request to remove a volume.
+type DeleteVolumeRequest struct {
+	VolumeID string
+}
+
+// ControllerGetCapabilitiesResponse is the reply to ControllerGetCapabilities.
+type ControllerGetCapabilitiesResponse struct {
+	Capabilities []string
+}
+
+// Snapshot is a snapshot of a volume. SnapshotID is policy/volume@snapshot.
+type Snapshot struct {
+	SnapshotID     string
+	SourceVolumeID string
+	ReadyToUse     bool
+}
+
+// CreateSnapshotRequest is a request to take a named snapshot of a volume.
+type CreateSnapshotRequest struct {
+	SourceVolumeID string
+	Name           string
+}
+
+// CreateSnapshotResponse is the reply to CreateSnapshot.
+type CreateSnapshotResponse struct {
+	Snapshot *Snapshot
+}
+
+// DeleteSnapshotRequest is a request to remove a snapshot.
+type DeleteSnapshotRequest struct {
+	SnapshotID string
+}
+
+// ListSnapshotsRequest is a request to list snapshots. If neither field is
+// set, the snapshots of all volumes are listed.
+type ListSnapshotsRequest struct {
+	SourceVolumeID string
+	SnapshotID     string
+}
+
+// ListSnapshotsResponse is the reply to ListSnapshots.
+type ListSnapshotsResponse struct {
+	Entries []*Snapshot
+}
+
+// NodeStageVolumeRequest is a request to mount a volume at the staging path.
+type NodeStageVolumeRequest struct {
+	VolumeID          string
+	StagingTargetPath string
+	VolumeContext     map[string]string
+}
+
+// NodeUnstageVolumeRequest is a request to unmount a volume from the staging path.
+type NodeUnstageVolumeRequest struct {
+	VolumeID          string
+	StagingTargetPath string
+}
+
+// NodePublishVolumeRequest is a request to bind-mount a staged volume at the
+// target path.
+type NodePublishVolumeRequest struct {
+	VolumeID          string
+	StagingTargetPath string
+	TargetPath        string
+	Readonly          bool
+}
+
+// NodeUnpublishVolumeRequest is a request to remove the bind mount at the
+// target path.
+type NodeUnpublishVolumeRequest struct {
+	VolumeID   string
+	TargetPath string
+}
+
+// NodeGetCapabilitiesResponse is the reply to NodeGetCapabilities.
+type NodeGetCapabilitiesResponse struct {
+	Capabilities []string
+}
+
+// NodeGetInfoResponse is the reply to NodeGetInfo.
+type NodeGetInfoResponse struct {
+	NodeID string
+}
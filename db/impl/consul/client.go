@@ -0,0 +1,406 @@
+package consul
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db"
+	"github.com/contiv/volplugin/db/jsonio"
+	"github.com/contiv/volplugin/errors"
+	"golang.org/x/net/context"
+)
+
+// watchWait is how long each blocking query of a watch waits for a change
+// before it is re-issued.
+const watchWait = 5 * time.Minute
+
+// Client implements the db.Client interface.
+type Client struct {
+	prefix       string
+	kv           *KV
+	watchers     map[string]chan struct{}
+	watcherMutex sync.Mutex
+	sessions     map[string]string
+	sessionMutex sync.Mutex
+}
+
+// NewClient creates a new Client talking to the consul agent at address.
+func NewClient(address, prefix string) (*Client, error) {
+	kv, err := NewKV(address)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		kv:       kv,
+		prefix:   strings.Trim(prefix, "/"),
+		watchers: map[string]chan struct{}{},
+		sessions: map[string]string{},
+	}
+
+	if _, _, err := kv.Get(context.Background(), c.prefix, nil); err != nil && err != errors.NotExists {
+		return nil, errored.New("Initial setup").Combine(err)
+	}
+
+	return c, nil
+}
+
+func (c *Client) qualified(path string) string {
+	return strings.Join([]string{c.prefix, strings.Trim(path, "/")}, "/")
+}
+
+// Get retrieves the item from consul's key/value store and then populates obj with its data.
+func (c *Client) Get(obj db.Entity) error {
+	if obj.Hooks().PreGet != nil {
+		if err := obj.Hooks().PreGet(c, obj); err != nil {
+			return err
+		}
+	}
+
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	pairs, _, err := c.kv.Get(context.Background(), c.qualified(path), nil)
+	if err != nil {
+		return err
+	}
+
+	if err := jsonio.Read(obj, pairs[0].Value); err != nil {
+		return err
+	}
+
+	if err := obj.SetKey(c.trimPath(pairs[0].Key)); err != nil {
+		return err
+	}
+
+	if obj.Hooks().PostGet != nil {
+		if err := obj.Hooks().PostGet(c, obj); err != nil {
+			return err
+		}
+	}
+
+	return obj.Validate()
+}
+
+// Set takes the object and commits it to the database.
+func (c *Client) Set(obj db.Entity) error {
+	return c.set(obj, &TxnOp{Verb: VerbSet})
+}
+
+// SetWithTTL commits the object to the database, to be removed if it is not
+// set again within the TTL. The key is held by a consul session owned by this
+// client; if another session holds it, errors.Exists is returned. Consul
+// sessions live for at least MinSessionTTL and are removed lazily, so the key
+// may outlive the TTL somewhat.
+func (c *Client) SetWithTTL(obj db.Entity, ttl time.Duration) error {
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	c.sessionMutex.Lock()
+	defer c.sessionMutex.Unlock()
+
+	session, ok := c.sessions[path]
+	if ok {
+		if err := c.kv.RenewSession(context.Background(), session); err != nil {
+			if err != errors.NotExists {
+				return err
+			}
+			ok = false
+		}
+	}
+
+	if !ok {
+		session, err = c.kv.CreateSession(context.Background(), ttl)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := c.set(obj, &TxnOp{Verb: VerbLock, Session: session}); err != nil {
+		if !ok {
+			c.kv.DestroySession(context.Background(), session)
+		}
+		return err
+	}
+
+	c.sessions[path] = session
+	return nil
+}
+
+func (c *Client) set(obj db.Entity, op *TxnOp) error {
+	if err := obj.Validate(); err != nil {
+		return err
+	}
+
+	if obj.Hooks().PreSet != nil {
+		if err := obj.Hooks().PreSet(c, obj); err != nil {
+			return err
+		}
+	}
+
+	content, err := jsonio.Write(obj)
+	if err != nil {
+		return err
+	}
+
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	op.Key = c.qualified(path)
+	op.Value = content
+
+	ok, _, err := c.kv.Txn(context.Background(), []*TxnOp{op})
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return errors.Exists.Combine(errored.Errorf("%q is held by another session", path))
+	}
+
+	if obj.Hooks().PostSet != nil {
+		if err := obj.Hooks().PostSet(c, obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the object from the store.
+func (c *Client) Delete(obj db.Entity) error {
+	if obj.Hooks().PreDelete != nil {
+		if err := obj.Hooks().PreDelete(c, obj); err != nil {
+			return err
+		}
+	}
+
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	if _, _, err := c.kv.Get(context.Background(), c.qualified(path), nil); err != nil {
+		return err
+	}
+
+	if _, _, err := c.kv.Txn(context.Background(), []*TxnOp{{Verb: VerbDelete, Key: c.qualified(path)}}); err != nil {
+		return err
+	}
+
+	c.sessionMutex.Lock()
+	if session, ok := c.sessions[path]; ok {
+		c.kv.DestroySession(context.Background(), session)
+		delete(c.sessions, path)
+	}
+	c.sessionMutex.Unlock()
+
+	if obj.Hooks().PostDelete != nil {
+		if err := obj.Hooks().PostDelete(c, obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Prefix returns a copy of the string used to make the database prefix.
+func (c *Client) Prefix() string {
+	return c.prefix
+}
+
+// Watch watches a given object for changes.
+func (c *Client) Watch(obj db.Entity) (chan db.Entity, chan error) {
+	path, err := obj.Path()
+	if err != nil {
+		errChan := make(chan error, 1)
+		errChan <- err
+		return make(chan db.Entity), errChan
+	}
+
+	return c.watchPath(obj, path, false)
+}
+
+// WatchStop stops a watch for a given object.
+func (c *Client) WatchStop(obj db.Entity) error {
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	return c.watchStopPath(path)
+}
+
+// WatchPrefix watches all items under the given entity's prefix
+func (c *Client) WatchPrefix(obj db.Entity) (chan db.Entity, chan error) {
+	return c.watchPath(obj, obj.Prefix(), true)
+}
+
+// WatchPrefixStop stops a WatchPrefix.
+func (c *Client) WatchPrefixStop(obj db.Entity) error {
+	return c.watchStopPath(obj.Prefix())
+}
+
+// watchPath watches an object for changes with consul blocking queries.
+// Returns two channels: one for entity updates and one for errors. Only one
+// watch for a given path may be active at a time.
+func (c *Client) watchPath(obj db.Entity, path string, recursive bool) (chan db.Entity, chan error) {
+	c.watcherMutex.Lock()
+	defer c.watcherMutex.Unlock()
+
+	stopChan := make(chan struct{}, 1)
+	retChan := make(chan db.Entity)
+	errChan := make(chan error, 1)
+
+	go func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-stopChan
+			cancel()
+		}()
+
+		key := c.qualified(path)
+		if recursive {
+			key += "/"
+		}
+
+		// the first query only establishes the index changes are tracked from.
+		var index uint64
+		first := true
+
+		for {
+			pairs, newIndex, err := c.kv.Get(ctx, key, &QueryOptions{Recurse: recursive, Index: index, Wait: watchWait})
+			if err != nil && err != errors.NotExists {
+				if err == context.Canceled {
+					logrus.Debugf("watch for %q canceled", path)
+					return
+				}
+
+				errChan <- err
+
+				time.Sleep(time.Second)
+				continue
+			}
+
+			if !first {
+				for _, pair := range pairs {
+					if pair.ModifyIndex <= index {
+						continue
+					}
+
+					if entity := c.toEntity(pair, obj); entity != nil {
+						retChan <- entity
+					}
+				}
+			}
+
+			first = false
+
+			// consul's index may go backwards if its state is restored; start over
+			// in that case, as its documentation recommends.
+			if newIndex < index {
+				newIndex = 0
+				first = true
+			}
+
+			index = newIndex
+		}
+	}()
+
+	_, ok := c.watchers[path]
+	if ok {
+		close(c.watchers[path])
+	}
+	c.watchers[path] = stopChan
+
+	return retChan, errChan
+}
+
+// watchStopPath stops a watch given a path to stop the watch on.
+func (c *Client) watchStopPath(path string) error {
+	c.watcherMutex.Lock()
+	defer c.watcherMutex.Unlock()
+
+	stopChan, ok := c.watchers[path]
+	if !ok {
+		return errors.InvalidDBPath.Combine(errored.New("missing key during watch"))
+	}
+
+	close(stopChan)
+	delete(c.watchers, path)
+
+	return nil
+}
+
+func (c *Client) trimPath(key string) string {
+	return strings.Trim(strings.TrimPrefix(strings.Trim(key, "/"), c.Prefix()), "/")
+}
+
+// toEntity converts a pair into a copy of obj. Errors are logged and yield
+// nil, so bad data will not break lists and watches.
+func (c *Client) toEntity(pair *Pair, obj db.Entity) db.Entity {
+	// keys ending in a slash are directories created by other tools.
+	if strings.HasSuffix(pair.Key, "/") {
+		return nil
+	}
+
+	copy := obj.Copy()
+
+	if err := jsonio.Read(copy, pair.Value); err != nil {
+		// This is kept this way so a buggy policy won't break listing all of them
+		logrus.Errorf("Received error retrieving value at path %q during list: %v", pair.Key, err)
+		return nil
+	}
+
+	if err := copy.SetKey(c.trimPath(pair.Key)); err != nil {
+		logrus.Error(err)
+		return nil
+	}
+
+	// same here. fire hooks to retrieve the full entity. only log but don't return on error.
+	if copy.Hooks().PostGet != nil {
+		if err := copy.Hooks().PostGet(c, copy); err != nil {
+			logrus.Errorf("Error received trying to run fetch hooks during %q list: %v", pair.Key, err)
+			return nil
+		}
+	}
+
+	return copy
+}
+
+func (c *Client) list(prefix string, obj db.Entity) ([]db.Entity, error) {
+	pairs, _, err := c.kv.Get(context.Background(), c.qualified(prefix)+"/", &QueryOptions{Recurse: true})
+	if err != nil {
+		return nil, err
+	}
+
+	entities := []db.Entity{}
+	for _, pair := range pairs {
+		if entity := c.toEntity(pair, obj); entity != nil {
+			entities = append(entities, entity)
+		}
+	}
+
+	return entities, nil
+}
+
+// List populates obj with the list of the db in the collection
+// corresponding to the entity.
+func (c *Client) List(obj db.Entity) ([]db.Entity, error) {
+	return c.list(obj.Prefix(), obj)
+}
+
+// ListPrefix is used to list a subtree of an entity, such as listing volume by policy.
+func (c *Client) ListPrefix(prefix string, obj db.Entity) ([]db.Entity, error) {
+	return c.list(path.Join(obj.Prefix(), prefix), obj)
+}
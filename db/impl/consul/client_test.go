@@ -0,0 +1,76 @@
+package consul
+
+import (
+	"strings"
+	. "testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db/impl/consul/consultest"
+	"github.com/contiv/volplugin/db/test"
+	"github.com/contiv/volplugin/errors"
+)
+
+type consulSuite struct {
+	fake   *consultest.Server
+	client *Client
+}
+
+var _ = Suite(&consulSuite{})
+
+func TestConsul(t *T) { TestingT(t) }
+
+func (s *consulSuite) SetUpTest(c *C) {
+	s.fake = consultest.NewServer()
+
+	var err error
+	s.client, err = NewClient(s.fake.URL, "volplugin")
+	c.Assert(err, IsNil)
+}
+
+func (s *consulSuite) TearDownTest(c *C) {
+	s.fake.Close()
+}
+
+func (s *consulSuite) TestNewKV(c *C) {
+	for _, address := range []string{"localhost:8500", "http://localhost:8500", "https://localhost:8500/"} {
+		_, err := NewKV(address)
+		c.Assert(err, IsNil, Commentf("%q", address))
+	}
+
+	_, err := NewKV("ftp://localhost:8500")
+	c.Assert(err, NotNil)
+}
+
+func (s *consulSuite) TestSetWithTTL(c *C) {
+	entity := test.NewEntity("foo", "bar")
+	c.Assert(s.client.SetWithTTL(entity, time.Second), IsNil)
+	c.Assert(s.client.SetWithTTL(entity, time.Second), IsNil)
+
+	other, err := NewClient(s.fake.URL, "volplugin")
+	c.Assert(err, IsNil)
+	er, ok := other.SetWithTTL(entity, time.Second).(*errored.Error)
+	c.Assert(ok, Equals, true)
+	c.Assert(er.Contains(errors.Exists), Equals, true)
+
+	// the key goes away with the session that holds it.
+	s.fake.Expire(s.client.sessions["test/foo"])
+	c.Assert(s.client.Get(test.NewEntity("foo", "")), Equals, errors.NotExists)
+
+	c.Assert(other.SetWithTTL(entity, time.Second), IsNil)
+	c.Assert(s.client.Get(test.NewEntity("foo", "")), IsNil)
+
+	c.Assert(other.Delete(entity), IsNil)
+	c.Assert(len(other.sessions), Equals, 0)
+	c.Assert(len(s.fake.Sessions()), Equals, 0)
+}
+
+func (s *consulSuite) TestDump(c *C) {
+	c.Assert(s.client.Set(test.NewEntity("foo", "bar")), IsNil)
+
+	file, err := s.client.Dump(c.MkDir())
+	c.Assert(err, IsNil)
+	c.Assert(strings.HasSuffix(file, ".tar.gz"), Equals, true)
+}
@@ -0,0 +1,300 @@
+// Package consultest provides an in-memory stand-in for a consul agent, for
+// testing code which talks to consul.
+package consultest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// kvPair and txnOp mirror the JSON of pair and txnOp; they are
+// not imported so the consul package's own tests can use this one.
+type kvPair struct {
+	Key         string
+	Value       []byte
+	Flags       uint64
+	CreateIndex uint64
+	ModifyIndex uint64
+	LockIndex   uint64
+	Session     string `json:",omitempty"`
+}
+
+type txnOp struct {
+	Verb    string
+	Key     string
+	Value   []byte
+	Index   uint64
+	Session string
+}
+
+// Server is an in-memory stand-in for the parts of a consul agent's HTTP API
+// volplugin uses: the key/value store with blocking queries, transactions and
+// sessions. Sessions only expire when Expire is called.
+type Server struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	index    uint64
+	pairs    map[string]*kvPair
+	sessions map[string]bool
+	changed  chan struct{}
+	values   int
+}
+
+// NewServer starts a Server. Close it when done.
+func NewServer() *Server {
+	f := &Server{
+		index:    1,
+		pairs:    map[string]*kvPair{},
+		sessions: map[string]bool{},
+		changed:  make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/kv/", f.kv)
+	mux.HandleFunc("/v1/txn", f.txn)
+	mux.HandleFunc("/v1/session/", f.session)
+	f.Server = httptest.NewServer(mux)
+
+	return f
+}
+
+// bump must be called with the mutex held after every write.
+func (f *Server) bump() uint64 {
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+	return f.index
+}
+
+// Expire expires the session as if it was not renewed in time.
+func (f *Server) Expire(id string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.destroy(id)
+}
+
+func (f *Server) destroy(id string) {
+	delete(f.sessions, id)
+	for key, pair := range f.pairs {
+		if pair.Session == id {
+			delete(f.pairs, key)
+		}
+	}
+	f.bump()
+}
+
+func (f *Server) kv(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	_, recurse := r.URL.Query()["recurse"]
+
+	f.mutex.Lock()
+	if index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); index > 0 && index >= f.index {
+		wait, _ := time.ParseDuration(r.URL.Query().Get("wait"))
+		changed := f.changed
+		f.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		case <-r.Context().Done():
+		}
+
+		f.mutex.Lock()
+	}
+	defer f.mutex.Unlock()
+
+	w.Header().Set("X-Consul-Index", fmt.Sprint(f.index))
+
+	if _, ok := r.URL.Query()["keys"]; ok {
+		f.keys(w, key, r.URL.Query().Get("separator"))
+		return
+	}
+
+	pairs := []*kvPair{}
+	for k, pair := range f.pairs {
+		if k == key || (recurse && strings.HasPrefix(k, key)) {
+			pairs = append(pairs, pair)
+		}
+	}
+
+	if len(pairs) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	f.values += len(pairs)
+	sort.Sort(byKey(pairs))
+	json.NewEncoder(w).Encode(pairs)
+}
+
+// keys lists the keys under the prefix, cut after the first separator
+// following it.
+func (f *Server) keys(w http.ResponseWriter, prefix, separator string) {
+	seen := map[string]bool{}
+	keys := []string{}
+	for k := range f.pairs {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		if i := strings.Index(k[len(prefix):], separator); separator != "" && i >= 0 {
+			k = k[:len(prefix)+i+len(separator)]
+		}
+
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+
+	if len(keys) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	sort.Strings(keys)
+	json.NewEncoder(w).Encode(keys)
+}
+
+func (f *Server) txn(w http.ResponseWriter, r *http.Request) {
+	ops := []*struct{ KV *txnOp }{}
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	// the operations are applied in order to a copy of the store, which
+	// replaces it only if all of them succeed. They share one index, as they
+	// do in consul.
+	index := f.index + 1
+	pairs := map[string]*kvPair{}
+	for key, pair := range f.pairs {
+		copy := *pair
+		pairs[key] = &copy
+	}
+
+	resp := &txnResponse{}
+	for _, op := range ops {
+		pair, exists := pairs[op.KV.Key]
+		ok := true
+
+		switch op.KV.Verb {
+		case "check-not-exists":
+			ok = !exists
+		case "check-index":
+			ok = exists && pair.ModifyIndex == op.KV.Index
+		case "cas", "delete-cas":
+			ok = (op.KV.Index == 0 && !exists) || (exists && pair.ModifyIndex == op.KV.Index)
+		case "lock":
+			ok = f.sessions[op.KV.Session] && (!exists || pair.Session == "" || pair.Session == op.KV.Session)
+		case "get":
+			ok = exists
+		}
+
+		if !ok {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(&txnResponse{})
+			return
+		}
+
+		switch op.KV.Verb {
+		case "set", "cas", "lock":
+			if !exists {
+				pair = &kvPair{Key: op.KV.Key, CreateIndex: index}
+				pairs[op.KV.Key] = pair
+			}
+			pair.Value = op.KV.Value
+			pair.ModifyIndex = index
+			if op.KV.Verb == "lock" {
+				pair.Session = op.KV.Session
+			}
+			resp.Results = append(resp.Results, &txnResult{KV: &kvPair{Key: pair.Key, CreateIndex: pair.CreateIndex, ModifyIndex: pair.ModifyIndex, Session: pair.Session}})
+		case "get":
+			f.values++
+			resp.Results = append(resp.Results, &txnResult{KV: pair})
+		case "delete", "delete-cas":
+			delete(pairs, op.KV.Key)
+		case "delete-tree":
+			for key := range pairs {
+				if strings.HasPrefix(key, op.KV.Key) {
+					delete(pairs, key)
+				}
+			}
+		}
+	}
+
+	f.pairs = pairs
+	f.bump()
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (f *Server) session(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/session/"), "/")
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	switch parts[0] {
+	case "create":
+		f.index++
+		id := fmt.Sprintf("session-%d", f.index)
+		f.sessions[id] = true
+		json.NewEncoder(w).Encode(map[string]string{"ID": id})
+	case "renew":
+		if !f.sessions[parts[1]] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, "[]")
+	case "destroy":
+		f.destroy(parts[1])
+		fmt.Fprint(w, "true")
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// ValuesRead returns the number of values reads have returned, so tests can
+// tell which reads only listed keys.
+func (f *Server) ValuesRead() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.values
+}
+
+// Sessions returns the IDs of the sessions which are alive.
+func (f *Server) Sessions() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	ids := []string{}
+	for id := range f.sessions {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+type txnResult struct {
+	KV *kvPair
+}
+
+type txnResponse struct {
+	Results []*txnResult
+}
+
+type byKey []*kvPair
+
+func (b byKey) Len() int           { return len(b) }
+func (b byKey) Less(i, j int) bool { return b[i].Key < b[j].Key }
+func (b byKey) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
@@ -0,0 +1,333 @@
+package consul
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"golang.org/x/net/context"
+)
+
+// MinSessionTTL and MaxSessionTTL bound the TTL of consul sessions; TTLs
+// outside of them are raised or lowered to fit.
+const (
+	MinSessionTTL = 10 * time.Second
+	MaxSessionTTL = 24 * time.Hour
+)
+
+// Txn verbs used by volplugin. See consul's /v1/txn documentation for the
+// meaning of each.
+const (
+	VerbSet            = "set"
+	VerbCAS            = "cas"
+	VerbLock           = "lock"
+	VerbGet            = "get"
+	VerbDelete         = "delete"
+	VerbDeleteCAS      = "delete-cas"
+	VerbDeleteTree     = "delete-tree"
+	VerbCheckIndex     = "check-index"
+	VerbCheckNotExists = "check-not-exists"
+)
+
+// Pair is a key and its value, as consul stores them. Keys held by a session
+// are removed when the session expires.
+type Pair struct {
+	Key         string
+	Value       []byte
+	Flags       uint64
+	CreateIndex uint64
+	ModifyIndex uint64
+	LockIndex   uint64
+	Session     string `json:",omitempty"`
+}
+
+// QueryOptions are the options of a read. A read with an Index blocks until
+// the index changes or Wait passes.
+type QueryOptions struct {
+	Recurse bool
+	Index   uint64
+	Wait    time.Duration
+}
+
+// TxnOp is a single operation of a transaction.
+type TxnOp struct {
+	Verb    string
+	Key     string
+	Value   []byte `json:",omitempty"`
+	Index   uint64 `json:",omitempty"`
+	Session string `json:",omitempty"`
+}
+
+type txnOp struct {
+	KV *TxnOp
+}
+
+type txnResult struct {
+	KV *Pair
+}
+
+type txnResponse struct {
+	Results []*txnResult
+	Errors  []struct {
+		OpIndex int
+		What    string
+	}
+}
+
+// KV is a client of consul's key/value, transaction and session HTTP APIs.
+type KV struct {
+	address string
+	client  *http.Client
+}
+
+// NewKV returns a client of the consul agent at the address, given as
+// host:port or as an http or https URL.
+func NewKV(address string) (*KV, error) {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, errors.Consul.Combine(err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Consul.Combine(errored.Errorf("Invalid consul address %q", address))
+	}
+
+	return &KV{address: strings.TrimSuffix(u.String(), "/"), client: &http.Client{}}, nil
+}
+
+func (kv *KV) do(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Response, error) {
+	u := kv.address + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, errors.Consul.Combine(err)
+	}
+
+	resp, err := kv.client.Do(req.WithContext(ctx))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		return nil, errors.Consul.Combine(err)
+	}
+
+	return resp, nil
+}
+
+func readError(resp *http.Response) error {
+	content, _ := ioutil.ReadAll(resp.Body)
+	return errors.Consul.Combine(errored.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(content))))
+}
+
+// Get reads the key, or with Recurse every key it prefixes, along with the
+// index of the read. It returns errors.NotExists if there are none.
+func (kv *KV) Get(ctx context.Context, key string, opts *QueryOptions) ([]*Pair, uint64, error) {
+	query := url.Values{}
+	if opts != nil {
+		if opts.Recurse {
+			query.Set("recurse", "")
+		}
+
+		if opts.Index > 0 {
+			query.Set("index", strconv.FormatUint(opts.Index, 10))
+			if opts.Wait > 0 {
+				query.Set("wait", fmt.Sprintf("%dms", opts.Wait/time.Millisecond))
+			}
+		}
+	}
+
+	resp, err := kv.do(ctx, "GET", "/v1/kv/"+key, query, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, index, errors.NotExists
+	default:
+		return nil, 0, readError(resp)
+	}
+
+	pairs := []*Pair{}
+	if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return nil, 0, errors.Consul.Combine(err)
+	}
+
+	return pairs, index, nil
+}
+
+// Keys lists the keys the prefix prefixes, along with the index of the read.
+// With a separator, each key is cut after the first separator following the
+// prefix and listed once, so only one level of a hierarchy is listed. It
+// returns errors.NotExists if there are none.
+func (kv *KV) Keys(ctx context.Context, prefix, separator string) ([]string, uint64, error) {
+	query := url.Values{}
+	query.Set("keys", "")
+	if separator != "" {
+		query.Set("separator", separator)
+	}
+
+	resp, err := kv.do(ctx, "GET", "/v1/kv/"+prefix, query, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, index, errors.NotExists
+	default:
+		return nil, 0, readError(resp)
+	}
+
+	keys := []string{}
+	if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil {
+		return nil, 0, errors.Consul.Combine(err)
+	}
+
+	return keys, index, nil
+}
+
+// Txn applies the operations atomically. If any of them fails, none are
+// applied and false is returned. The pairs written or read by the operations
+// are returned in order.
+func (kv *KV) Txn(ctx context.Context, ops []*TxnOp) (bool, []*Pair, error) {
+	wrapped := []*txnOp{}
+	for _, op := range ops {
+		wrapped = append(wrapped, &txnOp{KV: op})
+	}
+
+	content, err := json.Marshal(wrapped)
+	if err != nil {
+		return false, nil, errors.Consul.Combine(err)
+	}
+
+	resp, err := kv.do(ctx, "PUT", "/v1/txn", nil, bytes.NewReader(content))
+	if err != nil {
+		return false, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusConflict {
+		return false, nil, readError(resp)
+	}
+
+	tr := &txnResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(tr); err != nil {
+		return false, nil, errors.Consul.Combine(err)
+	}
+
+	if resp.StatusCode == http.StatusConflict {
+		return false, nil, nil
+	}
+
+	pairs := []*Pair{}
+	for _, result := range tr.Results {
+		if result.KV != nil {
+			pairs = append(pairs, result.KV)
+		}
+	}
+
+	return true, pairs, nil
+}
+
+// SessionTTL returns the TTL a session given the TTL is created with.
+func SessionTTL(ttl time.Duration) time.Duration {
+	switch {
+	case ttl < MinSessionTTL:
+		return MinSessionTTL
+	case ttl > MaxSessionTTL:
+		return MaxSessionTTL
+	default:
+		return ttl
+	}
+}
+
+// CreateSession creates a session which expires unless it is renewed within
+// the TTL. The keys it holds are removed when it expires.
+func (kv *KV) CreateSession(ctx context.Context, ttl time.Duration) (string, error) {
+	content, err := json.Marshal(map[string]string{
+		"Name":      "volplugin",
+		"TTL":       fmt.Sprintf("%ds", SessionTTL(ttl)/time.Second),
+		"Behavior":  "delete",
+		"LockDelay": "0s",
+	})
+	if err != nil {
+		return "", errors.Consul.Combine(err)
+	}
+
+	resp, err := kv.do(ctx, "PUT", "/v1/session/create", nil, bytes.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", readError(resp)
+	}
+
+	session := struct{ ID string }{}
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return "", errors.Consul.Combine(err)
+	}
+
+	return session.ID, nil
+}
+
+// RenewSession resets the TTL of the session. It returns errors.NotExists if
+// the session has already expired.
+func (kv *KV) RenewSession(ctx context.Context, id string) error {
+	resp, err := kv.do(ctx, "PUT", "/v1/session/renew/"+id, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return errors.NotExists
+	default:
+		return readError(resp)
+	}
+}
+
+// DestroySession destroys the session, removing the keys it holds.
+func (kv *KV) DestroySession(ctx context.Context, id string) error {
+	resp, err := kv.do(ctx, "PUT", "/v1/session/destroy/"+id, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+
+	return nil
+}
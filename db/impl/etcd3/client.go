@@ -0,0 +1,382 @@
+package etcd3
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db"
+	"github.com/contiv/volplugin/db/jsonio"
+	"github.com/contiv/volplugin/errors"
+	"golang.org/x/net/context"
+)
+
+// Client implements the db.Client interface.
+type Client struct {
+	prefix       string
+	kv           *KV
+	watchers     map[string]chan struct{}
+	watcherMutex sync.Mutex
+	leases       *Leases
+}
+
+// NewClient creates a new Client talking to the etcd member at address. See
+// NewKV for the form of the address.
+func NewClient(address, prefix string) (*Client, error) {
+	kv, err := NewKV(address)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		kv:       kv,
+		prefix:   strings.Trim(prefix, "/"),
+		watchers: map[string]chan struct{}{},
+		leases:   NewLeases(kv),
+	}
+
+	if _, err := kv.Range(context.Background(), &RangeRequest{Key: []byte(c.qualified(""))}); err != nil {
+		return nil, errored.New("Initial setup").Combine(err)
+	}
+
+	return c, nil
+}
+
+// keys are laid out as they are in etcd v2, so a v2 keyspace can be copied
+// over as is.
+func (c *Client) qualified(path string) string {
+	return "/" + strings.Join([]string{c.prefix, strings.Trim(path, "/")}, "/")
+}
+
+// Get retrieves the item from etcd's key/value store and then populates obj with its data.
+func (c *Client) Get(obj db.Entity) error {
+	if obj.Hooks().PreGet != nil {
+		if err := obj.Hooks().PreGet(c, obj); err != nil {
+			return err
+		}
+	}
+
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	kv, _, err := c.kv.Get(context.Background(), []byte(c.qualified(path)))
+	if err != nil {
+		return err
+	}
+
+	if err := jsonio.Read(obj, kv.Value); err != nil {
+		return err
+	}
+
+	if err := obj.SetKey(c.trimPath(string(kv.Key))); err != nil {
+		return err
+	}
+
+	if obj.Hooks().PostGet != nil {
+		if err := obj.Hooks().PostGet(c, obj); err != nil {
+			return err
+		}
+	}
+
+	return obj.Validate()
+}
+
+// Set takes the object and commits it to the database.
+func (c *Client) Set(obj db.Entity) error {
+	return c.set(obj, 0, 0)
+}
+
+// SetWithTTL commits the object to the database, attached to a lease with the
+// TTL. The client keeps one lease per TTL alive for as long as it is open, so
+// the object only expires if the client stops, or is closed or cut off from
+// etcd for longer than the TTL.
+func (c *Client) SetWithTTL(obj db.Entity, ttl time.Duration) error {
+	lease, err := c.leases.Get(ttl)
+	if err != nil {
+		return err
+	}
+
+	if err = c.set(obj, ttl, lease); err == errors.NotExists {
+		// the lease expired before it was found to be gone; try again with a
+		// new one. The object is set below, so it is not put back with the others.
+		if path, err := obj.Path(); err == nil {
+			c.leases.Release([]byte(c.qualified(path)), false)
+		}
+
+		if lease, err = c.leases.Renew(ttl, lease); err != nil {
+			return err
+		}
+
+		err = c.set(obj, ttl, lease)
+	}
+
+	return err
+}
+
+// set puts the object, on the lease with the TTL if lease is not zero.
+func (c *Client) set(obj db.Entity, ttl time.Duration, lease int64) error {
+	if err := obj.Validate(); err != nil {
+		return err
+	}
+
+	if obj.Hooks().PreSet != nil {
+		if err := obj.Hooks().PreSet(c, obj); err != nil {
+			return err
+		}
+	}
+
+	content, err := jsonio.Write(obj)
+	if err != nil {
+		return err
+	}
+
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	key := []byte(c.qualified(path))
+	if _, err := c.kv.Put(context.Background(), &PutRequest{Key: key, Value: content, Lease: lease}); err != nil {
+		return err
+	}
+
+	if lease != 0 {
+		c.leases.Hold(ttl, key, content)
+	} else {
+		c.leases.Release(key, false)
+	}
+
+	if obj.Hooks().PostSet != nil {
+		if err := obj.Hooks().PostSet(c, obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the object from the store.
+func (c *Client) Delete(obj db.Entity) error {
+	if obj.Hooks().PreDelete != nil {
+		if err := obj.Hooks().PreDelete(c, obj); err != nil {
+			return err
+		}
+	}
+
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	key := []byte(c.qualified(path))
+	resp, err := c.kv.DeleteRange(context.Background(), &DeleteRangeRequest{Key: key})
+	if err != nil {
+		return err
+	}
+
+	c.leases.Release(key, false)
+
+	if resp.Deleted == 0 {
+		return errors.NotExists
+	}
+
+	if obj.Hooks().PostDelete != nil {
+		if err := obj.Hooks().PostDelete(c, obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close stops keeping the client's leases alive and revokes them, removing
+// the objects set with a TTL.
+func (c *Client) Close() error {
+	return c.leases.Close()
+}
+
+// Prefix returns a copy of the string used to make the database prefix.
+func (c *Client) Prefix() string {
+	return c.prefix
+}
+
+// Watch watches a given object for changes.
+func (c *Client) Watch(obj db.Entity) (chan db.Entity, chan error) {
+	path, err := obj.Path()
+	if err != nil {
+		errChan := make(chan error, 1)
+		errChan <- err
+		return make(chan db.Entity), errChan
+	}
+
+	return c.watchPath(obj, path, false)
+}
+
+// WatchStop stops a watch for a given object.
+func (c *Client) WatchStop(obj db.Entity) error {
+	path, err := obj.Path()
+	if err != nil {
+		return err
+	}
+
+	return c.watchStopPath(path)
+}
+
+// WatchPrefix watches all items under the given entity's prefix
+func (c *Client) WatchPrefix(obj db.Entity) (chan db.Entity, chan error) {
+	return c.watchPath(obj, obj.Prefix(), true)
+}
+
+// WatchPrefixStop stops a WatchPrefix.
+func (c *Client) WatchPrefixStop(obj db.Entity) error {
+	return c.watchStopPath(obj.Prefix())
+}
+
+// watchPath watches an object for changes. Returns two channels: one for
+// entity updates and one for errors. Only one watch for a given path may be
+// active at a time.
+func (c *Client) watchPath(obj db.Entity, path string, recursive bool) (chan db.Entity, chan error) {
+	c.watcherMutex.Lock()
+	defer c.watcherMutex.Unlock()
+
+	stopChan := make(chan struct{}, 1)
+	retChan := make(chan db.Entity)
+	errChan := make(chan error, 1)
+
+	go func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-stopChan
+			cancel()
+		}()
+
+		key := []byte(c.qualified(path))
+		var rangeEnd []byte
+		if recursive {
+			key = append(key, '/')
+			rangeEnd = PrefixEnd(key)
+		}
+
+		// after a failure, the watch resumes after the last revision it saw.
+		var next int64
+
+		for {
+			respChan, watchErrChan := c.kv.Watch(ctx, key, rangeEnd, next)
+			for resp := range respChan {
+				for _, ev := range resp.Events {
+					if ev.Type != EventPut {
+						continue
+					}
+
+					if entity := c.toEntity(ev.Kv, obj); entity != nil {
+						retChan <- entity
+					}
+				}
+
+				next = resp.Header.Revision + 1
+			}
+
+			err := <-watchErrChan
+			if err == context.Canceled {
+				logrus.Debugf("watch for %q canceled", path)
+				return
+			}
+
+			errChan <- err
+			time.Sleep(time.Second)
+		}
+	}()
+
+	_, ok := c.watchers[path]
+	if ok {
+		close(c.watchers[path])
+	}
+	c.watchers[path] = stopChan
+
+	return retChan, errChan
+}
+
+// watchStopPath stops a watch given a path to stop the watch on.
+func (c *Client) watchStopPath(path string) error {
+	c.watcherMutex.Lock()
+	defer c.watcherMutex.Unlock()
+
+	stopChan, ok := c.watchers[path]
+	if !ok {
+		return errors.InvalidDBPath.Combine(errored.New("missing key during watch"))
+	}
+
+	close(stopChan)
+	delete(c.watchers, path)
+
+	return nil
+}
+
+func (c *Client) trimPath(key string) string {
+	return strings.Trim(strings.TrimPrefix(strings.Trim(key, "/"), c.Prefix()), "/")
+}
+
+// toEntity converts a key into a copy of obj. Errors are logged and yield
+// nil, so bad data will not break lists and watches.
+func (c *Client) toEntity(kv *KeyValue, obj db.Entity) db.Entity {
+	// keys ending in a slash are the directories of a copied v2 keyspace.
+	if strings.HasSuffix(string(kv.Key), "/") {
+		return nil
+	}
+
+	copy := obj.Copy()
+
+	if err := jsonio.Read(copy, kv.Value); err != nil {
+		// This is kept this way so a buggy policy won't break listing all of them
+		logrus.Errorf("Received error retrieving value at path %q during list: %v", kv.Key, err)
+		return nil
+	}
+
+	if err := copy.SetKey(c.trimPath(string(kv.Key))); err != nil {
+		logrus.Error(err)
+		return nil
+	}
+
+	// same here. fire hooks to retrieve the full entity. only log but don't return on error.
+	if copy.Hooks().PostGet != nil {
+		if err := copy.Hooks().PostGet(c, copy); err != nil {
+			logrus.Errorf("Error received trying to run fetch hooks during %q list: %v", kv.Key, err)
+			return nil
+		}
+	}
+
+	return copy
+}
+
+func (c *Client) list(prefix string, obj db.Entity) ([]db.Entity, error) {
+	key := []byte(c.qualified(prefix) + "/")
+	resp, err := c.kv.Range(context.Background(), &RangeRequest{Key: key, RangeEnd: PrefixEnd(key)})
+	if err != nil {
+		return nil, err
+	}
+
+	entities := []db.Entity{}
+	for _, kv := range resp.Kvs {
+		if entity := c.toEntity(kv, obj); entity != nil {
+			entities = append(entities, entity)
+		}
+	}
+
+	return entities, nil
+}
+
+// List populates obj with the list of the db in the collection
+// corresponding to the entity.
+func (c *Client) List(obj db.Entity) ([]db.Entity, error) {
+	return c.list(obj.Prefix(), obj)
+}
+
+// ListPrefix is used to list a subtree of an entity, such as listing volume by policy.
+func (c *Client) ListPrefix(prefix string, obj db.Entity) ([]db.Entity, error) {
+	return c.list(path.Join(obj.Prefix(), prefix), obj)
+}
@@ -0,0 +1,122 @@
+package etcd3
+
+import (
+	"strings"
+	. "testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/db/impl/etcd3/etcd3test"
+	"github.com/contiv/volplugin/db/test"
+	"github.com/contiv/volplugin/errors"
+	"golang.org/x/net/context"
+)
+
+type etcd3Suite struct {
+	fake   *etcd3test.Server
+	client *Client
+}
+
+var _ = Suite(&etcd3Suite{})
+
+func TestEtcd3(t *T) { TestingT(t) }
+
+func (s *etcd3Suite) SetUpTest(c *C) {
+	s.fake = etcd3test.NewServer()
+
+	var err error
+	s.client, err = NewClient(s.fake.URL, "volplugin")
+	c.Assert(err, IsNil)
+}
+
+func (s *etcd3Suite) TearDownTest(c *C) {
+	s.fake.Close()
+}
+
+func (s *etcd3Suite) TestNewKV(c *C) {
+	for address, expected := range map[string]string{
+		"localhost:2379":               "http://localhost:2379/v3",
+		"http://localhost:2379":        "http://localhost:2379/v3",
+		"https://localhost:2379/":      "https://localhost:2379/v3",
+		"http://localhost:2379/v3beta": "http://localhost:2379/v3beta",
+	} {
+		kv, err := NewKV(address)
+		c.Assert(err, IsNil, Commentf("%q", address))
+		c.Assert(kv.address, Equals, expected)
+	}
+
+	_, err := NewKV("ftp://localhost:2379")
+	c.Assert(err, NotNil)
+}
+
+func (s *etcd3Suite) TestPrefixEnd(c *C) {
+	c.Assert(PrefixEnd([]byte("/volplugin/")), DeepEquals, []byte("/volplugin0"))
+	c.Assert(PrefixEnd([]byte{'a', 0xff}), DeepEquals, []byte{'b'})
+	c.Assert(PrefixEnd([]byte{0xff}), DeepEquals, []byte{0})
+}
+
+func (s *etcd3Suite) TestSetWithTTL(c *C) {
+	c.Assert(s.client.SetWithTTL(test.NewEntity("foo", "bar"), time.Minute), IsNil)
+	c.Assert(s.client.SetWithTTL(test.NewEntity("bar", "baz"), time.Minute), IsNil)
+	c.Assert(s.client.SetWithTTL(test.NewEntity("baz", "quux"), time.Hour), IsNil)
+
+	// one lease per TTL is shared by every key set with it.
+	c.Assert(len(s.fake.Leases()), Equals, 2)
+
+	minute, err := s.client.leases.Get(time.Minute)
+	c.Assert(err, IsNil)
+	s.fake.Expire(minute)
+	c.Assert(s.client.Get(test.NewEntity("foo", "")), Equals, errors.NotExists)
+	c.Assert(s.client.Get(test.NewEntity("bar", "")), Equals, errors.NotExists)
+	c.Assert(s.client.Get(test.NewEntity("baz", "")), IsNil)
+
+	// the expired lease is replaced when it is next used, and the keys held
+	// with it are attached to the new one.
+	c.Assert(s.client.SetWithTTL(test.NewEntity("foo", "bar"), time.Minute), IsNil)
+	c.Assert(s.client.Get(test.NewEntity("foo", "")), IsNil)
+	c.Assert(s.client.Get(test.NewEntity("bar", "")), IsNil)
+	c.Assert(len(s.fake.Leases()), Equals, 2)
+
+	c.Assert(s.client.Close(), IsNil)
+	c.Assert(s.client.Get(test.NewEntity("baz", "")), Equals, errors.NotExists)
+	c.Assert(len(s.fake.Leases()), Equals, 0)
+}
+
+func (s *etcd3Suite) TestLeaseRenewed(c *C) {
+	ttl := 300 * time.Millisecond
+	c.Assert(s.client.SetWithTTL(test.NewEntity("foo", "bar"), ttl), IsNil)
+	c.Assert(s.client.SetWithTTL(test.NewEntity("bar", "baz"), ttl), IsNil)
+	c.Assert(s.client.SetWithTTL(test.NewEntity("deleted", "baz"), ttl), IsNil)
+	c.Assert(s.client.Delete(test.NewEntity("deleted", "")), IsNil)
+
+	lease, err := s.client.leases.Get(ttl)
+	c.Assert(err, IsNil)
+	s.fake.Expire(lease)
+
+	// bar is taken by someone else while the lease is gone.
+	_, err = s.client.kv.Put(context.Background(), &PutRequest{Key: []byte(s.client.qualified("test/bar")), Value: []byte(`{"Name":"bar","SomeData":"other"}`)})
+	c.Assert(err, IsNil)
+
+	for i := 0; i < 100 && s.client.Get(test.NewEntity("foo", "")) != nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the keys held are attached to a new lease by the keepalive.
+	c.Assert(s.client.Get(test.NewEntity("foo", "")), IsNil)
+	c.Assert(s.fake.Leases(), HasLen, 1)
+	c.Assert(s.fake.Leases()[0] == lease, Equals, false)
+
+	bar := test.NewEntity("bar", "")
+	c.Assert(s.client.Get(bar), IsNil)
+	c.Assert(bar.SomeData, Equals, "other")
+	c.Assert(s.client.Get(test.NewEntity("deleted", "")), Equals, errors.NotExists)
+}
+
+func (s *etcd3Suite) TestDump(c *C) {
+	c.Assert(s.client.Set(test.NewEntity("foo", "bar")), IsNil)
+
+	file, err := s.client.Dump(c.MkDir())
+	c.Assert(err, IsNil)
+	c.Assert(strings.HasSuffix(file, ".tar.gz"), Equals, true)
+}
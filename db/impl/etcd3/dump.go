@@ -0,0 +1,102 @@
+package etcd3
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+	"golang.org/x/net/context"
+)
+
+// Dump yields a database dump of the keyspace we manage. It will be contained
+// in a tarball based on the timestamp of the dump. If a dir is provided, it
+// will be placed under that directory.
+func (c *Client) Dump(dir string) (string, error) {
+	key := []byte(c.qualified(""))
+	resp, err := c.kv.Range(context.Background(), &RangeRequest{Key: key, RangeEnd: PrefixEnd(key)})
+	if err != nil {
+		return "", errored.Errorf(`Failed to recursively GET "%v" namespace from etcd`, c.prefix).Combine(err)
+	}
+
+	now := time.Now()
+
+	// tar hangs during unpacking if the base directory has colons in it
+	// unless --force-local is specified, so use the simpler "%Y%m%d-%H%M%S".
+	niceTimeFormat := fmt.Sprintf("%d%02d%02d-%02d%02d%02d",
+		now.Year(), now.Month(), now.Day(),
+		now.Hour(), now.Minute(), now.Second())
+
+	file, err := ioutil.TempFile(dir, "etcd3_dump_"+niceTimeFormat+"_")
+	if err != nil {
+		return "", errored.Errorf("Failed to create tempfile").Combine(err)
+	}
+	defer file.Close()
+
+	// create a gzipped, tarball writer which cleans up after itself
+	gzipWriter := gzip.NewWriter(file)
+	defer gzipWriter.Close()
+
+	tarWriter := tar.NewWriter(gzipWriter)
+	defer tarWriter.Close()
+
+	// ensure that the tarball extracts to a folder with the same name as the tarball
+	baseDirectory := filepath.Base(file.Name())
+
+	// etcd v3 has no directories; the directories in the tarball are implied by
+	// the keys, which come back sorted.
+	for _, kv := range resp.Kvs {
+		if err := addKeyValueToTarball(kv, tarWriter, baseDirectory); err != nil {
+			return "", err
+		}
+	}
+
+	// give the file a more fitting name
+	newFilename := file.Name() + ".tar.gz"
+
+	if err := os.Rename(file.Name(), newFilename); err != nil {
+		return "", err
+	}
+
+	return newFilename, nil
+}
+
+func addKeyValueToTarball(kv *KeyValue, writer *tar.Writer, baseDirectory string) error {
+	now := time.Now()
+
+	header := &tar.Header{
+		AccessTime: now,
+		ChangeTime: now,
+		ModTime:    now,
+		Name:       baseDirectory + string(kv.Key),
+		Mode:       0600,
+		Size:       int64(len(kv.Value)),
+		Typeflag:   tar.TypeReg,
+	}
+
+	// keys ending in a slash stand for directories.
+	if strings.HasSuffix(string(kv.Key), "/") {
+		header.Mode = 0700
+		header.Size = 0
+		header.Typeflag = tar.TypeDir
+	}
+
+	if err := writer.WriteHeader(header); err != nil {
+		return errored.Errorf("Failed to write tar entry header").Combine(err)
+	}
+
+	if header.Typeflag == tar.TypeDir {
+		return nil
+	}
+
+	if _, err := writer.Write(kv.Value); err != nil {
+		return errored.Errorf("Failed to write tar entry").Combine(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,547 @@
+// Package etcd3test provides an in-memory stand-in for etcd's v3 JSON
+// gateway, for testing code which talks to etcd v3.
+package etcd3test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+)
+
+// the types below mirror the JSON of the etcd3 package's; they are not
+// imported so its own tests can use this package.
+
+type keyValue struct {
+	Key            []byte `json:"key,omitempty"`
+	Value          []byte `json:"value,omitempty"`
+	CreateRevision int64  `json:"create_revision,string,omitempty"`
+	ModRevision    int64  `json:"mod_revision,string,omitempty"`
+	Version        int64  `json:"version,string,omitempty"`
+	Lease          int64  `json:"lease,string,omitempty"`
+}
+
+type header struct {
+	Revision int64 `json:"revision,string,omitempty"`
+}
+
+type rangeRequest struct {
+	Key      []byte `json:"key,omitempty"`
+	RangeEnd []byte `json:"range_end,omitempty"`
+	KeysOnly bool   `json:"keys_only,omitempty"`
+}
+
+type putRequest struct {
+	Key    []byte `json:"key,omitempty"`
+	Value  []byte `json:"value,omitempty"`
+	Lease  int64  `json:"lease,string,omitempty"`
+	PrevKV bool   `json:"prev_kv,omitempty"`
+}
+
+type deleteRangeRequest struct {
+	Key      []byte `json:"key,omitempty"`
+	RangeEnd []byte `json:"range_end,omitempty"`
+	PrevKV   bool   `json:"prev_kv,omitempty"`
+}
+
+type compare struct {
+	Result         string `json:"result,omitempty"`
+	Target         string `json:"target,omitempty"`
+	Key            []byte `json:"key,omitempty"`
+	Version        int64  `json:"version,string"`
+	CreateRevision int64  `json:"create_revision,string"`
+	ModRevision    int64  `json:"mod_revision,string"`
+	Value          []byte `json:"value,omitempty"`
+}
+
+type requestOp struct {
+	RequestRange       *rangeRequest       `json:"request_range,omitempty"`
+	RequestPut         *putRequest         `json:"request_put,omitempty"`
+	RequestDeleteRange *deleteRangeRequest `json:"request_delete_range,omitempty"`
+}
+
+type txnRequest struct {
+	Compare []*compare   `json:"compare,omitempty"`
+	Success []*requestOp `json:"success,omitempty"`
+	Failure []*requestOp `json:"failure,omitempty"`
+}
+
+type leaseRequest struct {
+	TTL int64 `json:"TTL,string,omitempty"`
+	ID  int64 `json:"ID,string,omitempty"`
+}
+
+type event struct {
+	Type   string    `json:"type,omitempty"`
+	Kv     *keyValue `json:"kv,omitempty"`
+	PrevKv *keyValue `json:"prev_kv,omitempty"`
+}
+
+type watchRequest struct {
+	CreateRequest *struct {
+		Key           []byte `json:"key,omitempty"`
+		RangeEnd      []byte `json:"range_end,omitempty"`
+		StartRevision int64  `json:"start_revision,string,omitempty"`
+		PrevKV        bool   `json:"prev_kv,omitempty"`
+	} `json:"create_request,omitempty"`
+}
+
+type revision struct {
+	revision int64
+	events   []*event
+}
+
+// Server is an in-memory stand-in for the parts of etcd's v3 JSON gateway
+// volplugin uses: ranges, puts, deletes, transactions, leases and watches.
+// Leases only expire when Expire is called. It serves the API under
+// /v3.
+type Server struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	revision int64
+	kvs      map[string]*keyValue
+	leases   map[int64]int64
+	nextID   int64
+	history  []*revision
+	changed  chan struct{}
+	values   int
+}
+
+// NewServer starts a Server. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		revision: 1,
+		kvs:      map[string]*keyValue{},
+		leases:   map[int64]int64{},
+		nextID:   1000,
+		changed:  make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/kv/range", s.handle(s.rangeHandler))
+	mux.HandleFunc("/v3/kv/put", s.handle(s.putHandler))
+	mux.HandleFunc("/v3/kv/deleterange", s.handle(s.deleteRangeHandler))
+	mux.HandleFunc("/v3/kv/txn", s.handle(s.txnHandler))
+	mux.HandleFunc("/v3/lease/grant", s.handle(s.grantHandler))
+	mux.HandleFunc("/v3/lease/keepalive", s.handle(s.keepAliveHandler))
+	mux.HandleFunc("/v3/lease/revoke", s.handle(s.revokeHandler))
+	mux.HandleFunc("/v3/watch", s.watchHandler)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// ValuesRead returns the number of values ranges have returned, so tests can
+// tell which reads only listed keys.
+func (s *Server) ValuesRead() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.values
+}
+
+// Leases returns the IDs of the leases which are alive.
+func (s *Server) Leases() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ids := []int64{}
+	for id := range s.leases {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// Expire expires the lease as if it was not kept alive in time.
+func (s *Server) Expire(id int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.revoke(id)
+}
+
+type handler func(body []byte) (interface{}, int)
+
+func (s *Server) handle(h handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		buf := &bytes.Buffer{}
+		buf.ReadFrom(r.Body)
+
+		s.mutex.Lock()
+		result, code := h(buf.Bytes())
+		s.mutex.Unlock()
+
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+func badRequest(err error) (interface{}, int) {
+	return map[string]interface{}{"error": err.Error(), "code": 3}, http.StatusBadRequest
+}
+
+func inRange(key, start, end []byte) bool {
+	if len(end) == 0 {
+		return bytes.Equal(key, start)
+	}
+
+	if bytes.Compare(key, start) < 0 {
+		return false
+	}
+
+	return (len(end) == 1 && end[0] == 0) || bytes.Compare(key, end) < 0
+}
+
+func (s *Server) keys(start, end []byte) []string {
+	keys := []string{}
+	for key := range s.kvs {
+		if inRange([]byte(key), start, end) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// commit records the events of a write and wakes up the watches. It must be
+// called with the mutex held.
+func (s *Server) commit(events []*event) {
+	if len(events) == 0 {
+		return
+	}
+
+	s.history = append(s.history, &revision{revision: s.revision, events: events})
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *Server) header() *header {
+	return &header{Revision: s.revision}
+}
+
+func (s *Server) rangeOp(req *rangeRequest) map[string]interface{} {
+	kvs := []*keyValue{}
+	for _, key := range s.keys(req.Key, req.RangeEnd) {
+		kv := s.kvs[key]
+		if req.KeysOnly {
+			copied := *kv
+			copied.Value = nil
+			kv = &copied
+		} else {
+			s.values++
+		}
+
+		kvs = append(kvs, kv)
+	}
+
+	return map[string]interface{}{"header": s.header(), "kvs": kvs, "count": fmt.Sprint(len(kvs))}
+}
+
+func (s *Server) putOp(req *putRequest, revision int64) (map[string]interface{}, *event, bool) {
+	if req.Lease != 0 {
+		if _, ok := s.leases[req.Lease]; !ok {
+			return nil, nil, false
+		}
+	}
+
+	prev := s.kvs[string(req.Key)]
+	kv := &keyValue{Key: req.Key, Value: req.Value, CreateRevision: revision, ModRevision: revision, Version: 1, Lease: req.Lease}
+	if prev != nil {
+		kv.CreateRevision = prev.CreateRevision
+		kv.Version = prev.Version + 1
+	}
+	s.kvs[string(req.Key)] = kv
+
+	result := map[string]interface{}{"header": &header{Revision: revision}}
+	if req.PrevKV && prev != nil {
+		result["prev_kv"] = prev
+	}
+
+	return result, &event{Kv: kv, PrevKv: prev}, true
+}
+
+func (s *Server) deleteOp(req *deleteRangeRequest, revision int64) (map[string]interface{}, []*event) {
+	events := []*event{}
+	prevKvs := []*keyValue{}
+
+	for _, key := range s.keys(req.Key, req.RangeEnd) {
+		prev := s.kvs[key]
+		delete(s.kvs, key)
+		prevKvs = append(prevKvs, prev)
+		events = append(events, &event{Type: "DELETE", Kv: &keyValue{Key: prev.Key, ModRevision: revision}, PrevKv: prev})
+	}
+
+	result := map[string]interface{}{"header": &header{Revision: revision}, "deleted": fmt.Sprint(len(events))}
+	if req.PrevKV {
+		result["prev_kvs"] = prevKvs
+	}
+
+	return result, events
+}
+
+func (s *Server) rangeHandler(body []byte) (interface{}, int) {
+	req := &rangeRequest{}
+	if err := json.Unmarshal(body, req); err != nil {
+		return badRequest(err)
+	}
+
+	return s.rangeOp(req), http.StatusOK
+}
+
+func (s *Server) putHandler(body []byte) (interface{}, int) {
+	req := &putRequest{}
+	if err := json.Unmarshal(body, req); err != nil {
+		return badRequest(err)
+	}
+
+	result, ev, ok := s.putOp(req, s.revision+1)
+	if !ok {
+		return map[string]interface{}{"error": "etcdserver: requested lease not found", "code": 5}, http.StatusNotFound
+	}
+
+	s.revision++
+	s.commit([]*event{ev})
+	return result, http.StatusOK
+}
+
+func (s *Server) deleteRangeHandler(body []byte) (interface{}, int) {
+	req := &deleteRangeRequest{}
+	if err := json.Unmarshal(body, req); err != nil {
+		return badRequest(err)
+	}
+
+	result, events := s.deleteOp(req, s.revision+1)
+	if len(events) > 0 {
+		s.revision++
+		s.commit(events)
+	} else {
+		result["header"] = s.header()
+	}
+
+	return result, http.StatusOK
+}
+
+func (s *Server) compare(cmp *compare) bool {
+	kv := s.kvs[string(cmp.Key)]
+	if kv == nil {
+		kv = &keyValue{}
+	}
+
+	var result int
+	switch cmp.Target {
+	case "VERSION", "":
+		result = compareInt(kv.Version, cmp.Version)
+	case "CREATE":
+		result = compareInt(kv.CreateRevision, cmp.CreateRevision)
+	case "MOD":
+		result = compareInt(kv.ModRevision, cmp.ModRevision)
+	case "VALUE":
+		if s.kvs[string(cmp.Key)] == nil {
+			return false
+		}
+		result = bytes.Compare(kv.Value, cmp.Value)
+	}
+
+	switch cmp.Result {
+	case "EQUAL", "":
+		return result == 0
+	case "GREATER":
+		return result > 0
+	case "LESS":
+		return result < 0
+	case "NOT_EQUAL":
+		return result != 0
+	}
+
+	return false
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (s *Server) txnHandler(body []byte) (interface{}, int) {
+	req := &txnRequest{}
+	if err := json.Unmarshal(body, req); err != nil {
+		return badRequest(err)
+	}
+
+	succeeded := true
+	for _, cmp := range req.Compare {
+		if !s.compare(cmp) {
+			succeeded = false
+			break
+		}
+	}
+
+	ops := req.Success
+	if !succeeded {
+		ops = req.Failure
+	}
+
+	for _, op := range ops {
+		if op.RequestPut != nil && op.RequestPut.Lease != 0 {
+			if _, ok := s.leases[op.RequestPut.Lease]; !ok {
+				return map[string]interface{}{"error": "etcdserver: requested lease not found", "code": 5}, http.StatusNotFound
+			}
+		}
+	}
+
+	revision := s.revision + 1
+	events := []*event{}
+	responses := []map[string]interface{}{}
+
+	for _, op := range ops {
+		switch {
+		case op.RequestRange != nil:
+			responses = append(responses, map[string]interface{}{"response_range": s.rangeOp(op.RequestRange)})
+		case op.RequestPut != nil:
+			result, ev, _ := s.putOp(op.RequestPut, revision)
+			events = append(events, ev)
+			responses = append(responses, map[string]interface{}{"response_put": result})
+		case op.RequestDeleteRange != nil:
+			result, evs := s.deleteOp(op.RequestDeleteRange, revision)
+			events = append(events, evs...)
+			responses = append(responses, map[string]interface{}{"response_delete_range": result})
+		}
+	}
+
+	if len(events) > 0 {
+		s.revision = revision
+		s.commit(events)
+	}
+
+	result := map[string]interface{}{"header": s.header(), "responses": responses}
+	if succeeded {
+		result["succeeded"] = true
+	}
+
+	return result, http.StatusOK
+}
+
+func (s *Server) grantHandler(body []byte) (interface{}, int) {
+	req := &leaseRequest{}
+	if err := json.Unmarshal(body, req); err != nil {
+		return badRequest(err)
+	}
+
+	s.nextID++
+	s.leases[s.nextID] = req.TTL
+
+	return &leaseRequest{ID: s.nextID, TTL: req.TTL}, http.StatusOK
+}
+
+func (s *Server) keepAliveHandler(body []byte) (interface{}, int) {
+	req := &leaseRequest{}
+	if err := json.Unmarshal(body, req); err != nil {
+		return badRequest(err)
+	}
+
+	ttl := s.leases[req.ID]
+	return map[string]interface{}{"result": &leaseRequest{ID: req.ID, TTL: ttl}}, http.StatusOK
+}
+
+func (s *Server) revokeHandler(body []byte) (interface{}, int) {
+	req := &leaseRequest{}
+	if err := json.Unmarshal(body, req); err != nil {
+		return badRequest(err)
+	}
+
+	if _, ok := s.leases[req.ID]; !ok {
+		return map[string]interface{}{"error": "etcdserver: requested lease not found", "code": 5}, http.StatusNotFound
+	}
+
+	s.revoke(req.ID)
+	return map[string]interface{}{"header": s.header()}, http.StatusOK
+}
+
+// revoke removes the lease and the keys attached to it. It must be called
+// with the mutex held.
+func (s *Server) revoke(id int64) {
+	delete(s.leases, id)
+
+	events := []*event{}
+	for _, key := range s.keys([]byte{0}, []byte{0}) {
+		if kv := s.kvs[key]; kv.Lease == id {
+			delete(s.kvs, key)
+			events = append(events, &event{Type: "DELETE", Kv: &keyValue{Key: kv.Key, ModRevision: s.revision + 1}, PrevKv: kv})
+		}
+	}
+
+	if len(events) > 0 {
+		s.revision++
+		s.commit(events)
+	}
+}
+
+func (s *Server) watchHandler(w http.ResponseWriter, r *http.Request) {
+	req := &watchRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.CreateRequest == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	create := req.CreateRequest
+
+	flusher := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	s.mutex.Lock()
+	next := create.StartRevision
+	if next == 0 {
+		next = s.revision + 1
+	}
+	encoder.Encode(map[string]interface{}{"result": map[string]interface{}{"header": s.header(), "created": true}})
+	s.mutex.Unlock()
+	flusher.Flush()
+
+	for {
+		s.mutex.Lock()
+		changed := s.changed
+		messages := []map[string]interface{}{}
+
+		for _, rev := range s.history {
+			if rev.revision < next {
+				continue
+			}
+
+			events := []*event{}
+			for _, ev := range rev.events {
+				if inRange(ev.Kv.Key, create.Key, create.RangeEnd) {
+					if !create.PrevKV {
+						ev = &event{Type: ev.Type, Kv: ev.Kv}
+					}
+					events = append(events, ev)
+				}
+			}
+
+			if len(events) > 0 {
+				messages = append(messages, map[string]interface{}{"result": map[string]interface{}{"header": &header{Revision: rev.revision}, "events": events}})
+			}
+			next = rev.revision + 1
+		}
+		s.mutex.Unlock()
+
+		for _, msg := range messages {
+			if err := encoder.Encode(msg); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package etcd3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"golang.org/x/net/context"
+)
+
+// DefaultAPIPath is the path etcd's JSON gateway serves the v3 API under when
+// none is given to NewKV. etcd 3.3 serves it under /v3beta and 3.2 under
+// /v3alpha.
+const DefaultAPIPath = "/v3"
+
+// KeyValue is a key and its value, as etcd stores them.
+type KeyValue struct {
+	Key            []byte `json:"key,omitempty"`
+	Value          []byte `json:"value,omitempty"`
+	CreateRevision int64  `json:"create_revision,string,omitempty"`
+	ModRevision    int64  `json:"mod_revision,string,omitempty"`
+	Version        int64  `json:"version,string,omitempty"`
+	Lease          int64  `json:"lease,string,omitempty"`
+}
+
+// Header is the header of every response, holding the revision of the store
+// the response reflects.
+type Header struct {
+	Revision int64 `json:"revision,string,omitempty"`
+}
+
+// RangeRequest reads Key, or the keys from Key up to but not including
+// RangeEnd. If KeysOnly is set, the values are left out.
+type RangeRequest struct {
+	Key        []byte `json:"key,omitempty"`
+	RangeEnd   []byte `json:"range_end,omitempty"`
+	SortOrder  string `json:"sort_order,omitempty"`
+	SortTarget string `json:"sort_target,omitempty"`
+	KeysOnly   bool   `json:"keys_only,omitempty"`
+}
+
+// RangeResponse is the result of a RangeRequest.
+type RangeResponse struct {
+	Header *Header     `json:"header,omitempty"`
+	Kvs    []*KeyValue `json:"kvs,omitempty"`
+}
+
+// PutRequest writes the key, attached to the lease if it is not zero.
+type PutRequest struct {
+	Key    []byte `json:"key,omitempty"`
+	Value  []byte `json:"value,omitempty"`
+	Lease  int64  `json:"lease,string,omitempty"`
+	PrevKV bool   `json:"prev_kv,omitempty"`
+}
+
+// PutResponse is the result of a PutRequest.
+type PutResponse struct {
+	Header *Header   `json:"header,omitempty"`
+	PrevKV *KeyValue `json:"prev_kv,omitempty"`
+}
+
+// DeleteRangeRequest deletes Key, or the keys from Key up to but not
+// including RangeEnd.
+type DeleteRangeRequest struct {
+	Key      []byte `json:"key,omitempty"`
+	RangeEnd []byte `json:"range_end,omitempty"`
+	PrevKV   bool   `json:"prev_kv,omitempty"`
+}
+
+// DeleteRangeResponse is the result of a DeleteRangeRequest.
+type DeleteRangeResponse struct {
+	Header  *Header     `json:"header,omitempty"`
+	Deleted int64       `json:"deleted,string,omitempty"`
+	PrevKvs []*KeyValue `json:"prev_kvs,omitempty"`
+}
+
+// Compare results and targets.
+const (
+	CompareEqual   = "EQUAL"
+	CompareGreater = "GREATER"
+	CompareLess    = "LESS"
+
+	TargetVersion = "VERSION"
+	TargetCreate  = "CREATE"
+	TargetMod     = "MOD"
+	TargetValue   = "VALUE"
+)
+
+// Compare is a condition of a transaction. The field matching Target is
+// compared with the key's.
+type Compare struct {
+	Result         string `json:"result,omitempty"`
+	Target         string `json:"target,omitempty"`
+	Key            []byte `json:"key,omitempty"`
+	Version        int64  `json:"version,string"`
+	CreateRevision int64  `json:"create_revision,string"`
+	ModRevision    int64  `json:"mod_revision,string"`
+	Value          []byte `json:"value,omitempty"`
+}
+
+// RequestOp is one operation of a transaction. Exactly one field is set.
+type RequestOp struct {
+	RequestRange       *RangeRequest       `json:"request_range,omitempty"`
+	RequestPut         *PutRequest         `json:"request_put,omitempty"`
+	RequestDeleteRange *DeleteRangeRequest `json:"request_delete_range,omitempty"`
+}
+
+// ResponseOp is the result of a RequestOp.
+type ResponseOp struct {
+	ResponseRange       *RangeResponse       `json:"response_range,omitempty"`
+	ResponsePut         *PutResponse         `json:"response_put,omitempty"`
+	ResponseDeleteRange *DeleteRangeResponse `json:"response_delete_range,omitempty"`
+}
+
+// TxnRequest applies Success if every Compare holds, and Failure otherwise.
+type TxnRequest struct {
+	Compare []*Compare   `json:"compare,omitempty"`
+	Success []*RequestOp `json:"success,omitempty"`
+	Failure []*RequestOp `json:"failure,omitempty"`
+}
+
+// TxnResponse is the result of a TxnRequest.
+type TxnResponse struct {
+	Header    *Header       `json:"header,omitempty"`
+	Succeeded bool          `json:"succeeded,omitempty"`
+	Responses []*ResponseOp `json:"responses,omitempty"`
+}
+
+type leaseRequest struct {
+	TTL int64 `json:"TTL,string,omitempty"`
+	ID  int64 `json:"ID,string,omitempty"`
+}
+
+type leaseResponse struct {
+	Header *Header `json:"header,omitempty"`
+	ID     int64   `json:"ID,string,omitempty"`
+	TTL    int64   `json:"TTL,string,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// Event types. PUT is the zero value of the type and is left out of the JSON.
+const (
+	EventPut    = ""
+	EventDelete = "DELETE"
+)
+
+// Event is a change to a key seen by a watch.
+type Event struct {
+	Type   string    `json:"type,omitempty"`
+	Kv     *KeyValue `json:"kv,omitempty"`
+	PrevKv *KeyValue `json:"prev_kv,omitempty"`
+}
+
+// WatchResponse is one message of a watch.
+type WatchResponse struct {
+	Header          *Header  `json:"header,omitempty"`
+	Created         bool     `json:"created,omitempty"`
+	Canceled        bool     `json:"canceled,omitempty"`
+	CompactRevision int64    `json:"compact_revision,string,omitempty"`
+	Events          []*Event `json:"events,omitempty"`
+}
+
+type watchCreateRequest struct {
+	Key           []byte `json:"key,omitempty"`
+	RangeEnd      []byte `json:"range_end,omitempty"`
+	StartRevision int64  `json:"start_revision,string,omitempty"`
+	PrevKV        bool   `json:"prev_kv,omitempty"`
+}
+
+type watchMessage struct {
+	Result *WatchResponse `json:"result,omitempty"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// PrefixEnd returns the RangeEnd which makes a range of every key with the
+// prefix.
+func PrefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+
+	// the prefix is all 0xff; the range goes to the end of the keyspace.
+	return []byte{0}
+}
+
+// KV is a client of the key/value, lease and watch APIs of etcd v3, through
+// the JSON gateway etcd serves on its client port.
+type KV struct {
+	address string
+	client  *http.Client
+}
+
+// NewKV returns a client of the etcd member at the address, given as
+// host:port or as an http or https URL. The URL's path, if any, is the path
+// the v3 API is served under; DefaultAPIPath is used otherwise.
+func NewKV(address string) (*KV, error) {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, errors.Etcd3.Combine(err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Etcd3.Combine(errored.Errorf("Invalid etcd address %q", address))
+	}
+
+	if strings.Trim(u.Path, "/") == "" {
+		u.Path = DefaultAPIPath
+	}
+
+	return &KV{address: strings.TrimSuffix(u.String(), "/"), client: &http.Client{}}, nil
+}
+
+func (kv *KV) post(ctx context.Context, path string, req interface{}) (*http.Response, error) {
+	content, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Etcd3.Combine(err)
+	}
+
+	httpReq, err := http.NewRequest("POST", kv.address+path, bytes.NewReader(content))
+	if err != nil {
+		return nil, errors.Etcd3.Combine(err)
+	}
+
+	resp, err := kv.client.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		return nil, errors.Etcd3.Combine(err)
+	}
+
+	// the gateway answers with 404 when a lease does not exist.
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, errors.NotExists
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		content, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.Etcd3.Combine(errored.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(content))))
+	}
+
+	return resp, nil
+}
+
+func (kv *KV) call(ctx context.Context, path string, req, result interface{}) error {
+	resp, err := kv.post(ctx, path, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return errors.Etcd3.Combine(err)
+	}
+
+	return nil
+}
+
+// Range reads the keys of the request, sorted by key.
+func (kv *KV) Range(ctx context.Context, req *RangeRequest) (*RangeResponse, error) {
+	resp := &RangeResponse{Header: &Header{}}
+	return resp, kv.call(ctx, "/kv/range", req, resp)
+}
+
+// Get reads the key. It returns errors.NotExists, and the revision of the
+// store, if it does not exist.
+func (kv *KV) Get(ctx context.Context, key []byte) (*KeyValue, int64, error) {
+	resp, err := kv.Range(ctx, &RangeRequest{Key: key})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, resp.Header.Revision, errors.NotExists
+	}
+
+	return resp.Kvs[0], resp.Header.Revision, nil
+}
+
+// Put writes the key.
+func (kv *KV) Put(ctx context.Context, req *PutRequest) (*PutResponse, error) {
+	resp := &PutResponse{Header: &Header{}}
+	return resp, kv.call(ctx, "/kv/put", req, resp)
+}
+
+// DeleteRange deletes the keys of the request.
+func (kv *KV) DeleteRange(ctx context.Context, req *DeleteRangeRequest) (*DeleteRangeResponse, error) {
+	resp := &DeleteRangeResponse{Header: &Header{}}
+	return resp, kv.call(ctx, "/kv/deleterange", req, resp)
+}
+
+// Txn applies the transaction atomically.
+func (kv *KV) Txn(ctx context.Context, req *TxnRequest) (*TxnResponse, error) {
+	resp := &TxnResponse{Header: &Header{}}
+	return resp, kv.call(ctx, "/kv/txn", req, resp)
+}
+
+// Grant creates a lease which expires unless it is kept alive within the
+// TTL. The keys attached to it are deleted when it expires. TTLs are rounded
+// up to the second.
+func (kv *KV) Grant(ctx context.Context, ttl time.Duration) (int64, error) {
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	resp := &leaseResponse{}
+	if err := kv.call(ctx, "/lease/grant", &leaseRequest{TTL: seconds}, resp); err != nil {
+		return 0, err
+	}
+
+	if resp.Error != "" {
+		return 0, errors.Etcd3.Combine(errored.New(resp.Error))
+	}
+
+	return resp.ID, nil
+}
+
+// KeepAlive resets the TTL of the lease. It returns errors.NotExists if the
+// lease has already expired.
+func (kv *KV) KeepAlive(ctx context.Context, id int64) error {
+	msg := &struct {
+		Result *leaseResponse `json:"result,omitempty"`
+	}{}
+
+	if err := kv.call(ctx, "/lease/keepalive", &leaseRequest{ID: id}, msg); err != nil {
+		return err
+	}
+
+	// an expired lease is kept alive with a TTL of zero.
+	if msg.Result == nil || msg.Result.TTL <= 0 {
+		return errors.NotExists
+	}
+
+	return nil
+}
+
+// Revoke revokes the lease, deleting the keys attached to it. It returns
+// errors.NotExists if the lease has already expired.
+func (kv *KV) Revoke(ctx context.Context, id int64) error {
+	return kv.call(ctx, "/lease/revoke", &leaseRequest{ID: id}, &leaseResponse{})
+}
+
+// Watch watches the key, or the keys from key up to but not including
+// rangeEnd, for changes made at or after startRevision; zero starts with the
+// next change. The returned channel is closed when the watch ends, which it
+// does when ctx is canceled or the watch fails; the error is sent to errChan
+// in the latter case.
+func (kv *KV) Watch(ctx context.Context, key, rangeEnd []byte, startRevision int64) (<-chan *WatchResponse, <-chan error) {
+	respChan := make(chan *WatchResponse)
+	errChan := make(chan error, 1)
+
+	go func() {
+		defer close(respChan)
+
+		req := map[string]*watchCreateRequest{
+			"create_request": {Key: key, RangeEnd: rangeEnd, StartRevision: startRevision, PrevKV: true},
+		}
+
+		resp, err := kv.post(ctx, "/watch", req)
+		if err != nil {
+			errChan <- err
+			return
+		}
+		defer resp.Body.Close()
+
+		decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+		for {
+			msg := &watchMessage{}
+			if err := decoder.Decode(msg); err != nil {
+				if ctx.Err() != nil {
+					errChan <- ctx.Err()
+				} else {
+					errChan <- errors.Etcd3.Combine(err)
+				}
+				return
+			}
+
+			if msg.Error != nil {
+				errChan <- errors.Etcd3.Combine(errored.New(msg.Error.Message))
+				return
+			}
+
+			if msg.Result == nil {
+				continue
+			}
+
+			if msg.Result.Canceled {
+				errChan <- errors.Etcd3.Combine(errored.Errorf("watch canceled; revision %d was compacted", msg.Result.CompactRevision))
+				return
+			}
+
+			select {
+			case respChan <- msg.Result:
+			case <-ctx.Done():
+				errChan <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return respChan, errChan
+}
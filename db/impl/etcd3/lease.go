@@ -0,0 +1,197 @@
+package etcd3
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/errors"
+	"golang.org/x/net/context"
+)
+
+// Leases hands out one lease per TTL and keeps them alive until it is
+// closed, so a process can hold any number of keys with a TTL without
+// refreshing each of them. The keys held with a lease are recorded, so if the
+// lease expires anyway they are attached to a new one.
+type Leases struct {
+	kv     *KV
+	mutex  sync.Mutex
+	leases map[time.Duration]int64
+	stop   map[time.Duration]chan struct{}
+	held   map[time.Duration]map[string][]byte
+}
+
+// NewLeases creates a Leases granting leases through kv.
+func NewLeases(kv *KV) *Leases {
+	return &Leases{
+		kv:     kv,
+		leases: map[time.Duration]int64{},
+		stop:   map[time.Duration]chan struct{}{},
+		held:   map[time.Duration]map[string][]byte{},
+	}
+}
+
+// Get returns the ID of the lease with the TTL, granting it if it does not
+// exist.
+func (l *Leases) Get(ttl time.Duration) (int64, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if id, ok := l.leases[ttl]; ok {
+		return id, nil
+	}
+
+	return l.grant(ttl)
+}
+
+// grant grants the lease with the TTL and keeps it alive. Keys held with an
+// earlier lease with the TTL are attached to it; those which were set by
+// someone else since are no longer held. The mutex must be held, so the keys
+// are not put on the earlier lease in the meantime.
+func (l *Leases) grant(ttl time.Duration) (int64, error) {
+	id, err := l.kv.Grant(context.Background(), ttl)
+	if err != nil {
+		return 0, err
+	}
+
+	for key, value := range l.held[ttl] {
+		if err := l.attach(id, []byte(key), value); err != nil {
+			logrus.Errorf("Could not attach %q to lease %d: %v", key, id, err)
+			delete(l.held[ttl], key)
+		}
+	}
+
+	stopChan := make(chan struct{})
+	l.leases[ttl] = id
+	l.stop[ttl] = stopChan
+
+	go l.keepAlive(ttl, id, stopChan)
+
+	return id, nil
+}
+
+// Hold records that the key was put with the value on the lease with the
+// TTL, so it is attached to the new lease if the lease expires.
+func (l *Leases) Hold(ttl time.Duration, key, value []byte) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, held := range l.held {
+		delete(held, string(key))
+	}
+
+	if l.held[ttl] == nil {
+		l.held[ttl] = map[string][]byte{}
+	}
+
+	l.held[ttl][string(key)] = value
+}
+
+// Release stops holding the key, after it was removed or overwritten. If
+// prefix is set, every key starting with it is released.
+func (l *Leases) Release(key []byte, prefix bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, held := range l.held {
+		for k := range held {
+			if k == string(key) || (prefix && strings.HasPrefix(k, string(key))) {
+				delete(held, k)
+			}
+		}
+	}
+}
+
+// Renew replaces the lease with the TTL after it was found to have expired.
+// The keys held with it are attached to the new lease. If the lease was
+// already replaced, the current one is returned.
+func (l *Leases) Renew(ttl time.Duration, id int64) (int64, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	current, ok := l.leases[ttl]
+	if ok && current != id {
+		return current, nil
+	}
+
+	if ok {
+		close(l.stop[ttl])
+		delete(l.leases, ttl)
+		delete(l.stop, ttl)
+	}
+
+	return l.grant(ttl)
+}
+
+// attach puts the key with the value on the lease, if the key does not exist
+// or still has the value.
+func (l *Leases) attach(lease int64, key, value []byte) error {
+	put := []*RequestOp{{RequestPut: &PutRequest{Key: key, Value: value, Lease: lease}}}
+
+	for _, cmp := range []*Compare{
+		{Key: key, Target: TargetCreate, Result: CompareEqual, CreateRevision: 0},
+		{Key: key, Target: TargetValue, Result: CompareEqual, Value: value},
+	} {
+		resp, err := l.kv.Txn(context.Background(), &TxnRequest{Compare: []*Compare{cmp}, Success: put})
+		if err != nil {
+			return err
+		}
+
+		if resp.Succeeded {
+			return nil
+		}
+	}
+
+	return errors.Exists.Combine(errored.Errorf("%q was set by someone else", key))
+}
+
+// keepAlive keeps the lease alive until stopChan is closed. If the lease
+// expires anyway, it is renewed. If no new lease can be granted, the next Get
+// or Renew grants one.
+func (l *Leases) keepAlive(ttl time.Duration, id int64, stopChan chan struct{}) {
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-time.After(ttl / 3):
+		}
+
+		err := l.kv.KeepAlive(context.Background(), id)
+		if err == nil {
+			continue
+		}
+
+		logrus.Errorf("Could not keep lease %d alive: %v", id, err)
+
+		if err == errors.NotExists {
+			// Renew starts keeping the new lease alive.
+			if _, err := l.Renew(ttl, id); err != nil {
+				logrus.Errorf("Could not renew expired lease %d: %v", id, err)
+			}
+			return
+		}
+	}
+}
+
+// Close stops keeping the leases alive and revokes those which have not
+// expired.
+func (l *Leases) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var err error
+	for ttl, id := range l.leases {
+		close(l.stop[ttl])
+		if revokeErr := l.kv.Revoke(context.Background(), id); revokeErr != nil && revokeErr != errors.NotExists {
+			err = revokeErr
+		}
+	}
+
+	l.leases = map[time.Duration]int64{}
+	l.stop = map[time.Duration]chan struct{}{}
+	l.held = map[time.Duration]map[string][]byte{}
+
+	return err
+}
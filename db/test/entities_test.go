@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os/exec"
 	. "testing"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -11,30 +12,86 @@ import (
 
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/db"
+	"github.com/contiv/volplugin/db/impl/consul"
+	"github.com/contiv/volplugin/db/impl/consul/consultest"
 	"github.com/contiv/volplugin/db/impl/etcd"
+	"github.com/contiv/volplugin/db/impl/etcd3"
+	"github.com/contiv/volplugin/db/impl/etcd3/etcd3test"
 	"github.com/contiv/volplugin/db/jsonio"
 	"github.com/coreos/etcd/client"
 )
 
 var etcdHosts = []string{"http://127.0.0.1:2379"}
 
+// testSuite runs against the backend it names. The etcd backend needs etcd
+// running locally; consul and etcd3 run against in-memory stand-ins. Tests
+// which reach into etcd directly only run against etcd.
 type testSuite struct {
-	client db.Client
+	backend string
+	client  db.Client
+	consul  *consultest.Server
+	etcd3   *etcd3test.Server
 }
 
-var _ = Suite(&testSuite{})
+var _ = Suite(&testSuite{backend: "etcd"})
+var _ = Suite(&testSuite{backend: "consul"})
+var _ = Suite(&testSuite{backend: "etcd3"})
 
 func TestDB(t *T) { TestingT(t) }
 
 func (s *testSuite) SetUpTest(c *C) {
 	errored.AlwaysDebug = true
 	errored.AlwaysTrace = true
-	exec.Command("/bin/sh", "-c", "etcdctl rm --recursive /volplugin /testing /test /watch").Run()
+
 	var err error
-	s.client, err = etcd.NewClient(etcdHosts, "volplugin")
+
+	switch s.backend {
+	case "etcd":
+		exec.Command("/bin/sh", "-c", "etcdctl rm --recursive /volplugin /testing /test /watch").Run()
+		s.client, err = etcd.NewClient(etcdHosts, "volplugin")
+	case "consul":
+		s.consul = consultest.NewServer()
+		s.client, err = consul.NewClient(s.consul.URL, "volplugin")
+	case "etcd3":
+		s.etcd3 = etcd3test.NewServer()
+		s.client, err = etcd3.NewClient(s.etcd3.URL, "volplugin")
+	}
+
 	c.Assert(err, IsNil)
 }
 
+func (s *testSuite) TearDownTest(c *C) {
+	switch s.backend {
+	case "consul":
+		s.consul.Close()
+	case "etcd3":
+		s.etcd3.Close()
+	}
+}
+
+// etcdOnly skips the test unless the suite runs against etcd.
+func (s *testSuite) etcdOnly(c *C) {
+	if s.backend != "etcd" {
+		c.Skip("reaches into etcd directly")
+	}
+}
+
+// setKey stores the entity, past the client's hooks on etcd.
+func (s *testSuite) setKey(c *C, value db.Entity) {
+	if s.backend == "etcd" {
+		setKey(value)
+		return
+	}
+
+	c.Assert(s.client.Set(value), IsNil)
+}
+
+// waitWatch gives a new watch time to establish where it tracks changes from;
+// consul and etcd3 watches only report changes made after that.
+func waitWatch() {
+	time.Sleep(100 * time.Millisecond)
+}
+
 func getEtcdClient() (client.KeysAPI, error) {
 	ec, err := client.New(client.Config{Endpoints: etcdHosts})
 	if err != nil {
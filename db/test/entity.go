@@ -0,0 +1,66 @@
+// Package test holds the conformance tests of the db.Client implementations,
+// and the entity they, and the tests of the implementations, store.
+package test
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/db"
+)
+
+// Entity is a db.Entity for testing clients, stored under "test".
+type Entity struct {
+	Name            string
+	SomeData        string
+	FailsValidation bool
+	hooks           *db.Hooks
+}
+
+// NewEntity returns an entity with no hooks.
+func NewEntity(name, somedata string) *Entity {
+	return &Entity{Name: name, SomeData: somedata, hooks: &db.Hooks{}}
+}
+
+func (t *Entity) String() string {
+	return t.Name
+}
+
+func (t *Entity) SetKey(key string) error {
+	t.Name = strings.Trim(strings.TrimPrefix(strings.Trim(key, "/"), t.Prefix()), "/")
+	return nil
+}
+
+func (t *Entity) Read(b []byte) error {
+	return json.Unmarshal(b, t)
+}
+
+func (t *Entity) Write() ([]byte, error) {
+	return json.Marshal(t)
+}
+
+func (t *Entity) Path() (string, error) {
+	return strings.Join([]string{t.Prefix(), t.Name}, "/"), nil
+}
+
+func (t *Entity) Prefix() string {
+	return "test"
+}
+
+func (t *Entity) Validate() error {
+	if t.FailsValidation {
+		return errored.New("failed validation")
+	}
+
+	return nil
+}
+
+func (t *Entity) Copy() db.Entity {
+	t2 := *t
+	return &t2
+}
+
+func (t *Entity) Hooks() *db.Hooks {
+	return t.hooks
+}
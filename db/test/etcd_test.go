@@ -14,13 +14,17 @@ import (
 
 	. "gopkg.in/check.v1"
 
+	"github.com/contiv/errored"
 	"github.com/contiv/executor"
 	"github.com/contiv/volplugin/db"
 	"github.com/contiv/volplugin/db/impl/etcd"
+	"github.com/contiv/volplugin/errors"
 	"golang.org/x/net/context"
 )
 
 func (s *testSuite) TestNewClient(c *C) {
+	s.etcdOnly(c)
+
 	client, err := getEtcdClient()
 	c.Assert(err, IsNil)
 
@@ -44,6 +48,8 @@ func (s *testSuite) TestNewClient(c *C) {
 }
 
 func (s *testSuite) TestDump(c *C) {
+	s.etcdOnly(c)
+
 	volClient, err := etcd.NewClient(etcdHosts, "volplugin")
 	c.Assert(err, IsNil)
 
@@ -108,59 +114,73 @@ func (s *testSuite) TestDump(c *C) {
 }
 
 func (s *testSuite) TestCRUD(c *C) {
-	volClient, err := etcd.NewClient(etcdHosts, "volplugin")
-	c.Assert(err, IsNil)
-
-	client, err := getEtcdClient()
-	c.Assert(err, IsNil)
-
-	te := newTestEntity("test", "data")
+	te := NewEntity("test", "data")
 	path, err := te.Path()
 	c.Assert(err, IsNil)
 	c.Assert(path, Equals, "test/test")
-	c.Assert(volClient.Get(te), NotNil)
+	c.Assert(s.client.Get(te), Equals, errors.NotExists)
 
-	c.Assert(volClient.Set(te), IsNil)
+	c.Assert(s.client.Set(te), IsNil)
+	c.Assert(s.client.Set(NewEntity("other", "more")), IsNil)
 
-	te = newTestEntity("test", "")
-	c.Assert(volClient.Get(te), IsNil)
+	te = NewEntity("test", "")
+	c.Assert(s.client.Get(te), IsNil)
 	c.Assert(te.SomeData, Equals, "data")
 
-	_, err = client.Get(context.Background(), "/volplugin/test/test", nil)
-	c.Assert(err, IsNil)
+	if s.backend == "etcd" {
+		client, err := getEtcdClient()
+		c.Assert(err, IsNil)
+
+		_, err = client.Get(context.Background(), "/volplugin/test/test", nil)
+		c.Assert(err, IsNil)
+	}
 
-	entities, err := volClient.List(te)
+	entities, err := s.client.List(te)
 	c.Assert(err, IsNil)
-	c.Assert(len(entities), Equals, 1)
-	c.Assert(entities[0].(*testEntity).Name, Equals, "test")
-	c.Assert(entities[0].(*testEntity).SomeData, Equals, "data")
+	c.Assert(len(entities), Equals, 2)
+
+	data := map[string]string{}
+	for _, entity := range entities {
+		data[entity.(*Entity).Name] = entity.(*Entity).SomeData
+	}
+	c.Assert(data, DeepEquals, map[string]string{"test": "data", "other": "more"})
 
-	c.Assert(volClient.Delete(te), IsNil)
-	c.Assert(volClient.Get(te), NotNil)
+	c.Assert(s.client.Delete(te), IsNil)
+	c.Assert(s.client.Get(te), Equals, errors.NotExists)
+	c.Assert(s.client.Delete(te), Equals, errors.NotExists)
 }
 
-func (s *testSuite) TestWatch(c *C) {
-	volClient, err := etcd.NewClient(etcdHosts, "volplugin")
+func (s *testSuite) TestListPrefix(c *C) {
+	c.Assert(s.client.Set(NewEntity("policy1/foo", "bar")), IsNil)
+	c.Assert(s.client.Set(NewEntity("policy1/bar", "bar")), IsNil)
+	c.Assert(s.client.Set(NewEntity("policy10/baz", "bar")), IsNil)
+
+	// policy10 is not under policy1.
+	entities, err := s.client.ListPrefix("policy1", NewEntity("", ""))
 	c.Assert(err, IsNil)
+	c.Assert(len(entities), Equals, 2)
+}
 
-	te := newTestEntity("test", "")
+func (s *testSuite) TestWatch(c *C) {
+	te := NewEntity("test", "")
 
 	channel := make(chan interface{}, 10)
 
-	retChan, errChan := volClient.Watch(te)
+	retChan, errChan := s.client.Watch(te)
+	waitWatch()
 
+	// consul folds changes made between two of its blocking queries into one,
+	// so wait for each change before making the next.
 	for i := 0; i < 10; i++ {
-		te2 := te.Copy().(*testEntity)
+		te2 := te.Copy().(*Entity)
 		te2.SomeData = fmt.Sprintf("data%d", i)
-		setKey(te2)
-	}
+		s.setKey(c, te2)
 
-	for i := 0; i < 10; i++ {
 		select {
 		case err := <-errChan:
 			c.Assert(err, IsNil, Commentf("select: %v", err)) // this will always fail, assert is just to raise the error.
 		case ent := <-retChan:
-			te, ok := ent.(*testEntity)
+			te, ok := ent.(*Entity)
 			c.Assert(ok, Equals, true)
 			c.Assert(te, NotNil)
 			c.Assert(te.Name, Equals, "test")
@@ -168,11 +188,11 @@ func (s *testSuite) TestWatch(c *C) {
 		}
 	}
 
-	c.Assert(volClient.WatchStop(te), IsNil)
+	c.Assert(s.client.WatchStop(te), IsNil)
 	for i := 0; i < 10; i++ {
-		te2 := te.Copy().(*testEntity)
+		te2 := te.Copy().(*Entity)
 		te2.SomeData = fmt.Sprintf("data%d", i)
-		setKey(te2)
+		s.setKey(c, te2)
 	}
 
 	var x = 0
@@ -186,66 +206,84 @@ func (s *testSuite) TestWatch(c *C) {
 	}
 }
 
-func (s *testSuite) TestHooks(c *C) {
-	volClient, err := etcd.NewClient(etcdHosts, "volplugin")
-	c.Assert(err, IsNil)
+func (s *testSuite) TestWatchPrefix(c *C) {
+	c.Assert(s.client.Set(NewEntity("foo", "before")), IsNil)
+
+	prefixChan, _ := s.client.WatchPrefix(NewEntity("", ""))
+	waitWatch()
+
+	c.Assert(s.client.Set(NewEntity("foo", "after")), IsNil)
+	c.Assert((<-prefixChan).(*Entity).SomeData, Equals, "after")
+
+	c.Assert(s.client.Set(NewEntity("bar", "new")), IsNil)
+	c.Assert((<-prefixChan).(*Entity).Name, Equals, "bar")
 
+	c.Assert(s.client.WatchPrefixStop(NewEntity("", "")), IsNil)
+	c.Assert(s.client.WatchPrefixStop(NewEntity("", "")), NotNil)
+}
+
+func (s *testSuite) TestHooks(c *C) {
 	triggered := &struct{ i int }{i: 0}
 
-	te := newTestEntity("test", "")
+	te := NewEntity("test", "")
 	triggerFunc := func(c db.Client, te db.Entity) error {
 		triggered.i++
 		return nil
 	}
 
 	te.hooks.PreSet = triggerFunc
-	c.Assert(volClient.Set(te), IsNil)
+	c.Assert(s.client.Set(te), IsNil)
 	c.Assert(triggered.i, Equals, 1)
 
 	triggered.i = 0
 	te.hooks.PostSet = triggerFunc
-	c.Assert(volClient.Set(te), IsNil)
+	c.Assert(s.client.Set(te), IsNil)
 	c.Assert(triggered.i, Equals, 2)
 
 	triggered.i = 0
 	te.hooks.PreSet = nil
 	te.hooks.PostSet = nil
-	c.Assert(volClient.Set(te), IsNil)
+	c.Assert(s.client.Set(te), IsNil)
 	c.Assert(triggered.i, Equals, 0)
 
 	te.hooks.PreGet = triggerFunc
-	c.Assert(volClient.Get(te), IsNil)
+	c.Assert(s.client.Get(te), IsNil)
 	c.Assert(triggered.i, Equals, 1)
 
 	triggered.i = 0
 	te.hooks.PostGet = triggerFunc
-	c.Assert(volClient.Get(te), IsNil)
+	c.Assert(s.client.Get(te), IsNil)
 	c.Assert(triggered.i, Equals, 2)
 
 	triggered.i = 0
 	te.hooks.PreGet = nil
 	te.hooks.PostGet = nil
-	c.Assert(volClient.Get(te), IsNil)
+	c.Assert(s.client.Get(te), IsNil)
 	c.Assert(triggered.i, Equals, 0)
 
 	te.hooks.PreDelete = triggerFunc
-	c.Assert(volClient.Delete(te), IsNil)
+	c.Assert(s.client.Delete(te), IsNil)
 	c.Assert(triggered.i, Equals, 1)
 
 	// to test these delete calls, we have to re-set the data.
-	c.Assert(volClient.Set(te), IsNil)
+	c.Assert(s.client.Set(te), IsNil)
 
 	triggered.i = 0
 	te.hooks.PostDelete = triggerFunc
-	c.Assert(volClient.Delete(te), IsNil)
+	c.Assert(s.client.Delete(te), IsNil)
 	c.Assert(triggered.i, Equals, 2)
 
 	// to test these delete calls, we have to re-set the data.
-	c.Assert(volClient.Set(te), IsNil)
+	c.Assert(s.client.Set(te), IsNil)
 
 	triggered.i = 0
 	te.hooks.PreDelete = nil
 	te.hooks.PostDelete = nil
-	c.Assert(volClient.Delete(te), IsNil)
+	c.Assert(s.client.Delete(te), IsNil)
 	c.Assert(triggered.i, Equals, 0)
+
+	// a failing hook stops the operation.
+	te.hooks.PreSet = func(db.Client, db.Entity) error { return errored.New("nope") }
+	c.Assert(s.client.Set(te), NotNil)
+	c.Assert(s.client.Get(te), Equals, errors.NotExists)
 }
@@ -27,9 +27,9 @@ func (s *testSuite) TestGlobalEmpty(c *C) {
 func (s *testSuite) TestGlobalWatch(c *C) {
 	global := db.NewGlobal()
 
-	// XXX this leaks but w/e, we should probably implement a stop chan. not a
-	// real world problem
 	globalChan, errChan := s.client.Watch(global)
+	defer s.client.WatchStop(global)
+	waitWatch()
 
 	c.Assert(s.client.Set(global), IsNil)
 	select {
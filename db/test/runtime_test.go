@@ -15,6 +15,7 @@ func (s *testSuite) TestRuntimeWatch(c *C) {
 
 	objChan, errChan := s.client.WatchPrefix(&db.RuntimeOptions{})
 	defer s.client.WatchPrefixStop(&db.RuntimeOptions{})
+	waitWatch()
 	opts := db.NewRuntimeOptions(vol.PolicyName, vol.VolumeName)
 	opts.RateLimit.ReadBPS = 1000
 	c.Assert(s.client.Set(opts), IsNil)
@@ -81,9 +81,10 @@ func (s *testSuite) TestVolumeCRUD(c *C) {
 		c.Assert(volumeNames, DeepEquals, volumeKeys)
 		for _, entity := range volumes {
 			vol := entity.(*db.Volume)
-			testPolicies["basic"].RuntimeOptions.SetKey(vol.String())
+			runtime := *testPolicies["basic"].RuntimeOptions
+			runtime.SetKey(vol.String())
 			c.Assert(vol.CreateOptions, DeepEquals, testPolicies["basic"].CreateOptions)
-			c.Assert(vol.RuntimeOptions, DeepEquals, testPolicies["basic"].RuntimeOptions)
+			c.Assert(vol.RuntimeOptions, DeepEquals, &runtime)
 		}
 	}
 
@@ -233,6 +234,7 @@ func (s *testSuite) TestMountSource(c *C) {
 
 func (s *testSuite) TestWatchVolumes(c *C) {
 	entChan, errChan := s.client.WatchPrefix(&db.Volume{})
+	waitWatch()
 	select {
 	case err := <-errChan:
 		c.Assert(err, IsNil)
@@ -57,6 +57,10 @@ func CreateVolume(vr *VolumeRequest) (*Volume, error) {
 		MountSource:    mount,
 	}
 
+	// the volume's hooks name its runtime options after it; copy them so the
+	// policy's are left alone.
+	vc = vc.Copy().(*Volume)
+
 	if err := vc.Validate(); err != nil {
 		return nil, err
 	}
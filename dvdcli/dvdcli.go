@@ -0,0 +1,130 @@
+// Package dvdcli implements a dvdcli-compatible client, which the Mesos
+// docker/volume isolator executes to mount and unmount volumes. Calls are
+// forwarded to the volplugin on the host, which serves them through the same
+// handlers as docker's: volumes are named policy/volume, options are merged
+// into the policy as docker's -o options are, and volumes which do not exist
+// are created on mount.
+package dvdcli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/api/impl/mesos"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+)
+
+// Client forwards dvdcli calls to the volplugin serving the socket.
+type Client struct {
+	Socket string
+}
+
+// NewClient returns a client forwarding to the volplugin serving the socket.
+func NewClient(socket string) *Client {
+	return &Client{Socket: socket}
+}
+
+// ParseOptions parses the key=value volume options given to dvdcli.
+func ParseOptions(opts []string) (map[string]string, error) {
+	options := map[string]string{}
+
+	for _, opt := range opts {
+		parts := strings.SplitN(opt, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errored.Errorf("Invalid volume option %q; must be key=value", opt)
+		}
+
+		options[parts[0]] = parts[1]
+	}
+
+	return options, nil
+}
+
+func (c *Client) post(path string, req *mesos.Request) (*mesos.Response, error) {
+	if _, _, err := storage.SplitName(req.Volume); err != nil {
+		return nil, errored.Errorf("Volume name must be policy/volume: %v", err)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				return net.Dial("unix", c.Socket)
+			},
+		},
+	}
+
+	content, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Post("http://volplugin"+path, "application/json", bytes.NewBuffer(content))
+	if err != nil {
+		return nil, errored.Errorf("Could not contact volplugin at %q: %v", c.Socket, err)
+	}
+	defer resp.Body.Close()
+
+	content, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, errored.Errorf("volplugin returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+
+	mesosResp := &mesos.Response{}
+	if err := json.Unmarshal(content, mesosResp); err != nil {
+		return nil, err
+	}
+
+	if mesosResp.Code == mesos.CodeExists {
+		return nil, errors.Exists
+	}
+
+	if mesosResp.Err != "" {
+		return nil, errored.New(mesosResp.Err)
+	}
+
+	return mesosResp, nil
+}
+
+// Mount creates the volume if it does not exist, mounts it, and returns its
+// mountpoint.
+func (c *Client) Mount(volume string, opts map[string]string) (string, error) {
+	req := &mesos.Request{Volume: volume, Options: opts}
+
+	// volplugin refuses to create a volume which exists; it is mounted as it is.
+	if _, err := c.post("/Mesos.Create", req); err != nil && err != errors.Exists {
+		return "", err
+	}
+
+	resp, err := c.post("/Mesos.Mount", req)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Mountpoint, nil
+}
+
+// Unmount unmounts the volume.
+func (c *Client) Unmount(volume string) error {
+	_, err := c.post("/Mesos.Unmount", &mesos.Request{Volume: volume})
+	return err
+}
+
+// Path returns the mountpoint of the volume.
+func (c *Client) Path(volume string) (string, error) {
+	resp, err := c.post("/Mesos.Path", &mesos.Request{Volume: volume})
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Mountpoint, nil
+}
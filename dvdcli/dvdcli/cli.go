@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/codegangsta/cli"
+	"github.com/contiv/volplugin/api/impl/mesos"
+	"github.com/contiv/volplugin/dvdcli"
+)
+
+// version is provided by build
+var version = ""
+
+var volumeFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "volumedriver",
+		Usage: "Name of the volume driver; accepted for compatibility and ignored",
+	},
+	cli.StringFlag{
+		Name:  "volumename",
+		Usage: "Name of the volume, as policy/volume",
+	},
+}
+
+func newClient(ctx *cli.Context) *dvdcli.Client {
+	return dvdcli.NewClient(ctx.GlobalString("socket"))
+}
+
+func execAndExit(ctx *cli.Context, fun func(*cli.Context) (string, error)) {
+	out, err := fun(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if out != "" {
+		fmt.Println(out)
+	}
+
+	os.Exit(0)
+}
+
+func mount(ctx *cli.Context) (string, error) {
+	opts, err := dvdcli.ParseOptions(ctx.StringSlice("volumeopts"))
+	if err != nil {
+		return "", err
+	}
+
+	return newClient(ctx).Mount(ctx.String("volumename"), opts)
+}
+
+func unmount(ctx *cli.Context) (string, error) {
+	return "", newClient(ctx).Unmount(ctx.String("volumename"))
+}
+
+func path(ctx *cli.Context) (string, error) {
+	return newClient(ctx).Path(ctx.String("volumename"))
+}
+
+func main() {
+	app := cli.NewApp()
+	app.Version = version
+	app.Usage = "dvdcli-compatible client for volplugin, for the Mesos docker/volume isolator"
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "socket",
+			Usage:  "Socket volplugin serves the Mesos frontend on",
+			Value:  mesos.DefaultSocket,
+			EnvVar: "VOLPLUGIN_MESOS_SOCKET",
+		},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:  "mount",
+			Usage: "Create the volume if it does not exist, mount it and print its mountpoint",
+			Flags: append(volumeFlags,
+				cli.StringSliceFlag{
+					Name:  "volumeopts",
+					Usage: "Volume option as key=value; may be repeated",
+				},
+				cli.BoolFlag{
+					Name:  "explicitcreate",
+					Usage: "Accepted for compatibility; volumes are always created if they do not exist",
+				},
+			),
+			Action: func(ctx *cli.Context) { execAndExit(ctx, mount) },
+		},
+		{
+			Name:   "unmount",
+			Usage:  "Unmount the volume",
+			Flags:  volumeFlags,
+			Action: func(ctx *cli.Context) { execAndExit(ctx, unmount) },
+		},
+		{
+			Name:   "path",
+			Usage:  "Print the mountpoint of the volume",
+			Flags:  volumeFlags,
+			Action: func(ctx *cli.Context) { execAndExit(ctx, path) },
+		},
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
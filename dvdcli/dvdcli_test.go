@@ -0,0 +1,115 @@
+package dvdcli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	. "testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/api/impl/mesos"
+	"github.com/contiv/volplugin/errors"
+)
+
+type dvdcliSuite struct{}
+
+var _ = Suite(&dvdcliSuite{})
+
+func TestDVDCLI(t *T) { TestingT(t) }
+
+func (s *dvdcliSuite) TestParseOptions(c *C) {
+	opts, err := ParseOptions([]string{"size=10MB", "filesystem=xfs", "mount=host:/export=a"})
+	c.Assert(err, IsNil)
+	c.Assert(opts, DeepEquals, map[string]string{"size": "10MB", "filesystem": "xfs", "mount": "host:/export=a"})
+
+	opts, err = ParseOptions(nil)
+	c.Assert(err, IsNil)
+	c.Assert(opts, DeepEquals, map[string]string{})
+
+	for _, opt := range []string{"size", "=10MB"} {
+		_, err := ParseOptions([]string{opt})
+		c.Assert(err, NotNil, Commentf("%q", opt))
+	}
+}
+
+func (s *dvdcliSuite) TestInvalidVolume(c *C) {
+	client := NewClient("/nonexistent.sock")
+
+	for _, volume := range []string{"", "test", "policy1/test/extra"} {
+		_, err := client.Mount(volume, nil)
+		c.Assert(err, NotNil, Commentf("%q", volume))
+		c.Assert(client.Unmount(volume), NotNil, Commentf("%q", volume))
+	}
+
+	_, err := client.Mount("policy1/test", nil)
+	c.Assert(err, ErrorMatches, "Could not contact volplugin.*")
+}
+
+// serve serves the Mesos calls for the volumes on a socket, as volplugin
+// does, and returns the socket.
+func serve(c *C, volumes map[string]bool) string {
+	frontend := mesos.NewVolplugin()
+
+	read := func(r *http.Request) string {
+		req := &mesos.Request{}
+		content, err := ioutil.ReadAll(r.Body)
+		c.Assert(err, IsNil)
+		c.Assert(json.Unmarshal(content, req), IsNil)
+		return req.Volume
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/Mesos.Create", func(w http.ResponseWriter, r *http.Request) {
+		volume := read(r)
+		if volumes[volume] {
+			frontend.HTTPError(w, errors.Exists)
+			return
+		}
+
+		volumes[volume] = true
+		json.NewEncoder(w).Encode(mesos.Response{})
+	})
+	mux.HandleFunc("/Mesos.Mount", func(w http.ResponseWriter, r *http.Request) {
+		volume := read(r)
+		if !volumes[volume] {
+			frontend.HTTPError(w, errors.NotExists)
+			return
+		}
+
+		json.NewEncoder(w).Encode(mesos.Response{Mountpoint: "/mnt/ceph/" + volume})
+	})
+
+	socket := filepath.Join(c.MkDir(), "mesos.sock")
+	l, err := net.Listen("unix", socket)
+	c.Assert(err, IsNil)
+	go http.Serve(l, mux)
+
+	return socket
+}
+
+func (s *dvdcliSuite) TestMount(c *C) {
+	volumes := map[string]bool{"policy1/existing": true}
+	client := NewClient(serve(c, volumes))
+
+	mountpoint, err := client.Mount("policy1/existing", nil)
+	c.Assert(err, IsNil)
+	c.Assert(mountpoint, Equals, "/mnt/ceph/policy1/existing")
+
+	mountpoint, err = client.Mount("policy1/new", nil)
+	c.Assert(err, IsNil)
+	c.Assert(mountpoint, Equals, "/mnt/ceph/policy1/new")
+	c.Assert(volumes["policy1/new"], Equals, true)
+
+	// errors carry a trace in debug mode, which must not hide that the
+	// volume exists.
+	errored.AlwaysDebug, errored.AlwaysTrace = true, true
+	defer func() { errored.AlwaysDebug, errored.AlwaysTrace = false, false }()
+
+	mountpoint, err = client.Mount("policy1/existing", nil)
+	c.Assert(err, IsNil)
+	c.Assert(mountpoint, Equals, "/mnt/ceph/policy1/existing")
+}
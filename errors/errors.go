@@ -149,6 +149,10 @@ var (
 	GetMount = errored.New("Retrieving mount")
 	// MountFailed is used when mounts fail.
 	MountFailed = errored.New("Mount failed")
+	// PlacementConstraint is used when a host does not satisfy a volume's placement constraints.
+	PlacementConstraint = errored.New("Host does not satisfy the volume's placement constraints")
+	// VolumeDraining is used when a mount is refused because the volume is being handed off.
+	VolumeDraining = errored.New("Volume is being handed off to another host")
 	// UnmountFailed is used when unmounts fail.
 	UnmountFailed = errored.New("Unmount failed")
 
@@ -159,4 +163,79 @@ var (
 
 	// ReadBody is used when reading the request body.
 	ReadBody = errored.New("Reading request body")
+
+	// InvalidNode is used when a node record is missing its hostname.
+	InvalidNode = errored.New("Invalid node: hostname is required")
+	// PublishNode is used when publishing node registrations.
+	PublishNode = errored.New("Publishing node registration")
+	// GetNode is used when retrieving node registrations.
+	GetNode = errored.New("Retrieving node registration")
+	// ListNode is used when listing node registrations.
+	ListNode = errored.New("Listing node registrations")
+
+	// Handoff is used when a volume handoff cannot be performed.
+	Handoff = errored.New("Handing off volume")
+	// HandoffCancelled is used when a handoff is cancelled while it is draining.
+	HandoffCancelled = errored.New("Handoff was cancelled")
+	// PublishHandoff is used when publishing handoff requests.
+	PublishHandoff = errored.New("Publishing handoff request")
+	// GetHandoff is used when retrieving handoff requests.
+	GetHandoff = errored.New("Retrieving handoff request")
+
+	// PublishOperation is used when journaling operations.
+	PublishOperation = errored.New("Journaling operation")
+	// ListOperation is used when listing journaled operations.
+	ListOperation = errored.New("Listing operations")
+	// RecoverOperation is used when resuming or rolling back an incomplete operation.
+	RecoverOperation = errored.New("Recovering incomplete operation")
+
+	// ImportVolume is used when an existing image cannot be adopted as a volume.
+	ImportVolume = errored.New("Importing image as volume")
+
+	// Reconcile is used when volume records cannot be compared with the backends.
+	Reconcile = errored.New("Reconciling volumes with storage backends")
+	// Repair is used when a reconciliation repair cannot be performed.
+	Repair = errored.New("Repairing volume")
+
+	// InvalidIdentity is used when an identity fails validation.
+	InvalidIdentity = errored.New("Invalid identity")
+	// PublishIdentity is used when publishing identities.
+	PublishIdentity = errored.New("Publishing identity")
+	// GetIdentity is used when retrieving identities.
+	GetIdentity = errored.New("Retrieving identity")
+	// Unauthenticated is used when a request carries no valid credentials.
+	Unauthenticated = errored.New("Authentication required")
+	// Unauthorized is used when an identity lacks the role a request requires.
+	Unauthorized = errored.New("Permission denied")
+
+	// QuotaExceeded is used when a request would exceed its policy's quota.
+	QuotaExceeded = errored.New("Policy quota exceeded")
+	// PolicyUsage is used when reading or updating a policy's usage.
+	PolicyUsage = errored.New("Updating policy usage")
+	// PublishVolumeUsage is used when publishing the usage of a volume.
+	PublishVolumeUsage = errored.New("Publishing volume usage")
+	// GetVolumeUsage is used when retrieving the usage of a volume.
+	GetVolumeUsage = errored.New("Retrieving volume usage")
+
+	// PublishEvent is used when recording volume events.
+	PublishEvent = errored.New("Publishing event")
+	// ListEvents is used when reading or following volume events.
+	ListEvents = errored.New("Listing events")
+	// InvalidWebhook is used when a webhook receiver fails validation.
+	InvalidWebhook = errored.New("Invalid webhook")
+	// DeliverWebhook is used when an event cannot be delivered to a webhook receiver.
+	DeliverWebhook = errored.New("Delivering webhook")
+	// DeadLetter is used when reading or writing undeliverable webhooks.
+	DeadLetter = errored.New("Recording undeliverable webhook")
+
+	// Unhealthy is used when a dependency of a daemon fails its health check.
+	Unhealthy = errored.New("Health check failed")
+	// DebugReport is used when requesting, publishing or collecting debug reports.
+	DebugReport = errored.New("Collecting debug reports")
+	// Consul is used when a request to consul fails.
+	Consul = errored.New("Consul request")
+	// Etcd3 is used when a request to etcd's v3 API fails.
+	Etcd3 = errored.New("etcd v3 request")
+	// InvalidStore is used when the store given to a daemon cannot be used.
+	InvalidStore = errored.New("Invalid store")
 )
@@ -0,0 +1,243 @@
+// Package flexvolume implements the kubernetes FlexVolume driver which the
+// kubelet executes. Mounts and unmounts are forwarded to the volplugin on the
+// host, which takes the same locks and keeps the same mount counts as it does
+// for docker; the volume is then bind-mounted into the pod's directory.
+//
+// The kubelet only provides the pod directory on unmount, so the volume
+// mounted at each directory is recorded in a state directory.
+package flexvolume
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/api/impl/flexvolume"
+	"github.com/contiv/volplugin/storage"
+	"golang.org/x/sys/unix"
+)
+
+// DefaultStateDir is where the volume mounted at each pod directory is recorded.
+const DefaultStateDir = "/var/lib/volplugin/flexvolume"
+
+// optionReadWrite is the kubelet's option for the access mode of the mount.
+const optionReadWrite = "kubernetes.io/readwrite"
+
+// Driver is the FlexVolume driver.
+type Driver struct {
+	Socket   string
+	StateDir string
+}
+
+// NewDriver returns a driver forwarding to the volplugin serving the socket.
+func NewDriver(socket, stateDir string) *Driver {
+	return &Driver{Socket: socket, StateDir: stateDir}
+}
+
+func parseOptions(options string) (map[string]string, error) {
+	opts := map[string]string{}
+	if err := json.Unmarshal([]byte(options), &opts); err != nil {
+		return nil, errored.Errorf("Invalid options %q: %v", options, err)
+	}
+
+	return opts, nil
+}
+
+func volumeName(opts map[string]string) (string, error) {
+	volume := opts[flexvolume.OptionVolume]
+	if _, _, err := storage.SplitName(volume); err != nil {
+		return "", errored.Errorf("Option %q must be set to policy/volume: %v", flexvolume.OptionVolume, err)
+	}
+
+	return volume, nil
+}
+
+func (d *Driver) post(path string, req *flexvolume.Request) (*flexvolume.Response, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				return net.Dial("unix", d.Socket)
+			},
+		},
+	}
+
+	content, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Post("http://volplugin"+path, "application/json", bytes.NewBuffer(content))
+	if err != nil {
+		return nil, errored.Errorf("Could not contact volplugin at %q: %v", d.Socket, err)
+	}
+	defer resp.Body.Close()
+
+	content, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, errored.Errorf("volplugin returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+
+	fvResp := &flexvolume.Response{}
+	if err := json.Unmarshal(content, fvResp); err != nil {
+		return nil, err
+	}
+
+	if fvResp.Status != flexvolume.StatusSuccess {
+		return nil, errored.New(fvResp.Message)
+	}
+
+	return fvResp, nil
+}
+
+func (d *Driver) statePath(mountDir string) string {
+	return filepath.Join(d.StateDir, base64.URLEncoding.EncodeToString([]byte(filepath.Clean(mountDir))))
+}
+
+func (d *Driver) writeState(mountDir, volume string) error {
+	if err := os.MkdirAll(d.StateDir, 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(d.statePath(mountDir), []byte(volume), 0600)
+}
+
+func (d *Driver) readState(mountDir string) (string, error) {
+	content, err := ioutil.ReadFile(d.statePath(mountDir))
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+func (d *Driver) removeState(mountDir string) error {
+	if err := os.Remove(d.statePath(mountDir)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Init reports the driver's capabilities. Volumes are attached as part of
+// the mount, so the kubelet does not need to call attach or detach.
+func (d *Driver) Init() (*flexvolume.Response, error) {
+	return &flexvolume.Response{Status: flexvolume.StatusSuccess, Capabilities: &flexvolume.Capabilities{Attach: false}}, nil
+}
+
+// Attach is a no-op; the volume is attached when it is mounted.
+func (d *Driver) Attach(options, node string) (*flexvolume.Response, error) {
+	if _, err := parseOptions(options); err != nil {
+		return nil, err
+	}
+
+	return &flexvolume.Response{Status: flexvolume.StatusSuccess}, nil
+}
+
+// Detach is a no-op; the volume is detached when it is unmounted.
+func (d *Driver) Detach(device, node string) (*flexvolume.Response, error) {
+	return &flexvolume.Response{Status: flexvolume.StatusSuccess}, nil
+}
+
+// GetVolumeName yields the unique name of the volume. Kubernetes does not
+// allow '/' in the name, so the policy and volume are joined with '.'.
+func (d *Driver) GetVolumeName(options string) (*flexvolume.Response, error) {
+	opts, err := parseOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	volume, err := volumeName(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &flexvolume.Response{Status: flexvolume.StatusSuccess, VolumeName: strings.Replace(volume, "/", ".", 1)}, nil
+}
+
+// Mount mounts the volume through volplugin and bind-mounts it at the pod
+// directory.
+func (d *Driver) Mount(mountDir, options string) (*flexvolume.Response, error) {
+	opts, err := parseOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	volume, err := volumeName(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := d.post("/FlexVolume.Mount", &flexvolume.Request{Volume: volume, Options: opts})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.bind(resp.Mountpoint, mountDir, volume, opts[optionReadWrite] == "ro"); err != nil {
+		if _, uerr := d.post("/FlexVolume.Unmount", &flexvolume.Request{Volume: volume, Options: opts}); uerr != nil {
+			return nil, errored.Errorf("%v; additionally, could not unmount %q: %v", err, volume, uerr)
+		}
+
+		return nil, err
+	}
+
+	return &flexvolume.Response{Status: flexvolume.StatusSuccess}, nil
+}
+
+func (d *Driver) bind(source, mountDir, volume string, readOnly bool) error {
+	if err := os.MkdirAll(mountDir, 0750); err != nil {
+		return err
+	}
+
+	if err := d.writeState(mountDir, volume); err != nil {
+		return errored.Errorf("Could not record mount of %q at %q: %v", volume, mountDir, err)
+	}
+
+	if err := unix.Mount(source, mountDir, "", unix.MS_BIND, ""); err != nil {
+		d.removeState(mountDir)
+		return errored.Errorf("Could not bind mount %q at %q: %v", source, mountDir, err)
+	}
+
+	if readOnly {
+		if err := unix.Mount("", mountDir, "", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY, ""); err != nil {
+			unix.Unmount(mountDir, 0)
+			d.removeState(mountDir)
+			return errored.Errorf("Could not remount %q read-only: %v", mountDir, err)
+		}
+	}
+
+	return nil
+}
+
+// Unmount removes the bind mount at the pod directory and unmounts the volume
+// through volplugin.
+func (d *Driver) Unmount(mountDir string) (*flexvolume.Response, error) {
+	volume, err := d.readState(mountDir)
+	if err != nil {
+		return nil, errored.Errorf("No volplugin volume is recorded at %q: %v", mountDir, err)
+	}
+
+	if err := unix.Unmount(mountDir, 0); err != nil && err != unix.EINVAL && err != unix.ENOENT {
+		return nil, errored.Errorf("Could not unmount %q: %v", mountDir, err)
+	}
+
+	if _, err := d.post("/FlexVolume.Unmount", &flexvolume.Request{Volume: volume}); err != nil {
+		return nil, err
+	}
+
+	if err := d.removeState(mountDir); err != nil {
+		return nil, err
+	}
+
+	return &flexvolume.Response{Status: flexvolume.StatusSuccess}, nil
+}
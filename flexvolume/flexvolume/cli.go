@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/codegangsta/cli"
+	"github.com/contiv/volplugin/api/impl/flexvolume"
+	driver "github.com/contiv/volplugin/flexvolume"
+)
+
+// version is provided by build
+var version = ""
+
+func newDriver() *driver.Driver {
+	socket := os.Getenv("VOLPLUGIN_FLEXVOLUME_SOCKET")
+	if socket == "" {
+		socket = flexvolume.DefaultSocket
+	}
+
+	stateDir := os.Getenv("VOLPLUGIN_FLEXVOLUME_STATE")
+	if stateDir == "" {
+		stateDir = driver.DefaultStateDir
+	}
+
+	return driver.NewDriver(socket, stateDir)
+}
+
+// respond prints the response for the kubelet. The kubelet reads the status
+// from the output, so the exit status is only non-zero on failure.
+func respond(resp *flexvolume.Response, err error) {
+	if err != nil {
+		resp = &flexvolume.Response{Status: flexvolume.StatusFailure, Message: err.Error()}
+	}
+
+	content, merr := json.Marshal(resp)
+	if merr != nil {
+		fmt.Printf("{\"status\": %q, \"message\": %q}\n", flexvolume.StatusFailure, merr.Error())
+		os.Exit(1)
+	}
+
+	fmt.Println(string(content))
+
+	if resp.Status == flexvolume.StatusFailure {
+		os.Exit(1)
+	}
+}
+
+func args(ctx *cli.Context, count int) []string {
+	a := []string(ctx.Args())
+	if len(a) < count {
+		respond(nil, fmt.Errorf("%s requires %d arguments, received %d", ctx.Command.Name, count, len(a)))
+	}
+
+	return a
+}
+
+func main() {
+	app := cli.NewApp()
+	app.Version = version
+	app.Usage = "Kubernetes FlexVolume driver for volplugin"
+	app.HideHelp = true
+	app.CommandNotFound = func(ctx *cli.Context, command string) {
+		respond(&flexvolume.Response{Status: flexvolume.StatusNotSupported}, nil)
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:            "init",
+			SkipFlagParsing: true,
+			Action: func(ctx *cli.Context) {
+				respond(newDriver().Init())
+			},
+		},
+		{
+			Name:            "attach",
+			SkipFlagParsing: true,
+			Action: func(ctx *cli.Context) {
+				a := args(ctx, 1)
+				respond(newDriver().Attach(a[0], ctx.Args().Get(1)))
+			},
+		},
+		{
+			Name:            "detach",
+			SkipFlagParsing: true,
+			Action: func(ctx *cli.Context) {
+				a := args(ctx, 1)
+				respond(newDriver().Detach(a[0], ctx.Args().Get(1)))
+			},
+		},
+		{
+			Name:            "mount",
+			SkipFlagParsing: true,
+			Action: func(ctx *cli.Context) {
+				// older kubelets pass the device between the directory and options.
+				a := args(ctx, 2)
+				respond(newDriver().Mount(a[0], a[len(a)-1]))
+			},
+		},
+		{
+			Name:            "unmount",
+			SkipFlagParsing: true,
+			Action: func(ctx *cli.Context) {
+				a := args(ctx, 1)
+				respond(newDriver().Unmount(a[0]))
+			},
+		},
+		{
+			Name:            "getvolumename",
+			SkipFlagParsing: true,
+			Action: func(ctx *cli.Context) {
+				a := args(ctx, 1)
+				respond(newDriver().GetVolumeName(a[0]))
+			},
+		},
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		respond(nil, err)
+	}
+}
@@ -0,0 +1,72 @@
+package flexvolume
+
+import (
+	"io/ioutil"
+	"os"
+	. "testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/api/impl/flexvolume"
+)
+
+type flexvolumeSuite struct {
+	stateDir string
+	driver   *Driver
+}
+
+var _ = Suite(&flexvolumeSuite{})
+
+func TestFlexVolume(t *T) { TestingT(t) }
+
+func (s *flexvolumeSuite) SetUpTest(c *C) {
+	dir, err := ioutil.TempDir("", "flexvolume")
+	c.Assert(err, IsNil)
+	s.stateDir = dir
+	s.driver = NewDriver("/nonexistent.sock", dir)
+}
+
+func (s *flexvolumeSuite) TearDownTest(c *C) {
+	os.RemoveAll(s.stateDir)
+}
+
+func (s *flexvolumeSuite) TestInit(c *C) {
+	resp, err := s.driver.Init()
+	c.Assert(err, IsNil)
+	c.Assert(resp.Status, Equals, flexvolume.StatusSuccess)
+	c.Assert(resp.Capabilities, NotNil)
+	c.Assert(resp.Capabilities.Attach, Equals, false)
+}
+
+func (s *flexvolumeSuite) TestGetVolumeName(c *C) {
+	resp, err := s.driver.GetVolumeName(`{"volume": "policy1/test", "kubernetes.io/fsType": "ext4"}`)
+	c.Assert(err, IsNil)
+	c.Assert(resp.VolumeName, Equals, "policy1.test")
+
+	for _, options := range []string{`{}`, `{"volume": "test"}`, `not json`} {
+		_, err := s.driver.GetVolumeName(options)
+		c.Assert(err, NotNil, Commentf("%q", options))
+	}
+}
+
+func (s *flexvolumeSuite) TestState(c *C) {
+	dir := "/var/lib/kubelet/pods/1234/volumes/contiv~volplugin/test"
+
+	_, err := s.driver.readState(dir)
+	c.Assert(err, NotNil)
+
+	c.Assert(s.driver.writeState(dir+"/", "policy1/test"), IsNil)
+	volume, err := s.driver.readState(dir)
+	c.Assert(err, IsNil)
+	c.Assert(volume, Equals, "policy1/test")
+
+	c.Assert(s.driver.removeState(dir), IsNil)
+	c.Assert(s.driver.removeState(dir), IsNil)
+	_, err = s.driver.readState(dir)
+	c.Assert(err, NotNil)
+}
+
+func (s *flexvolumeSuite) TestUnmountUnknown(c *C) {
+	_, err := s.driver.Unmount("/var/lib/kubelet/pods/1234/volumes/contiv~volplugin/unknown")
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,210 @@
+package info
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/logging"
+)
+
+// Redacted replaces the values of secrets in debug bundles.
+const Redacted = "<redacted>"
+
+// MaxFileSize is the size, in bytes, the goroutine stacks and logs collected
+// for a debug bundle are truncated to. Volplugins publish their files to etcd
+// as a single value.
+const MaxFileSize = 256 * 1024
+
+// secretWords are the words which mark a key as naming a secret.
+var secretWords = []string{"secret", "password", "passwd", "token", "keyring", "credential"}
+
+// secretText matches a key naming a secret in text, such as log lines with
+// %#v or %v dumps of driver options, and the value it is set to: quoted, or
+// up to a space, comma or closing bracket.
+var secretText = regexp.MustCompile(`(?i)([\w.-]*(?:` + strings.Join(secretWords, "|") + `)[\w.-]*\\?"?\s*[:=]\s*)("(?:[^"\\]|\\.)*"|[^\s,}\])]+)`)
+
+// BundleName returns the name of a debug bundle made now, which is also the
+// base directory of its files. Tar hangs during unpacking if the base
+// directory has colons in it unless --force-local is specified, so it uses
+// the simpler "%Y%m%d-%H%M%S".
+func BundleName(prefix string) string {
+	return prefix + "_debug_" + time.Now().Format("20060102-150405")
+}
+
+// Bundle is a debug bundle being written: a gzipped tarball whose files are
+// all placed under a single base directory.
+type Bundle struct {
+	base      string
+	gzip      *gzip.Writer
+	tarWriter *tar.Writer
+}
+
+// NewBundle starts a bundle on the writer.
+func NewBundle(w io.Writer, base string) *Bundle {
+	gz := gzip.NewWriter(w)
+	return &Bundle{base: base, gzip: gz, tarWriter: tar.NewWriter(gz)}
+}
+
+// Add adds the file to the bundle.
+func (b *Bundle) Add(name string, content []byte) error {
+	header := &tar.Header{
+		Name:     path.Join(b.base, name),
+		Mode:     0600,
+		Size:     int64(len(content)),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}
+
+	if err := b.tarWriter.WriteHeader(header); err != nil {
+		return errored.Errorf("Failed to write tar entry header").Combine(err)
+	}
+
+	if _, err := b.tarWriter.Write(content); err != nil {
+		return errored.Errorf("Failed to write tar entry").Combine(err)
+	}
+
+	return nil
+}
+
+// AddFiles adds the files to the bundle, under the directory.
+func (b *Bundle) AddFiles(dir string, files map[string]string) error {
+	for name, content := range files {
+		if err := b.Add(path.Join(dir, name), []byte(content)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddEtcd adds the etcd namespace to the bundle, under "etcd", with secrets
+// redacted.
+func (b *Bundle) AddEtcd(client *config.Client) error {
+	return client.DumpNamespace(b.tarWriter, path.Join(b.base, "etcd"), func(value string) string {
+		return string(Redact([]byte(value)))
+	})
+}
+
+// Close finishes the bundle. It does not close the underlying writer.
+func (b *Bundle) Close() error {
+	if err := b.tarWriter.Close(); err != nil {
+		return err
+	}
+
+	return b.gzip.Close()
+}
+
+// Redact replaces the values of keys which name secrets, such as passwords
+// and tokens in driver options, in JSON content. Content which is not JSON
+// is returned unchanged.
+func Redact(content []byte) []byte {
+	var value interface{}
+	if err := json.Unmarshal(content, &value); err != nil {
+		return content
+	}
+
+	redacted, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return content
+	}
+
+	return redacted
+}
+
+func redactValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, inner := range value {
+			if isSecret(key) {
+				value[key] = Redacted
+			} else {
+				value[key] = redactValue(inner)
+			}
+		}
+	case []interface{}:
+		for i, inner := range value {
+			value[i] = redactValue(inner)
+		}
+	}
+
+	return value
+}
+
+// RedactText replaces the values of keys which name secrets in text which is
+// not JSON, such as log lines.
+func RedactText(content string) string {
+	return secretText.ReplaceAllString(content, `${1}"`+Redacted+`"`)
+}
+
+func isSecret(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range secretWords {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// truncate cuts the content down to MaxFileSize, keeping its head, or its
+// tail if tail is set.
+func truncate(content string, tail bool) string {
+	if len(content) <= MaxFileSize {
+		return content
+	}
+
+	note := fmt.Sprintf("\n... truncated %d bytes ...\n", len(content)-MaxFileSize)
+	if tail {
+		return note + content[len(content)-MaxFileSize:]
+	}
+
+	return content[:MaxFileSize] + note
+}
+
+// Collect returns the files every daemon contributes to a debug bundle: its
+// version, its goroutine stacks and, if logs is set, its recent log lines.
+// Secrets found in the stacks and logs are redacted, and they are truncated
+// to MaxFileSize; the logs keep their most recent lines.
+func Collect(daemon, version string, logs bool) map[string]string {
+	cephVersion, err := getCephVersion()
+	if err != nil {
+		cephVersion = "n/a"
+	}
+
+	versions, _ := json.MarshalIndent(map[string]interface{}{
+		"daemon":       daemon,
+		"version":      version,
+		"go_version":   runtime.Version(),
+		"ceph_version": cephVersion,
+		"os":           runtime.GOOS,
+		"architecture": runtime.GOARCH,
+		"goroutines":   runtime.NumGoroutine(),
+	}, "", "  ")
+
+	goroutines := new(bytes.Buffer)
+	pprof.Lookup("goroutine").WriteTo(goroutines, 2)
+
+	files := map[string]string{
+		"version.json":   string(versions),
+		"goroutines.txt": truncate(RedactText(goroutines.String()), false),
+	}
+
+	if logs {
+		files["logs.txt"] = truncate(RedactText(strings.Join(logging.Recent(), "")), true)
+	}
+
+	return files
+}
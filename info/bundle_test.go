@@ -0,0 +1,92 @@
+package info
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	. "testing"
+
+	. "gopkg.in/check.v1"
+)
+
+type infoSuite struct{}
+
+var _ = Suite(&infoSuite{})
+
+func TestInfo(t *T) { TestingT(t) }
+
+func (s *infoSuite) TestRedact(c *C) {
+	content := []byte(`{"name":"foo","driver":{"pool":"rbd","secret":"s3cret"},"Params":[{"AdminPassword":"hunter2"}],"token-hash":"abc"}`)
+
+	value := map[string]interface{}{}
+	c.Assert(json.Unmarshal(Redact(content), &value), IsNil)
+	c.Assert(value["name"], Equals, "foo")
+	c.Assert(value["token-hash"], Equals, Redacted)
+	c.Assert(value["driver"].(map[string]interface{})["pool"], Equals, "rbd")
+	c.Assert(value["driver"].(map[string]interface{})["secret"], Equals, Redacted)
+	c.Assert(value["Params"].([]interface{})[0].(map[string]interface{})["AdminPassword"], Equals, Redacted)
+
+	c.Assert(string(Redact([]byte("not json"))), Equals, "not json")
+}
+
+func (s *infoSuite) TestBundle(c *C) {
+	buf := new(bytes.Buffer)
+	bundle := NewBundle(buf, "bundle")
+	c.Assert(bundle.AddFiles("volplugin/host1", map[string]string{"version.json": "{}"}), IsNil)
+	c.Assert(bundle.Add("missing-reports.txt", []byte("host2\n")), IsNil)
+	c.Assert(bundle.Close(), IsNil)
+
+	gz, err := gzip.NewReader(buf)
+	c.Assert(err, IsNil)
+	tr := tar.NewReader(gz)
+
+	files := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+
+		content, err := ioutil.ReadAll(tr)
+		c.Assert(err, IsNil)
+		files[header.Name] = string(content)
+	}
+
+	c.Assert(files, DeepEquals, map[string]string{
+		"bundle/volplugin/host1/version.json": "{}",
+		"bundle/missing-reports.txt":          "host2\n",
+	})
+
+	files = Collect("volplugin", "1.0", false)
+	c.Assert(files["version.json"], Matches, `(?s).*"version": "1.0".*`)
+	c.Assert(files["goroutines.txt"], Not(Equals), "")
+	_, ok := files["logs.txt"]
+	c.Assert(ok, Equals, false)
+
+	files = Collect("volplugin", "1.0", true)
+	_, ok = files["logs.txt"]
+	c.Assert(ok, Equals, true)
+}
+
+func (s *infoSuite) TestRedactText(c *C) {
+	for text, redacted := range map[string]string{
+		`Volume Create: config.Volume{DriverOptions:map[string]string{"pool":"rbd", "secret":"s3cret"}}`: `Volume Create: config.Volume{DriverOptions:map[string]string{"pool":"rbd", "secret":"<redacted>"}}`,
+		`msg="Mounting {AdminPassword:hunter2 Pool:rbd}"`:                                                `msg="Mounting {AdminPassword:"<redacted>" Pool:rbd}"`,
+		`msg="options map[keyring:/etc/ceph/keyring pool:rbd]"`:                                          `msg="options map[keyring:"<redacted>" pool:rbd]"`,
+		`msg="request {\"token\":\"abc\"}"`:                                                              `msg="request {\"token\":"<redacted>"}"`,
+		`url=https://example.com/hook`:                                                                   `url=https://example.com/hook`,
+	} {
+		c.Assert(RedactText(text), Equals, redacted)
+	}
+}
+
+func (s *infoSuite) TestTruncate(c *C) {
+	c.Assert(truncate("short", false), Equals, "short")
+
+	long := strings.Repeat("a", MaxFileSize) + strings.Repeat("b", 10)
+	c.Assert(truncate(long, false), Equals, strings.Repeat("a", MaxFileSize)+"\n... truncated 10 bytes ...\n")
+	c.Assert(truncate(long, true), Equals, "\n... truncated 10 bytes ...\n"+strings.Repeat("a", MaxFileSize-10)+strings.Repeat("b", 10))
+}
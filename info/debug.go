@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"syscall"
@@ -64,22 +65,52 @@ func HandleDebugSignal() {
 	}
 }
 
-// HandleDumpTarballSignal watches for SIGUSR2 and creates a gzipped tarball
-// of the current etcd directories/keys under the "/volplugin" namespace
-func HandleDumpTarballSignal(client *config.Client) {
+// HandleDumpTarballSignal watches for SIGUSR2 and writes a debug bundle of
+// this daemon, including the etcd namespace under "/volplugin" with secrets
+// redacted, to a gzipped tarball in the temporary directory.
+func HandleDumpTarballSignal(client *config.Client, daemon, version string) {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGUSR2)
 	for {
 		select {
 		case <-signals:
-			logrus.Info("received SIGUSR2; dumping etcd namespace to tarball")
+			logrus.Info("received SIGUSR2; writing debug bundle")
 
-			tarballPath, err := client.DumpTarball()
+			bundlePath, err := writeBundle(client, daemon, version)
 			if err != nil {
-				logrus.Info("Failed to dump etcd namespace: ", err)
+				logrus.Info("Failed to write debug bundle: ", err)
 			} else {
-				logrus.Info("Dumped etcd namespace to ", tarballPath)
+				logrus.Info("Wrote debug bundle to ", bundlePath)
 			}
 		}
 	}
 }
+
+func writeBundle(client *config.Client, daemon, version string) (string, error) {
+	file, err := ioutil.TempFile("", BundleName(daemon)+"_")
+	if err != nil {
+		return "", errored.Errorf("Failed to create tempfile").Combine(err)
+	}
+	defer file.Close()
+
+	bundle := NewBundle(file, filepath.Base(file.Name()))
+
+	if err := bundle.AddEtcd(client); err != nil {
+		return "", err
+	}
+
+	if err := bundle.AddFiles(daemon, Collect(daemon, version, true)); err != nil {
+		return "", err
+	}
+
+	if err := bundle.Close(); err != nil {
+		return "", err
+	}
+
+	newFilename := file.Name() + ".tar.gz"
+	if err := os.Rename(file.Name(), newFilename); err != nil {
+		return "", err
+	}
+
+	return newFilename, nil
+}
@@ -0,0 +1,144 @@
+package lock
+
+import (
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/db/impl/etcd3/etcd3test"
+)
+
+type etcd3LockSuite struct {
+	server *etcd3test.Server
+	tlc    *config.Client
+}
+
+var _ = Suite(&etcd3LockSuite{})
+
+func (s *etcd3LockSuite) SetUpTest(c *C) {
+	s.server = etcd3test.NewServer()
+
+	var err error
+	s.tlc, err = config.NewStoreClient("/volplugin", "etcd3://"+strings.TrimPrefix(s.server.URL, "http://"), nil)
+	c.Assert(err, IsNil)
+}
+
+func (s *etcd3LockSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *etcd3LockSuite) TestExecuteWithMultiUseLock(c *C) {
+	um := &config.UseMount{Volume: "policy/foo", Reason: ReasonCreate, Hostname: "mon0"}
+	us := &config.UseSnapshot{Volume: "policy/foo", Reason: ReasonCreate}
+	vol := &config.Volume{PolicyName: "policy", VolumeName: "foo"}
+	driver := NewDriver(s.tlc)
+
+	c.Assert(s.tlc.PublishUse(us), IsNil)
+
+	// none of the locks are taken if one of them is held.
+	err := driver.ExecuteWithMultiUseLock([]config.UseLocker{um, us}, 0, func(ld *Driver, ul []config.UseLocker) error {
+		c.Fatal("locks were acquired")
+		return nil
+	})
+	c.Assert(err, NotNil)
+	c.Assert(s.tlc.GetUse(&config.UseMount{}, vol), NotNil)
+
+	c.Assert(s.tlc.RemoveUse(us, false), IsNil)
+
+	ran := false
+	c.Assert(driver.ExecuteWithMultiUseLock([]config.UseLocker{um, us}, 0, func(ld *Driver, ul []config.UseLocker) error {
+		ran = true
+		return nil
+	}), IsNil)
+	c.Assert(ran, Equals, true)
+}
+
+func (s *etcd3LockSuite) TestAcquireWithTTLRefresh(c *C) {
+	um := &config.UseMount{Volume: "policy/foo", Reason: ReasonMount, Hostname: "mon0"}
+	vol := &config.Volume{PolicyName: "policy", VolumeName: "foo"}
+	driver := NewDriver(s.tlc)
+
+	stopChan, err := driver.AcquireWithTTLRefresh(um, time.Minute, 0)
+	c.Assert(err, IsNil)
+
+	// the use is attached to the lease of the host instead of being refreshed.
+	c.Assert(len(s.server.Leases()), Equals, 1)
+	c.Assert(s.tlc.GetUse(&config.UseMount{}, vol), IsNil)
+
+	stopChan <- struct{}{}
+
+	for i := 0; i < 50; i++ {
+		if s.tlc.GetUse(&config.UseMount{}, vol) != nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c.Fatal("use was not removed after stop")
+}
+
+func (s *etcd3LockSuite) TestExecuteWithMultiUseLockWaits(c *C) {
+	um := &config.UseMount{Volume: "policy/foo", Reason: ReasonCreate, Hostname: "mon0"}
+	us := &config.UseSnapshot{Volume: "policy/foo", Reason: ReasonCreate}
+	driver := NewDriver(s.tlc)
+
+	// the second use is the one held.
+	held := &config.UseSnapshot{Volume: "policy/foo", Reason: ReasonSnapshot}
+	c.Assert(s.tlc.PublishUse(held), IsNil)
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		s.tlc.RemoveUse(held, false)
+	}()
+
+	ran := false
+	c.Assert(driver.ExecuteWithMultiUseLock([]config.UseLocker{um, us}, 5*time.Second, func(ld *Driver, ul []config.UseLocker) error {
+		ran = true
+		return nil
+	}), IsNil)
+	c.Assert(ran, Equals, true)
+}
+
+func (s *etcd3LockSuite) TestAcquireWithTTLRefreshLeaseLost(c *C) {
+	um := &config.UseMount{Volume: "policy/foo", Reason: ReasonMount, Hostname: "mon0"}
+	vol := &config.Volume{PolicyName: "policy", VolumeName: "foo"}
+	driver := NewDriver(s.tlc)
+
+	lost := make(chan error, 1)
+	driver.Lost = func(uc config.UseLocker, err error) {
+		select {
+		case lost <- err:
+		default:
+		}
+	}
+
+	stopChan, err := driver.AcquireWithTTLRefresh(um, 300*time.Millisecond, 100*time.Millisecond)
+	c.Assert(err, IsNil)
+	defer func() { stopChan <- struct{}{} }()
+
+	// the lock is put back after its lease expires.
+	c.Assert(s.server.Leases(), HasLen, 1)
+	s.server.Expire(s.server.Leases()[0])
+
+	for i := 0; i < 100 && s.tlc.GetUse(&config.UseMount{}, vol) != nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(s.tlc.GetUse(&config.UseMount{}, vol), IsNil)
+
+	// the holder is told once someone else takes it.
+	c.Assert(s.tlc.RemoveUse(um, true), IsNil)
+	c.Assert(s.tlc.PublishUse(&config.UseMount{Volume: "policy/foo", Reason: ReasonMount, Hostname: "mon1"}), IsNil)
+
+	select {
+	case err := <-lost:
+		c.Assert(err, NotNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("the lost lock was not reported")
+	}
+
+	use := &config.UseMount{}
+	c.Assert(s.tlc.GetUse(use, vol), IsNil)
+	c.Assert(use.Hostname, Equals, "mon1")
+}
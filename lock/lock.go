@@ -11,13 +11,17 @@ package lock
 import (
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/jbeda/go-wait"
 
 	"github.com/contiv/volplugin/config"
 	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/logging"
+	"github.com/contiv/volplugin/metrics"
+	"github.com/contiv/volplugin/trace"
 )
 
+var log = logging.For("lock")
+
 var (
 	// Unlocked is a string indicating unlocked operation, this is typically used
 	// as a hostname for our locking system.
@@ -41,11 +45,22 @@ const (
 	ReasonCopy = "Copy"
 	// ReasonMaintenance indicates that an operator is acquiring the lock.
 	ReasonMaintenance = "Maintenance"
+	// ReasonRecover indicates an incomplete operation is being recovered.
+	ReasonRecover = "Recover"
+	// ReasonImport indicates an existing image is being adopted as a volume.
+	ReasonImport = "Import"
+	// ReasonRepair indicates a volume is being repaired by the consistency checker.
+	ReasonRepair = "Repair"
 )
 
 // Driver is the top-level struct for lock objects
 type Driver struct {
 	Config *config.Client
+
+	// Lost, if set, is called when a lock taken with AcquireWithTTLRefresh
+	// can no longer be held, such as when someone else took it after it
+	// expired.
+	Lost func(uc config.UseLocker, err error)
 }
 
 // NewDriver creates a Driver. Requires a configured Client.
@@ -57,13 +72,13 @@ func NewDriver(config *config.Client) *Driver {
 // *config.UseMount.
 func (d *Driver) ExecuteWithUseLock(uc config.UseLocker, runFunc func(d *Driver, uc config.UseLocker) error) error {
 	if err := d.Config.PublishUse(uc); err != nil {
-		logrus.Debugf("Could not publish use lock %#v: %v", uc, err)
+		log.Debugf("Could not publish use lock %#v: %v", uc, err)
 		return errors.ErrLockPublish
 	}
 
 	defer func() {
 		if err := d.Config.RemoveUse(uc, false); err != nil {
-			logrus.Errorf("Could not remove use lock %#v: %v", uc, err)
+			log.Errorf("Could not remove use lock %#v: %v", uc, err)
 		}
 	}()
 
@@ -79,22 +94,21 @@ func (d *Driver) ClearLock(uc config.UseLocker, timeout time.Duration) error {
 // at the same time. If it fails, it returns an error. If timeout is zero, it
 // will not attempt to retry acquiring the lock. Otherwise, it will attempt to
 // wait for the provided timeout and only return an error if it fails to
-// acquire them in time.
+// acquire them in time. Either all of the locks are held or none of them.
 func (d *Driver) ExecuteWithMultiUseLock(ucs []config.UseLocker, timeout time.Duration, runFunc func(d *Driver, ucs []config.UseLocker) error) error {
-	acquired := []config.UseLocker{}
+	if len(ucs) == 0 {
+		return runFunc(d, ucs)
+	}
 
-	for _, uc := range ucs {
-		if err := d.acquire(uc, 0, timeout); err != nil {
-			return err
-		}
-		acquired = append(acquired, uc)
+	if err := d.acquireAll(ucs, timeout); err != nil {
+		return err
 	}
 
 	err := runFunc(d, ucs)
 
-	for _, uc := range acquired {
+	for _, uc := range ucs {
 		if err := d.Config.RemoveUse(uc, false); err != nil {
-			logrus.Errorf("Could not remove use lock %#v: %v", uc, err)
+			log.Errorf("Could not remove use lock %#v: %v", uc, err)
 		}
 	}
 
@@ -104,27 +118,45 @@ func (d *Driver) ExecuteWithMultiUseLock(ucs []config.UseLocker, timeout time.Du
 // AcquireWithTTLRefresh accepts a UseLocker, and attempts to acquire the
 // lock. When it successfully does, it then spawns a goroutine to refresh the
 // lock after a timeout, returning a stop channel. Timeout is jittered to
-// mitigate thundering herd problems.
+// mitigate thundering herd problems. If the store keeps the lock alive
+// itself, it is published with the TTL right away; the goroutine still
+// publishes it again on the same schedule, which puts it back if it was lost
+// with its lease. Refreshes which fail are reported to Lost.
 func (d *Driver) AcquireWithTTLRefresh(uc config.UseLocker, ttl, timeout time.Duration) (chan struct{}, error) {
 	// we acquire a permanent lock, then overwrite it with a TTL lock later.
 	if err := d.Config.PublishUse(uc); err != nil {
+		metrics.LockFailures.Inc(uc.GetReason())
 		return nil, err
 	}
 
+	if d.Config.KeepsUsesAlive() {
+		if err := d.acquire(uc, ttl, timeout); err != nil {
+			metrics.LockRefreshFailures.Inc(uc.GetReason())
+			if err := d.Config.RemoveUse(uc, false); err != nil {
+				log.Errorf("Could not remove use lock %#v: %v", uc, err)
+			}
+			return nil, err
+		}
+	}
+
 	stopChan := make(chan struct{}, 1)
 
 	go func() {
 		for {
 			select {
 			case <-stopChan:
-				logrus.Debugf("Clearing lock for %v", uc)
+				log.Debugf("Clearing lock for %v", uc)
 				if err := d.Config.RemoveUse(uc, false); err != nil {
-					logrus.Errorf("Could not clear lock %v after stop received: %v", uc, err)
+					log.Errorf("Could not clear lock %v after stop received: %v", uc, err)
 				}
 				return
 			case <-time.After(wait.Jitter(ttl/4, 0)):
 				if err := d.acquire(uc, ttl, timeout); err != nil {
-					logrus.Errorf("Could not acquire lock %v: %v", uc, err)
+					metrics.LockRefreshFailures.Inc(uc.GetReason())
+					log.Errorf("Could not acquire lock %v: %v", uc, err)
+					if d.Lost != nil {
+						d.Lost(uc, err)
+					}
 				}
 			}
 		}
@@ -134,9 +166,9 @@ func (d *Driver) AcquireWithTTLRefresh(uc config.UseLocker, ttl, timeout time.Du
 }
 
 func (d *Driver) lockWait(uc config.UseLocker, timeout time.Duration, now time.Time, reason string) (bool, error) {
-	logrus.Warnf("Could not %s %q lock for %q", reason, uc.GetReason(), uc.GetVolume())
+	log.Warnf("Could not %s %q lock for %q", reason, uc.GetReason(), uc.GetVolume())
 	if timeout != 0 && (timeout == -1 || time.Since(now) < timeout) {
-		logrus.Warnf("Waiting 100ms for %q lock on %q to free", uc.GetReason(), uc.GetVolume())
+		log.Warnf("Waiting 100ms for %q lock on %q to free", uc.GetReason(), uc.GetVolume())
 		time.Sleep(wait.Jitter(100*time.Millisecond, 0))
 		return true, nil
 	} else if time.Since(now) >= timeout {
@@ -146,9 +178,13 @@ func (d *Driver) lockWait(uc config.UseLocker, timeout time.Duration, now time.T
 	return false, nil
 }
 
-func (d *Driver) clear(uc config.UseLocker, timeout time.Duration) error {
+func (d *Driver) clear(uc config.UseLocker, timeout time.Duration) (err error) {
 	now := time.Now()
 
+	span, _ := trace.StartChild(d.Config.Context(), "lock clear")
+	span.SetTag("volume", uc.GetVolume()).SetTag("reason", uc.GetReason())
+	defer func() { span.Finish(err) }()
+
 retry:
 	if err := d.Config.RemoveUse(uc, false); err != nil {
 		if ok, err := d.lockWait(uc, timeout, now, "remove"); ok && err == nil {
@@ -161,19 +197,72 @@ retry:
 	return nil
 }
 
-func (d *Driver) acquire(uc config.UseLocker, ttl, timeout time.Duration) error {
+func (d *Driver) acquireAll(ucs []config.UseLocker, timeout time.Duration) (err error) {
+	now := time.Now()
+
+	span, _ := trace.StartChild(d.Config.Context(), "lock acquire")
+	span.SetTag("volume", ucs[0].GetVolume()).SetTag("reason", ucs[0].GetReason())
+	defer func() { span.Finish(err) }()
+
+retry:
+	if err = d.Config.PublishUses(ucs); err != nil {
+		log.Warnf("Could not acquire %d locks for %q", len(ucs), ucs[0].GetVolume())
+
+		// each use held by someone else is waited on until it is free.
+		for _, uc := range d.contended(ucs) {
+			for {
+				if _, err := d.lockWait(uc, timeout, now, "publish"); err != nil {
+					metrics.LockFailures.Inc(uc.GetReason())
+					return err
+				}
+
+				if held, err := d.Config.UseHeld(uc); err == nil && !held {
+					break
+				}
+			}
+		}
+
+		goto retry
+	}
+
+	metrics.LockWaits.Since(now, ucs[0].GetReason())
+	return err
+}
+
+// contended returns the uses which are held by someone else. If none of them
+// are found to be, the first use is returned so the caller still waits
+// before trying again.
+func (d *Driver) contended(ucs []config.UseLocker) []config.UseLocker {
+	contended := []config.UseLocker{}
+
+	for _, uc := range ucs {
+		if held, err := d.Config.UseHeld(uc); err != nil || held {
+			contended = append(contended, uc)
+		}
+	}
+
+	if len(contended) == 0 {
+		return ucs[:1]
+	}
+
+	return contended
+}
+
+func (d *Driver) acquire(uc config.UseLocker, ttl, timeout time.Duration) (err error) {
 	now := time.Now()
 
-	var err error
+	span, _ := trace.StartChild(d.Config.Context(), "lock acquire")
+	span.SetTag("volume", uc.GetVolume()).SetTag("reason", uc.GetReason())
+	defer func() { span.Finish(err) }()
 
 retry:
 	if ttl != time.Duration(0) {
 		if err = d.Config.PublishUseWithTTL(uc, ttl); err != nil {
-			logrus.Debugf("Lock publish failed for %q with error: %v. Continuing.", uc, err)
+			log.Debugf("Lock publish failed for %q with error: %v. Continuing.", uc, err)
 		}
 	} else {
 		if err = d.Config.PublishUse(uc); err != nil {
-			logrus.Warnf("Could not acquire %q lock for %q", uc.GetReason(), uc.GetVolume())
+			log.Warnf("Could not acquire %q lock for %q", uc.GetReason(), uc.GetVolume())
 		}
 	}
 
@@ -181,9 +270,11 @@ retry:
 		if ok, err := d.lockWait(uc, timeout, now, "publish"); ok && err == nil {
 			goto retry
 		} else if err != nil {
+			metrics.LockFailures.Inc(uc.GetReason())
 			return err
 		}
 	}
 
+	metrics.LockWaits.Since(now, uc.GetReason())
 	return nil
 }
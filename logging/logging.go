@@ -0,0 +1,177 @@
+// Package logging provides the loggers of volplugin's subsystems and the
+// request IDs which correlate log lines across daemons.
+//
+// Each subsystem logs through its own logger, so its level can be set apart
+// from the others; every line it logs carries a "subsystem" field. Request
+// IDs are generated where a request enters the system, carried in a
+// context.Context and over HTTP in the X-Request-Id header, and added to the
+// log lines of the request by WithContext.
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// RequestIDHeader carries the request ID across HTTP calls.
+	RequestIDHeader = "X-Request-Id"
+
+	// FormatText logs human-readable lines; it is the default.
+	FormatText = "text"
+	// FormatJSON logs a JSON object per line.
+	FormatJSON = "json"
+
+	// DefaultSubsystem names the level of the subsystems which are not given
+	// one of their own.
+	DefaultSubsystem = "default"
+)
+
+type requestIDKey struct{}
+
+var (
+	loggers     = map[string]*logrus.Logger{}
+	loggerMutex sync.Mutex
+)
+
+// For returns the logger of the subsystem.
+func For(subsystem string) *logrus.Entry {
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+
+	logger, ok := loggers[subsystem]
+	if !ok {
+		std := logrus.StandardLogger()
+		logger = &logrus.Logger{
+			Out:       std.Out,
+			Hooks:     std.Hooks,
+			Formatter: std.Formatter,
+			Level:     std.Level,
+		}
+		loggers[subsystem] = logger
+	}
+
+	return logger.WithField("subsystem", subsystem)
+}
+
+// SetFormat sets the format of all log lines, FormatText or FormatJSON.
+func SetFormat(format string) error {
+	var formatter logrus.Formatter
+
+	switch format {
+	case "", FormatText:
+		formatter = &logrus.TextFormatter{}
+	case FormatJSON:
+		formatter = &logrus.JSONFormatter{}
+	default:
+		return errored.Errorf("Unknown log format %q", format)
+	}
+
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+
+	logrus.SetFormatter(formatter)
+	for _, logger := range loggers {
+		logger.Formatter = formatter
+	}
+
+	return nil
+}
+
+// ParseLevels validates a map of subsystem names to level names, as found in
+// the global configuration.
+func ParseLevels(levels map[string]string) (map[string]logrus.Level, error) {
+	parsed := map[string]logrus.Level{}
+
+	for subsystem, name := range levels {
+		level, err := logrus.ParseLevel(name)
+		if err != nil {
+			return nil, errored.Errorf("Invalid log level %q for subsystem %q", name, subsystem)
+		}
+		parsed[subsystem] = level
+	}
+
+	return parsed, nil
+}
+
+// SetLevels sets the level of each subsystem. Subsystems without a level of
+// their own, and logging outside of any subsystem, use the level given for
+// DefaultSubsystem; debug raises it to debug. Invalid levels are ignored.
+func SetLevels(debug bool, levels map[string]string) {
+	parsed, err := ParseLevels(levels)
+	if err != nil {
+		logrus.Errorf("Not setting log levels: %v", err)
+		parsed = map[string]logrus.Level{}
+	}
+
+	defaultLevel, ok := parsed[DefaultSubsystem]
+	if !ok {
+		defaultLevel = logrus.InfoLevel
+	}
+
+	if debug {
+		defaultLevel = logrus.DebugLevel
+	}
+
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+
+	logrus.SetLevel(defaultLevel)
+	for subsystem, logger := range loggers {
+		level, ok := parsed[subsystem]
+		if !ok {
+			level = defaultLevel
+		}
+		logger.Level = level
+	}
+}
+
+// NewRequestID returns a new request ID.
+func NewRequestID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// WithRequestID returns a context carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by the context, or "".
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithContext adds the request ID carried by the context, if any, to the
+// log entry.
+func WithContext(entry *logrus.Entry, ctx context.Context) *logrus.Entry {
+	if id := RequestID(ctx); id != "" {
+		return entry.WithField("request_id", id)
+	}
+
+	return entry
+}
+
+// WithResponse adds the request ID set in the response headers, if any, to
+// the log entry. It is used where the request context is not at hand, such as
+// in the writers of error responses.
+func WithResponse(entry *logrus.Entry, w http.ResponseWriter) *logrus.Entry {
+	if id := w.Header().Get(RequestIDHeader); id != "" {
+		return entry.WithField("request_id", id)
+	}
+
+	return entry
+}
@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	. "testing"
+
+	"github.com/Sirupsen/logrus"
+	. "gopkg.in/check.v1"
+
+	"golang.org/x/net/context"
+)
+
+type loggingSuite struct{}
+
+var _ = Suite(&loggingSuite{})
+
+func TestLogging(t *T) { TestingT(t) }
+
+func (s *loggingSuite) TestLevels(c *C) {
+	lock := For("lock")
+	api := For("api")
+
+	SetLevels(false, map[string]string{"lock": "debug"})
+	c.Assert(lock.Logger.Level, Equals, logrus.DebugLevel)
+	c.Assert(api.Logger.Level, Equals, logrus.InfoLevel)
+
+	SetLevels(false, map[string]string{DefaultSubsystem: "warn", "api": "error"})
+	c.Assert(lock.Logger.Level, Equals, logrus.WarnLevel)
+	c.Assert(api.Logger.Level, Equals, logrus.ErrorLevel)
+	c.Assert(logrus.GetLevel(), Equals, logrus.WarnLevel)
+
+	SetLevels(true, map[string]string{"api": "error"})
+	c.Assert(lock.Logger.Level, Equals, logrus.DebugLevel)
+	c.Assert(api.Logger.Level, Equals, logrus.ErrorLevel)
+
+	_, err := ParseLevels(map[string]string{"api": "loud"})
+	c.Assert(err, NotNil)
+
+	SetLevels(false, nil)
+}
+
+func (s *loggingSuite) TestJSONRequestID(c *C) {
+	c.Assert(SetFormat("xml"), NotNil)
+	c.Assert(SetFormat(FormatJSON), IsNil)
+	defer SetFormat(FormatText)
+
+	entry := For("apiserver")
+	buf := new(bytes.Buffer)
+	entry.Logger.Out = buf
+
+	ctx := WithRequestID(context.Background(), "abc123")
+	c.Assert(RequestID(ctx), Equals, "abc123")
+	c.Assert(RequestID(context.Background()), Equals, "")
+
+	WithContext(entry, ctx).Info("hello")
+
+	line := map[string]interface{}{}
+	c.Assert(json.Unmarshal(buf.Bytes(), &line), IsNil)
+	c.Assert(line["msg"], Equals, "hello")
+	c.Assert(line["subsystem"], Equals, "apiserver")
+	c.Assert(line["request_id"], Equals, "abc123")
+
+	w := httptest.NewRecorder()
+	w.Header().Set(RequestIDHeader, "def456")
+	c.Assert(WithResponse(entry, w).Data["request_id"], Equals, "def456")
+	c.Assert(WithResponse(entry, httptest.NewRecorder()).Data["request_id"], IsNil)
+}
+
+func (s *loggingSuite) TestRecent(c *C) {
+	entry := For("recent")
+	entry.Logger.Out = ioutil.Discard
+
+	for i := 0; i < RecentLines+5; i++ {
+		entry.Infof("line %d", i)
+	}
+
+	lines := Recent()
+	c.Assert(len(lines), Equals, RecentLines)
+	c.Assert(strings.Contains(lines[0], fmt.Sprintf("line %d", 5)), Equals, true)
+	c.Assert(strings.Contains(lines[len(lines)-1], fmt.Sprintf("line %d", RecentLines+4)), Equals, true)
+}
@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// RecentLines is the number of log lines kept for debug bundles.
+const RecentLines = 1000
+
+// recentHook keeps the last RecentLines lines logged, by any logger.
+type recentHook struct {
+	mutex sync.Mutex
+	lines []string
+	next  int
+}
+
+var recent = &recentHook{}
+
+func init() {
+	logrus.AddHook(recent)
+}
+
+func (h *recentHook) Levels() []logrus.Level {
+	return []logrus.Level{
+		logrus.PanicLevel,
+		logrus.FatalLevel,
+		logrus.ErrorLevel,
+		logrus.WarnLevel,
+		logrus.InfoLevel,
+		logrus.DebugLevel,
+	}
+}
+
+func (h *recentHook) Fire(entry *logrus.Entry) error {
+	line, err := entry.String()
+	if err != nil {
+		return err
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(h.lines) < RecentLines {
+		h.lines = append(h.lines, line)
+		return nil
+	}
+
+	h.lines[h.next] = line
+	h.next = (h.next + 1) % RecentLines
+	return nil
+}
+
+// Recent returns the most recently logged lines, oldest first. Each line ends
+// in a newline.
+func Recent() []string {
+	recent.mutex.Lock()
+	defer recent.mutex.Unlock()
+
+	lines := make([]string, 0, len(recent.lines))
+	lines = append(lines, recent.lines[recent.next:]...)
+	return append(lines, recent.lines[:recent.next]...)
+}
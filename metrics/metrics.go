@@ -0,0 +1,321 @@
+// Package metrics collects the counters, histograms and gauges of the
+// volplugin daemons and serves them in the Prometheus text exposition format
+// on /metrics. The format is written directly, as the Prometheus client library
+// is not among volplugin's dependencies.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/contiv/errored"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the latency histograms.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+type metric interface {
+	metricName() string
+	write(w io.Writer)
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      = map[string]metric{}
+)
+
+func register(m metric) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, ok := registry[m.metricName()]; ok {
+		panic(fmt.Sprintf("metric %q registered twice", m.metricName()))
+	}
+
+	registry[m.metricName()] = m
+}
+
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// labelEscaper escapes label values as the exposition format requires. Only
+// backslashes, double quotes and newlines are escaped; other characters are
+// written as they are, in UTF-8.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+func formatLabels(names, values []string, extra ...string) string {
+	pairs := []string{}
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, quoteLabel(values[i])))
+	}
+
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", extra[i], quoteLabel(extra[i+1])))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// CounterVec is a set of counters partitioned by label values.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mutex  sync.Mutex
+	values map[string]float64
+	keys   map[string][]string
+}
+
+// NewCounterVec creates and registers a counter with the label names.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: map[string]float64{},
+		keys:   map[string][]string{},
+	}
+
+	register(c)
+	return c
+}
+
+// Inc increments the counter for the label values.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds n to the counter for the label values.
+func (c *CounterVec) Add(n float64, values ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := labelKey(values)
+	c.values[key] += n
+	c.keys[key] = values
+}
+
+// Get returns the counter for the label values.
+func (c *CounterVec) Get(values ...string) float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.values[labelKey(values)]
+}
+
+func (c *CounterVec) metricName() string {
+	return c.name
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.keys) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, c.keys[key]), formatValue(c.values[key]))
+	}
+}
+
+type histogramValue struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec is a set of histograms partitioned by label values.
+type HistogramVec struct {
+	name    string
+	help    string
+	buckets []float64
+	labels  []string
+
+	mutex  sync.Mutex
+	values map[string]*histogramValue
+	keys   map[string][]string
+}
+
+// NewHistogramVec creates and registers a histogram with the bucket upper
+// bounds and label names.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		name:    name,
+		help:    help,
+		buckets: buckets,
+		labels:  labels,
+		values:  map[string]*histogramValue{},
+		keys:    map[string][]string{},
+	}
+
+	register(h)
+	return h
+}
+
+// Observe records a value for the label values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	key := labelKey(values)
+	hv, ok := h.values[key]
+	if !ok {
+		hv = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hv
+		h.keys[key] = values
+	}
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			hv.counts[i]++
+		}
+	}
+
+	hv.sum += v
+	hv.count++
+}
+
+// Since records the seconds elapsed since start for the label values.
+func (h *HistogramVec) Since(start time.Time, values ...string) {
+	h.Observe(time.Since(start).Seconds(), values...)
+}
+
+// Count returns the number of values observed for the label values.
+func (h *HistogramVec) Count(values ...string) uint64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if hv, ok := h.values[labelKey(values)]; ok {
+		return hv.count
+	}
+
+	return 0
+}
+
+func (h *HistogramVec) metricName() string {
+	return h.name
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	for _, key := range sortedKeys(h.keys) {
+		values := h.keys[key]
+		hv := h.values[key]
+
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, values, "le", formatValue(bound)), hv.counts[i])
+		}
+
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, values, "le", "+Inf"), hv.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, values), formatValue(hv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, values), hv.count)
+	}
+}
+
+// GaugeFunc is a gauge whose value is read when the metrics are collected.
+type GaugeFunc struct {
+	name string
+	help string
+	f    func() float64
+}
+
+// NewGaugeFunc creates and registers a gauge reading its value from f.
+func NewGaugeFunc(name, help string, f func() float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, f: f}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) metricName() string {
+	return g.name
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatValue(g.f()))
+}
+
+func sortedKeys(keys map[string][]string) []string {
+	sorted := []string{}
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+
+	sort.Strings(sorted)
+	return sorted
+}
+
+// Write writes all registered metrics in the text exposition format.
+func Write(w io.Writer) {
+	registryMutex.Lock()
+	names := []string{}
+	metrics := map[string]metric{}
+	for name, m := range registry {
+		names = append(names, name)
+		metrics[name] = m
+	}
+	registryMutex.Unlock()
+
+	sort.Strings(names)
+	for _, name := range names {
+		metrics[name].write(w)
+	}
+}
+
+// Handler serves the registered metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := new(bytes.Buffer)
+		Write(buf)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(buf.Bytes())
+	})
+}
+
+// ListenAndServe serves the metrics on /metrics at the listen address.
+func ListenAndServe(listen string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	return http.ListenAndServe(listen, mux)
+}
+
+// ErrorCategory returns the category of an error: the description of the
+// outermost errors.* value it was built from.
+func ErrorCategory(err error) string {
+	if erd, ok := err.(*errored.Error); ok {
+		return erd.String()
+	}
+
+	return "other"
+}
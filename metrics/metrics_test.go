@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	. "testing"
+	"time"
+
+	"github.com/contiv/errored"
+
+	. "gopkg.in/check.v1"
+)
+
+type metricsSuite struct{}
+
+var _ = Suite(&metricsSuite{})
+
+func TestMetrics(t *T) { TestingT(t) }
+
+var (
+	testCounter   = NewCounterVec("test_total", "A test counter.", "kind")
+	testHistogram = NewHistogramVec("test_seconds", "A test histogram.", []float64{1, 5}, "kind")
+	testGauge     = NewGaugeFunc("test_gauge", "A test gauge.", func() float64 { return 3 })
+)
+
+func (s *metricsSuite) TestWrite(c *C) {
+	testCounter.Inc("a")
+	testCounter.Add(2, "b")
+	testHistogram.Observe(0.5, "a")
+	testHistogram.Observe(3, "a")
+
+	c.Assert(testCounter.Get("b"), Equals, float64(2))
+	c.Assert(testHistogram.Count("a"), Equals, uint64(2))
+
+	buf := new(bytes.Buffer)
+	Write(buf)
+	out := buf.String()
+
+	for _, line := range []string{
+		"# TYPE test_total counter",
+		`test_total{kind="a"} 1`,
+		`test_total{kind="b"} 2`,
+		"# TYPE test_seconds histogram",
+		`test_seconds_bucket{kind="a",le="1"} 1`,
+		`test_seconds_bucket{kind="a",le="5"} 2`,
+		`test_seconds_bucket{kind="a",le="+Inf"} 2`,
+		`test_seconds_sum{kind="a"} 3.5`,
+		`test_seconds_count{kind="a"} 2`,
+		"# TYPE test_gauge gauge",
+		"test_gauge 3",
+	} {
+		c.Assert(strings.Contains(out, line+"\n"), Equals, true, Commentf("missing %q in:\n%s", line, out))
+	}
+
+	c.Assert(strings.Index(out, "test_gauge") < strings.Index(out, "test_seconds"), Equals, true)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	c.Assert(rec.Body.String(), Equals, out)
+}
+
+func (s *metricsSuite) TestLabelEscaping(c *C) {
+	c.Assert(formatLabels([]string{"kind"}, []string{"a\\b \"c\"\nd é"}), Equals, `{kind="a\\b \"c\"\nd é"}`)
+}
+
+func (s *metricsSuite) TestObserveOperation(c *C) {
+	category := errored.New("Mounting volume")
+
+	ObserveOperation("mount", time.Now(), nil)
+	ObserveOperation("mount", time.Now(), category.Combine(errored.New("device busy")))
+	ObserveOperation("mount", time.Now(), errored.New("Mounting volume"))
+
+	c.Assert(Operations.Count("mount"), Equals, uint64(3))
+	c.Assert(OperationErrors.Get("mount", "Mounting volume"), Equals, float64(2))
+	c.Assert(ErrorCategory(bytes.ErrTooLarge), Equals, "other")
+	c.Assert(Outcome(nil), Equals, "success")
+}
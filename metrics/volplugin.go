@@ -0,0 +1,52 @@
+package metrics
+
+import "time"
+
+// The metrics shared by the daemons. Each daemon only reports the ones
+// relevant to it.
+var (
+	// Operations is the latency of volume operations: mount, unmount, create,
+	// remove and so on.
+	Operations = NewHistogramVec("volplugin_operation_duration_seconds", "Latency of volume operations.", DefaultBuckets, "operation")
+	// OperationErrors counts failed volume operations by error category.
+	OperationErrors = NewCounterVec("volplugin_operation_errors_total", "Failed volume operations by error category.", "operation", "category")
+
+	// HTTPRequests is the latency of apiserver requests by route.
+	HTTPRequests = NewHistogramVec("volplugin_http_request_duration_seconds", "Latency of API requests.", DefaultBuckets, "method", "route")
+	// HTTPErrors counts API requests which failed, by error category.
+	HTTPErrors = NewCounterVec("volplugin_http_errors_total", "Failed API requests by error category.", "category")
+
+	// LockWaits is the time spent acquiring use locks.
+	LockWaits = NewHistogramVec("volplugin_lock_wait_seconds", "Time spent acquiring use locks.", DefaultBuckets, "reason")
+	// LockFailures counts use locks which could not be acquired.
+	LockFailures = NewCounterVec("volplugin_lock_failures_total", "Use locks which could not be acquired.", "reason")
+	// LockRefreshFailures counts failures to refresh TTL use locks.
+	LockRefreshFailures = NewCounterVec("volplugin_lock_refresh_failures_total", "Failures to refresh TTL use locks.", "reason")
+
+	// Snapshots counts snapshot creations and prunes by result.
+	Snapshots = NewCounterVec("volplugin_snapshot_operations_total", "Snapshot creations and prunes by result.", "operation", "result")
+
+	// DriverCommands is the duration of the commands storage drivers run.
+	DriverCommands = NewHistogramVec("volplugin_driver_command_duration_seconds", "Duration of storage driver commands.", DefaultBuckets, "command")
+
+	// WatchReconnects counts etcd watches which were re-established after an error.
+	WatchReconnects = NewCounterVec("volplugin_watch_reconnects_total", "etcd watches re-established after an error.", "path")
+)
+
+// ObserveOperation records the latency of an operation and, if it failed,
+// its error category.
+func ObserveOperation(operation string, start time.Time, err error) {
+	Operations.Since(start, operation)
+	if err != nil {
+		OperationErrors.Inc(operation, ErrorCategory(err))
+	}
+}
+
+// Outcome is the result label of an outcome.
+func Outcome(err error) string {
+	if err != nil {
+		return "failure"
+	}
+
+	return "success"
+}
@@ -0,0 +1,340 @@
+// Package reconcile compares the volume records kept in etcd with the images
+// the storage backends actually hold, and with the mounts present on a host.
+// It reports the differences between them and implements the repairs for
+// each kind of difference.
+//
+// Volumes with an operation in the journal are skipped; their records and
+// images are expected to disagree until the operation completes or is
+// recovered by the apiserver.
+package reconcile
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/logging"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/backend"
+)
+
+var log = logging.For("reconcile")
+
+// Image is an image found in a storage backend.
+type Image struct {
+	Backend string `json:"backend"`
+	Pool    string `json:"pool"`
+	Name    string `json:"name"`
+}
+
+// StaleMount is a mount lock held for a host which does not have the volume
+// mounted.
+type StaleMount struct {
+	Volume   string `json:"volume"`
+	Hostname string `json:"hostname"`
+	Backend  string `json:"backend"`
+}
+
+// Report is the result of a consistency check.
+type Report struct {
+	// OrphanedImages are images named like volplugin volumes which have no
+	// volume record.
+	OrphanedImages []*Image `json:"orphaned-images"`
+	// MissingImages are the volume records whose image does not exist.
+	MissingImages []string `json:"missing-images"`
+	// StaleMounts are the mount locks held for a host which does not have the
+	// volume mounted.
+	StaleMounts []*StaleMount `json:"stale-mounts"`
+}
+
+// Reconciler checks and repairs the consistency of volumes.
+type Reconciler struct {
+	Config   *config.Client
+	Hostname string
+	Timeout  time.Duration
+}
+
+func (i *Image) String() string {
+	return path.Join(i.Backend, i.Pool, i.Name)
+}
+
+func (i *Image) key() string {
+	return imageKey(i.Backend, i.Pool, i.Name)
+}
+
+func imageKey(backend, pool, name string) string {
+	return strings.Join([]string{backend, pool, name}, "\x00")
+}
+
+// Clean returns true if no inconsistencies were found.
+func (r *Report) Clean() bool {
+	return len(r.OrphanedImages) == 0 && len(r.MissingImages) == 0 && len(r.StaleMounts) == 0
+}
+
+func isNotExist(err error) bool {
+	erd, ok := err.(*errored.Error)
+	return ok && erd.Contains(errors.NotExists)
+}
+
+// volumes yields every volume record, keyed by volume name.
+func (r *Reconciler) volumes() (map[string]*config.Volume, error) {
+	names, err := r.Config.ListAllVolumes()
+	if err != nil {
+		return nil, errors.ListVolume.Combine(err)
+	}
+
+	volumes := map[string]*config.Volume{}
+
+	for _, name := range names {
+		parts := strings.SplitN(name, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		vol, err := r.Config.GetVolume(parts[0], parts[1])
+		if err != nil {
+			// removed since it was listed
+			if isNotExist(err) {
+				continue
+			}
+
+			return nil, errors.GetVolume.Combine(errored.New(name)).Combine(err)
+		}
+
+		volumes[name] = vol
+	}
+
+	return volumes, nil
+}
+
+// busy yields the volumes which have an operation in the journal.
+func (r *Reconciler) busy() (map[string]struct{}, error) {
+	busy := map[string]struct{}{}
+
+	ops, err := r.Config.ListOperations()
+	if err != nil {
+		if isNotExist(err) {
+			return busy, nil
+		}
+
+		return nil, errors.ListOperation.Combine(err)
+	}
+
+	for _, op := range ops {
+		busy[op.Volume.String()] = struct{}{}
+	}
+
+	return busy, nil
+}
+
+// images lists the images in every pool used by a policy or a volume. Any
+// failure to list a pool is an error; a partial list would report every
+// volume in the pool as missing its image.
+func (r *Reconciler) images(volumes map[string]*config.Volume) ([]*Image, error) {
+	pools := map[string]map[string]struct{}{}
+
+	addPool := func(backends *config.BackendDrivers, driverOpts map[string]string) {
+		if backends == nil || backends.CRUD == "" || driverOpts["pool"] == "" {
+			return
+		}
+
+		if _, ok := pools[backends.CRUD]; !ok {
+			pools[backends.CRUD] = map[string]struct{}{}
+		}
+
+		pools[backends.CRUD][driverOpts["pool"]] = struct{}{}
+	}
+
+	policies, err := r.Config.ListPolicies()
+	if err != nil && !isNotExist(err) {
+		return nil, errors.ListPolicy.Combine(err)
+	}
+
+	for _, policy := range policies {
+		addPool(policy.Backends, policy.DriverOptions)
+	}
+
+	for _, vol := range volumes {
+		addPool(vol.Backends, vol.DriverOptions)
+	}
+
+	images := []*Image{}
+
+	for backendName, poolNames := range pools {
+		driver, err := backend.NewCRUDDriver(backendName)
+		if err != nil {
+			return nil, err
+		}
+
+		for pool := range poolNames {
+			list, err := driver.List(storage.ListOptions{Params: storage.Params{"pool": pool}})
+			if err != nil {
+				return nil, errored.Errorf("Listing pool %q of backend %q: %v", pool, backendName, err)
+			}
+
+			for _, vol := range list {
+				images = append(images, &Image{Backend: backendName, Pool: pool, Name: vol.Name})
+			}
+		}
+	}
+
+	return images, nil
+}
+
+// CheckImages compares the volume records with the images held by the
+// storage backends.
+func (r *Reconciler) CheckImages() (*Report, error) {
+	volumes, err := r.volumes()
+	if err != nil {
+		return nil, errors.Reconcile.Combine(err)
+	}
+
+	busy, err := r.busy()
+	if err != nil {
+		return nil, errors.Reconcile.Combine(err)
+	}
+
+	images, err := r.images(volumes)
+	if err != nil {
+		return nil, errors.Reconcile.Combine(err)
+	}
+
+	return compareImages(volumes, images, busy), nil
+}
+
+// compareImages yields the orphaned images and the volumes with missing
+// images. Images which are not named policy/volume were not created by
+// volplugin and are ignored.
+func compareImages(volumes map[string]*config.Volume, images []*Image, busy map[string]struct{}) *Report {
+	report := &Report{OrphanedImages: []*Image{}, MissingImages: []string{}, StaleMounts: []*StaleMount{}}
+	found := map[string]struct{}{}
+
+	for _, image := range images {
+		found[image.key()] = struct{}{}
+
+		if _, ok := busy[image.Name]; ok || !strings.Contains(image.Name, "/") {
+			continue
+		}
+
+		vol, ok := volumes[image.Name]
+		if ok && vol.Backends != nil && vol.Backends.CRUD == image.Backend && vol.DriverOptions["pool"] == image.Pool {
+			continue
+		}
+
+		report.OrphanedImages = append(report.OrphanedImages, image)
+	}
+
+	for name, vol := range volumes {
+		if _, ok := busy[name]; ok || vol.Backends == nil || vol.Backends.CRUD == "" {
+			continue
+		}
+
+		if _, ok := found[imageKey(vol.Backends.CRUD, vol.DriverOptions["pool"], name)]; !ok {
+			report.MissingImages = append(report.MissingImages, name)
+		}
+	}
+
+	sort.Sort(imageList(report.OrphanedImages))
+	sort.Strings(report.MissingImages)
+
+	return report
+}
+
+// CheckMounts compares the mount locks held for this host with the volumes
+// the mount drivers report as mounted.
+func (r *Reconciler) CheckMounts(mountPath string) ([]*StaleMount, error) {
+	stale := []*StaleMount{}
+
+	uses, err := r.Config.ListUses(config.UseTypeMount)
+	if err != nil {
+		if isNotExist(err) {
+			return stale, nil
+		}
+
+		return nil, errors.Reconcile.Combine(err)
+	}
+
+	mounted := map[string]map[string]struct{}{}
+
+	for _, name := range uses {
+		um, vol, err := r.mountUse(name)
+		if err != nil {
+			if isNotExist(err) {
+				continue
+			}
+
+			return nil, errors.Reconcile.Combine(err)
+		}
+
+		if um.Hostname != r.Hostname || um.Reason != lock.ReasonMount || vol.Backends == nil || vol.Backends.Mount == "" {
+			continue
+		}
+
+		if _, ok := mounted[vol.Backends.Mount]; !ok {
+			names, err := r.mounted(vol.Backends.Mount, mountPath)
+			if err != nil {
+				return nil, errors.Reconcile.Combine(err)
+			}
+
+			mounted[vol.Backends.Mount] = names
+		}
+
+		if _, ok := mounted[vol.Backends.Mount][name]; !ok {
+			stale = append(stale, &StaleMount{Volume: name, Hostname: um.Hostname, Backend: vol.Backends.Mount})
+		}
+	}
+
+	return stale, nil
+}
+
+// mountUse retrieves the mount lock and the volume record for the volume.
+func (r *Reconciler) mountUse(name string) (*config.UseMount, *config.Volume, error) {
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) != 2 {
+		return nil, nil, errored.Errorf("Invalid volume name %q", name)
+	}
+
+	vol, err := r.Config.GetVolume(parts[0], parts[1])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	um := &config.UseMount{}
+	if err := r.Config.GetUse(um, vol); err != nil {
+		return nil, nil, err
+	}
+
+	return um, vol, nil
+}
+
+// mounted yields the names of the volumes the mount driver has mounted.
+func (r *Reconciler) mounted(backendName, mountPath string) (map[string]struct{}, error) {
+	driver, err := backend.NewMountDriver(backendName, mountPath)
+	if err != nil {
+		return nil, err
+	}
+
+	mounts, err := driver.Mounted(r.Timeout)
+	if err != nil {
+		return nil, errors.ErrMountScan.Combine(err)
+	}
+
+	names := map[string]struct{}{}
+	for _, mount := range mounts {
+		log.Debugf("Volume %q is mounted at %q", mount.Volume.Name, mount.Path)
+		names[mount.Volume.Name] = struct{}{}
+	}
+
+	return names, nil
+}
+
+type imageList []*Image
+
+func (il imageList) Len() int           { return len(il) }
+func (il imageList) Swap(i, j int)      { il[i], il[j] = il[j], il[i] }
+func (il imageList) Less(i, j int) bool { return il[i].String() < il[j].String() }
@@ -0,0 +1,58 @@
+package reconcile
+
+import (
+	. "testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/config"
+)
+
+type reconcileSuite struct{}
+
+var _ = Suite(&reconcileSuite{})
+
+func TestReconcile(t *T) { TestingT(t) }
+
+func cephVolume(policy, name, pool string) *config.Volume {
+	return &config.Volume{
+		PolicyName:    policy,
+		VolumeName:    name,
+		DriverOptions: map[string]string{"pool": pool},
+		Backends:      &config.BackendDrivers{CRUD: "ceph", Mount: "ceph", Snapshot: "ceph"},
+	}
+}
+
+func (s *reconcileSuite) TestCompareImages(c *C) {
+	volumes := map[string]*config.Volume{
+		"policy1/present":  cephVolume("policy1", "present", "rbd"),
+		"policy1/missing":  cephVolume("policy1", "missing", "rbd"),
+		"policy1/moved":    cephVolume("policy1", "moved", "rbd"),
+		"policy1/creating": cephVolume("policy1", "creating", "rbd"),
+		"policy1/nfs": {
+			PolicyName: "policy1",
+			VolumeName: "nfs",
+			Backends:   &config.BackendDrivers{Mount: "nfs"},
+		},
+	}
+
+	images := []*Image{
+		{Backend: "ceph", Pool: "rbd", Name: "policy1/present"},
+		{Backend: "ceph", Pool: "other", Name: "policy1/moved"},
+		{Backend: "ceph", Pool: "rbd", Name: "policy1/orphan"},
+		{Backend: "ceph", Pool: "rbd", Name: "not-volplugin"},
+	}
+
+	busy := map[string]struct{}{"policy1/creating": {}}
+
+	report := compareImages(volumes, images, busy)
+	c.Assert(report.Clean(), Equals, false)
+	c.Assert(report.MissingImages, DeepEquals, []string{"policy1/missing", "policy1/moved"})
+	c.Assert(report.OrphanedImages, DeepEquals, []*Image{
+		{Backend: "ceph", Pool: "other", Name: "policy1/moved"},
+		{Backend: "ceph", Pool: "rbd", Name: "policy1/orphan"},
+	})
+
+	report = compareImages(map[string]*config.Volume{"policy1/present": volumes["policy1/present"]}, images[:1], map[string]struct{}{})
+	c.Assert(report.Clean(), Equals, true)
+}
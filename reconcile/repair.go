@@ -0,0 +1,198 @@
+package reconcile
+
+import (
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/backend"
+	"github.com/contiv/volplugin/storage/control"
+)
+
+// repairLocks yields the locks taken while repairing the volume. They fail
+// to acquire if the volume is mounted or in use by any other operation.
+func (r *Reconciler) repairLocks(volume string) []config.UseLocker {
+	return []config.UseLocker{
+		&config.UseMount{Volume: volume, Reason: lock.ReasonRepair, Hostname: r.Hostname},
+		&config.UseSnapshot{Volume: volume, Reason: lock.ReasonRepair},
+	}
+}
+
+// Adopt publishes a volume record for an orphaned image, using the defaults
+// of the policy named by the image.
+func (r *Reconciler) Adopt(image *Image) error {
+	parts := strings.SplitN(image.Name, "/", 2)
+	if len(parts) != 2 {
+		return errors.Repair.Combine(errored.Errorf("Image %q is not named after a volume", image))
+	}
+
+	vol, err := r.Config.CreateVolume(&config.VolumeRequest{Policy: parts[0], Name: parts[1]})
+	if err != nil {
+		return errors.Repair.Combine(errored.New(image.Name)).Combine(err)
+	}
+
+	if vol.Backends == nil || vol.Backends.CRUD != image.Backend {
+		return errors.Repair.Combine(errored.Errorf("Policy %q does not use backend %q for image %q", parts[0], image.Backend, image))
+	}
+
+	driverOpts := map[string]string{}
+	for key, value := range vol.DriverOptions {
+		driverOpts[key] = value
+	}
+
+	driverOpts["pool"] = image.Pool
+	vol.DriverOptions = driverOpts
+
+	return lock.NewDriver(r.Config).ExecuteWithMultiUseLock(r.repairLocks(image.Name), 0, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		log.Infof("Adopting image %q as volume %q", image, vol)
+
+		// the image exists already, so it is counted even over the quota.
+		usage, err := config.VolumeUsage(vol)
+		if err != nil {
+			return errors.Repair.Combine(errored.New(image.Name)).Combine(err)
+		}
+
+		if usage.Snapshots, err = control.CountSnapshots(vol, r.Timeout); err != nil {
+			log.Warnf("Could not count snapshots of adopted image %q: %v", image, err)
+		}
+
+		if err := r.Config.ReservePolicyUsage(vol.PolicyName, nil, usage); err != nil {
+			return errors.Repair.Combine(errored.New(image.Name)).Combine(err)
+		}
+
+		if err := r.Config.PublishVolume(vol); err != nil {
+			if rerr := r.Config.ReleasePolicyUsage(vol.PolicyName, usage); rerr != nil {
+				log.Warnf("Could not release usage of image %q: %v", image, rerr)
+			}
+			return errors.Repair.Combine(errored.New(image.Name)).Combine(err)
+		}
+
+		return nil
+	})
+}
+
+// RemoveRecord removes the record of a volume whose image does not exist. The
+// image is checked again once the locks are held.
+func (r *Reconciler) RemoveRecord(volume string) error {
+	parts := strings.SplitN(volume, "/", 2)
+	if len(parts) != 2 {
+		return errors.Repair.Combine(errored.Errorf("Invalid volume name %q", volume))
+	}
+
+	vol, err := r.Config.GetVolume(parts[0], parts[1])
+	if err != nil {
+		return errors.Repair.Combine(errored.New(volume)).Combine(err)
+	}
+
+	return lock.NewDriver(r.Config).ExecuteWithMultiUseLock(r.repairLocks(volume), 0, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		exists, err := control.ExistsVolume(vol, r.Timeout)
+		if err != nil && err != errors.NoActionTaken {
+			return errors.Repair.Combine(errored.New(volume)).Combine(err)
+		}
+
+		if exists {
+			return errors.Repair.Combine(errored.Errorf("Image for volume %q exists", volume))
+		}
+
+		log.Infof("Removing record of volume %q with missing image", volume)
+
+		if err := r.Config.RemoveVolume(vol.PolicyName, vol.VolumeName); err != nil {
+			return errors.Repair.Combine(errors.ClearVolume).Combine(err)
+		}
+
+		// the snapshots of the missing image cannot be counted, so the usage
+		// of the policy is recounted rather than released.
+		if _, err := r.Config.RecountPolicyUsage(vol.PolicyName, r.countSnapshots); err != nil {
+			log.Warnf("Could not recount usage of policy %q: %v", vol.PolicyName, err)
+		}
+
+		return nil
+	})
+}
+
+// countSnapshots counts the snapshots of a volume for a recount of its
+// policy's usage.
+func (r *Reconciler) countSnapshots(vc *config.Volume) (uint64, error) {
+	return control.CountSnapshots(vc, r.Timeout)
+}
+
+// releaseTTL is added to the timeout to expire the mount lock taken over by
+// ReleaseMount, should it not finish.
+const releaseTTL = time.Minute
+
+// ReleaseMount unmaps the volume on this host and releases its stale mount
+// lock. The mount lock is taken over for the repair first, so a mount of the
+// volume started meanwhile fails instead of being unmapped. The host mounts
+// are checked again once it is held, and the snapshot lock is held so the
+// volume is not snapshotted meanwhile. This must run on the host named by the
+// stale mount.
+func (r *Reconciler) ReleaseMount(sm *StaleMount, mountPath string) error {
+	if sm.Hostname != r.Hostname {
+		return errors.Repair.Combine(errored.Errorf("Mount of %q belongs to host %q, not %q", sm.Volume, sm.Hostname, r.Hostname))
+	}
+
+	um, vol, err := r.mountUse(sm.Volume)
+	if err != nil {
+		return errors.Repair.Combine(errored.New(sm.Volume)).Combine(err)
+	}
+
+	if um.Hostname != r.Hostname || um.Reason != lock.ReasonMount {
+		return errors.Repair.Combine(errored.Errorf("Mount lock of %q has changed", sm.Volume))
+	}
+
+	repair := &config.UseMount{Volume: sm.Volume, Reason: lock.ReasonRepair, Hostname: r.Hostname}
+	if err := r.Config.ReserveUse(um, repair, r.Timeout+releaseTTL); err != nil {
+		return errors.Repair.Combine(errored.Errorf("Mount lock of %q has changed", sm.Volume)).Combine(err)
+	}
+
+	us := &config.UseSnapshot{Volume: sm.Volume, Reason: lock.ReasonRepair}
+	unmapped := false
+
+	err = lock.NewDriver(r.Config).ExecuteWithMultiUseLock([]config.UseLocker{us}, 0, func(ld *lock.Driver, ucs []config.UseLocker) error {
+		names, err := r.mounted(sm.Backend, mountPath)
+		if err != nil {
+			return errors.Repair.Combine(err)
+		}
+
+		if _, ok := names[sm.Volume]; ok {
+			return errors.Repair.Combine(errored.Errorf("Volume %q is mounted", sm.Volume))
+		}
+
+		driver, err := backend.NewMountDriver(sm.Backend, mountPath)
+		if err != nil {
+			return errors.Repair.Combine(err)
+		}
+
+		do := storage.DriverOptions{
+			Volume:  storage.Volume{Name: vol.String(), Params: vol.DriverOptions},
+			Timeout: r.Timeout,
+		}
+
+		log.Infof("Unmapping volume %q and releasing its stale mount lock", sm.Volume)
+
+		if err := driver.Unmount(do); err != nil {
+			return errors.Repair.Combine(errors.UnmountFailed).Combine(err)
+		}
+
+		unmapped = true
+		return nil
+	})
+
+	// the stale lock is put back unless the volume was unmapped.
+	if !unmapped {
+		if rerr := r.Config.ReserveUse(repair, um, 0); rerr != nil {
+			log.Errorf("Could not restore mount lock of %q: %v", sm.Volume, rerr)
+		}
+		return err
+	}
+
+	if err := r.Config.RemoveUse(repair, false); err != nil {
+		return errors.Repair.Combine(errors.LockMismatch).Combine(err)
+	}
+
+	return nil
+}
@@ -1,6 +1,8 @@
 package backend
 
 import (
+	"os/exec"
+
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/storage"
 	"github.com/contiv/volplugin/storage/backend/ceph"
@@ -31,6 +33,38 @@ var SnapshotDrivers = map[string]func() (storage.SnapshotDriver, error){
 	ceph.BackendName: ceph.NewSnapshotDriver,
 }
 
+// MountPrograms are the programs each mount driver needs on the host. The
+// nfs driver mounts with a system call, but needs the NFS client utilities
+// which provide mount.nfs.
+var MountPrograms = map[string][]string{
+	ceph.BackendName: {"rbd"},
+	nfs.BackendName:  {"mount.nfs"},
+}
+
+// MissingPrograms returns the programs the mount driver needs which are not
+// installed on this host.
+func MissingPrograms(backend string) []string {
+	missing := []string{}
+
+	for _, program := range MountPrograms[backend] {
+		if _, err := exec.LookPath(program); err != nil {
+			missing = append(missing, program)
+		}
+	}
+
+	return missing
+}
+
+// MountAvailable is true if the mount driver exists and the programs it needs
+// are installed on this host.
+func MountAvailable(backend string) bool {
+	if _, ok := MountDrivers[backend]; !ok {
+		return false
+	}
+
+	return len(MissingPrograms(backend)) == 0
+}
+
 // NewMountDriver instantiates and return a mount driver instance of the
 // specified type
 func NewMountDriver(backend, mountpath string) (storage.MountDriver, error) {
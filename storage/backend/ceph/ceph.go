@@ -15,14 +15,18 @@ import (
 	"golang.org/x/net/context"
 	"golang.org/x/sys/unix"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/contiv/errored"
 	"github.com/contiv/executor"
 	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/logging"
+	"github.com/contiv/volplugin/metrics"
 	"github.com/contiv/volplugin/storage"
 	"github.com/contiv/volplugin/storage/mountscan"
+	"github.com/contiv/volplugin/trace"
 )
 
+var log = logging.For("storage")
+
 const (
 	// BackendName is string for ceph storage backend
 	BackendName = "ceph"
@@ -57,8 +61,29 @@ func mkpool(poolName, volumeName string) string {
 	return fmt.Sprintf("%s/%s", poolName, volumeName)
 }
 
-func runWithTimeout(cmd *exec.Cmd, timeout time.Duration) (*executor.ExecResult, error) {
-	ctx, _ := context.WithTimeout(context.Background(), timeout)
+func runWithTimeout(ctx context.Context, cmd *exec.Cmd, timeout time.Duration) (*executor.ExecResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return run(ctx, cmd)
+}
+
+// run runs the command, recording its duration by the command and its
+// subcommand, e.g. "rbd map", and tracing it if the context is traced.
+func run(ctx context.Context, cmd *exec.Cmd) (er *executor.ExecResult, err error) {
+	name := filepath.Base(cmd.Args[0])
+	if len(cmd.Args) > 1 {
+		name += " " + cmd.Args[1]
+	}
+
+	span, _ := trace.StartChild(ctx, name)
+	span.SetTag("command", strings.Join(cmd.Args, " "))
+	defer func() { span.Finish(err) }()
+
+	defer metrics.DriverCommands.Since(time.Now(), name)
 	return executor.NewCapture(cmd).Run(ctx)
 }
 
@@ -116,7 +141,7 @@ func (c *Driver) Create(do storage.DriverOptions) error {
 	}
 
 	cmd := exec.Command("rbd", "create", mkpool(do.Volume.Params["pool"], intName), "--size", strconv.FormatUint(do.Volume.Size, 10))
-	er, err := runWithTimeout(cmd, do.Timeout)
+	er, err := runWithTimeout(do.Context, cmd, do.Timeout)
 
 	if er != nil {
 		if er.ExitStatus == 17 {
@@ -138,9 +163,9 @@ func (c *Driver) Format(do storage.DriverOptions) error {
 		return err
 	}
 
-	if err := c.mkfsVolume(do.FSOptions.CreateCommand, device, do.Timeout); err != nil {
+	if err := c.mkfsVolume(do.Context, do.FSOptions.CreateCommand, device, do.Timeout); err != nil {
 		if err := c.unmapImage(do); err != nil {
-			logrus.Errorf("Error while trying to unmap after failed filesystem creation: %v", err)
+			log.Errorf("Error while trying to unmap after failed filesystem creation: %v", err)
 		}
 		return err
 	}
@@ -157,13 +182,13 @@ func (c *Driver) Destroy(do storage.DriverOptions) error {
 	}
 
 	cmd := exec.Command("rbd", "snap", "purge", mkpool(poolName, intName))
-	er, _ := runWithTimeout(cmd, do.Timeout)
+	er, _ := runWithTimeout(do.Context, cmd, do.Timeout)
 	if er.ExitStatus != 0 {
 		return errored.Errorf("Destroying snapshots for disk %q: %v", intName, er.Stderr)
 	}
 
 	cmd = exec.Command("rbd", "rm", mkpool(poolName, intName))
-	er, _ = runWithTimeout(cmd, do.Timeout)
+	er, _ = runWithTimeout(do.Context, cmd, do.Timeout)
 	if er.ExitStatus != 0 {
 		return errored.Errorf("Destroying disk %q: %v (%v)", intName, er, er.Stdout)
 	}
@@ -176,7 +201,7 @@ func (c *Driver) List(lo storage.ListOptions) ([]storage.Volume, error) {
 	poolName := lo.Params["pool"]
 
 retry:
-	er, err := executor.NewCapture(exec.Command("rbd", "ls", poolName, "--format", "json")).Run(context.Background())
+	er, err := run(context.Background(), exec.Command("rbd", "ls", poolName, "--format", "json"))
 	if err != nil {
 		return nil, err
 	}
@@ -188,7 +213,7 @@ retry:
 	textList := []string{}
 
 	if err := json.Unmarshal([]byte(er.Stdout), &textList); err != nil {
-		logrus.Errorf("Unmarshalling ls for pool %q: %v. Retrying.", poolName, err)
+		log.Errorf("Unmarshalling ls for pool %q: %v. Retrying.", poolName, err)
 		time.Sleep(100 * time.Millisecond)
 		goto retry
 	}
@@ -245,7 +270,10 @@ func (c *Driver) Mount(do storage.DriverOptions) (*storage.Mount, error) {
 	minor := rdev & 0xFF
 
 	// Mount the RBD
-	if err := unix.Mount(devName, volumePath, do.FSOptions.Type, 0, ""); err != nil {
+	start := time.Now()
+	err = unix.Mount(devName, volumePath, do.FSOptions.Type, 0, "")
+	metrics.DriverCommands.Since(start, "mount")
+	if err != nil {
 		return nil, errored.Errorf("Failed to mount RBD dev %q: %v", devName, err)
 	}
 
@@ -277,9 +305,12 @@ func (c *Driver) Unmount(do storage.DriverOptions) error {
 
 retry:
 	if retries < 3 {
-		if err := unix.Unmount(volumeDir, 0); err != nil && err != unix.ENOENT && err != unix.EINVAL {
+		start := time.Now()
+		err := unix.Unmount(volumeDir, 0)
+		metrics.DriverCommands.Since(start, "umount")
+		if err != nil && err != unix.ENOENT && err != unix.EINVAL {
 			lastErr = errored.Errorf("Failed to unmount %q (retrying): %v", volumeDir, err)
-			logrus.Error(lastErr)
+			log.Error(lastErr)
 			retries++
 			time.Sleep(100 * time.Millisecond)
 			goto retry
@@ -291,7 +322,7 @@ retry:
 	// Remove the mounted directory
 	// FIXME remove all, but only after the FIXME above.
 	if err := os.Remove(volumeDir); err != nil && !os.IsNotExist(err) {
-		logrus.Error(errored.Errorf("error removing %q directory: %v", volumeDir, err))
+		log.Error(errored.Errorf("error removing %q directory: %v", volumeDir, err))
 		goto retry
 	}
 
@@ -309,8 +340,15 @@ func (c *Driver) Exists(do storage.DriverOptions) (bool, error) {
 		return false, err
 	}
 
+	// names without a policy are images named outside of volplugin; List
+	// yields those by their external name too.
+	name := do.Volume.Name
+	if !strings.Contains(name, "/") {
+		name = c.externalName(name)
+	}
+
 	for _, vol := range volumes {
-		if vol.Name == do.Volume.Name {
+		if vol.Name == name {
 			return true, nil
 		}
 	}
@@ -318,6 +356,114 @@ func (c *Driver) Exists(do storage.DriverOptions) (bool, error) {
 	return false, nil
 }
 
+// InternalName yields the name of the RBD image for the volume.
+func (c *Driver) InternalName(s string) (string, error) {
+	return c.internalName(s)
+}
+
+// Rename renames an RBD image in the pool to the image of the volume.
+func (c *Driver) Rename(do storage.DriverOptions, image string) error {
+	intName, err := c.internalName(do.Volume.Name)
+	if err != nil {
+		return err
+	}
+
+	poolName := do.Volume.Params["pool"]
+
+	cmd := exec.Command("rbd", "rename", mkpool(poolName, image), mkpool(poolName, intName))
+	er, err := runWithTimeout(do.Context, cmd, do.Timeout)
+	if err != nil {
+		return err
+	}
+
+	if er.ExitStatus != 0 {
+		return errored.Errorf("Renaming image %q to %q in pool %q: %v", image, intName, poolName, er)
+	}
+
+	return nil
+}
+
+type rbdInfo struct {
+	Size uint64 `json:"size"`
+}
+
+// Size reports the size of an RBD image in the pool, in the megabytes images
+// are created with, rounded up.
+func (c *Driver) Size(do storage.DriverOptions, image string) (uint64, error) {
+	poolName := do.Volume.Params["pool"]
+
+	cmd := exec.Command("rbd", "info", "--format", "json", mkpool(poolName, image))
+	er, err := runWithTimeout(do.Context, cmd, do.Timeout)
+	if err != nil {
+		return 0, err
+	}
+
+	if er.ExitStatus != 0 {
+		return 0, errored.Errorf("Reading size of image %q in pool %q: %v", image, poolName, er)
+	}
+
+	return parseInfo(er.Stdout)
+}
+
+func parseInfo(content string) (uint64, error) {
+	info := rbdInfo{}
+	if err := json.Unmarshal([]byte(content), &info); err != nil {
+		return 0, errored.Errorf("Parsing rbd info output: %v", err)
+	}
+
+	// rbd sizes are in binary megabytes.
+	const mb = 1024 * 1024
+	return (info.Size + mb - 1) / mb, nil
+}
+
+type rbdDu struct {
+	Images []struct {
+		Name        string `json:"name"`
+		Snapshot    string `json:"snapshot"`
+		Provisioned uint64 `json:"provisioned_size"`
+	} `json:"images"`
+	TotalUsed uint64 `json:"total_used_size"`
+}
+
+// Usage reports the provisioned size of the volume's image and the space it
+// and its snapshots actually use, as reported by `rbd du`.
+func (c *Driver) Usage(do storage.DriverOptions) (*storage.ImageUsage, error) {
+	intName, err := c.internalName(do.Volume.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	poolName := do.Volume.Params["pool"]
+
+	cmd := exec.Command("rbd", "du", "--format", "json", mkpool(poolName, intName))
+	er, err := runWithTimeout(do.Context, cmd, do.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if er.ExitStatus != 0 {
+		return nil, errored.Errorf("Reading usage of image %q in pool %q: %v", intName, poolName, er)
+	}
+
+	return parseDu(er.Stdout)
+}
+
+func parseDu(content string) (*storage.ImageUsage, error) {
+	du := rbdDu{}
+	if err := json.Unmarshal([]byte(content), &du); err != nil {
+		return nil, errored.Errorf("Parsing rbd du output: %v", err)
+	}
+
+	usage := &storage.ImageUsage{Used: du.TotalUsed}
+	for _, image := range du.Images {
+		if image.Snapshot == "" {
+			usage.Provisioned = image.Provisioned
+		}
+	}
+
+	return usage, nil
+}
+
 // CreateSnapshot creates a named snapshot for the volume. Any error will be returned.
 func (c *Driver) CreateSnapshot(snapName string, do storage.DriverOptions) error {
 	intName, err := c.internalName(do.Volume.Name)
@@ -329,7 +475,7 @@ func (c *Driver) CreateSnapshot(snapName string, do storage.DriverOptions) error
 
 	snapName = strings.Replace(snapName, " ", "-", -1)
 	cmd := exec.Command("rbd", "snap", "create", mkpool(poolName, intName), "--snap", snapName)
-	er, err := runWithTimeout(cmd, do.Timeout)
+	er, err := runWithTimeout(do.Context, cmd, do.Timeout)
 	if err != nil {
 		return err
 	}
@@ -351,7 +497,7 @@ func (c *Driver) RemoveSnapshot(snapName string, do storage.DriverOptions) error
 	poolName := do.Volume.Params["pool"]
 
 	cmd := exec.Command("rbd", "snap", "rm", mkpool(poolName, intName), "--snap", snapName)
-	er, err := runWithTimeout(cmd, do.Timeout)
+	er, err := runWithTimeout(do.Context, cmd, do.Timeout)
 	if err != nil {
 		return err
 	}
@@ -374,8 +520,7 @@ func (c *Driver) ListSnapshots(do storage.DriverOptions) ([]string, error) {
 	poolName := do.Volume.Params["pool"]
 
 	cmd := exec.Command("rbd", "snap", "ls", mkpool(poolName, intName))
-	ctx, _ := context.WithTimeout(context.Background(), do.Timeout)
-	er, err := executor.NewCapture(cmd).Run(ctx)
+	er, err := runWithTimeout(do.Context, cmd, do.Timeout)
 	if err != nil {
 		return nil, err
 	}
@@ -404,13 +549,13 @@ func (c *Driver) ListSnapshots(do storage.DriverOptions) ([]string, error) {
 func (c *Driver) cleanupCopy(snapName, newName string, do storage.DriverOptions, errChan chan error) {
 	intOrigName, err := c.internalName(do.Volume.Name)
 	if err != nil {
-		logrus.Error(err)
+		log.Error(err)
 		return
 	}
 
 	intNewName, err := c.internalName(newName)
 	if err != nil {
-		logrus.Error(err)
+		log.Error(err)
 		return
 	}
 
@@ -420,19 +565,19 @@ func (c *Driver) cleanupCopy(snapName, newName string, do storage.DriverOptions,
 	case err := <-errChan:
 		newerr, ok := err.(*errored.Error)
 		if ok && newerr.Contains(errors.SnapshotCopy) {
-			logrus.Warnf("Error received while copying snapshot %q: %v. Attempting to cleanup... Snapshot %q may still be protected!", do.Volume.Name, err, snapName)
+			log.Warnf("Error received while copying snapshot %q: %v. Attempting to cleanup... Snapshot %q may still be protected!", do.Volume.Name, err, snapName)
 			cmd := exec.Command("rbd", "rm", mkpool(poolName, intNewName))
-			if er, err := runWithTimeout(cmd, do.Timeout); err != nil || er.ExitStatus != 0 {
-				logrus.Errorf("Error encountered removing new volume %q for volume %q, snapshot %q: %v, %v", intNewName, intOrigName, snapName, err, er.Stderr)
+			if er, err := runWithTimeout(do.Context, cmd, do.Timeout); err != nil || er.ExitStatus != 0 {
+				log.Errorf("Error encountered removing new volume %q for volume %q, snapshot %q: %v, %v", intNewName, intOrigName, snapName, err, er.Stderr)
 				return
 			}
 		}
 
 		if ok && newerr.Contains(errors.SnapshotProtect) {
-			logrus.Warnf("Error received protecting snapshot %q: %v. Attempting to cleanup.", do.Volume.Name, err)
+			log.Warnf("Error received protecting snapshot %q: %v. Attempting to cleanup.", do.Volume.Name, err)
 			cmd := exec.Command("rbd", "snap", "unprotect", mkpool(poolName, intOrigName), "--snap", snapName)
-			if er, err := runWithTimeout(cmd, do.Timeout); err != nil || er.ExitStatus != 0 {
-				logrus.Errorf("Error encountered unprotecting new volume %q for volume %q, snapshot %q: %v, %v", newName, intOrigName, snapName, err, er.Stderr)
+			if er, err := runWithTimeout(do.Context, cmd, do.Timeout); err != nil || er.ExitStatus != 0 {
+				log.Errorf("Error encountered unprotecting new volume %q for volume %q, snapshot %q: %v, %v", newName, intOrigName, snapName, err, er.Stderr)
 				return
 			}
 		}
@@ -465,7 +610,7 @@ func (c *Driver) CopySnapshot(do storage.DriverOptions, snapName, newName string
 	errChan := make(chan error, 1)
 
 	cmd := exec.Command("rbd", "snap", "protect", mkpool(poolName, intOrigName), "--snap", snapName)
-	er, err := runWithTimeout(cmd, do.Timeout)
+	er, err := runWithTimeout(do.Context, cmd, do.Timeout)
 
 	// EBUSY indicates that the snapshot is already protected.
 	if err != nil && er.ExitStatus != 0 && er.ExitStatus != int(unix.EBUSY) {
@@ -479,7 +624,7 @@ func (c *Driver) CopySnapshot(do storage.DriverOptions, snapName, newName string
 	defer c.cleanupCopy(snapName, newName, do, errChan)
 
 	cmd = exec.Command("rbd", "clone", mkpool(poolName, intOrigName), mkpool(poolName, intNewName), "--snap", snapName)
-	er, err = runWithTimeout(cmd, do.Timeout)
+	er, err = runWithTimeout(do.Context, cmd, do.Timeout)
 	if err != nil && er.ExitStatus == 0 {
 		var err2 *errored.Error
 		var ok bool
@@ -516,7 +661,7 @@ func (c *Driver) Mounted(timeout time.Duration) ([]*storage.Mount, error) {
 	}
 
 	for _, mount := range hostMounts {
-		logrus.Debugf("Host mounts: %#v", mount)
+		log.Debugf("Host mounts: %#v", mount)
 	}
 
 	mapped, err := c.getMapped(timeout)
@@ -525,7 +670,7 @@ func (c *Driver) Mounted(timeout time.Duration) ([]*storage.Mount, error) {
 	}
 
 	for _, mapd := range mapped {
-		logrus.Debugf("Mapped: %#v", mapd)
+		log.Debugf("Mapped: %#v", mapd)
 	}
 
 	for _, hostMount := range hostMounts {
@@ -15,6 +15,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/contiv/volplugin/storage"
 	"github.com/contiv/volplugin/storage/mountscan"
+	"golang.org/x/net/context"
 )
 
 const myMountpath = "/mnt/ceph"
@@ -97,10 +98,10 @@ func (s *cephSuite) TestMkfsVolume(c *C) {
 	// Create a new driver; the ceph driver is needed
 	driver := Driver{mountpath: myMountpath}
 
-	err := driver.mkfsVolume("echo %s; sleep 1", "fake-fake-fake", 3*time.Second)
+	err := driver.mkfsVolume(context.Background(), "echo %s; sleep 1", "fake-fake-fake", 3*time.Second)
 	c.Assert(err, IsNil)
 
-	err = driver.mkfsVolume("echo %s; sleep 2", "fake-fake-fake", 1*time.Second)
+	err = driver.mkfsVolume(context.Background(), "echo %s; sleep 2", "fake-fake-fake", 1*time.Second)
 	c.Assert(err, NotNil)
 }
 
@@ -340,6 +341,28 @@ func (s *cephSuite) TestExternalInternalNames(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (s *cephSuite) TestParseDu(c *C) {
+	usage, err := parseDu(`{"images":[{"name":"policy1.test","snapshot":"snap1","provisioned_size":10485760,"used_size":4194304},{"name":"policy1.test","provisioned_size":10485760,"used_size":8388608}],"total_provisioned_size":20971520,"total_used_size":12582912}`)
+	c.Assert(err, IsNil)
+	c.Assert(*usage, DeepEquals, storage.ImageUsage{Provisioned: 10485760, Used: 12582912})
+
+	_, err = parseDu("rbd: error")
+	c.Assert(err, NotNil)
+}
+
+func (s *cephSuite) TestParseInfo(c *C) {
+	size, err := parseInfo(`{"name":"legacy","size":10485760,"objects":3,"order":22,"object_size":4194304,"format":2}`)
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, uint64(10))
+
+	size, err = parseInfo(`{"name":"legacy","size":10485761}`)
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, uint64(11))
+
+	_, err = parseInfo("rbd: error")
+	c.Assert(err, NotNil)
+}
+
 func (s *cephSuite) TestSnapshotClone(c *C) {
 	snapDrv, err := NewSnapshotDriver()
 	c.Assert(err, IsNil)
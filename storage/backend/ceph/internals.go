@@ -10,7 +10,6 @@ import (
 	"golang.org/x/net/context"
 	"golang.org/x/sys/unix"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/contiv/errored"
 	"github.com/contiv/executor"
 	"github.com/contiv/volplugin/storage"
@@ -33,9 +32,9 @@ func (c *Driver) mapImage(do storage.DriverOptions) (string, error) {
 
 retry:
 	cmd := exec.Command("rbd", "map", intName, "--pool", poolName)
-	er, err := runWithTimeout(cmd, do.Timeout)
+	er, err := runWithTimeout(do.Context, cmd, do.Timeout)
 	if retries < 10 && err != nil {
-		logrus.Errorf("Error mapping image: %v (%v) (%v). Retrying.", intName, er, err)
+		log.Errorf("Error mapping image: %v (%v) (%v). Retrying.", intName, er, err)
 		retries++
 		goto retry
 	}
@@ -62,14 +61,14 @@ retry:
 		return "", errored.Errorf("Volume %s in pool %s not found in RBD showmapped output", intName, do.Volume.Params["pool"])
 	}
 
-	logrus.Debugf("mapped volume %q as %q", intName, device)
+	log.Debugf("mapped volume %q as %q", intName, device)
 
 	return device, nil
 }
 
-func (c *Driver) mkfsVolume(fscmd, devicePath string, timeout time.Duration) error {
+func (c *Driver) mkfsVolume(ctx context.Context, fscmd, devicePath string, timeout time.Duration) error {
 	cmd := exec.Command("/bin/sh", "-c", templateFSCmd(fscmd, devicePath))
-	er, err := runWithTimeout(cmd, timeout)
+	er, err := runWithTimeout(ctx, cmd, timeout)
 	if err != nil || er.ExitStatus != 0 {
 		return errored.Errorf("Error creating filesystem on %s with cmd: %q. Error: %v (%v) (%v) (%v)", devicePath, fscmd, er, err, strings.TrimSpace(er.Stdout), strings.TrimSpace(er.Stderr))
 	}
@@ -110,19 +109,19 @@ func (c *Driver) doUnmap(do storage.DriverOptions, rbdmap rbdMap) (bool, error)
 
 	for _, rbd := range rbdmap {
 		if rbd.Name == intName && rbd.Pool == do.Volume.Params["pool"] {
-			logrus.Debugf("Unmapping volume %s/%s at device %q", poolName, intName, strings.TrimSpace(rbd.Device))
+			log.Debugf("Unmapping volume %s/%s at device %q", poolName, intName, strings.TrimSpace(rbd.Device))
 
 			if _, err := os.Stat(rbd.Device); err != nil {
-				logrus.Debugf("Trying to unmap device %q for %s/%s that does not exist, continuing", poolName, intName, rbd.Device)
+				log.Debugf("Trying to unmap device %q for %s/%s that does not exist, continuing", poolName, intName, rbd.Device)
 				continue
 			}
 
 			cmd := exec.Command("rbd", "unmap", rbd.Device)
-			er, err := runWithTimeout(cmd, do.Timeout)
+			er, err := runWithTimeout(do.Context, cmd, do.Timeout)
 			if err != nil || er.ExitStatus != 0 {
-				logrus.Errorf("Could not unmap volume %q (device %q): %v (%v) (%v)", intName, rbd.Device, er, err, er.Stderr)
+				log.Errorf("Could not unmap volume %q (device %q): %v (%v) (%v)", intName, rbd.Device, er, err, er.Stderr)
 				if er.ExitStatus == int(unix.EBUSY) {
-					logrus.Errorf("Retrying to unmap volume %q (device %q)...", intName, rbd.Device)
+					log.Errorf("Retrying to unmap volume %q (device %q)...", intName, rbd.Device)
 					time.Sleep(100 * time.Millisecond)
 					return true, nil
 				}
@@ -157,16 +156,15 @@ retry:
 	rbdmap := rbdMap{}
 
 	cmd := exec.Command("rbd", "showmapped", "--format", "json")
-	ctx, _ := context.WithTimeout(context.Background(), timeout)
-	er, err = executor.NewCapture(cmd).Run(ctx)
+	er, err = runWithTimeout(context.Background(), cmd, timeout)
 	if err != nil || er.ExitStatus != 0 || er.Stdout == "" {
-		logrus.Warnf("Could not show mapped volumes. Retrying: %v", er.Stderr)
+		log.Warnf("Could not show mapped volumes. Retrying: %v", er.Stderr)
 		time.Sleep(100 * time.Millisecond)
 		goto retry
 	}
 
 	if err := json.Unmarshal([]byte(er.Stdout), &rbdmap); err != nil {
-		logrus.Errorf("Could not parse RBD showmapped output, retrying: %s", er.Stderr)
+		log.Errorf("Could not parse RBD showmapped output, retrying: %s", er.Stderr)
 		time.Sleep(100 * time.Millisecond)
 		goto retry
 	}
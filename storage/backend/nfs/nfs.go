@@ -10,12 +10,15 @@ import (
 
 	"golang.org/x/sys/unix"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/logging"
+	"github.com/contiv/volplugin/metrics"
 	"github.com/contiv/volplugin/storage"
 	"github.com/vishvananda/netlink"
 )
 
+var log = logging.For("storage")
+
 // Driver is a basic struct for controlling the NFS driver.
 type Driver struct {
 	mountpath string
@@ -186,9 +189,12 @@ func (d *Driver) Mount(do storage.DriverOptions) (*storage.Mount, error) {
 	times := 0
 
 retry:
-	if err := unix.Mount(do.Source, mp, "nfs", 0, opts); err != nil && err != unix.EBUSY {
+	start := time.Now()
+	err = unix.Mount(do.Source, mp, "nfs", 0, opts)
+	metrics.DriverCommands.Since(start, "mount")
+	if err != nil && err != unix.EBUSY {
 		if err == unix.EIO {
-			logrus.Errorf("I/O error mounting %q Retrying after timeout...", do.Volume.Name)
+			log.Errorf("I/O error mounting %q Retrying after timeout...", do.Volume.Name)
 			time.Sleep(do.Timeout)
 			times++
 			if times == 3 {
@@ -215,7 +221,10 @@ func (d *Driver) Unmount(do storage.DriverOptions) error {
 		return err
 	}
 
-	if err := unix.Unmount(mp, 0); err != nil {
+	start := time.Now()
+	err = unix.Unmount(mp, 0)
+	metrics.DriverCommands.Since(start, "umount")
+	if err != nil {
 		return err
 	}
 
@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"io/ioutil"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/logging"
 	"github.com/contiv/volplugin/storage"
 )
 
+var log = logging.For("storage")
+
 const (
 	writeBPSFile = "/sys/fs/cgroup/blkio/blkio.throttle.write_bps_device"
 	readBPSFile  = "/sys/fs/cgroup/blkio/blkio.throttle.read_bps_device"
@@ -21,7 +23,7 @@ func makeLimit(mc *storage.Mount, limit uint64) []byte {
 // ApplyCGroupRateLimit applies cgroups based on the runtime options. Current
 // this is restricted to BPS-related functions.
 func ApplyCGroupRateLimit(ro config.RuntimeOptions, mc *storage.Mount) error {
-	logrus.Debugf("Apply rate limits: [write: %d] [read: %d] to mount %v", ro.RateLimit.WriteBPS, ro.RateLimit.ReadBPS, mc.Volume)
+	log.Debugf("Apply rate limits: [write: %d] [read: %d] to mount %v", ro.RateLimit.WriteBPS, ro.RateLimit.ReadBPS, mc.Volume)
 
 	opMap := map[string]uint64{
 		writeBPSFile: ro.RateLimit.WriteBPS,
@@ -30,7 +32,7 @@ func ApplyCGroupRateLimit(ro config.RuntimeOptions, mc *storage.Mount) error {
 
 	for fn, val := range opMap {
 		if err := ioutil.WriteFile(fn, makeLimit(mc, val), 0600); err != nil {
-			logrus.Errorf("Error writing cgroups: %v", err)
+			log.Errorf("Error writing cgroups: %v", err)
 			return err
 		}
 	}
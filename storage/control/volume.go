@@ -3,25 +3,30 @@ package control
 import (
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/config"
 	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/logging"
 	"github.com/contiv/volplugin/storage"
 	"github.com/contiv/volplugin/storage/backend"
+
+	"golang.org/x/net/context"
 )
 
+var log = logging.For("storage")
+
 const defaultFsCmd = "mkfs.ext4 -m0 %"
 
-// CreateVolume performs the dirty work of actually constructing a volume.
-func CreateVolume(policy *config.Policy, config *config.Volume, timeout time.Duration) (storage.DriverOptions, error) {
+// CreateVolume performs the dirty work of actually constructing a volume. The
+// context, which may be nil, is carried in the returned driver options.
+func CreateVolume(ctx context.Context, policy *config.Policy, config *config.Volume, timeout time.Duration) (storage.DriverOptions, error) {
 	var (
 		fscmd string
 		ok    bool
 	)
 
 	if config.Backends.CRUD == "" {
-		logrus.Debugf("Not creating volume %q, backend is unspecified", config)
+		log.Debugf("Not creating volume %q, backend is unspecified", config)
 		return storage.DriverOptions{}, errors.NoActionTaken
 	}
 
@@ -55,9 +60,10 @@ func CreateVolume(policy *config.Policy, config *config.Volume, timeout time.Dur
 			CreateCommand: fscmd,
 		},
 		Timeout: timeout,
+		Context: ctx,
 	}
 
-	logrus.Infof("Creating volume %v with size %d", config, actualSize)
+	log.Infof("Creating volume %v with size %d", config, actualSize)
 	return driverOpts, driver.Create(driverOpts)
 }
 
@@ -69,7 +75,7 @@ func FormatVolume(config *config.Volume, do storage.DriverOptions) error {
 	}
 
 	if config.Backends.CRUD == "" {
-		logrus.Debugf("Not formatting volume %q, backend is unspecified", config)
+		log.Debugf("Not formatting volume %q, backend is unspecified", config)
 		return errors.NoActionTaken
 	}
 
@@ -78,14 +84,14 @@ func FormatVolume(config *config.Volume, do storage.DriverOptions) error {
 		return err
 	}
 
-	logrus.Infof("Formatting volume %v (filesystem %q) with size %d", config, config.CreateOptions.FileSystem, actualSize)
+	log.Infof("Formatting volume %v (filesystem %q) with size %d", config, config.CreateOptions.FileSystem, actualSize)
 	return driver.Format(do)
 }
 
 // ExistsVolume tells if a volume exists. It is *not* suitable for any locking primitive.
 func ExistsVolume(config *config.Volume, timeout time.Duration) (bool, error) {
 	if config.Backends.CRUD == "" {
-		logrus.Debugf("volume %q, backend is unspecified", config)
+		log.Debugf("volume %q, backend is unspecified", config)
 		return true, errors.NoActionTaken
 	}
 
@@ -108,7 +114,7 @@ func ExistsVolume(config *config.Volume, timeout time.Duration) (bool, error) {
 // RemoveVolume removes a volume.
 func RemoveVolume(config *config.Volume, timeout time.Duration) error {
 	if config.Backends.CRUD == "" {
-		logrus.Debugf("Not removing volume %q, backend is unspecified", config)
+		log.Debugf("Not removing volume %q, backend is unspecified", config)
 		return errors.NoActionTaken
 	}
 
@@ -125,7 +131,35 @@ func RemoveVolume(config *config.Volume, timeout time.Duration) error {
 		Timeout: timeout,
 	}
 
-	logrus.Infof("Destroying volume %v", config)
+	log.Infof("Destroying volume %v", config)
 
 	return driver.Destroy(driverOpts)
 }
+
+// CountSnapshots counts the snapshots of a volume. Volumes without a snapshot
+// backend have none.
+func CountSnapshots(config *config.Volume, timeout time.Duration) (uint64, error) {
+	if config.Backends == nil || config.Backends.Snapshot == "" {
+		return 0, nil
+	}
+
+	driver, err := backend.NewSnapshotDriver(config.Backends.Snapshot)
+	if err != nil {
+		return 0, err
+	}
+
+	driverOpts := storage.DriverOptions{
+		Volume: storage.Volume{
+			Name:   config.String(),
+			Params: config.DriverOptions,
+		},
+		Timeout: timeout,
+	}
+
+	list, err := driver.ListSnapshots(driverOpts)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(len(list)), nil
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/contiv/errored"
+	"golang.org/x/net/context"
 )
 
 var (
@@ -38,6 +39,10 @@ type DriverOptions struct {
 	FSOptions FSOptions
 	Timeout   time.Duration
 	Options   map[string]string
+
+	// Context carries the trace of the request the operation is part of. It
+	// may be nil.
+	Context context.Context
 }
 
 // ListOptions is a set of parameters used for the List operation of Driver.
@@ -103,6 +108,34 @@ type CRUDDriver interface {
 	Exists(DriverOptions) (bool, error)
 }
 
+// RenamingDriver renames images which were not created by volplugin, so they
+// can be adopted as volumes.
+type RenamingDriver interface {
+	// InternalName yields the name of the volume's image in the backend.
+	InternalName(string) (string, error)
+
+	// Rename renames an image, given by its name in the backend, to the image
+	// of the volume in the DriverOptions.
+	Rename(DriverOptions, string) error
+
+	// Size yields the size of an image, given by its name in the backend, in
+	// megabytes as volumes are created with.
+	Size(DriverOptions, string) (uint64, error)
+}
+
+// ImageUsage is the space a volume's image occupies in the backend, in bytes.
+// Used includes the space held by the image's snapshots.
+type ImageUsage struct {
+	Provisioned uint64
+	Used        uint64
+}
+
+// UsageDriver reports the space volumes occupy in the backend.
+type UsageDriver interface {
+	// Usage yields the provisioned and actually used space of the volume's image.
+	Usage(DriverOptions) (*ImageUsage, error)
+}
+
 // SnapshotDriver manages snapshots.
 type SnapshotDriver interface {
 	NamedDriver
@@ -5,11 +5,13 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/logging"
 )
 
+var log = logging.For("storage")
+
 const (
 	mountInfoFile           = "/proc/self/mountinfo"
 	deviceInfoFile          = "/proc/devices"
@@ -173,11 +175,11 @@ func GetMounts(request *GetMountsRequest) ([]*MountInfo, error) {
 	for _, line := range lines {
 		if !isEmpty(line) {
 			if len(strings.Split(line, " ")) < totalMountInfoFieldsNum {
-				logrus.Debugf("Insufficient mount info data: %q", line)
+				log.Debugf("Insufficient mount info data: %q", line)
 				continue
 			}
 			if mountDetails, err := convertToMountInfo(line); err != nil {
-				logrus.Errorf("%s", err)
+				log.Errorf("%s", err)
 				continue
 			} else {
 				if mountDetails.DeviceNumber.Major == driverMajorID {
@@ -0,0 +1,77 @@
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/contiv/errored"
+)
+
+// Exporter receives finished spans.
+type Exporter interface {
+	Export(*Span)
+}
+
+var (
+	exporter      Exporter
+	exporterMutex sync.RWMutex
+)
+
+// SetExporter sets the exporter finished spans are handed to. A nil exporter
+// discards them, which is the default.
+func SetExporter(e Exporter) {
+	exporterMutex.Lock()
+	exporter = e
+	exporterMutex.Unlock()
+}
+
+func export(s *Span) {
+	exporterMutex.RLock()
+	e := exporter
+	exporterMutex.RUnlock()
+
+	if e != nil {
+		e.Export(s)
+	}
+}
+
+// JSONExporter writes each span as a line of JSON.
+type JSONExporter struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewJSONExporter returns an exporter writing to the writer.
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{encoder: json.NewEncoder(w)}
+}
+
+// Export writes the span.
+func (e *JSONExporter) Export(s *Span) {
+	e.mutex.Lock()
+	e.encoder.Encode(s)
+	e.mutex.Unlock()
+}
+
+// NewExporter returns the exporter named by the spec: "" disables tracing,
+// "stdout" writes spans as JSON to standard output and "file:<path>" appends
+// them as JSON to the file.
+func NewExporter(spec string) (Exporter, error) {
+	switch {
+	case spec == "":
+		return nil, nil
+	case spec == "stdout":
+		return NewJSONExporter(os.Stdout), nil
+	case strings.HasPrefix(spec, "file:"):
+		f, err := os.OpenFile(strings.TrimPrefix(spec, "file:"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		return NewJSONExporter(f), nil
+	default:
+		return nil, errored.Errorf("Unknown trace exporter %q", spec)
+	}
+}
@@ -0,0 +1,151 @@
+// Package trace implements request-scoped tracing. A span is started when a
+// request enters volplugin or the apiserver and is carried in a
+// context.Context through the API, lock, configuration and storage layers,
+// each of which records child spans for the work it does. Spans are
+// propagated between processes in HTTP headers, and handed to the configured
+// Exporter when they finish.
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// TraceHeader carries the trace ID across HTTP calls.
+	TraceHeader = "X-Volplugin-Trace-Id"
+	// SpanHeader carries the ID of the calling span across HTTP calls.
+	SpanHeader = "X-Volplugin-Span-Id"
+)
+
+type spanKey struct{}
+
+// Span is a timed unit of work within a trace.
+type Span struct {
+	TraceID  string            `json:"trace_id"`
+	SpanID   string            `json:"span_id"`
+	ParentID string            `json:"parent_id,omitempty"`
+	Name     string            `json:"name"`
+	Start    time.Time         `json:"start"`
+	Duration time.Duration     `json:"duration"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+func newID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Start starts a span which is a child of the span in the context, or the
+// root of a new trace if there is none. The returned context carries the new
+// span.
+func Start(ctx context.Context, name string) (*Span, context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	span := &Span{
+		TraceID: newID(),
+		SpanID:  newID(),
+		Name:    name,
+		Start:   time.Now(),
+	}
+
+	if parent := FromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+	}
+
+	return span, context.WithValue(ctx, spanKey{}, span)
+}
+
+// StartChild starts a span only if the context is already being traced, so
+// that background work does not create traces of its own. It returns a nil
+// span otherwise; all Span methods may be called on a nil span.
+func StartChild(ctx context.Context, name string) (*Span, context.Context) {
+	if FromContext(ctx) == nil {
+		return nil, ctx
+	}
+
+	return Start(ctx, name)
+}
+
+// FromContext returns the span carried by the context, or nil.
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Detach returns a context carrying only the span of ctx, if any. It is not
+// cancelled when ctx is.
+func Detach(ctx context.Context) context.Context {
+	detached := context.Background()
+	if span := FromContext(ctx); span != nil {
+		detached = context.WithValue(detached, spanKey{}, span)
+	}
+
+	return detached
+}
+
+// SetTag annotates the span.
+func (s *Span) SetTag(key, value string) *Span {
+	if s == nil {
+		return nil
+	}
+
+	if s.Tags == nil {
+		s.Tags = map[string]string{}
+	}
+	s.Tags[key] = value
+
+	return s
+}
+
+// Finish records the duration of the span and the error it ended with, if
+// any, and exports it.
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+
+	s.Duration = time.Since(s.Start)
+	if err != nil {
+		s.Error = err.Error()
+	}
+
+	export(s)
+}
+
+// Inject writes the span carried by the context into the headers of an
+// outgoing request.
+func Inject(ctx context.Context, header http.Header) {
+	span := FromContext(ctx)
+	if span == nil {
+		return
+	}
+
+	header.Set(TraceHeader, span.TraceID)
+	header.Set(SpanHeader, span.SpanID)
+}
+
+// Extract returns a context carrying the remote span named by the headers of
+// an incoming request, so spans started from it join the caller's trace. The
+// remote span is never exported here; its process exports it.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	traceID := header.Get(TraceHeader)
+	if traceID == "" {
+		return ctx
+	}
+
+	return context.WithValue(ctx, spanKey{}, &Span{TraceID: traceID, SpanID: header.Get(SpanHeader)})
+}
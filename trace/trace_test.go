@@ -0,0 +1,100 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	. "testing"
+
+	. "gopkg.in/check.v1"
+
+	"golang.org/x/net/context"
+)
+
+type traceSuite struct{}
+
+var _ = Suite(&traceSuite{})
+
+func TestTrace(t *T) { TestingT(t) }
+
+func (s *traceSuite) TestSpans(c *C) {
+	buf := new(bytes.Buffer)
+	SetExporter(NewJSONExporter(buf))
+	defer SetExporter(nil)
+
+	root, ctx := Start(context.Background(), "mount")
+	child, _ := Start(ctx, "rbd map")
+	child.SetTag("volume", "policy1/foo").Finish(errors.New("failed"))
+	root.Finish(nil)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	c.Assert(len(lines), Equals, 2)
+
+	spans := []*Span{}
+	for _, line := range lines {
+		span := &Span{}
+		c.Assert(json.Unmarshal([]byte(line), span), IsNil)
+		spans = append(spans, span)
+	}
+
+	c.Assert(spans[0].Name, Equals, "rbd map")
+	c.Assert(spans[0].TraceID, Equals, root.TraceID)
+	c.Assert(spans[0].ParentID, Equals, root.SpanID)
+	c.Assert(spans[0].Tags["volume"], Equals, "policy1/foo")
+	c.Assert(spans[0].Error, Equals, "failed")
+	c.Assert(spans[1].Name, Equals, "mount")
+	c.Assert(spans[1].ParentID, Equals, "")
+}
+
+func (s *traceSuite) TestStartChild(c *C) {
+	span, ctx := StartChild(context.Background(), "etcd get")
+	c.Assert(span, IsNil)
+	c.Assert(FromContext(ctx), IsNil)
+	span.SetTag("key", "value").Finish(nil)
+
+	root, ctx := Start(nil, "mount")
+	span, _ = StartChild(ctx, "etcd get")
+	c.Assert(span, NotNil)
+	c.Assert(span.ParentID, Equals, root.SpanID)
+}
+
+func (s *traceSuite) TestDetach(c *C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	root, ctx := Start(ctx, "mount")
+	detached := Detach(ctx)
+	cancel()
+
+	c.Assert(ctx.Err(), NotNil)
+	c.Assert(detached.Err(), IsNil)
+	c.Assert(FromContext(detached), Equals, root)
+	c.Assert(FromContext(Detach(context.Background())), IsNil)
+}
+
+func (s *traceSuite) TestPropagation(c *C) {
+	header := http.Header{}
+	Inject(context.Background(), header)
+	c.Assert(header.Get(TraceHeader), Equals, "")
+	c.Assert(FromContext(Extract(context.Background(), header)), IsNil)
+
+	root, ctx := Start(context.Background(), "remove")
+	Inject(ctx, header)
+
+	span, _ := Start(Extract(context.Background(), header), "apiserver")
+	c.Assert(span.TraceID, Equals, root.TraceID)
+	c.Assert(span.ParentID, Equals, root.SpanID)
+}
+
+func (s *traceSuite) TestNewExporter(c *C) {
+	e, err := NewExporter("")
+	c.Assert(err, IsNil)
+	c.Assert(e, IsNil)
+
+	e, err = NewExporter("stdout")
+	c.Assert(err, IsNil)
+	c.Assert(e, NotNil)
+
+	_, err = NewExporter("zipkin")
+	c.Assert(err, NotNil)
+}
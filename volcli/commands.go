@@ -1,6 +1,9 @@
 package volcli
 
-import "github.com/codegangsta/cli"
+import (
+	"github.com/codegangsta/cli"
+	"github.com/contiv/volplugin/config"
+)
 
 // GlobalFlags are required global flags for the operation of volcli.
 var GlobalFlags = []cli.Flag{
@@ -14,11 +17,32 @@ var GlobalFlags = []cli.Flag{
 		Usage: "URL for etcd",
 		Value: &cli.StringSlice{"http://localhost:2379"},
 	},
+	cli.StringFlag{
+		Name:  "store",
+		Usage: "URL of the store: etcd://host:port,..., etcd3://host:port or consul://host:port. Defaults to etcd at --etcd",
+	},
 	cli.StringFlag{
 		Name:  "apiserver",
 		Usage: "address of apiserver process",
 		Value: "127.0.0.1:9005",
 	},
+	cli.StringFlag{
+		Name:   "token",
+		Usage:  "bearer token to present to the apiserver",
+		EnvVar: "VOLCLI_TOKEN",
+	},
+	cli.StringFlag{
+		Name:  "tls-cert",
+		Usage: "client certificate to present to the apiserver; enables TLS",
+	},
+	cli.StringFlag{
+		Name:  "tls-key",
+		Usage: "key of the client certificate",
+	},
+	cli.StringFlag{
+		Name:  "tls-ca",
+		Usage: "CA to verify the apiserver against; enables TLS",
+	},
 }
 
 // Commands is the data structure which describes the command hierarchy
@@ -104,6 +128,19 @@ var Commands = []cli.Command{
 				Usage:       "Watch for policy changes",
 				Action:      PolicyWatch,
 			},
+			{
+				Name:        "usage",
+				ArgsUsage:   "[policy name]",
+				Description: "Shows the volumes, size and snapshots the volumes of a policy consume against the policy's quota, in tab-delimited form: resource, usage, quota.",
+				Usage:       "Show a policy's usage and quota",
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "recount",
+						Usage: "Recount the usage from the policy's volumes and their snapshots first",
+					},
+				},
+				Action: PolicyUsage,
+			},
 		},
 	},
 	{
@@ -121,19 +158,42 @@ var Commands = []cli.Command{
 				Usage:       "Create a volume for a given policy",
 				Action:      VolumeCreate,
 			},
+			{
+				Name: "adopt",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "image",
+						Usage: "Existing image to adopt, in the form of pool/name",
+					},
+					cli.BoolFlag{
+						Name:  "rename",
+						Usage: "Rename the image to the name volplugin uses for the volume",
+					},
+				},
+				ArgsUsage:   "[policy name]/[volume name]",
+				Description: "Records an existing image as a volume of the policy, without creating or formatting it. The image must already be named after the volume unless --rename is given. Refuses if the volume or its image name is already taken.",
+				Usage:       "Adopt an existing image as a volume",
+				Action:      VolumeAdopt,
+			},
 			{
 				Name:        "get",
 				ArgsUsage:   "[policy name]/[volume name]",
 				Usage:       "Get JSON configuration for a volume",
-				Description: "Obtain the JSON configuration for the volume",
+				Description: "Obtain the JSON configuration for the volume, along with the registered nodes which satisfy its placement constraints",
 				Action:      VolumeGet,
 			},
 			{
 				Name:        "list",
 				ArgsUsage:   "[policy name]",
-				Description: "Given a policy name, produces a newline-delimited list of volumes.",
+				Description: "Given a policy name, produces a newline-delimited list of volumes. With --usage, each line is tab-delimited: volume, used, available, percent used, percent of inodes used, provisioned and actual backend size, and any alerts.",
 				Usage:       "List all volumes for a given policy",
-				Action:      VolumeList,
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "usage",
+						Usage: "Show the usage of each volume",
+					},
+				},
+				Action: VolumeList,
 			},
 			{
 				Name:        "list-all",
@@ -166,6 +226,38 @@ var Commands = []cli.Command{
 				Usage:       "Remove a volume and its contents",
 				Action:      VolumeRemove,
 			},
+			{
+				Name: "migrate",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "to",
+						Usage: "Host to hand the volume off to",
+					},
+					cli.StringFlag{
+						Name:  "grace",
+						Usage: "Time to reserve the volume for the new host after the handoff",
+						Value: config.DefaultHandoffGrace.String(),
+					},
+				},
+				ArgsUsage:   "[policy name]/[volume name]",
+				Description: "Hands a locked volume off to another host. The host holding the volume refuses new mounts, waits for the volume to be unmounted, then reserves it for the new host.",
+				Usage:       "Move a locked volume to another host",
+				Action:      VolumeMigrate,
+			},
+			{
+				Name:        "migrate-status",
+				ArgsUsage:   "[policy name]/[volume name]",
+				Description: "Show the status of the most recent handoff for a volume",
+				Usage:       "Show volume handoff status",
+				Action:      VolumeMigrateStatus,
+			},
+			{
+				Name:        "migrate-cancel",
+				ArgsUsage:   "[policy name]/[volume name]",
+				Description: "Cancel the handoff of a volume. A host draining the volume allows mounts of it again. Handoffs which are not answered expire on their own after the grace window and the global timeout.",
+				Usage:       "Cancel a volume handoff",
+				Action:      VolumeMigrateCancel,
+			},
 			{
 				Name:        "snapshot",
 				Description: "Snapshot management tools",
@@ -263,4 +355,177 @@ var Commands = []cli.Command{
 			},
 		},
 	},
+	{
+		Name:  "node",
+		Usage: "Inspect volplugin hosts",
+		Subcommands: []cli.Command{
+			{
+				Name:        "list",
+				ArgsUsage:   "",
+				Description: "List the volplugin hosts which are currently heartbeating, in newline-delimited form.",
+				Usage:       "List registered nodes",
+				Action:      NodeList,
+			},
+			{
+				Name:        "get",
+				ArgsUsage:   "[hostname]",
+				Description: "Obtain the registration information for a volplugin host, including its version and backends.",
+				Usage:       "Get node info",
+				Action:      NodeGet,
+			},
+		},
+	},
+	{
+		Name:  "op",
+		Usage: "Inspect in-flight volume operations",
+		Subcommands: []cli.Command{
+			{
+				Name:        "list",
+				ArgsUsage:   "",
+				Description: "List the create, copy and remove operations which are in progress or were interrupted, in tab-delimited form: volume, operation, last completed step, host and start time.",
+				Usage:       "List in-flight operations",
+				Action:      OperationList,
+			},
+		},
+	},
+	{
+		Name:        "events",
+		ArgsUsage:   "",
+		Usage:       "Show volume lifecycle events",
+		Description: "Lists the events of the last day, in tab-delimited form: time, volume, event, host and message. With --follow, keeps printing new events as they happen until interrupted.",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "follow, f",
+				Usage: "Keep printing events as they happen",
+			},
+			cli.StringFlag{
+				Name:  "volume",
+				Usage: "Only show the events of this volume, given as <policyName>/<volumeName>",
+			},
+		},
+		Action: Events,
+	},
+	{
+		Name:        "health",
+		ArgsUsage:   "",
+		Usage:       "Check the health of the apiserver and volplugin hosts",
+		Description: "Reports the health checks of the apiserver and of each registered volplugin host, in tab-delimited form: daemon and host, check, status (ok, warning or failed) and message. Exits non-zero if any daemon is unhealthy.",
+		Action:      Health,
+	},
+	{
+		Name:        "fsck",
+		ArgsUsage:   "",
+		Usage:       "Check volumes against the storage backends",
+		Description: "Reports images which have no volume record, volume records whose image is missing and, with --mounts, mount locks held for this host on volumes it does not have mounted. Requires direct access to etcd and the storage backend tools. Repairs are performed under use locks and only when requested.",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "mounts",
+				Usage: "Also check the mount locks held for this host",
+			},
+			cli.StringFlag{
+				Name:   "host-label",
+				Usage:  "Hostname the volplugin on this host registers with; defaults to the hostname",
+				EnvVar: "HOSTLABEL",
+			},
+			cli.BoolFlag{
+				Name:  "adopt",
+				Usage: "Publish volume records for orphaned images, using their policy's defaults",
+			},
+			cli.BoolFlag{
+				Name:  "remove-missing",
+				Usage: "Remove the records of volumes whose image is missing",
+			},
+			cli.BoolFlag{
+				Name:  "release-mounts",
+				Usage: "Unmap volumes with stale mount locks on this host and release the locks",
+			},
+		},
+		Action: Fsck,
+	},
+	{
+		Name:  "webhook",
+		Usage: "Inspect webhook deliveries",
+		Subcommands: []cli.Command{
+			{
+				Name:        "dead-letters",
+				ArgsUsage:   "",
+				Description: "Lists the events which could not be delivered to a webhook receiver after all retries, in tab-delimited form: time, receiver URL, volume, event, attempts and error. Requires direct access to etcd.",
+				Usage:       "List undeliverable webhook events",
+				Action:      WebhookDeadLetters,
+			},
+		},
+	},
+	{
+		Name:  "debug",
+		Usage: "Collect debugging information",
+		Subcommands: []cli.Command{
+			{
+				Name:        "bundle",
+				ArgsUsage:   "",
+				Description: "Writes a gzipped tarball of the etcd namespace, and of the version, goroutine stacks and, with --logs, recent logs of the apiserver and each volplugin, along with each volplugin's mounts, mount counts, mountscan results and `rbd showmapped` output. Secrets are redacted. Volplugins which do not answer within --wait are listed in missing-reports.txt.",
+				Usage:       "Write a debug bundle",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "output, o",
+						Usage: "File to write the bundle to; defaults to a name based on the current time",
+					},
+					cli.StringFlag{
+						Name:  "wait",
+						Usage: "How long to wait for the volplugins to answer",
+						Value: "10s",
+					},
+					cli.BoolFlag{
+						Name:  "logs",
+						Usage: "Include the recent logs of the daemons",
+					},
+				},
+				Action: DebugBundle,
+			},
+		},
+	},
+	{
+		Name:  "identity",
+		Usage: "Manage apiserver identities",
+		Subcommands: []cli.Command{
+			{
+				Name:        "set",
+				ArgsUsage:   "[identity name]",
+				Description: "Creates or updates an identity. Each --grant gives a role (consumer, policy-owner, admin or node) on a policy, or on all policies with \"*\". A client certificate whose common name is the identity's name authenticates as it. Requires direct access to etcd.",
+				Usage:       "Create or update an identity",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "token",
+						Usage: "Bearer token of the identity; only its hash is stored. Keeps the existing token if omitted",
+					},
+					cli.StringSliceFlag{
+						Name:  "grant",
+						Usage: "Grant in the form of <policyName>=<role>; may be repeated",
+						Value: &cli.StringSlice{},
+					},
+				},
+				Action: IdentitySet,
+			},
+			{
+				Name:        "get",
+				ArgsUsage:   "[identity name]",
+				Description: "Displays an identity and its grants. Requires direct access to etcd.",
+				Usage:       "Get an identity",
+				Action:      IdentityGet,
+			},
+			{
+				Name:        "list",
+				ArgsUsage:   "",
+				Description: "Lists the names of the identities. Requires direct access to etcd.",
+				Usage:       "List identities",
+				Action:      IdentityList,
+			},
+			{
+				Name:        "remove",
+				ArgsUsage:   "[identity name]",
+				Description: "Removes an identity. Requires direct access to etcd.",
+				Usage:       "Remove an identity",
+				Action:      IdentityRemove,
+			},
+		},
+	},
 }
@@ -16,13 +16,21 @@ import (
 
 	"github.com/codegangsta/cli"
 	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/auth"
 	"github.com/contiv/volplugin/config"
 	"github.com/contiv/volplugin/errors"
 	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/logging"
+	"github.com/contiv/volplugin/reconcile"
 	"github.com/contiv/volplugin/watch"
+	units "github.com/docker/go-units"
 	"github.com/kr/pty"
 )
 
+// requestID is sent with every request to the apiserver, so the requests of
+// a command can be found in its logs.
+var requestID = logging.NewRequestID()
+
 func errorInvalidVolumeSyntax(rcvd, exptd string) error {
 	return errored.Errorf("Invalid syntax: %q must be in the form of %q)", rcvd, exptd)
 }
@@ -59,14 +67,58 @@ func ppJSON(v interface{}) ([]byte, error) {
 	return json.MarshalIndent(v, "", "  ")
 }
 
-func deleteRequest(url string, bodyType string, body io.Reader) (resp *http.Response, err error) {
+func credentials(ctx *cli.Context) *auth.Credentials {
+	return &auth.Credentials{
+		Token:    ctx.GlobalString("token"),
+		CertFile: ctx.GlobalString("tls-cert"),
+		KeyFile:  ctx.GlobalString("tls-key"),
+		CAFile:   ctx.GlobalString("tls-ca"),
+	}
+}
+
+// apiserverURL returns the scheme and address of the apiserver.
+func apiserverURL(ctx *cli.Context) string {
+	return credentials(ctx).URL(ctx.GlobalString("apiserver"), "")
+}
+
+func httpDo(ctx *cli.Context, req *http.Request) (*http.Response, error) {
+	client, err := credentials(ctx).Client()
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set(logging.RequestIDHeader, requestID)
+
+	return client.Do(req)
+}
+
+func httpGet(ctx *cli.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare request: %v", err)
+	}
+
+	return httpDo(ctx, req)
+}
+
+func httpPost(ctx *cli.Context, url string, bodyType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest("POST", url, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare request: %v", err)
+	}
+	req.Header.Set("Content-Type", bodyType)
+
+	return httpDo(ctx, req)
+}
+
+func deleteRequest(ctx *cli.Context, url string, bodyType string, body io.Reader) (resp *http.Response, err error) {
 	req, err := http.NewRequest("DELETE", url, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to prepare request: %v", err)
 	}
 	req.Header.Set("Content-Type", bodyType)
 
-	return http.DefaultClient.Do(req)
+	return httpDo(ctx, req)
 }
 
 // GlobalGet retrives the global configuration and displays it on standard output.
@@ -75,7 +127,7 @@ func GlobalGet(ctx *cli.Context) {
 }
 
 func queryGlobalConfig(ctx *cli.Context) (*config.Global, error) {
-	resp, err := http.Get(fmt.Sprintf("http://%s/global", ctx.GlobalString("apiserver")))
+	resp, err := httpGet(ctx, fmt.Sprintf("%s/global", apiserverURL(ctx)))
 	if err != nil {
 		return nil, err
 	}
@@ -133,7 +185,7 @@ func globalUpload(ctx *cli.Context) (bool, error) {
 		return false, err
 	}
 
-	resp, err := http.Post(fmt.Sprintf("http://%s/global", ctx.GlobalString("apiserver")), "application/json", bytes.NewBuffer(content))
+	resp, err := httpPost(ctx, fmt.Sprintf("%s/global", apiserverURL(ctx)), "application/json", bytes.NewBuffer(content))
 	if err != nil {
 		return false, err
 	}
@@ -170,7 +222,7 @@ func policyUpload(ctx *cli.Context) (bool, error) {
 		return false, err
 	}
 
-	resp, err := http.Post(fmt.Sprintf("http://%s/policies/%s", ctx.GlobalString("apiserver"), policyName), "application/json", bytes.NewBuffer(content))
+	resp, err := httpPost(ctx, fmt.Sprintf("%s/policies/%s", apiserverURL(ctx), policyName), "application/json", bytes.NewBuffer(content))
 	if err != nil {
 		return false, err
 	}
@@ -197,7 +249,7 @@ func policyDelete(ctx *cli.Context) (bool, error) {
 
 	policy := ctx.Args()[0]
 
-	resp, err := deleteRequest(fmt.Sprintf("http://%s/policies/%s", ctx.GlobalString("apiserver"), policy), "application/json", nil)
+	resp, err := deleteRequest(ctx, fmt.Sprintf("%s/policies/%s", apiserverURL(ctx), policy), "application/json", nil)
 	if err != nil {
 		return false, err
 	}
@@ -227,7 +279,7 @@ func policyGet(ctx *cli.Context) (bool, error) {
 
 	policy := ctx.Args()[0]
 
-	resp, err := http.Get(fmt.Sprintf("http://%s/policies/%s", ctx.GlobalString("apiserver"), policy))
+	resp, err := httpGet(ctx, fmt.Sprintf("%s/policies/%s", apiserverURL(ctx), policy))
 	if err != nil {
 		return false, err
 	}
@@ -260,7 +312,7 @@ func policyList(ctx *cli.Context) (bool, error) {
 		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
 	}
 
-	resp, err := http.Get(fmt.Sprintf("http://%s/policies", ctx.GlobalString("apiserver")))
+	resp, err := httpGet(ctx, fmt.Sprintf("%s/policies", apiserverURL(ctx)))
 	if err != nil {
 		return false, err
 	}
@@ -301,8 +353,8 @@ func policyGetRevision(ctx *cli.Context) (bool, error) {
 	name := ctx.Args()[0]
 	revision := ctx.Args()[1]
 
-	resp, err := http.Get(fmt.Sprintf("http://%s/policy-archives/%s/%s",
-		ctx.GlobalString("apiserver"),
+	resp, err := httpGet(ctx, fmt.Sprintf("%s/policy-archives/%s/%s",
+		apiserverURL(ctx),
 		name,
 		revision,
 	))
@@ -341,8 +393,8 @@ func policyListRevisions(ctx *cli.Context) (bool, error) {
 
 	name := ctx.Args()[0]
 
-	resp, err := http.Get(fmt.Sprintf("http://%s/policy-archives/%s",
-		ctx.GlobalString("apiserver"),
+	resp, err := httpGet(ctx, fmt.Sprintf("%s/policy-archives/%s",
+		apiserverURL(ctx),
 		name,
 	))
 	if err != nil {
@@ -372,6 +424,73 @@ func policyListRevisions(ctx *cli.Context) (bool, error) {
 	return false, nil
 }
 
+// PolicyUsage displays the usage of a policy against its quota.
+func PolicyUsage(ctx *cli.Context) {
+	execCliAndExit(ctx, policyUsage)
+}
+
+func policyUsage(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 1 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
+	}
+
+	var (
+		resp *http.Response
+		err  error
+	)
+
+	url := fmt.Sprintf("%s/policy-usage/%s", apiserverURL(ctx), ctx.Args()[0])
+	if ctx.Bool("recount") {
+		resp, err = httpPost(ctx, url, "application/json", nil)
+	} else {
+		resp, err = httpGet(ctx, url)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	if resp.StatusCode != 200 {
+		return false, errored.Errorf("Status code was %d not 200: %s", resp.StatusCode, string(content))
+	}
+
+	result := struct {
+		Usage *config.PolicyUsage `json:"usage"`
+		Quota *config.Quota       `json:"quota"`
+	}{}
+
+	if err := json.Unmarshal(content, &result); err != nil {
+		return false, err
+	}
+
+	quota := result.Quota
+	if quota == nil {
+		quota = &config.Quota{}
+	}
+
+	size, err := quota.ActualSize()
+	if err != nil {
+		return false, err
+	}
+
+	limit := func(n uint64, unit string) string {
+		if n == 0 {
+			return "unlimited"
+		}
+		return fmt.Sprintf("%d%s", n, unit)
+	}
+
+	fmt.Printf("volumes\t%d\t%s\n", result.Usage.Volumes, limit(quota.Volumes, ""))
+	fmt.Printf("size\t%dMB\t%s\n", result.Usage.Size, limit(size, "MB"))
+	fmt.Printf("snapshots\t%d\t%s\n", result.Usage.Snapshots, limit(quota.Snapshots, ""))
+
+	return false, nil
+}
+
 // PolicyWatch watches etcd for policy changes and prints the name and revision when a policy is uploaded.
 func PolicyWatch(ctx *cli.Context) {
 	execCliAndExit(ctx, policyWatch)
@@ -382,7 +501,7 @@ func policyWatch(ctx *cli.Context) (bool, error) {
 		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
 	}
 
-	cfg, err := config.NewClient(ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd"))
+	cfg, err := config.NewStoreClient(ctx.GlobalString("prefix"), ctx.GlobalString("store"), ctx.GlobalStringSlice("etcd"))
 	if err != nil {
 		return false, err
 	}
@@ -440,7 +559,7 @@ func volumeCreate(ctx *cli.Context) (bool, error) {
 		return false, errored.Errorf("Could not create request JSON: %v", err)
 	}
 
-	resp, err := http.Post(fmt.Sprintf("http://%s/volumes/create", ctx.GlobalString("apiserver")), "application/json", bytes.NewBuffer(content))
+	resp, err := httpPost(ctx, fmt.Sprintf("%s/volumes/create", apiserverURL(ctx)), "application/json", bytes.NewBuffer(content))
 	if err != nil {
 		return false, errored.Errorf("Error in request: %v - %v", err, resp.Status)
 	}
@@ -456,6 +575,57 @@ func volumeCreate(ctx *cli.Context) (bool, error) {
 	return false, nil
 }
 
+// VolumeAdopt adopts an existing image as a volume.
+func VolumeAdopt(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeAdopt)
+}
+
+func volumeAdopt(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 1 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
+	}
+
+	policy, volume, err := splitVolume(ctx)
+	if err != nil {
+		return true, err
+	}
+
+	if ctx.String("image") == "" {
+		return true, errored.Errorf("--image is required")
+	}
+
+	opts := map[string]string{
+		"image":  ctx.String("image"),
+		"rename": fmt.Sprintf("%v", ctx.Bool("rename")),
+	}
+
+	tc := &config.VolumeRequest{
+		Policy:  policy,
+		Name:    volume,
+		Options: opts,
+	}
+
+	content, err := json.Marshal(tc)
+	if err != nil {
+		return false, errored.Errorf("Could not create request JSON: %v", err)
+	}
+
+	resp, err := httpPost(ctx, fmt.Sprintf("%s/volumes/import", apiserverURL(ctx)), "application/json", bytes.NewBuffer(content))
+	if err != nil {
+		return false, errored.Errorf("Error in request: %v", err)
+	}
+
+	if resp.StatusCode != 200 {
+		qualifiedVolume := fmt.Sprintf("%v/%v", policy, volume)
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
+		}
+		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
+	}
+
+	return false, nil
+}
+
 // VolumeGet retrieves the metadata for a volume and prints it.
 func VolumeGet(ctx *cli.Context) {
 	execCliAndExit(ctx, volumeGet)
@@ -471,7 +641,7 @@ func volumeGet(ctx *cli.Context) (bool, error) {
 		return true, err
 	}
 
-	resp, err := http.Get(fmt.Sprintf("http://%s/volumes/%s/%s", ctx.GlobalString("apiserver"), policy, volume))
+	resp, err := httpGet(ctx, fmt.Sprintf("%s/volumes/%s/%s", apiserverURL(ctx), policy, volume))
 	if err != nil {
 		return false, err
 	}
@@ -499,7 +669,25 @@ func volumeGet(ctx *cli.Context) (bool, error) {
 		return false, err
 	}
 
-	content, err = ppJSON(vol)
+	// the volume is still shown if the nodes cannot be listed, just without the
+	// nodes it may be placed on.
+	nodes, err := queryNodes(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not list nodes, omitting eligible nodes: %v\n", err)
+		content, err = ppJSON(vol)
+	} else {
+		eligible := []string{}
+		for _, node := range nodes {
+			if node.Satisfies(vol.Constraints) {
+				eligible = append(eligible, node.Hostname)
+			}
+		}
+
+		content, err = ppJSON(struct {
+			*config.Volume
+			EligibleNodes []string `json:"eligible-nodes"`
+		}{&vol, eligible})
+	}
 	if err != nil {
 		return false, err
 	}
@@ -534,7 +722,7 @@ func volumeForceRemove(ctx *cli.Context) (bool, error) {
 		return false, err
 	}
 
-	resp, err := deleteRequest(fmt.Sprintf("http://%s/volumes/removeforce", ctx.GlobalString("apiserver")), "application/json", bytes.NewBuffer(content))
+	resp, err := deleteRequest(ctx, fmt.Sprintf("%s/volumes/removeforce", apiserverURL(ctx)), "application/json", bytes.NewBuffer(content))
 	if err != nil {
 		return false, err
 	}
@@ -589,7 +777,7 @@ func volumeRemove(ctx *cli.Context) (bool, error) {
 		return false, err
 	}
 
-	resp, err := deleteRequest(fmt.Sprintf("http://%s/volumes/remove", ctx.GlobalString("apiserver")), "application/json", bytes.NewBuffer(content))
+	resp, err := deleteRequest(ctx, fmt.Sprintf("%s/volumes/remove", apiserverURL(ctx)), "application/json", bytes.NewBuffer(content))
 	if err != nil {
 		return false, err
 	}
@@ -623,7 +811,7 @@ func volumeList(ctx *cli.Context) (bool, error) {
 
 	policy := ctx.Args()[0]
 
-	resp, err := http.Get(fmt.Sprintf("http://%s/volumes/%s", ctx.GlobalString("apiserver"), policy))
+	resp, err := httpGet(ctx, fmt.Sprintf("%s/volumes/%s", apiserverURL(ctx), policy))
 	if err != nil {
 		return false, err
 	}
@@ -645,12 +833,70 @@ func volumeList(ctx *cli.Context) (bool, error) {
 	}
 
 	for _, volume := range volumes {
-		fmt.Println(volume.VolumeName)
+		if !ctx.Bool("usage") {
+			fmt.Println(volume.VolumeName)
+			continue
+		}
+
+		vc, err := queryVolumeCapacity(ctx, volume.PolicyName, volume.VolumeName)
+		if err != nil {
+			return false, err
+		}
+
+		fmt.Println(formatVolumeCapacity(volume.VolumeName, vc))
 	}
 
 	return false, nil
 }
 
+func queryVolumeCapacity(ctx *cli.Context, policy, volume string) (*config.VolumeCapacity, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf("%s/volumes/%s/%s/usage", apiserverURL(ctx), policy, volume))
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, errored.Errorf("Status code was %d not 200: %s", resp.StatusCode, string(content))
+	}
+
+	vc := &config.VolumeCapacity{}
+	if err := json.Unmarshal(content, vc); err != nil {
+		return nil, err
+	}
+
+	return vc, nil
+}
+
+// formatVolumeCapacity yields the tab-delimited usage of a volume: name,
+// used, available, percent used, inodes used, provisioned, actual and alerts.
+// Volumes which are not mounted have no filesystem figures.
+func formatVolumeCapacity(name string, vc *config.VolumeCapacity) string {
+	fields := []string{name, "-", "-", "-", "-", "-", "-"}
+
+	if vc.Hostname != "" {
+		fields[1] = units.BytesSize(float64(vc.UsedBytes))
+		fields[2] = units.BytesSize(float64(vc.AvailableBytes))
+		fields[3] = fmt.Sprintf("%d%%", vc.UsedPercent())
+		fields[4] = fmt.Sprintf("%d%%", vc.InodesPercent())
+	}
+
+	if vc.ProvisionedBytes != 0 {
+		fields[5] = units.BytesSize(float64(vc.ProvisionedBytes))
+		fields[6] = units.BytesSize(float64(vc.ActualBytes))
+	}
+
+	if len(vc.Alerts) > 0 {
+		fields = append(fields, strings.Join(vc.Alerts, "; "))
+	}
+
+	return strings.Join(fields, "\t")
+}
+
 // VolumeSnapshotTake takes a snapshot for a volume immediately.
 func VolumeSnapshotTake(ctx *cli.Context) {
 	execCliAndExit(ctx, volumeSnapshotTake)
@@ -666,7 +912,7 @@ func volumeSnapshotTake(ctx *cli.Context) (bool, error) {
 		return true, err
 	}
 
-	resp, err := http.Post(fmt.Sprintf("http://%s/snapshots/take/%s/%s", ctx.GlobalString("apiserver"), policy, volume), "application/json", nil)
+	resp, err := httpPost(ctx, fmt.Sprintf("%s/snapshots/take/%s/%s", apiserverURL(ctx), policy, volume), "application/json", nil)
 	if err != nil {
 		return false, err
 	}
@@ -714,7 +960,7 @@ func volumeSnapshotCopy(ctx *cli.Context) (bool, error) {
 		return false, errored.Errorf("Could not create request JSON: %v", err)
 	}
 
-	resp, err := http.Post(fmt.Sprintf("http://%s/volumes/copy", ctx.GlobalString("apiserver")), "application/json", bytes.NewBuffer(content))
+	resp, err := httpPost(ctx, fmt.Sprintf("%s/volumes/copy", apiserverURL(ctx)), "application/json", bytes.NewBuffer(content))
 	if err != nil {
 		return false, err
 	}
@@ -757,7 +1003,7 @@ func volumeSnapshotList(ctx *cli.Context) (bool, error) {
 		return true, err
 	}
 
-	resp, err := http.Get(fmt.Sprintf("http://%s/snapshots/%s/%s", ctx.GlobalString("apiserver"), policy, volume))
+	resp, err := httpGet(ctx, fmt.Sprintf("%s/snapshots/%s/%s", apiserverURL(ctx), policy, volume))
 	if err != nil {
 		return false, err
 	}
@@ -788,84 +1034,79 @@ func volumeSnapshotList(ctx *cli.Context) (bool, error) {
 	return false, nil
 }
 
-// VolumeListAll returns a list of the pools the apiserver knows about.
-func VolumeListAll(ctx *cli.Context) {
-	execCliAndExit(ctx, volumeListAll)
+// VolumeMigrate requests a handoff of a locked volume to another host.
+func VolumeMigrate(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeMigrate)
 }
 
-func volumeListAll(ctx *cli.Context) (bool, error) {
-	var volumes []config.Volume
-	if len(ctx.Args()) != 0 {
-		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
+func volumeMigrate(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 1 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
 	}
 
-	resp, err := http.Get(fmt.Sprintf("http://%s/volumes/", ctx.GlobalString("apiserver")))
+	policy, volume, err := splitVolume(ctx)
 	if err != nil {
-		return false, err
+		return true, err
 	}
 
-	if resp.StatusCode != 200 {
-		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
-			return false, errored.Errorf("Error copying body: %v\nResponse Status Code was %d, not 200", err, resp.StatusCode)
-		}
-		return false, errored.Errorf("Response Status Code was %d, not 200", resp.StatusCode)
+	if ctx.String("to") == "" {
+		return true, errored.Errorf("You must supply a host to migrate to with --to")
 	}
 
-	content, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return false, err
+	request := config.VolumeRequest{
+		Policy: policy,
+		Name:   volume,
+		Options: map[string]string{
+			"to":    ctx.String("to"),
+			"grace": ctx.String("grace"),
+		},
 	}
 
-	if err := json.Unmarshal(content, &volumes); err != nil {
+	content, err := json.Marshal(request)
+	if err != nil {
 		return false, err
 	}
 
-	for _, volume := range volumes {
-		fmt.Printf("%v/%v\n", volume.PolicyName, volume.VolumeName)
+	resp, err := httpPost(ctx, fmt.Sprintf("%s/volumes/migrate", apiserverURL(ctx)), "application/json", bytes.NewBuffer(content))
+	if err != nil {
+		return false, err
 	}
 
-	return false, nil
-}
-
-// UseList returns a list of the mounts the apiserver knows about.
-func UseList(ctx *cli.Context) {
-	execCliAndExit(ctx, useList)
-}
+	qualifiedVolume := strings.Join([]string{policy, volume}, "/")
 
-func useList(ctx *cli.Context) (bool, error) {
-	if len(ctx.Args()) != 0 {
-		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
+	if resp.StatusCode != 200 {
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
+		}
+		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
 	}
 
-	cfg, err := config.NewClient(ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd"))
+	content, err = ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return false, err
 	}
 
-	var uses []string
-	if ctx.Bool("snapshots") {
-		uses, err = cfg.ListUses("snapshot")
-	} else {
-		uses, err = cfg.ListUses("mount")
+	handoff := &config.Handoff{}
+	if err := json.Unmarshal(content, handoff); err != nil {
+		return false, err
 	}
 
+	content, err = ppJSON(handoff)
 	if err != nil {
 		return false, err
 	}
 
-	for _, name := range uses {
-		fmt.Println(name)
-	}
+	fmt.Println(string(content))
 
 	return false, nil
 }
 
-// UseGet retrieves the JSON information for a mount.
-func UseGet(ctx *cli.Context) {
-	execCliAndExit(ctx, useGet)
+// VolumeMigrateStatus retrieves the status of the last handoff of a volume.
+func VolumeMigrateStatus(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeMigrateStatus)
 }
 
-func useGet(ctx *cli.Context) (bool, error) {
+func volumeMigrateStatus(ctx *cli.Context) (bool, error) {
 	if len(ctx.Args()) != 1 {
 		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
 	}
@@ -875,29 +1116,35 @@ func useGet(ctx *cli.Context) (bool, error) {
 		return true, err
 	}
 
-	cfg, err := config.NewClient(ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd"))
+	qualifiedVolume := strings.Join([]string{policy, volume}, "/")
+
+	resp, err := httpGet(ctx, fmt.Sprintf("%s/handoffs/%s/%s", apiserverURL(ctx), policy, volume))
 	if err != nil {
 		return false, err
 	}
 
-	vc := &config.Volume{
-		PolicyName: policy,
-		VolumeName: volume,
+	if resp.StatusCode == 404 {
+		return false, errored.Errorf("No handoff exists for volume %v.", qualifiedVolume)
 	}
 
-	var ul config.UseLocker
+	if resp.StatusCode != 200 {
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
+		}
+		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
+	}
 
-	if ctx.Bool("snapshot") {
-		ul = &config.UseSnapshot{}
-	} else {
-		ul = &config.UseMount{}
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
 	}
 
-	if err := cfg.GetUse(ul, vc); err != nil {
+	handoff := &config.Handoff{}
+	if err := json.Unmarshal(content, handoff); err != nil {
 		return false, err
 	}
 
-	content, err := ppJSON(ul)
+	content, err = ppJSON(handoff)
 	if err != nil {
 		return false, err
 	}
@@ -907,13 +1154,12 @@ func useGet(ctx *cli.Context) (bool, error) {
 	return false, nil
 }
 
-// UseTheForce deletes the use entry from etcd; useful for clearing a
-// stale mount.
-func UseTheForce(ctx *cli.Context) {
-	execCliAndExit(ctx, useTheForce)
+// VolumeMigrateCancel cancels the handoff of a volume.
+func VolumeMigrateCancel(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeMigrateCancel)
 }
 
-func useTheForce(ctx *cli.Context) (bool, error) {
+func volumeMigrateCancel(ctx *cli.Context) (bool, error) {
 	if len(ctx.Args()) != 1 {
 		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
 	}
@@ -923,43 +1169,201 @@ func useTheForce(ctx *cli.Context) (bool, error) {
 		return true, err
 	}
 
-	cfg, err := config.NewClient(ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd"))
+	qualifiedVolume := strings.Join([]string{policy, volume}, "/")
+
+	resp, err := deleteRequest(ctx, fmt.Sprintf("%s/handoffs/%s/%s", apiserverURL(ctx), policy, volume), "application/json", nil)
 	if err != nil {
 		return false, err
 	}
 
-	vc := &config.Volume{
-		PolicyName: policy,
-		VolumeName: volume,
+	if resp.StatusCode == 404 {
+		return false, errored.Errorf("No handoff exists for volume %v.", qualifiedVolume)
 	}
 
-	if err := cfg.RemoveUse(&config.UseMount{Volume: vc.String()}, true); err != nil {
-		fmt.Fprintf(os.Stderr, "Trouble removing mount lock (may be harmless) for %q: %v", vc, err)
+	if resp.StatusCode != 200 {
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return false, errored.Errorf("Error copying body: %v\n Volume %v Response Status Code was %d, not 200", err, qualifiedVolume, resp.StatusCode)
+		}
+		return false, errored.Errorf("Volume %v Response Status Code was %d, not 200", qualifiedVolume, resp.StatusCode)
 	}
 
-	if err := cfg.RemoveUse(&config.UseSnapshot{Volume: vc.String()}, true); err != nil {
-		fmt.Fprintf(os.Stderr, "Trouble removing snapshot lock (may be harmless) for %q: %v", vc, err)
-	}
+	fmt.Printf("Handoff of %q cancelled\n", qualifiedVolume)
 
 	return false, nil
 }
 
-// UseExec acquires a lock (waiting if necessary) and executes a command when it takes it.
-func UseExec(ctx *cli.Context) {
-	execCliAndExit(ctx, useExec)
+// VolumeListAll returns a list of the pools the apiserver knows about.
+func VolumeListAll(ctx *cli.Context) {
+	execCliAndExit(ctx, volumeListAll)
 }
 
-func useExec(ctx *cli.Context) (bool, error) {
-	if len(ctx.Args()) < 2 {
-		return true, errorInvalidArgCount(len(ctx.Args()), 2, ctx.Args())
-	}
+func volumeListAll(ctx *cli.Context) (bool, error) {
+	var volumes []config.Volume
+	if len(ctx.Args()) != 0 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
+	}
+
+	resp, err := httpGet(ctx, fmt.Sprintf("%s/volumes/", apiserverURL(ctx)))
+	if err != nil {
+		return false, err
+	}
+
+	if resp.StatusCode != 200 {
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return false, errored.Errorf("Error copying body: %v\nResponse Status Code was %d, not 200", err, resp.StatusCode)
+		}
+		return false, errored.Errorf("Response Status Code was %d, not 200", resp.StatusCode)
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	if err := json.Unmarshal(content, &volumes); err != nil {
+		return false, err
+	}
+
+	for _, volume := range volumes {
+		fmt.Printf("%v/%v\n", volume.PolicyName, volume.VolumeName)
+	}
+
+	return false, nil
+}
+
+// UseList returns a list of the mounts the apiserver knows about.
+func UseList(ctx *cli.Context) {
+	execCliAndExit(ctx, useList)
+}
+
+func useList(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 0 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
+	}
+
+	cfg, err := config.NewStoreClient(ctx.GlobalString("prefix"), ctx.GlobalString("store"), ctx.GlobalStringSlice("etcd"))
+	if err != nil {
+		return false, err
+	}
+
+	var uses []string
+	if ctx.Bool("snapshots") {
+		uses, err = cfg.ListUses("snapshot")
+	} else {
+		uses, err = cfg.ListUses("mount")
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, name := range uses {
+		fmt.Println(name)
+	}
+
+	return false, nil
+}
+
+// UseGet retrieves the JSON information for a mount.
+func UseGet(ctx *cli.Context) {
+	execCliAndExit(ctx, useGet)
+}
+
+func useGet(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 1 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
+	}
+
+	policy, volume, err := splitVolume(ctx)
+	if err != nil {
+		return true, err
+	}
+
+	cfg, err := config.NewStoreClient(ctx.GlobalString("prefix"), ctx.GlobalString("store"), ctx.GlobalStringSlice("etcd"))
+	if err != nil {
+		return false, err
+	}
+
+	vc := &config.Volume{
+		PolicyName: policy,
+		VolumeName: volume,
+	}
+
+	var ul config.UseLocker
+
+	if ctx.Bool("snapshot") {
+		ul = &config.UseSnapshot{}
+	} else {
+		ul = &config.UseMount{}
+	}
+
+	if err := cfg.GetUse(ul, vc); err != nil {
+		return false, err
+	}
+
+	content, err := ppJSON(ul)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Println(string(content))
+
+	return false, nil
+}
+
+// UseTheForce deletes the use entry from etcd; useful for clearing a
+// stale mount.
+func UseTheForce(ctx *cli.Context) {
+	execCliAndExit(ctx, useTheForce)
+}
+
+func useTheForce(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 1 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
+	}
 
 	policy, volume, err := splitVolume(ctx)
 	if err != nil {
 		return true, err
 	}
 
-	cfg, err := config.NewClient(ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd"))
+	cfg, err := config.NewStoreClient(ctx.GlobalString("prefix"), ctx.GlobalString("store"), ctx.GlobalStringSlice("etcd"))
+	if err != nil {
+		return false, err
+	}
+
+	vc := &config.Volume{
+		PolicyName: policy,
+		VolumeName: volume,
+	}
+
+	if err := cfg.RemoveUse(&config.UseMount{Volume: vc.String()}, true); err != nil {
+		fmt.Fprintf(os.Stderr, "Trouble removing mount lock (may be harmless) for %q: %v", vc, err)
+	}
+
+	if err := cfg.RemoveUse(&config.UseSnapshot{Volume: vc.String()}, true); err != nil {
+		fmt.Fprintf(os.Stderr, "Trouble removing snapshot lock (may be harmless) for %q: %v", vc, err)
+	}
+
+	return false, nil
+}
+
+// UseExec acquires a lock (waiting if necessary) and executes a command when it takes it.
+func UseExec(ctx *cli.Context) {
+	execCliAndExit(ctx, useExec)
+}
+
+func useExec(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) < 2 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 2, ctx.Args())
+	}
+
+	policy, volume, err := splitVolume(ctx)
+	if err != nil {
+		return true, err
+	}
+
+	cfg, err := config.NewStoreClient(ctx.GlobalString("prefix"), ctx.GlobalString("store"), ctx.GlobalStringSlice("etcd"))
 	if err != nil {
 		return false, err
 	}
@@ -1029,7 +1433,7 @@ func volumeRuntimeGet(ctx *cli.Context) (bool, error) {
 		return true, err
 	}
 
-	resp, err := http.Get(fmt.Sprintf("http://%s/runtime/%s/%s", ctx.GlobalString("apiserver"), policy, volume))
+	resp, err := httpGet(ctx, fmt.Sprintf("%s/runtime/%s/%s", apiserverURL(ctx), policy, volume))
 	if err != nil {
 		return false, err
 	}
@@ -1089,7 +1493,7 @@ func volumeRuntimeUpload(ctx *cli.Context) (bool, error) {
 		return false, err
 	}
 
-	resp, err := http.Post(fmt.Sprintf("http://%s/runtime/%s/%s", ctx.GlobalString("apiserver"), policy, volume), "application/json", bytes.NewBuffer(content))
+	resp, err := httpPost(ctx, fmt.Sprintf("%s/runtime/%s/%s", apiserverURL(ctx), policy, volume), "application/json", bytes.NewBuffer(content))
 	if err != nil {
 		return false, err
 	}
@@ -1104,3 +1508,535 @@ func volumeRuntimeUpload(ctx *cli.Context) (bool, error) {
 
 	return false, nil
 }
+
+func queryNodes(ctx *cli.Context) ([]*config.Node, error) {
+	resp, err := httpGet(ctx, fmt.Sprintf("%s/nodes", apiserverURL(ctx)))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return nil, errored.Errorf("Error copying body: %v\nResponse Status Code was %d, not 200", err, resp.StatusCode)
+		}
+		return nil, errored.Errorf("Response Status Code was %d, not 200", resp.StatusCode)
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []*config.Node{}
+	if err := json.Unmarshal(content, &nodes); err != nil {
+		return nil, err
+	}
+
+	return nodes, nil
+}
+
+// NodeList lists the volplugin hosts which are currently heartbeating.
+func NodeList(ctx *cli.Context) {
+	execCliAndExit(ctx, nodeList)
+}
+
+func nodeList(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 0 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
+	}
+
+	nodes, err := queryNodes(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, node := range nodes {
+		fmt.Println(node.Hostname)
+	}
+
+	return false, nil
+}
+
+// NodeGet retrieves the registration information for a volplugin host.
+func NodeGet(ctx *cli.Context) {
+	execCliAndExit(ctx, nodeGet)
+}
+
+func nodeGet(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 1 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
+	}
+
+	hostname := ctx.Args()[0]
+
+	resp, err := httpGet(ctx, fmt.Sprintf("%s/nodes/%s", apiserverURL(ctx), hostname))
+	if err != nil {
+		return false, err
+	}
+
+	if resp.StatusCode == 404 {
+		return false, errored.Errorf("Node %v is not registered.", hostname)
+	}
+
+	if resp.StatusCode != 200 {
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return false, errored.Errorf("Error copying body: %v\n Node %v Response Status Code was %d, not 200", err, hostname, resp.StatusCode)
+		}
+		return false, errored.Errorf("Node %v Response Status Code was %d, not 200", hostname, resp.StatusCode)
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	node := &config.Node{}
+	if err := json.Unmarshal(content, node); err != nil {
+		return false, err
+	}
+
+	content, err = ppJSON(node)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Println(string(content))
+
+	return false, nil
+}
+
+// OperationList lists the in-flight operations recorded in the journal.
+func OperationList(ctx *cli.Context) {
+	execCliAndExit(ctx, operationList)
+}
+
+func operationList(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 0 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
+	}
+
+	resp, err := httpGet(ctx, fmt.Sprintf("%s/operations", apiserverURL(ctx)))
+	if err != nil {
+		return false, err
+	}
+
+	if resp.StatusCode != 200 {
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return false, errored.Errorf("Error copying body: %v\nResponse Status Code was %d, not 200", err, resp.StatusCode)
+		}
+		return false, errored.Errorf("Response Status Code was %d, not 200", resp.StatusCode)
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	ops := []*config.Operation{}
+	if err := json.Unmarshal(content, &ops); err != nil {
+		return false, err
+	}
+
+	for _, op := range ops {
+		fmt.Printf("%v\t%s\t%s\t%s\t%s\n", op.Volume, op.Type, op.Step, op.Hostname, op.Started.Format(time.RFC3339))
+	}
+
+	return false, nil
+}
+
+// Events prints the volume event log, and follows it if requested.
+func Events(ctx *cli.Context) {
+	execCliAndExit(ctx, events)
+}
+
+func events(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 0 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
+	}
+
+	url := fmt.Sprintf("%s/events", apiserverURL(ctx))
+	if volume := ctx.String("volume"); volume != "" {
+		if len(strings.Split(volume, "/")) != 2 {
+			return true, errorInvalidVolumeSyntax(volume, `<policyName>/<volumeName>`)
+		}
+		url = fmt.Sprintf("%s/%s", url, volume)
+	}
+
+	if ctx.Bool("follow") {
+		url += "?follow=true"
+	}
+
+	resp, err := httpGet(ctx, url)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return false, errored.Errorf("Error copying body: %v\nResponse Status Code was %d, not 200", err, resp.StatusCode)
+		}
+		return false, errored.Errorf("Response Status Code was %d, not 200", resp.StatusCode)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		ev := &config.Event{}
+		if err := dec.Decode(ev); err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\n", ev.Time.Format(time.RFC3339), ev.Volume, ev.Type, ev.Hostname, ev.Message)
+	}
+}
+
+// Health reports the health of the apiserver and of every registered
+// volplugin host.
+func Health(ctx *cli.Context) {
+	execCliAndExit(ctx, health)
+}
+
+func health(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 0 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
+	}
+
+	resp, err := httpGet(ctx, fmt.Sprintf("%s/readyz", apiserverURL(ctx)))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 && resp.StatusCode != http.StatusServiceUnavailable {
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return false, errored.Errorf("Error copying body: %v\nResponse Status Code was %d, not 200", err, resp.StatusCode)
+		}
+		return false, errored.Errorf("Response Status Code was %d, not 200", resp.StatusCode)
+	}
+
+	apiserver := &config.Health{}
+	if err := json.NewDecoder(resp.Body).Decode(apiserver); err != nil {
+		return false, err
+	}
+
+	nodes, err := queryNodes(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	unhealthy := printHealth("apiserver", apiserver)
+	for _, node := range nodes {
+		if node.Health == nil {
+			fmt.Printf("volplugin %s\t-\tunknown\tno health reported\n", node.Hostname)
+			continue
+		}
+
+		unhealthy += printHealth("volplugin", node.Health)
+	}
+
+	if unhealthy > 0 {
+		return false, errored.Errorf("%d daemons are unhealthy", unhealthy)
+	}
+
+	return false, nil
+}
+
+// printHealth prints the checks of the report in tab-delimited form, and
+// returns 1 if the report is unhealthy.
+func printHealth(daemon string, health *config.Health) int {
+	for _, check := range health.Checks {
+		status := "ok"
+		switch {
+		case !check.OK && check.Optional:
+			status = "warning"
+		case !check.OK:
+			status = "failed"
+		}
+
+		fmt.Printf("%s %s\t%s\t%s\t%s\n", daemon, health.Hostname, check.Name, status, check.Message)
+	}
+
+	if health.Healthy() {
+		return 0
+	}
+
+	return 1
+}
+
+// DebugBundle writes a debug bundle collected by the apiserver.
+func DebugBundle(ctx *cli.Context) {
+	execCliAndExit(ctx, debugBundle)
+}
+
+func debugBundle(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 0 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
+	}
+
+	if _, err := time.ParseDuration(ctx.String("wait")); err != nil {
+		return true, err
+	}
+
+	resp, err := httpGet(ctx, fmt.Sprintf("%s/debug/bundle?wait=%s&logs=%v", apiserverURL(ctx), ctx.String("wait"), ctx.Bool("logs")))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		if _, err := io.Copy(os.Stderr, resp.Body); err != nil {
+			return false, errored.Errorf("Error copying body: %v\nResponse Status Code was %d, not 200", err, resp.StatusCode)
+		}
+		return false, errored.Errorf("Response Status Code was %d, not 200", resp.StatusCode)
+	}
+
+	output := ctx.String("output")
+	if output == "" {
+		output = fmt.Sprintf("volplugin_debug_%s.tar.gz", time.Now().Format("20060102-150405"))
+	}
+
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return false, err
+	}
+
+	fmt.Println(output)
+	return false, nil
+}
+
+// WebhookDeadLetters lists the events which could not be delivered to webhook
+// receivers.
+func WebhookDeadLetters(ctx *cli.Context) {
+	execCliAndExit(ctx, webhookDeadLetters)
+}
+
+func webhookDeadLetters(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 0 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
+	}
+
+	cfg, err := config.NewStoreClient(ctx.GlobalString("prefix"), ctx.GlobalString("store"), ctx.GlobalStringSlice("etcd"))
+	if err != nil {
+		return false, err
+	}
+
+	letters, err := cfg.ListDeadLetters()
+	if err != nil {
+		return false, err
+	}
+
+	for _, dl := range letters {
+		fmt.Printf("%s\t%s\t%s\t%s\t%d\t%s\n", dl.Time.Format(time.RFC3339), dl.URL, dl.Event.Volume, dl.Event.Type, dl.Attempts, dl.Error)
+	}
+
+	return false, nil
+}
+
+// Fsck checks the volume records against the images held by the storage
+// backends and, optionally, the mounts on this host. Repairs are performed
+// when requested.
+func Fsck(ctx *cli.Context) {
+	execCliAndExit(ctx, fsck)
+}
+
+func fsck(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 0 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
+	}
+
+	// stale mounts are only found when the mounts are checked.
+	if ctx.Bool("release-mounts") && !ctx.Bool("mounts") {
+		return true, errored.Errorf("--release-mounts requires --mounts")
+	}
+
+	cfg, err := config.NewStoreClient(ctx.GlobalString("prefix"), ctx.GlobalString("store"), ctx.GlobalStringSlice("etcd"))
+	if err != nil {
+		return false, err
+	}
+
+	global, err := cfg.GetGlobal()
+	if err != nil {
+		return false, err
+	}
+
+	host := ctx.String("host-label")
+	if host == "" {
+		host, err = os.Hostname()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	reconciler := &reconcile.Reconciler{Config: cfg, Hostname: host, Timeout: global.Timeout}
+
+	report, err := reconciler.CheckImages()
+	if err != nil {
+		return false, err
+	}
+
+	if ctx.Bool("mounts") {
+		report.StaleMounts, err = reconciler.CheckMounts(global.MountPath)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	content, err := ppJSON(report)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Println(string(content))
+
+	var failed bool
+
+	repair := func(desc string, err error) {
+		if err != nil {
+			failed = true
+			fmt.Fprintf(os.Stderr, "Could not %s: %v\n", desc, err)
+			return
+		}
+
+		fmt.Fprintf(os.Stderr, "Repaired: %s\n", desc)
+	}
+
+	if ctx.Bool("adopt") {
+		for _, image := range report.OrphanedImages {
+			repair(fmt.Sprintf("adopt image %q", image), reconciler.Adopt(image))
+		}
+	}
+
+	if ctx.Bool("remove-missing") {
+		for _, volume := range report.MissingImages {
+			repair(fmt.Sprintf("remove record of volume %q", volume), reconciler.RemoveRecord(volume))
+		}
+	}
+
+	if ctx.Bool("release-mounts") {
+		for _, sm := range report.StaleMounts {
+			repair(fmt.Sprintf("release mount of volume %q", sm.Volume), reconciler.ReleaseMount(sm, global.MountPath))
+		}
+	}
+
+	if failed {
+		return false, errored.Errorf("Some repairs failed")
+	}
+
+	return false, nil
+}
+
+// IdentitySet creates or updates an identity and its grants. Requires direct
+// access to etcd.
+func IdentitySet(ctx *cli.Context) {
+	execCliAndExit(ctx, identitySet)
+}
+
+func identitySet(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 1 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
+	}
+
+	id := &config.Identity{Name: ctx.Args()[0], Grants: map[string]string{}}
+
+	for _, grant := range ctx.StringSlice("grant") {
+		parts := strings.SplitN(grant, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return true, errored.Errorf("Invalid grant %q: must be in the form of %q", grant, "<policyName>=<role>")
+		}
+		id.Grants[parts[0]] = parts[1]
+	}
+
+	cfg, err := config.NewStoreClient(ctx.GlobalString("prefix"), ctx.GlobalString("store"), ctx.GlobalStringSlice("etcd"))
+	if err != nil {
+		return false, err
+	}
+
+	if token := ctx.String("token"); token != "" {
+		id.TokenHash = config.HashToken(token)
+	} else if existing, err := cfg.GetIdentity(id.Name); err == nil {
+		id.TokenHash = existing.TokenHash
+	}
+
+	return false, cfg.PublishIdentity(id)
+}
+
+// IdentityGet displays an identity and its grants.
+func IdentityGet(ctx *cli.Context) {
+	execCliAndExit(ctx, identityGet)
+}
+
+func identityGet(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 1 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
+	}
+
+	cfg, err := config.NewStoreClient(ctx.GlobalString("prefix"), ctx.GlobalString("store"), ctx.GlobalStringSlice("etcd"))
+	if err != nil {
+		return false, err
+	}
+
+	id, err := cfg.GetIdentity(ctx.Args()[0])
+	if err != nil {
+		return false, err
+	}
+
+	content, err := ppJSON(id)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Println(string(content))
+	return false, nil
+}
+
+// IdentityList lists the names of the identities.
+func IdentityList(ctx *cli.Context) {
+	execCliAndExit(ctx, identityList)
+}
+
+func identityList(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 0 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
+	}
+
+	cfg, err := config.NewStoreClient(ctx.GlobalString("prefix"), ctx.GlobalString("store"), ctx.GlobalStringSlice("etcd"))
+	if err != nil {
+		return false, err
+	}
+
+	ids, err := cfg.ListIdentities()
+	if err != nil {
+		return false, err
+	}
+
+	for _, id := range ids {
+		fmt.Println(id.Name)
+	}
+
+	return false, nil
+}
+
+// IdentityRemove removes an identity. Its credentials are refused from then on.
+func IdentityRemove(ctx *cli.Context) {
+	execCliAndExit(ctx, identityRemove)
+}
+
+func identityRemove(ctx *cli.Context) (bool, error) {
+	if len(ctx.Args()) != 1 {
+		return true, errorInvalidArgCount(len(ctx.Args()), 1, ctx.Args())
+	}
+
+	cfg, err := config.NewStoreClient(ctx.GlobalString("prefix"), ctx.GlobalString("store"), ctx.GlobalStringSlice("etcd"))
+	if err != nil {
+		return false, err
+	}
+
+	return false, cfg.RemoveIdentity(ctx.Args()[0])
+}
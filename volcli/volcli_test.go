@@ -1,10 +1,16 @@
 package volcli
 
 import (
+	"encoding/json"
 	"flag"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	. "testing"
 
 	"github.com/codegangsta/cli"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/logging"
 
 	. "gopkg.in/check.v1"
 )
@@ -52,6 +58,11 @@ func (s *volcliSuite) TestErrorReturns(c *C) {
 			args: []string{},
 			err:  errorInvalidArgCount(0, 1, []string{}),
 		},
+		"policyUsage": {
+			f:    policyUsage,
+			args: []string{},
+			err:  errorInvalidArgCount(0, 1, []string{}),
+		},
 		"policyWatch": {
 			f:    policyWatch,
 			args: []string{"foo"},
@@ -97,6 +108,21 @@ func (s *volcliSuite) TestErrorReturns(c *C) {
 			args: []string{"foo"},
 			err:  errorInvalidVolumeSyntax("foo", `<policyName>/<volumeName>`),
 		},
+		"volumeMigrate": {
+			f:    volumeMigrate,
+			args: []string{},
+			err:  errorInvalidArgCount(0, 1, []string{}),
+		},
+		"volumeMigrateInvalidPolicy": {
+			f:    volumeMigrate,
+			args: []string{"foo"},
+			err:  errorInvalidVolumeSyntax("foo", `<policyName>/<volumeName>`),
+		},
+		"volumeMigrateStatus": {
+			f:    volumeMigrateStatus,
+			args: []string{},
+			err:  errorInvalidArgCount(0, 1, []string{}),
+		},
 		"volumeList": {
 			f:    volumeList,
 			args: []string{},
@@ -137,6 +163,71 @@ func (s *volcliSuite) TestErrorReturns(c *C) {
 			args: []string{"foo"},
 			err:  errorInvalidArgCount(1, 0, []string{"foo"}),
 		},
+		"nodeList": {
+			f:    nodeList,
+			args: []string{"foo"},
+			err:  errorInvalidArgCount(1, 0, []string{"foo"}),
+		},
+		"nodeGet": {
+			f:    nodeGet,
+			args: []string{},
+			err:  errorInvalidArgCount(0, 1, []string{}),
+		},
+		"operationList": {
+			f:    operationList,
+			args: []string{"foo"},
+			err:  errorInvalidArgCount(1, 0, []string{"foo"}),
+		},
+		"events": {
+			f:    events,
+			args: []string{"foo"},
+			err:  errorInvalidArgCount(1, 0, []string{"foo"}),
+		},
+		"health": {
+			f:    health,
+			args: []string{"foo"},
+			err:  errorInvalidArgCount(1, 0, []string{"foo"}),
+		},
+		"debugBundle": {
+			f:    debugBundle,
+			args: []string{"foo"},
+			err:  errorInvalidArgCount(1, 0, []string{"foo"}),
+		},
+		"webhookDeadLetters": {
+			f:    webhookDeadLetters,
+			args: []string{"foo"},
+			err:  errorInvalidArgCount(1, 0, []string{"foo"}),
+		},
+		"volumeAdopt": {
+			f:    volumeAdopt,
+			args: []string{},
+			err:  errorInvalidArgCount(0, 1, []string{}),
+		},
+		"fsck": {
+			f:    fsck,
+			args: []string{"foo"},
+			err:  errorInvalidArgCount(1, 0, []string{"foo"}),
+		},
+		"identitySet": {
+			f:    identitySet,
+			args: []string{},
+			err:  errorInvalidArgCount(0, 1, []string{}),
+		},
+		"identityGet": {
+			f:    identityGet,
+			args: []string{},
+			err:  errorInvalidArgCount(0, 1, []string{}),
+		},
+		"identityList": {
+			f:    identityList,
+			args: []string{"foo"},
+			err:  errorInvalidArgCount(1, 0, []string{"foo"}),
+		},
+		"identityRemove": {
+			f:    identityRemove,
+			args: []string{},
+			err:  errorInvalidArgCount(0, 1, []string{}),
+		},
 		"globalUpload": {
 			f:    globalUpload,
 			args: []string{"foo"},
@@ -152,3 +243,83 @@ func (s *volcliSuite) TestErrorReturns(c *C) {
 		c.Assert(err.Error(), Equals, test.err.Error(), Commentf("test key: %q", key))
 	}
 }
+
+func (s *volcliSuite) TestFormatVolumeCapacity(c *C) {
+	c.Assert(formatVolumeCapacity("test", &config.VolumeCapacity{}), Equals, "test\t-\t-\t-\t-\t-\t-")
+
+	vc := &config.VolumeCapacity{
+		Hostname:         "host1",
+		UsedBytes:        3 * 1024 * 1024,
+		AvailableBytes:   1024 * 1024,
+		UsedInodes:       1,
+		TotalInodes:      4,
+		ProvisionedBytes: 10 * 1024 * 1024,
+		ActualBytes:      4 * 1024 * 1024,
+		Alerts:           []string{"space 75% used, threshold 70%"},
+	}
+	c.Assert(formatVolumeCapacity("test", vc), Equals, "test\t3 MiB\t1 MiB\t75%\t25%\t10 MiB\t4 MiB\tspace 75% used, threshold 70%")
+}
+
+// apiserverContext returns a context for running a command with the args
+// against the apiserver served by handler.
+func apiserverContext(c *C, handler http.Handler, args ...string) (*cli.Context, func()) {
+	server := httptest.NewServer(handler)
+
+	global := flag.NewFlagSet("global", flag.PanicOnError)
+	global.String("apiserver", strings.TrimPrefix(server.URL, "http://"), "")
+	for _, name := range []string{"token", "tls-cert", "tls-key", "tls-ca"} {
+		global.String(name, "", "")
+	}
+
+	fs := flag.NewFlagSet("test", flag.PanicOnError)
+	c.Assert(fs.Parse(args), IsNil)
+
+	return cli.NewContext(nil, fs, cli.NewContext(nil, global, nil)), server.Close
+}
+
+func (s *volcliSuite) TestVolumeGetWithoutNodes(c *C) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/volumes/policy1/foo", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&config.Volume{PolicyName: "policy1", VolumeName: "foo"})
+	})
+	mux.HandleFunc("/nodes", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "etcd is unavailable", http.StatusInternalServerError)
+	})
+
+	ctx, done := apiserverContext(c, mux, "policy1/foo")
+	defer done()
+
+	_, err := volumeGet(ctx)
+	c.Assert(err, IsNil)
+}
+
+func (s *volcliSuite) TestRequestID(c *C) {
+	ids := []string{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, r.Header.Get(logging.RequestIDHeader))
+		w.Write([]byte("{}"))
+	})
+
+	ctx, done := apiserverContext(c, handler)
+	defer done()
+
+	_, err := globalGet(ctx)
+	c.Assert(err, IsNil)
+	_, err = globalGet(ctx)
+	c.Assert(err, IsNil)
+
+	// the requests of a command share its ID.
+	c.Assert(ids, DeepEquals, []string{requestID, requestID})
+	c.Assert(requestID, Not(Equals), "")
+}
+
+func (s *volcliSuite) TestFsckReleaseMountsRequiresMounts(c *C) {
+	fs := flag.NewFlagSet("test", flag.PanicOnError)
+	fs.Bool("mounts", false, "")
+	fs.Bool("release-mounts", false, "")
+	c.Assert(fs.Parse([]string{"--release-mounts"}), IsNil)
+
+	showHelp, err := fsck(cli.NewContext(nil, fs, nil))
+	c.Assert(showHelp, Equals, true)
+	c.Assert(err, ErrorMatches, ".*requires --mounts.*")
+}
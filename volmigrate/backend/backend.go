@@ -37,3 +37,20 @@ type Backend interface {
 	// UpdateSchemaVersion records the version number of the latest migration which successfully ran.
 	UpdateSchemaVersion(version int64) error
 }
+
+// Walker is implemented by backends whose keys can be copied into another.
+type Walker interface {
+	// Walk calls the function for each directory and key under the prefix, with
+	// its path relative to the prefix. Directories come before the keys in them.
+	// Keys with a TTL are skipped, as they are only held while their owner runs.
+	// If the function returns an error, Walk stops and returns it.
+	Walk(func(path string, dir bool, contents []byte) error) error
+}
+
+// Importer is implemented by backends which are created with another backend
+// to copy keys from.
+type Importer interface {
+	// Import copies the keys of the backend it was created with which do not
+	// exist yet, except for SchemaVersionKey.
+	Import() error
+}
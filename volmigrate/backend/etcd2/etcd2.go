@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"path"
 	"strconv"
+	"strings"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/contiv/errored"
@@ -99,6 +100,36 @@ func (e *Engine) DeleteKey(target string) error {
 	return nil
 }
 
+// Walk calls the function for each directory and key under the prefix.
+func (e *Engine) Walk(walkFunc func(path string, dir bool, contents []byte) error) error {
+	resp, err := e.etcdClient.Get(context.Background(), e.prefix, &client.GetOptions{Recursive: true, Sort: true})
+	if err != nil {
+		return errored.Errorf("Failed to list %s: %s", e.prefix, err)
+	}
+
+	return e.walk(resp.Node.Nodes, walkFunc)
+}
+
+func (e *Engine) walk(nodes client.Nodes, walkFunc func(path string, dir bool, contents []byte) error) error {
+	for _, node := range nodes {
+		if node.TTL != 0 {
+			continue
+		}
+
+		target := strings.TrimPrefix(strings.TrimPrefix(node.Key, e.prefix), "/")
+
+		if err := walkFunc(target, node.Dir, []byte(node.Value)); err != nil {
+			return err
+		}
+
+		if err := e.walk(node.Nodes, walkFunc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Name returns the name of the engine ("etcd2", "etcd3", "consul", etc.)
 func (e *Engine) Name() string {
 	return "etcd2"
@@ -0,0 +1,221 @@
+package etcd3
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	etcd3kv "github.com/contiv/volplugin/db/impl/etcd3"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/volmigrate/backend"
+	"golang.org/x/net/context"
+)
+
+// New creates a new etcd3 migration engine. If source is not nil, Import
+// copies its keys into etcd.
+func New(prefix, address string, source backend.Walker) *Engine {
+	kv, err := etcd3kv.NewKV(address)
+	if err != nil {
+		logrus.Fatalf("Failed to create etcd3 client: %s", err)
+	}
+
+	return &Engine{
+		kv:     kv,
+		prefix: "/" + strings.Trim(prefix, "/"),
+		source: source,
+	}
+}
+
+// Engine is a migration engine for an etcd v3 datastore. Keys are laid out as
+// volplugin lays them out in etcd v3: as they were in etcd v2, with each
+// directory stored as an empty key ending in a slash.
+type Engine struct {
+	kv     *etcd3kv.KV
+	prefix string
+	source backend.Walker
+}
+
+func (e *Engine) key(target string) []byte {
+	return []byte(path.Join(e.prefix, target))
+}
+
+func (e *Engine) dir(target string) []byte {
+	return []byte(path.Join(e.prefix, target) + "/")
+}
+
+// create puts the key if it does not exist, and returns whether it did.
+func (e *Engine) create(key, contents []byte) (bool, error) {
+	resp, err := e.kv.Txn(context.Background(), &etcd3kv.TxnRequest{
+		Compare: []*etcd3kv.Compare{{Key: key, Target: etcd3kv.TargetCreate, Result: etcd3kv.CompareEqual, CreateRevision: 0}},
+		Success: []*etcd3kv.RequestOp{{RequestPut: &etcd3kv.PutRequest{Key: key, Value: contents}}},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return resp.Succeeded, nil
+}
+
+func (e *Engine) exists(key []byte) (bool, error) {
+	_, _, err := e.kv.Get(context.Background(), key)
+	switch err {
+	case nil:
+		return true, nil
+	case errors.NotExists:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// CurrentSchemaVersion returns the version of the last migration which was successfully run.
+// If no previous migrations have been run, the schema version is 0.
+// If there's any error besides "key doesn't exist", execution is aborted.
+func (e *Engine) CurrentSchemaVersion() int64 {
+	kv, _, err := e.kv.Get(context.Background(), e.key(backend.SchemaVersionKey))
+	if err != nil {
+		if err == errors.NotExists {
+			return 0 // no key = schema version 0
+		}
+
+		logrus.Fatalf("Unexpected error when looking up schema version: %v\n", err)
+	}
+
+	i, err := strconv.Atoi(string(kv.Value))
+	if err != nil {
+		logrus.Fatalf("Got back unexpected schema version data: %v\n", string(kv.Value))
+	}
+
+	return int64(i)
+}
+
+// CreateDirectory creates a directory at the target path.
+func (e *Engine) CreateDirectory(target string) error {
+	fmt.Println("Creating directory: " + target)
+
+	if exists, err := e.exists(e.key(target)); err != nil {
+		return errored.Errorf("Failed to create directory: %s", err)
+	} else if exists {
+		return errored.Errorf("Failed to create directory: %s is a key", target)
+	}
+
+	if _, err := e.create(e.dir(target), nil); err != nil {
+		return errored.Errorf("Failed to create directory: %s", err)
+	}
+
+	return nil
+}
+
+// CreateKey will create a key at the target location.
+func (e *Engine) CreateKey(target string, contents []byte) error {
+	fmt.Println("Creating key: " + target)
+
+	if exists, err := e.exists(e.dir(target)); err != nil {
+		return errored.Errorf("Failed to create key: %s", err)
+	} else if exists {
+		return errored.Errorf("Failed to create key: %s is a directory", target)
+	}
+
+	created, err := e.create(e.key(target), contents)
+	if err != nil {
+		return errored.Errorf("Failed to create key: %s", err)
+	} else if !created {
+		return errored.Errorf("Failed to create key: %s exists", target)
+	}
+
+	return nil
+}
+
+// DeleteDirectory will recursively delete a target directory.
+func (e *Engine) DeleteDirectory(target string) error {
+	fmt.Println("Deleting directory: " + target)
+
+	if exists, err := e.exists(e.key(target)); err != nil {
+		return errored.Errorf("Failed to delete directory: %s", err)
+	} else if exists {
+		return errored.Errorf("Failed to delete directory: %s is a key", target)
+	}
+
+	dir := e.dir(target)
+	if _, err := e.kv.DeleteRange(context.Background(), &etcd3kv.DeleteRangeRequest{Key: dir, RangeEnd: etcd3kv.PrefixEnd(dir)}); err != nil {
+		return errored.Errorf("Failed to delete directory: %s", err)
+	}
+
+	return nil
+}
+
+// DeleteKey will delete the target key if it exists.
+func (e *Engine) DeleteKey(target string) error {
+	fmt.Println("Deleting key: " + target)
+
+	if exists, err := e.exists(e.dir(target)); err != nil {
+		return errored.Errorf("Failed to delete key: %s", err)
+	} else if exists {
+		return errored.Errorf("Failed to delete key: %s is a directory", target)
+	}
+
+	if _, err := e.kv.DeleteRange(context.Background(), &etcd3kv.DeleteRangeRequest{Key: e.key(target)}); err != nil {
+		return errored.Errorf("Failed to delete key: %s", err)
+	}
+
+	return nil
+}
+
+// Import copies the keys of the source the engine was created with which do
+// not exist in etcd yet.
+func (e *Engine) Import() error {
+	if e.source == nil {
+		return errored.Errorf("No source to import keys from")
+	}
+
+	return e.source.Walk(func(target string, dir bool, contents []byte) error {
+		if target == backend.SchemaVersionKey {
+			return nil
+		}
+
+		key := e.key(target)
+		if dir {
+			key = e.dir(target)
+		}
+
+		created, err := e.create(key, contents)
+		if err != nil {
+			return errored.Errorf("Failed to copy %s: %s", target, err)
+		}
+
+		if created {
+			fmt.Println("Copied: " + target)
+		}
+
+		return nil
+	})
+}
+
+// Name returns the name of the engine ("etcd2", "etcd3", "consul", etc.)
+func (e *Engine) Name() string {
+	return "etcd3"
+}
+
+// UpdateSchemaVersion records the version number of the latest migration which successfully ran.
+// If the new version number is <= the current version number, it will log a fatal error.
+func (e *Engine) UpdateSchemaVersion(newVersion int64) error {
+	fmt.Printf("Updating schema version key to: %d\n", newVersion)
+
+	currentVersion := e.CurrentSchemaVersion()
+
+	// sanity check to make sure the version number is actually increasing
+	if newVersion <= currentVersion {
+		logrus.Fatalf("Cowardly refusing to update schema version to a version <= the current version.  Current: %d, Desired: %d\n", currentVersion, newVersion)
+	}
+
+	data := strconv.Itoa(int(newVersion))
+
+	if _, err := e.kv.Put(context.Background(), &etcd3kv.PutRequest{Key: e.key(backend.SchemaVersionKey), Value: []byte(data)}); err != nil {
+		return errored.Errorf("Failed to update schema version key to %d: %s", newVersion, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package etcd3
+
+import (
+	"strings"
+	. "testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/db/impl/etcd3/etcd3test"
+	"github.com/contiv/volplugin/volmigrate/backend"
+	"golang.org/x/net/context"
+)
+
+type etcd3Suite struct {
+	server *etcd3test.Server
+}
+
+var _ = Suite(&etcd3Suite{})
+
+func TestEtcd3(t *T) { TestingT(t) }
+
+func (s *etcd3Suite) SetUpTest(c *C) {
+	s.server = etcd3test.NewServer()
+}
+
+func (s *etcd3Suite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+type walker []struct {
+	path     string
+	dir      bool
+	contents string
+}
+
+func (w walker) Walk(walkFunc func(path string, dir bool, contents []byte) error) error {
+	for _, entry := range w {
+		if err := walkFunc(entry.path, entry.dir, []byte(entry.contents)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *etcd3Suite) TestKeysAndDirectories(c *C) {
+	e := New("/volplugin", strings.TrimPrefix(s.server.URL, "http://"), nil)
+
+	c.Assert(e.CurrentSchemaVersion(), Equals, int64(0))
+	c.Assert(e.UpdateSchemaVersion(1), IsNil)
+	c.Assert(e.CurrentSchemaVersion(), Equals, int64(1))
+
+	c.Assert(e.CreateDirectory("foo"), IsNil)
+	c.Assert(e.CreateDirectory("foo"), IsNil)
+	c.Assert(e.CreateKey("foo", nil), NotNil)
+	c.Assert(e.CreateKey("foo/bar", []byte("baz")), IsNil)
+	c.Assert(e.CreateKey("foo/bar", []byte("baz")), NotNil)
+	c.Assert(e.CreateDirectory("foo/bar"), NotNil)
+
+	c.Assert(e.DeleteKey("foo"), NotNil)
+	c.Assert(e.DeleteDirectory("foo"), IsNil)
+
+	_, _, err := e.kv.Get(context.Background(), []byte("/volplugin/foo/bar"))
+	c.Assert(err, NotNil)
+}
+
+func (s *etcd3Suite) TestImport(c *C) {
+	source := walker{
+		{path: backend.SchemaVersionKey, contents: "1"},
+		{path: "policies", dir: true},
+		{path: "policies/policy1", contents: "new"},
+		{path: "policies/policy2", contents: "new"},
+	}
+
+	e := New("/volplugin", strings.TrimPrefix(s.server.URL, "http://"), source)
+	c.Assert(e.CreateKey("policies/policy1", []byte("old")), IsNil)
+	c.Assert(e.Import(), IsNil)
+
+	for key, value := range map[string]string{
+		"/volplugin/policies/":        "",
+		"/volplugin/policies/policy1": "old",
+		"/volplugin/policies/policy2": "new",
+	} {
+		kv, _, err := e.kv.Get(context.Background(), []byte(key))
+		c.Assert(err, IsNil, Commentf("%s", key))
+		c.Assert(string(kv.Value), Equals, value)
+	}
+
+	c.Assert(e.CurrentSchemaVersion(), Equals, int64(0))
+}
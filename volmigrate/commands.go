@@ -18,6 +18,10 @@ var GlobalFlags = []cli.Flag{
 		Usage: "URL for etcd",
 		Value: &cli.StringSlice{"http://localhost:2379"},
 	},
+	cli.StringFlag{
+		Name:  "store",
+		Usage: "URL of the store to migrate: etcd://host:port,... or etcd3://host:port. Migrating etcd3 copies the keys from etcd at --etcd. Defaults to etcd at --etcd",
+	},
 }
 
 // Commands is the data structure which describes the command hierarchy for volmigrate.
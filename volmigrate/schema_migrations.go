@@ -61,4 +61,14 @@ func registerMigrations() {
 		return nil
 	})
 
+	// Backends which are not created with another to copy from, such as etcd2,
+	// have nothing to copy.
+	registerMigration(2, "Copy the etcd v2 keyspace into etcd v3", func(b backend.Backend) error {
+		if importer, ok := b.(backend.Importer); ok {
+			return importer.Import()
+		}
+
+		return nil
+	})
+
 }
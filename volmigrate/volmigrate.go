@@ -12,6 +12,7 @@ import (
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/volmigrate/backend"
 	"github.com/contiv/volplugin/volmigrate/backend/etcd2"
+	"github.com/contiv/volplugin/volmigrate/backend/etcd3"
 )
 
 // -------------------------------------------------------------------------------------------------
@@ -64,6 +65,46 @@ func promptBeforeRunning(ctx *cli.Context, msg string) {
 	}
 }
 
+// newBackend creates the backend for the store given with --store.
+func newBackend(ctx *cli.Context) (backend.Backend, error) {
+	prefix := ctx.GlobalString("prefix")
+	etcd := etcd2.New(prefix, ctx.GlobalStringSlice("etcd"))
+
+	store := ctx.GlobalString("store")
+	if store == "" {
+		return etcd, nil
+	}
+
+	parts := strings.SplitN(store, "://", 2)
+	if len(parts) != 2 {
+		return nil, errored.Errorf("Invalid store: %q is not a URL", store)
+	}
+
+	scheme, hosts := parts[0], strings.Trim(parts[1], "/")
+
+	switch scheme {
+	case "etcd":
+		if hosts == "" {
+			return etcd, nil
+		}
+
+		etcdHosts := []string{}
+		for _, host := range strings.Split(hosts, ",") {
+			etcdHosts = append(etcdHosts, "http://"+host)
+		}
+
+		return etcd2.New(prefix, etcdHosts), nil
+	case "etcd3":
+		if hosts == "" || strings.Contains(hosts, ",") {
+			return nil, errored.Errorf("Invalid store: etcd3 takes one host, not %q", hosts)
+		}
+
+		return etcd3.New(prefix, hosts, etcd), nil
+	default:
+		return nil, errored.Errorf("Invalid store: unknown store %q", scheme)
+	}
+}
+
 // ListMigrations returns a newline-delimited list of migration versions and their descriptions.
 func ListMigrations(ctx *cli.Context) {
 	execCliAndExit(ctx, listMigrations)
@@ -90,7 +131,10 @@ func RunMigrations(ctx *cli.Context) {
 }
 
 func runMigrations(ctx *cli.Context) (bool, error) {
-	e := etcd2.New(ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd"))
+	e, err := newBackend(ctx)
+	if err != nil {
+		return false, err
+	}
 
 	if len(ctx.Args()) > 0 {
 		i, err := strconv.Atoi(ctx.Args()[0])
@@ -160,7 +204,10 @@ func showVersions(ctx *cli.Context) (bool, error) {
 		return true, errorInvalidArgCount(len(ctx.Args()), 0, ctx.Args())
 	}
 
-	e := etcd2.New(ctx.GlobalString("prefix"), ctx.GlobalStringSlice("etcd"))
+	e, err := newBackend(ctx)
+	if err != nil {
+		return false, err
+	}
 
 	fmt.Printf("Current local schema version: %d\n", e.CurrentSchemaVersion())
 	fmt.Printf("Newest available schema version: %d\n", latestMigrationVersion)
@@ -0,0 +1,129 @@
+package volplugin
+
+import (
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage"
+	"github.com/contiv/volplugin/storage/backend"
+)
+
+// pollCapacity periodically measures the volumes mounted on this host and
+// publishes their usage. The records expire if volplugin stops publishing
+// them, e.g. when the volume is unmounted.
+func (dc *DaemonConfig) pollCapacity() {
+	for {
+		time.Sleep(dc.UsageInterval)
+
+		for _, mc := range dc.API.MountCollection.List() {
+			vc, err := dc.capacity(mc)
+			if err != nil {
+				log.Errorf("Could not measure usage of volume %q: %v", mc.Volume.Name, err)
+				continue
+			}
+
+			for _, alert := range vc.Alerts {
+				log.Warnf("Volume %q: %s", vc.Volume, alert)
+			}
+
+			if err := dc.Client.PublishVolumeCapacity(vc, 3*dc.UsageInterval); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+}
+
+// capacity measures the filesystem of the mount and asks the volume's
+// backends for its image usage and snapshot count, if they can report them.
+func (dc *DaemonConfig) capacity(mc *storage.Mount) (*config.VolumeCapacity, error) {
+	stat := syscall.Statfs_t{}
+	if err := syscall.Statfs(mc.Path, &stat); err != nil {
+		return nil, err
+	}
+
+	bsize := uint64(stat.Bsize)
+	vc := &config.VolumeCapacity{
+		Volume:         mc.Volume.Name,
+		Hostname:       dc.Hostname,
+		UsedBytes:      (stat.Blocks - stat.Bfree) * bsize,
+		AvailableBytes: stat.Bavail * bsize,
+		TotalBytes:     stat.Blocks * bsize,
+		UsedInodes:     stat.Files - stat.Ffree,
+		FreeInodes:     stat.Ffree,
+		TotalInodes:    stat.Files,
+		Updated:        time.Now(),
+	}
+
+	parts := strings.SplitN(mc.Volume.Name, "/", 2)
+	if len(parts) != 2 {
+		return vc, nil
+	}
+
+	vol, err := dc.Client.GetVolume(parts[0], parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	vc.CheckAlerts(vol.RuntimeOptions.Alerts)
+
+	if vol.Backends == nil {
+		return vc, nil
+	}
+
+	if vol.Backends.Snapshot != "" {
+		if count, err := dc.snapshotCount(vol); err != nil {
+			log.Warnf("Could not count the snapshots of volume %q: %v", vol, err)
+		} else {
+			vc.Snapshots = &count
+		}
+	}
+
+	if vol.Backends.CRUD == "" {
+		return vc, nil
+	}
+
+	driver, err := backend.NewCRUDDriver(vol.Backends.CRUD)
+	if err != nil {
+		return nil, err
+	}
+
+	if ud, ok := driver.(storage.UsageDriver); ok {
+		usage, err := ud.Usage(storage.DriverOptions{
+			Volume:  storage.Volume{Name: vol.String(), Params: vol.DriverOptions},
+			Timeout: dc.Global.Timeout,
+		})
+		if err != nil {
+			log.Warnf("Could not read backend usage of volume %q: %v", vol, err)
+		} else {
+			vc.ProvisionedBytes = usage.Provisioned
+			vc.ActualBytes = usage.Used
+		}
+	}
+
+	return vc, nil
+}
+
+// snapshotCount returns the number of snapshots of the volume. It is
+// published with the usage so that VolumeDriver.Get does not have to list
+// the snapshots on every call.
+func (dc *DaemonConfig) snapshotCount(vol *config.Volume) (int, error) {
+	driver, err := backend.NewSnapshotDriver(vol.Backends.Snapshot)
+	if err != nil {
+		return 0, errors.GetDriver.Combine(err)
+	}
+
+	driverOpts, err := vol.ToDriverOptions(dc.Global.Timeout)
+	if err != nil {
+		return 0, errors.ConfiguringVolume.Combine(err)
+	}
+
+	snaps, err := driver.ListSnapshots(driverOpts)
+	if err != nil {
+		return 0, errors.ListSnapshots.Combine(err)
+	}
+
+	return len(snaps), nil
+}
@@ -0,0 +1,89 @@
+package volplugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"time"
+
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/info"
+	"github.com/contiv/volplugin/storage/mountscan"
+
+	"golang.org/x/net/context"
+)
+
+// mountscanRequests are the scans of the host's mounts included in debug
+// reports, one for each mount backend.
+var mountscanRequests = map[string]*mountscan.GetMountsRequest{
+	"ceph": {DriverName: "ceph", KernelDriver: "rbd"},
+	"nfs":  {DriverName: "nfs", FsType: "nfs4"},
+}
+
+// watchDebugRequests answers each debug bundle request with this host's
+// debug report.
+func (dc *DaemonConfig) watchDebugRequests() {
+	for {
+		requests := make(chan *config.DebugRequest)
+		errChan := make(chan error, 1)
+		go func() { errChan <- dc.Client.WatchDebugRequests(context.Background(), requests) }()
+
+	follow:
+		for {
+			select {
+			case request := <-requests:
+				if err := dc.Client.PublishDebugReport(request.ID, dc.debugReport(request.Logs)); err != nil {
+					log.Errorf("Could not publish debug report for request %q: %v", request.ID, err)
+				}
+			case err := <-errChan:
+				log.Errorf("Lost the debug request watch: %v. Retrying in 1 second", err)
+				time.Sleep(time.Second)
+				break follow
+			}
+		}
+	}
+}
+
+// debugReport collects the files this host contributes to a debug bundle:
+// those of every daemon, with its logs if requested, the mount collection and
+// counters, the mounts found by mountscan and the output of `rbd showmapped`.
+// Secrets in the driver options of the mounts are redacted.
+func (dc *DaemonConfig) debugReport(logs bool) *config.DebugReport {
+	files := info.Collect("volplugin", dc.Version, logs)
+
+	files["mounts.json"] = debugJSON(dc.API.MountCollection.List())
+	files["mount-counts.json"] = debugJSON(dc.API.MountCounter.List())
+
+	scans := map[string]interface{}{}
+	for name, request := range mountscanRequests {
+		mounts, err := mountscan.GetMounts(request)
+		if err != nil {
+			scans[name] = err.Error()
+			continue
+		}
+		scans[name] = mounts
+	}
+	files["mountscan.json"] = debugJSON(scans)
+
+	out, err := exec.Command("rbd", "showmapped").CombinedOutput()
+	if err != nil {
+		out = append(out, []byte(err.Error()+"\n")...)
+	}
+	files["rbd-showmapped.txt"] = string(out)
+
+	return &config.DebugReport{Hostname: dc.Hostname, Files: files, Time: time.Now()}
+}
+
+func debugJSON(value interface{}) string {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return err.Error()
+	}
+
+	buf := new(bytes.Buffer)
+	if err := json.Indent(buf, info.Redact(content), "", "  "); err != nil {
+		return err.Error()
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,64 @@
+package volplugin
+
+import (
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/watch"
+)
+
+// watchHandoffs processes handoff requests for volumes mounted on this host,
+// including any which were requested while volplugin was down.
+func (dc *DaemonConfig) watchHandoffs() {
+	activity := make(chan *watch.Watch)
+	dc.Client.WatchHandoffs(activity)
+
+	handoffs, err := dc.Client.ListHandoffs()
+	if err != nil {
+		log.Errorf("Could not list pending handoffs: %v", err)
+	}
+
+	for _, h := range handoffs {
+		dc.handleHandoff(h)
+	}
+
+	for w := range activity {
+		if h, ok := w.Config.(*config.Handoff); ok {
+			dc.handleHandoff(h)
+		}
+	}
+}
+
+func (dc *DaemonConfig) handleHandoff(h *config.Handoff) {
+	if h.From != dc.Hostname || h.Status != config.HandoffPending {
+		return
+	}
+
+	// the draining record expires like the pending one did, in case this host
+	// goes away before finishing it.
+	h.Status = config.HandoffDraining
+	if err := dc.Client.UpdateHandoff(h, h.TTL(dc.Global.Timeout)); err != nil {
+		log.Errorf("Could not update handoff of %q: %v", h.Volume, err)
+		return
+	}
+
+	go func(h config.Handoff) {
+		if err := dc.API.Handoff(&h); err != nil {
+			if er, ok := err.(*errored.Error); ok && er.Contains(errors.HandoffCancelled) {
+				log.Infof("Handoff of %q to %q was cancelled", h.Volume, h.To)
+				return
+			}
+
+			log.Errorf("Handoff of %q to %q failed: %v", h.Volume, h.To, err)
+			h.Status = config.HandoffFailed
+			h.Error = err.Error()
+		} else {
+			log.Infof("Handoff of %q to %q complete; reserved for %v", h.Volume, h.To, h.Grace)
+			h.Status = config.HandoffComplete
+		}
+
+		if err := dc.Client.UpdateHandoff(&h, h.Grace); err != nil {
+			log.Errorf("Could not update handoff of %q: %v", h.Volume, err)
+		}
+	}(*h)
+}
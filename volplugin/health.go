@@ -0,0 +1,119 @@
+package volplugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/contiv/errored"
+	"github.com/contiv/volplugin/api"
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/errors"
+	"github.com/contiv/volplugin/storage/backend"
+	"github.com/docker/engine-api/client"
+	"github.com/jbeda/go-wait"
+)
+
+// healthTimeout bounds the time docker has to answer the health check.
+const healthTimeout = 5 * time.Second
+
+// health checks etcd, the global configuration, docker, which getMounted
+// relies on, and the programs each mount backend needs. Only the backends of
+// published policies are required; the programs of the others are reported,
+// but do not make the host unhealthy.
+func (dc *DaemonConfig) health() *config.Health {
+	health := config.NewHealth(dc.Hostname)
+	health.Add("etcd", dc.Client.CheckEtcd())
+	health.Add("global", dc.Client.CheckGlobal())
+	health.Add("docker", checkDocker())
+
+	used := map[string]bool{}
+	if policies, err := dc.Client.ListPolicies(); err != nil {
+		log.Warnf("Could not list policies to find the backends in use: %v", err)
+	} else {
+		for _, policy := range policies {
+			if policy.Backends != nil {
+				used[policy.Backends.Mount] = true
+			}
+		}
+	}
+
+	backends := []string{}
+	for name := range backend.MountDrivers {
+		backends = append(backends, name)
+	}
+
+	sort.Strings(backends)
+
+	for _, name := range backends {
+		var err error
+		if missing := backend.MissingPrograms(name); len(missing) > 0 {
+			err = errors.Unhealthy.Combine(errored.Errorf("missing %s", strings.Join(missing, ", ")))
+		}
+
+		health.Add("backend "+name, err).Optional = !used[name]
+	}
+
+	return health
+}
+
+// pollHealth checks the health of this host in the background and keeps the
+// result for the node registration, so that the heartbeat does not wait on
+// the checks.
+func (dc *DaemonConfig) pollHealth() {
+	for {
+		health := dc.health()
+
+		dc.healthMutex.Lock()
+		dc.lastHealth = health
+		dc.healthMutex.Unlock()
+
+		time.Sleep(wait.Jitter(dc.Global.TTL/4, 0))
+	}
+}
+
+// cachedHealth returns the result of the last health check, or nil if none
+// has finished yet.
+func (dc *DaemonConfig) cachedHealth() *config.Health {
+	dc.healthMutex.Lock()
+	defer dc.healthMutex.Unlock()
+	return dc.lastHealth
+}
+
+func checkDocker() error {
+	dockerClient, err := client.NewEnvClient()
+	if err != nil {
+		return errors.Unhealthy.Combine(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+
+	if _, err := dockerClient.ServerVersion(ctx); err != nil {
+		return errors.Unhealthy.Combine(err)
+	}
+
+	return nil
+}
+
+// handleHealth reports the health of this host. It responds 503 if a check
+// failed.
+func (dc *DaemonConfig) handleHealth(w http.ResponseWriter, r *http.Request) {
+	health := dc.health()
+
+	content, err := json.Marshal(health)
+	if err != nil {
+		api.RESTHTTPError(w, err)
+		return
+	}
+
+	if !health.Healthy() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	w.Write(content)
+}
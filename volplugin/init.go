@@ -6,7 +6,6 @@ import (
 
 	"golang.org/x/net/context"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/config"
 	"github.com/contiv/volplugin/errors"
@@ -36,7 +35,7 @@ func (dc *DaemonConfig) getMounted() (map[string]*storage.Mount, map[string]int,
 			if now.Sub(time.Now()) > dc.Global.Timeout {
 				panic("Cannot contact docker")
 			}
-			logrus.Error(errored.Errorf("Could not query docker; retrying").Combine(err))
+			log.Error(errored.Errorf("Could not query docker; retrying").Combine(err))
 			time.Sleep(time.Second)
 			continue
 		}
@@ -67,7 +66,7 @@ func (dc *DaemonConfig) getMounted() (map[string]*storage.Mount, map[string]int,
 		}
 
 		for _, mount := range mounted {
-			logrus.Debugf("Refreshing existing mount for %q: %v", mount.Volume.Name, *mount)
+			log.Debugf("Refreshing existing mount for %q: %v", mount.Volume.Name, *mount)
 			mounts[mount.Volume.Name] = mount
 		}
 	}
@@ -87,13 +86,13 @@ func (dc *DaemonConfig) updateMounts() error {
 	}
 
 	for name, mount := range mountNames {
-		logrus.Debugf("%s: %#v", name, *mount)
+		log.Debugf("%s: %#v", name, *mount)
 		if mount != nil {
 			dc.API.MountCounter.AddCount(name, counts[name])
 
 			parts := strings.Split(name, "/")
 			if len(parts) != 2 {
-				logrus.Warnf("Invalid volume named %q in mount scan: skipping refresh", name)
+				log.Warnf("Invalid volume named %q in mount scan: skipping refresh", name)
 				continue
 			}
 
@@ -101,13 +100,13 @@ func (dc *DaemonConfig) updateMounts() error {
 			if erd, ok := err.(*errored.Error); ok {
 				switch {
 				case erd.Contains(errors.NotExists):
-					logrus.Warnf("Volume %q not found in database, skipping", name)
+					log.Warnf("Volume %q not found in database, skipping", name)
 					continue
 				case erd.Contains(errors.GetVolume):
-					logrus.Fatalf("Volmaster could not be contacted; aborting volplugin.")
+					log.Fatalf("Volmaster could not be contacted; aborting volplugin.")
 				}
 			} else if err != nil {
-				logrus.Fatalf("Unknown error reading from apiserver: %v", err)
+				log.Fatalf("Unknown error reading from apiserver: %v", err)
 			}
 
 			payload := &config.UseMount{
@@ -126,14 +125,14 @@ func (dc *DaemonConfig) updateMounts() error {
 				// since this may run twice, it will terminate the original goroutine via the original stop channel.
 				stopChan, err := dc.API.Lock.AcquireWithTTLRefresh(payload, dc.Global.TTL, dc.Global.Timeout)
 				if err != nil {
-					logrus.Fatalf("Error encountered while trying to acquire lock for mount %v: %v", payload, err)
+					log.Fatalf("Error encountered while trying to acquire lock for mount %v: %v", payload, err)
 					continue
 				}
 
 				dc.API.AddStopChan(name, stopChan)
 			}
 		} else {
-			logrus.Errorf("Missing mount data for %q which was reported by volplugin or docker as previously mounted", name)
+			log.Errorf("Missing mount data for %q which was reported by volplugin or docker as previously mounted", name)
 		}
 	}
 
@@ -0,0 +1,53 @@
+package volplugin
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/storage/backend"
+	"github.com/jbeda/go-wait"
+)
+
+// rbdSysfsPath exists when the kernel rbd module is loaded.
+const rbdSysfsPath = "/sys/bus/rbd"
+
+func kernelRBDAvailable() bool {
+	_, err := os.Stat(rbdSysfsPath)
+	return err == nil
+}
+
+// node builds the registration record for this host, including the result
+// of its last health check.
+func (dc *DaemonConfig) node() *config.Node {
+	backends := []string{}
+	for name := range backend.MountDrivers {
+		backends = append(backends, name)
+	}
+
+	sort.Strings(backends)
+
+	return &config.Node{
+		Hostname:      dc.Hostname,
+		Version:       dc.Version,
+		Backends:      backends,
+		KernelRBD:     kernelRBDAvailable(),
+		MountPath:     dc.Global.MountPath,
+		Labels:        dc.Labels,
+		LastHeartbeat: time.Now(),
+		Health:        dc.cachedHealth(),
+	}
+}
+
+// heartbeat publishes the node registration and refreshes it well within the
+// global TTL, so the record expires shortly after volplugin stops.
+func (dc *DaemonConfig) heartbeat() {
+	for {
+		if err := dc.Client.PublishNode(dc.node(), dc.Global.TTL); err != nil {
+			log.Errorf("Could not publish node registration for %q: %v", dc.Hostname, err)
+		}
+
+		time.Sleep(wait.Jitter(dc.Global.TTL/4, 0))
+	}
+}
@@ -1,7 +1,6 @@
 package volplugin
 
 import (
-	"github.com/Sirupsen/logrus"
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/config"
 	"github.com/contiv/volplugin/errors"
@@ -23,26 +22,26 @@ func (dc *DaemonConfig) pollRuntime() {
 		var ok bool
 
 		if vol, ok = volWatch.Config.(*config.Volume); !ok {
-			logrus.Error(errored.Errorf("Error processing runtime update for volume %q: assertion failed", vol))
+			log.Error(errored.Errorf("Error processing runtime update for volume %q: assertion failed", vol))
 			continue
 		}
 
-		logrus.Infof("Adjusting runtime parameters for volume %q", vol)
+		log.Infof("Adjusting runtime parameters for volume %q", vol)
 		thisMC, err := dc.API.MountCollection.Get(vol.String())
 
 		if er, ok := err.(*errored.Error); ok && !er.Contains(errors.NotExists) {
-			logrus.Errorf("Unknown error processing runtime configuration parameters for volume %q: %v", vol, er)
+			log.Errorf("Unknown error processing runtime configuration parameters for volume %q: %v", vol, er)
 			continue
 		}
 
 		// if we can't look it up, it's possible it was mounted on a different host.
 		if err != nil {
-			logrus.Errorf("Error retrieving mount information for %q from cache: %v", vol, err)
+			log.Errorf("Error retrieving mount information for %q from cache: %v", vol, err)
 			continue
 		}
 
 		if err := cgroup.ApplyCGroupRateLimit(vol.RuntimeOptions, thisMC); err != nil {
-			logrus.Error(errored.Errorf("Error processing runtime update for volume %q", vol).Combine(err))
+			log.Error(errored.Errorf("Error processing runtime update for volume %q", vol).Combine(err))
 			continue
 		}
 	}
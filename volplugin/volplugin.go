@@ -7,51 +7,104 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
 	"github.com/contiv/errored"
 	"github.com/contiv/volplugin/api"
 	"github.com/contiv/volplugin/api/impl/docker"
+	"github.com/contiv/volplugin/api/impl/flexvolume"
+	"github.com/contiv/volplugin/api/impl/mesos"
+	"github.com/contiv/volplugin/auth"
 	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/csi"
 	"github.com/contiv/volplugin/info"
+	"github.com/contiv/volplugin/logging"
+	"github.com/contiv/volplugin/metrics"
+	"github.com/contiv/volplugin/trace"
 	"github.com/contiv/volplugin/watch"
 	"github.com/jbeda/go-wait"
 )
 
+var log = logging.For("volplugin")
+
 const basePath = "/run/docker/plugins"
 
 // DaemonConfig is the top-level configuration for the daemon. It is used by
 // the cli package in volplugin/volplugin.
 type DaemonConfig struct {
-	Hostname   string
-	Global     *config.Global
-	Client     *config.Client
-	API        *api.API
-	PluginName string
+	Hostname         string
+	Global           *config.Global
+	Client           *config.Client
+	API              *api.API
+	PluginName       string
+	Version          string
+	Labels           map[string]string
+	FlexVolumeSocket string
+	MesosSocket      string
+	CSISocket        string
+	APIServer        string
+	APICredentials   *auth.Credentials
+	PropagatedMount  string
+	ListLocal        bool
+	UsageInterval    time.Duration
+	MetricsListen    string
+
+	healthMutex sync.Mutex
+	lastHealth  *config.Health
 }
 
 // NewDaemonConfig creates a DaemonConfig from the master host and hostname
 // arguments.
 func NewDaemonConfig(ctx *cli.Context) *DaemonConfig {
+	if err := logging.SetFormat(ctx.String("log-format")); err != nil {
+		log.Fatalf("Cannot continue; invalid log format: %v", err)
+	}
 
 retry:
-	client, err := config.NewClient(ctx.String("prefix"), ctx.StringSlice("etcd"))
+	client, err := config.NewStoreClient(ctx.String("prefix"), ctx.String("store"), ctx.StringSlice("etcd"))
 	if err != nil {
-		logrus.Warn("Could not establish client to etcd cluster: %v. Retrying.", err)
+		log.Warnf("Could not establish client to etcd cluster: %v. Retrying.", err)
 		time.Sleep(wait.Jitter(time.Second, 0))
 		goto retry
 	}
 
+	labels, err := config.ParseLabels(ctx.StringSlice("label"))
+	if err != nil {
+		log.Fatalf("Cannot continue; invalid host labels: %v", err)
+	}
+
+	exporter, err := trace.NewExporter(ctx.String("trace-exporter"))
+	if err != nil {
+		log.Fatalf("Cannot continue; invalid trace exporter: %v", err)
+	}
+	trace.SetExporter(exporter)
+
 	dc := &DaemonConfig{
-		Hostname:   ctx.String("host-label"),
-		Client:     client,
-		PluginName: ctx.String("plugin-name"),
+		Hostname:         ctx.String("host-label"),
+		Client:           client,
+		PluginName:       ctx.String("plugin-name"),
+		Version:          ctx.App.Version,
+		Labels:           labels,
+		FlexVolumeSocket: ctx.String("flexvolume-socket"),
+		MesosSocket:      ctx.String("mesos-socket"),
+		CSISocket:        ctx.String("csi-socket"),
+		APIServer:        ctx.String("apiserver"),
+		APICredentials: &auth.Credentials{
+			Token:    ctx.String("apiserver-token"),
+			CertFile: ctx.String("apiserver-cert"),
+			KeyFile:  ctx.String("apiserver-key"),
+			CAFile:   ctx.String("apiserver-ca"),
+		},
+		PropagatedMount: ctx.String("propagated-mount"),
+		ListLocal:       ctx.Bool("list-local"),
+		UsageInterval:   ctx.Duration("usage-interval"),
+		MetricsListen:   ctx.String("metrics-listen"),
 	}
 
 	if dc.PluginName == "" || strings.Contains(dc.PluginName, "/") {
-		logrus.Fatal("Cannot continue; socket name contains empty value or invalid characters")
+		log.Fatal("Cannot continue; socket name contains empty value or invalid characters")
 	}
 
 	return dc
@@ -61,17 +114,12 @@ retry:
 func (dc *DaemonConfig) Daemon() error {
 	global, err := dc.Client.GetGlobal()
 	if err != nil {
-		logrus.Errorf("Error fetching global configuration: %v", err)
-		logrus.Infof("No global configuration. Proceeding with defaults...")
+		log.Errorf("Error fetching global configuration: %v", err)
+		log.Infof("No global configuration. Proceeding with defaults...")
 		global = config.NewGlobalConfig()
 	}
 
-	dc.Global = global
-	errored.AlwaysDebug = dc.Global.Debug
-	errored.AlwaysTrace = dc.Global.Debug
-	if dc.Global.Debug {
-		logrus.SetLevel(logrus.DebugLevel)
-	}
+	dc.setGlobal(global)
 
 	go info.HandleDebugSignal()
 
@@ -79,25 +127,46 @@ func (dc *DaemonConfig) Daemon() error {
 	dc.Client.WatchGlobal(activity)
 	go func() {
 		for {
-			dc.Global = (<-activity).Config.(*config.Global)
-
-			logrus.Debugf("Received global %#v", dc.Global)
-
-			errored.AlwaysDebug = dc.Global.Debug
-			errored.AlwaysTrace = dc.Global.Debug
-			if dc.Global.Debug {
-				logrus.SetLevel(logrus.DebugLevel)
-			}
+			dc.setGlobal((<-activity).Config.(*config.Global))
+			log.Debugf("Received global %#v", dc.Global)
 		}
 	}()
 
 	dc.API = api.NewAPI(docker.NewVolplugin(), dc.Hostname, dc.Client, &dc.Global)
+	dc.API.Labels = dc.Labels
+	dc.API.APIServer = dc.APIServer
+	dc.API.APICredentials = dc.APICredentials
+	dc.API.ListLocal = dc.ListLocal
 
 	if err := dc.updateMounts(); err != nil {
 		return err
 	}
 
 	go dc.pollRuntime()
+	go dc.pollHealth()
+	go dc.heartbeat()
+	go dc.watchHandoffs()
+	go dc.watchDebugRequests()
+
+	if dc.UsageInterval != 0 {
+		go dc.pollCapacity()
+	}
+
+	if dc.MetricsListen != "" {
+		go dc.serveMetrics()
+	}
+
+	if dc.FlexVolumeSocket != "" {
+		go dc.serveFrontend("FlexVolume", dc.FlexVolumeSocket, flexvolume.NewVolplugin())
+	}
+
+	if dc.MesosSocket != "" {
+		go dc.serveFrontend("Mesos", dc.MesosSocket, mesos.NewVolplugin())
+	}
+
+	if dc.CSISocket != "" {
+		go dc.serveCSI()
+	}
 
 	driverPath := path.Join(basePath, fmt.Sprintf("%s.sock", dc.PluginName))
 	if err := os.Remove(driverPath); err != nil && !os.IsNotExist(err) {
@@ -112,11 +181,80 @@ func (dc *DaemonConfig) Daemon() error {
 		return err
 	}
 
-	srv := http.Server{Handler: dc.API.Router(dc.API)}
+	router := dc.API.Router(dc.API)
+	router.HandleFunc("/health", dc.handleHealth).Methods("GET")
+
+	srv := http.Server{Handler: router}
 	srv.SetKeepAlivesEnabled(false)
 	if err := srv.Serve(l); err != nil {
-		logrus.Fatalf("Fatal error serving volplugin: %v", err)
+		log.Fatalf("Fatal error serving volplugin: %v", err)
 	}
 	l.Close()
 	return os.Remove(driverPath)
 }
+
+// setGlobal applies the global configuration. When running as a managed
+// plugin, volumes must be mounted under the plugin's propagated mount for
+// docker to see them, so it replaces the global mount path.
+func (dc *DaemonConfig) setGlobal(global *config.Global) {
+	if dc.PropagatedMount != "" {
+		global.MountPath = dc.PropagatedMount
+	}
+
+	dc.Global = global
+
+	errored.AlwaysDebug = dc.Global.Debug
+	errored.AlwaysTrace = dc.Global.Debug
+	logging.SetLevels(dc.Global.Debug, dc.Global.LogLevels)
+}
+
+// serveMetrics serves the metrics, including the size of the mount
+// collection and the mount counters, on /metrics.
+func (dc *DaemonConfig) serveMetrics() {
+	metrics.NewGaugeFunc("volplugin_mounts", "Volumes mounted on this host.", func() float64 {
+		return float64(len(dc.API.MountCollection.List()))
+	})
+
+	metrics.NewGaugeFunc("volplugin_mount_references", "Mounts of volumes on this host, counting each container using them.", func() float64 {
+		return float64(dc.API.MountCounter.Total())
+	})
+
+	if err := metrics.ListenAndServe(dc.MetricsListen); err != nil {
+		log.Errorf("Could not serve metrics on %q: %v", dc.MetricsListen, err)
+	}
+}
+
+// serveCSI serves the CSI identity and node services on the CSI socket. The
+// node service mounts through the API, sharing the mount state of the docker
+// frontend.
+func (dc *DaemonConfig) serveCSI() {
+	server := csi.NewServer(csi.NewIdentity(dc.Version, false), nil, csi.NewNode(dc.API))
+	if err := server.ListenAndServe(dc.CSISocket); err != nil {
+		log.Fatalf("Fatal error serving CSI: %v", err)
+	}
+}
+
+// serveFrontend serves another client interface on the socket. It shares
+// the mount state of the docker frontend.
+func (dc *DaemonConfig) serveFrontend(name, socket string, volplugin api.Volplugin) {
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Could not remove %s socket: %v", name, err)
+	}
+
+	if err := os.MkdirAll(path.Dir(socket), 0700); err != nil {
+		log.Fatalf("Could not create %s socket directory: %v", name, err)
+	}
+
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: socket, Net: "unix"})
+	if err != nil {
+		log.Fatalf("Could not listen on %s socket: %v", name, err)
+	}
+
+	frontend := dc.API.Frontend(volplugin)
+
+	srv := http.Server{Handler: frontend.Router(frontend)}
+	srv.SetKeepAlivesEnabled(false)
+	if err := srv.Serve(l); err != nil {
+		log.Fatalf("Fatal error serving %s frontend: %v", name, err)
+	}
+}
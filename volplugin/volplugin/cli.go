@@ -3,8 +3,11 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/codegangsta/cli"
+	"github.com/contiv/volplugin/api/impl/flexvolume"
+	"github.com/contiv/volplugin/api/impl/mesos"
 	"github.com/contiv/volplugin/volplugin"
 )
 
@@ -27,19 +30,27 @@ func main() {
 	app.Usage = "Mount and manage Ceph RBD for containers"
 	app.Flags = []cli.Flag{
 		cli.StringFlag{
-			Name:  "plugin-name",
-			Value: "volcontiv",
-			Usage: "Name of plugin presented to docker, et al.",
+			Name:   "plugin-name",
+			Value:  "volcontiv",
+			EnvVar: "VOLPLUGIN_PLUGIN_NAME",
+			Usage:  "Name of plugin presented to docker, et al.",
 		},
 		cli.StringFlag{
-			Name:  "prefix",
-			Usage: "prefix key used in etcd for namespacing",
-			Value: "/volplugin",
+			Name:   "prefix",
+			Usage:  "prefix key used in etcd for namespacing",
+			Value:  "/volplugin",
+			EnvVar: "VOLPLUGIN_PREFIX",
 		},
 		cli.StringSliceFlag{
-			Name:  "etcd",
-			Usage: "URL for etcd",
-			Value: &cli.StringSlice{"http://localhost:2379"},
+			Name:   "etcd",
+			Usage:  "URL for etcd",
+			Value:  &cli.StringSlice{"http://localhost:2379"},
+			EnvVar: "VOLPLUGIN_ETCD",
+		},
+		cli.StringFlag{
+			Name:   "store",
+			Usage:  "URL of the store: etcd://host:port,..., etcd3://host:port or consul://host:port. Defaults to etcd at --etcd",
+			EnvVar: "VOLPLUGIN_STORE",
 		},
 		cli.StringFlag{
 			Name:   "host-label",
@@ -47,6 +58,83 @@ func main() {
 			EnvVar: "HOSTLABEL",
 			Value:  host,
 		},
+		cli.StringSliceFlag{
+			Name:   "label",
+			Usage:  "Label this host with key=value for volume placement constraints; may be repeated",
+			EnvVar: "HOSTLABELS",
+		},
+		cli.StringFlag{
+			Name:   "flexvolume-socket",
+			Usage:  "Socket to serve the kubernetes FlexVolume driver on; empty to disable",
+			Value:  flexvolume.DefaultSocket,
+			EnvVar: "VOLPLUGIN_FLEXVOLUME_SOCKET",
+		},
+		cli.StringFlag{
+			Name:   "mesos-socket",
+			Usage:  "Socket to serve the Mesos dvdcli frontend on; empty to disable",
+			Value:  mesos.DefaultSocket,
+			EnvVar: "VOLPLUGIN_MESOS_SOCKET",
+		},
+		cli.StringFlag{
+			Name:   "csi-socket",
+			Usage:  "Socket to serve the CSI identity and node services on; empty to disable",
+			EnvVar: "VOLPLUGIN_CSI_SOCKET",
+		},
+		cli.StringFlag{
+			Name:   "apiserver",
+			Usage:  "address of the apiserver, used to remove volumes when their policy allows it",
+			Value:  "127.0.0.1:9005",
+			EnvVar: "VOLPLUGIN_APISERVER",
+		},
+		cli.StringFlag{
+			Name:   "apiserver-token",
+			Usage:  "bearer token of this host's identity, presented to the apiserver",
+			EnvVar: "VOLPLUGIN_APISERVER_TOKEN",
+		},
+		cli.StringFlag{
+			Name:  "apiserver-cert",
+			Usage: "client certificate presented to the apiserver; enables TLS",
+		},
+		cli.StringFlag{
+			Name:  "apiserver-key",
+			Usage: "key of the client certificate",
+		},
+		cli.StringFlag{
+			Name:  "apiserver-ca",
+			Usage: "CA to verify the apiserver against; enables TLS",
+		},
+		cli.BoolFlag{
+			Name:   "list-local",
+			Usage:  "Only list volumes whose storage backend is available on this host",
+			EnvVar: "VOLPLUGIN_LIST_LOCAL",
+		},
+		cli.DurationFlag{
+			Name:   "usage-interval",
+			Usage:  "Interval to measure and publish the usage of mounted volumes at; 0 to disable",
+			Value:  time.Minute,
+			EnvVar: "VOLPLUGIN_USAGE_INTERVAL",
+		},
+		cli.StringFlag{
+			Name:   "metrics-listen",
+			Usage:  "Address to serve Prometheus metrics on /metrics at; empty to disable",
+			EnvVar: "VOLPLUGIN_METRICS_LISTEN",
+		},
+		cli.StringFlag{
+			Name:   "trace-exporter",
+			Usage:  "Where to export request traces: \"stdout\" or \"file:<path>\" for JSON; empty to disable",
+			EnvVar: "VOLPLUGIN_TRACE_EXPORTER",
+		},
+		cli.StringFlag{
+			Name:   "log-format",
+			Usage:  "Format of log lines: \"text\" or \"json\"",
+			Value:  "text",
+			EnvVar: "VOLPLUGIN_LOG_FORMAT",
+		},
+		cli.StringFlag{
+			Name:   "propagated-mount",
+			Usage:  "Mount volumes under this path instead of the global mount path; set when running as a docker managed plugin",
+			EnvVar: "VOLPLUGIN_PROPAGATED_MOUNT",
+		},
 	}
 	app.Action = run
 
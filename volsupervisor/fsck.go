@@ -0,0 +1,40 @@
+package volsupervisor
+
+import (
+	"time"
+
+	"github.com/contiv/volplugin/reconcile"
+	wait "github.com/jbeda/go-wait"
+)
+
+// fsckInterval is how often volume records are checked against the images
+// held by the storage backends.
+const fsckInterval = 10 * time.Minute
+
+// fsck periodically reports inconsistencies between the volume records and
+// the storage backends. Repairs are left to the operator; see `volcli fsck`.
+func (dc *DaemonConfig) fsck() {
+	for {
+		time.Sleep(wait.Jitter(fsckInterval, 0))
+
+		reconciler := &reconcile.Reconciler{Config: dc.Config, Hostname: dc.Hostname, Timeout: dc.Global.Timeout}
+
+		report, err := reconciler.CheckImages()
+		if err != nil {
+			log.Errorf("Consistency check failed: %v", err)
+			continue
+		}
+
+		for _, image := range report.OrphanedImages {
+			log.Warnf("Consistency check: image %q has no volume record", image)
+		}
+
+		for _, volume := range report.MissingImages {
+			log.Warnf("Consistency check: volume %q has no image", volume)
+		}
+
+		if report.Clean() {
+			log.Debug("Consistency check found no problems")
+		}
+	}
+}
@@ -5,10 +5,10 @@ import (
 	"sync"
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/contiv/volplugin/config"
 	"github.com/contiv/volplugin/errors"
 	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/metrics"
 	"github.com/contiv/volplugin/storage"
 	"github.com/contiv/volplugin/storage/backend"
 )
@@ -21,7 +21,7 @@ var (
 func (dc *DaemonConfig) updateVolumes() {
 	myVolumes, err := dc.Config.ListAllVolumes()
 	if err != nil {
-		logrus.Error(err)
+		log.Error(err)
 		return
 	}
 
@@ -32,13 +32,13 @@ func (dc *DaemonConfig) updateVolumes() {
 	for _, name := range myVolumes {
 		parts := strings.SplitN(name, "/", 2)
 		if len(parts) < 2 {
-			logrus.Errorf("Invalid volume %q. Skipping on volsupervisor read.", name)
+			log.Errorf("Invalid volume %q. Skipping on volsupervisor read.", name)
 			continue
 		}
 
 		vol, err := dc.Config.GetVolume(parts[0], parts[1])
 		if err != nil {
-			logrus.Errorf("Could not get volume %q. Skipping.", name)
+			log.Errorf("Could not get volume %q. Skipping.", name)
 			continue
 		}
 
@@ -47,9 +47,9 @@ func (dc *DaemonConfig) updateVolumes() {
 }
 
 func (dc *DaemonConfig) pruneSnapshots(val *config.Volume) {
-	logrus.Infof("starting snapshot prune for %q", val.VolumeName)
+	log.Infof("starting snapshot prune for %q", val.VolumeName)
 	if val.Backends.Snapshot == "" {
-		logrus.Debugf("Snapshot driver for volume %v was empty, not snapshotting.", val)
+		log.Debugf("Snapshot driver for volume %v was empty, not snapshotting.", val)
 		return
 	}
 
@@ -60,7 +60,7 @@ func (dc *DaemonConfig) pruneSnapshots(val *config.Volume) {
 
 	stopChan, err := lock.NewDriver(dc.Config).AcquireWithTTLRefresh(uc, dc.Global.TTL, dc.Global.Timeout)
 	if err != nil {
-		logrus.Error(errors.LockFailed.Combine(err))
+		log.Error(errors.LockFailed.Combine(err))
 		return
 	}
 
@@ -68,7 +68,7 @@ func (dc *DaemonConfig) pruneSnapshots(val *config.Volume) {
 
 	driver, err := backend.NewSnapshotDriver(val.Backends.Snapshot)
 	if err != nil {
-		logrus.Errorf("failed to get driver: %v", err)
+		log.Errorf("failed to get driver: %v", err)
 		return
 	}
 
@@ -84,27 +84,40 @@ func (dc *DaemonConfig) pruneSnapshots(val *config.Volume) {
 
 	list, err := driver.ListSnapshots(driverOpts)
 	if err != nil {
-		logrus.Errorf("Could not list snapshots for volume %q: %v", val.VolumeName, err)
+		log.Errorf("Could not list snapshots for volume %q: %v", val.VolumeName, err)
 		return
 	}
 
-	logrus.Debugf("Volume %q: keeping %d snapshots", val, val.RuntimeOptions.Snapshot.Keep)
+	log.Debugf("Volume %q: keeping %d snapshots", val, val.RuntimeOptions.Snapshot.Keep)
 
 	toDeleteCount := len(list) - int(val.RuntimeOptions.Snapshot.Keep)
 	if toDeleteCount < 0 {
 		return
 	}
 
+	var removed uint64
 	for i := 0; i < toDeleteCount; i++ {
-		logrus.Infof("Removing snapshot %q for volume %q", list[i], val.VolumeName)
-		if err := driver.RemoveSnapshot(list[i], driverOpts); err != nil {
-			logrus.Errorf("Removing snapshot %q for volume %q failed: %v", list[i], val.VolumeName, err)
+		log.Infof("Removing snapshot %q for volume %q", list[i], val.VolumeName)
+		err := driver.RemoveSnapshot(list[i], driverOpts)
+		metrics.Snapshots.Inc("prune", metrics.Outcome(err))
+		if err != nil {
+			log.Errorf("Removing snapshot %q for volume %q failed: %v", list[i], val.VolumeName, err)
+			dc.Config.RecordEvent(config.EventSnapshotFailed, val.String(), dc.Hostname, "removing snapshot %q: %v", list[i], err)
+			continue
+		}
+		dc.Config.RecordEvent(config.EventSnapshotPruned, val.String(), dc.Hostname, "removed snapshot %q", list[i])
+		removed++
+	}
+
+	if removed > 0 {
+		if err := dc.Config.ReleasePolicyUsage(val.PolicyName, config.PolicyUsage{Snapshots: removed}); err != nil {
+			log.Errorf("Could not release snapshot quota for volume %q: %v", val, err)
 		}
 	}
 }
 
 func (dc *DaemonConfig) createSnapshot(val *config.Volume) {
-	logrus.Infof("Snapshotting %q.", val)
+	log.Infof("Snapshotting %q.", val)
 
 	uc := &config.UseSnapshot{
 		Volume: val.String(),
@@ -113,7 +126,7 @@ func (dc *DaemonConfig) createSnapshot(val *config.Volume) {
 
 	stopChan, err := lock.NewDriver(dc.Config).AcquireWithTTLRefresh(uc, dc.Global.TTL, dc.Global.Timeout)
 	if err != nil {
-		logrus.Error(err)
+		log.Error(err)
 		return
 	}
 
@@ -121,7 +134,7 @@ func (dc *DaemonConfig) createSnapshot(val *config.Volume) {
 
 	driver, err := backend.NewSnapshotDriver(val.Backends.Snapshot)
 	if err != nil {
-		logrus.Errorf("Error establishing driver backend %q; cannot snapshot", val.Backends.Snapshot)
+		log.Errorf("Error establishing driver backend %q; cannot snapshot", val.Backends.Snapshot)
 		return
 	}
 
@@ -135,9 +148,32 @@ func (dc *DaemonConfig) createSnapshot(val *config.Volume) {
 		Timeout: dc.Global.Timeout,
 	}
 
-	if err := driver.CreateSnapshot(time.Now().String(), driverOpts); err != nil {
-		logrus.Errorf("Error creating snapshot for volume %q: %v", val, err)
+	policy, err := dc.Config.GetPolicy(val.PolicyName)
+	if err != nil {
+		log.Errorf("Error retrieving policy %q; cannot snapshot: %v", val.PolicyName, err)
+		return
+	}
+
+	usage := config.PolicyUsage{Snapshots: 1}
+	if err := dc.Config.ReservePolicyUsage(val.PolicyName, policy.Quota, usage); err != nil {
+		log.Errorf("Not snapshotting volume %q: %v", val, err)
+		dc.Config.RecordEvent(config.EventSnapshotFailed, val.String(), dc.Hostname, "%v", err)
+		return
+	}
+
+	name := time.Now().String()
+	err = driver.CreateSnapshot(name, driverOpts)
+	metrics.Snapshots.Inc("create", metrics.Outcome(err))
+	if err != nil {
+		log.Errorf("Error creating snapshot for volume %q: %v", val, err)
+		dc.Config.RecordEvent(config.EventSnapshotFailed, val.String(), dc.Hostname, "creating snapshot: %v", err)
+		if err := dc.Config.ReleasePolicyUsage(val.PolicyName, usage); err != nil {
+			log.Errorf("Could not release snapshot quota for volume %q: %v", val, err)
+		}
+		return
 	}
+
+	dc.Config.RecordEvent(config.EventSnapshotTaken, val.String(), dc.Hostname, "took snapshot %q", name)
 }
 
 func (dc *DaemonConfig) loop() {
@@ -149,7 +185,7 @@ func (dc *DaemonConfig) loop() {
 
 		volumeMutex.Lock()
 		for volume, val := range volumes {
-			logrus.Debugf("Adding volume %q for processing", volume)
+			log.Debugf("Adding volume %q for processing", volume)
 			val2 := *val
 			volumeCopy[volume] = &val2
 		}
@@ -159,14 +195,14 @@ func (dc *DaemonConfig) loop() {
 			if val.RuntimeOptions.UseSnapshots {
 				freq, err := time.ParseDuration(val.RuntimeOptions.Snapshot.Frequency)
 				if err != nil {
-					logrus.Errorf("Volume %q has an invalid frequency. Skipping snapshot.", volume)
+					log.Errorf("Volume %q has an invalid frequency. Skipping snapshot.", volume)
 				}
 
 				if time.Now().Unix()%int64(freq.Seconds()) == 0 {
 					var isUsed bool
 					var err error
 					if isUsed, err = dc.Config.IsVolumeInUse(val, dc.Global); err != nil {
-						logrus.Errorf("etcd error: %s", errors.EtcdToErrored(err)) // some issue with "etcd GET"; we should not hit this case
+						log.Errorf("etcd error: %s", errors.EtcdToErrored(err)) // some issue with "etcd GET"; we should not hit this case
 					}
 
 					go func(val *config.Volume, isUsed bool) {
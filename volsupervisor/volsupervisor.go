@@ -6,16 +6,19 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
 	wait "github.com/jbeda/go-wait"
 
 	"github.com/contiv/volplugin/config"
 	"github.com/contiv/volplugin/info"
 	"github.com/contiv/volplugin/lock"
+	"github.com/contiv/volplugin/logging"
+	"github.com/contiv/volplugin/metrics"
 	"github.com/contiv/volplugin/watch"
 )
 
+var log = logging.For("volsupervisor")
+
 // DaemonConfig is the top-level configuration for the daemon. It is used by
 // the cli package in volplugin/volplugin.
 type DaemonConfig struct {
@@ -26,15 +29,19 @@ type DaemonConfig struct {
 
 // Daemon is the top-level entrypoint for the volsupervisor from the CLI.
 func Daemon(ctx *cli.Context) {
-	cfg, err := config.NewClient(ctx.String("prefix"), ctx.StringSlice("etcd"))
+	if err := logging.SetFormat(ctx.String("log-format")); err != nil {
+		log.Fatal(err)
+	}
+
+	cfg, err := config.NewStoreClient(ctx.String("prefix"), ctx.String("store"), ctx.StringSlice("etcd"))
 	if err != nil {
-		logrus.Fatal(err)
+		log.Fatal(err)
 	}
 
 retry:
 	global, err := cfg.GetGlobal()
 	if err != nil {
-		logrus.Errorf("Could not retrieve global configuration: %v. Retrying in 1 second", err)
+		log.Errorf("Could not retrieve global configuration: %v. Retrying in 1 second", err)
 		time.Sleep(time.Second)
 		goto retry
 	}
@@ -47,16 +54,29 @@ retry:
 	go dc.watchAndSetGlobal(globalChan)
 	go info.HandleDebugSignal()
 
-	stopChan, err := lock.NewDriver(dc.Config).AcquireWithTTLRefresh(&config.UseVolsupervisor{Hostname: dc.Hostname}, dc.Global.TTL, dc.Global.Timeout)
+	if listen := ctx.String("metrics-listen"); listen != "" {
+		go func() {
+			if err := metrics.ListenAndServe(listen); err != nil {
+				log.Errorf("Could not serve metrics on %q: %v", listen, err)
+			}
+		}()
+	}
+
+	driver := lock.NewDriver(dc.Config)
+	driver.Lost = func(uc config.UseLocker, err error) {
+		log.Fatalf("Lost the volsupervisor lock, another volsupervisor may be running: %v", err)
+	}
+
+	stopChan, err := driver.AcquireWithTTLRefresh(&config.UseVolsupervisor{Hostname: dc.Hostname}, dc.Global.TTL, dc.Global.Timeout)
 	if err != nil {
-		logrus.Fatal("Could not start volsupervisor: already in use")
+		log.Fatal("Could not start volsupervisor: already in use")
 	}
 
 	sigChan := make(chan os.Signal, 1)
 
 	go func() {
 		<-sigChan
-		logrus.Infof("Removing volsupervisor global lock; waiting %v for lock to clear", dc.Global.TTL)
+		log.Infof("Removing volsupervisor global lock; waiting %v for lock to clear", dc.Global.TTL)
 		stopChan <- struct{}{}
 		time.Sleep(wait.Jitter(dc.Global.TTL+time.Second, 0)) // give us enough time to try to clear the lock
 		os.Exit(0)
@@ -74,6 +94,9 @@ retry:
 		}
 	}()
 
+	go dc.deliverWebhooks()
+	go dc.fsck()
+
 	dc.loop()
 }
 
@@ -85,10 +108,8 @@ func (dc *DaemonConfig) watchAndSetGlobal(globalChan chan *watch.Watch) {
 }
 
 func (dc *DaemonConfig) setDebug() {
+	logging.SetLevels(dc.Global.Debug, dc.Global.LogLevels)
 	if dc.Global.Debug {
-		logrus.SetLevel(logrus.DebugLevel)
-		logrus.Debug("Debug logging enabled")
-	} else {
-		logrus.SetLevel(logrus.InfoLevel)
+		log.Debug("Debug logging enabled")
 	}
 }
@@ -37,12 +37,28 @@ func main() {
 			Usage: "URL for etcd",
 			Value: &cli.StringSlice{"http://localhost:2379"},
 		},
+		cli.StringFlag{
+			Name:   "store",
+			Usage:  "URL of the store: etcd://host:port,..., etcd3://host:port or consul://host:port. Defaults to etcd at --etcd",
+			EnvVar: "VOLSUPERVISOR_STORE",
+		},
 		cli.StringFlag{
 			Name:   "host-label",
 			Usage:  "Set the internal hostname",
 			EnvVar: "HOSTLABEL",
 			Value:  host,
 		},
+		cli.StringFlag{
+			Name:   "metrics-listen",
+			Usage:  "Address to serve Prometheus metrics on /metrics at; empty to disable",
+			EnvVar: "VOLSUPERVISOR_METRICS_LISTEN",
+		},
+		cli.StringFlag{
+			Name:   "log-format",
+			Usage:  "Format of log lines: \"text\" or \"json\"",
+			Value:  "text",
+			EnvVar: "VOLSUPERVISOR_LOG_FORMAT",
+		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -0,0 +1,115 @@
+package volsupervisor
+
+import (
+	"time"
+
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/webhook"
+
+	"golang.org/x/net/context"
+)
+
+// deliverWebhooks follows the event log and delivers each new event to the
+// webhook receivers in the global configuration which match it. Events which
+// cannot be delivered after all retries are recorded as dead letters. When the
+// watch of the log is lost, delivery resumes after the last event delivered.
+func (dc *DaemonConfig) deliverWebhooks() {
+	sender := webhook.NewSender()
+
+	// index is the index of the last event delivered. Events recorded before
+	// volsupervisor started are not delivered.
+	var index uint64
+	for {
+		var err error
+		_, index, err = dc.Config.ListEvents("")
+		if err == nil {
+			break
+		}
+
+		log.Errorf("Could not read the event log: %v. Retrying in 1 second", err)
+		time.Sleep(time.Second)
+	}
+
+	for {
+		events := make(chan *config.Event)
+		errChan := make(chan error, 1)
+		go func(index uint64) { errChan <- dc.Config.WatchEvents(context.Background(), index, "", events) }(index)
+
+	follow:
+		for {
+			select {
+			case ev := <-events:
+				dc.dispatchWebhooks(sender, ev)
+				index = ev.Index
+			case err := <-errChan:
+				log.Errorf("Lost the event log watch: %v. Retrying in 1 second", err)
+				time.Sleep(time.Second)
+				break follow
+			}
+		}
+
+		for {
+			var err error
+			index, err = dc.catchUp(sender, index)
+			if err == nil {
+				break
+			}
+
+			log.Errorf("Could not read the event log: %v. Retrying in 1 second", err)
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// catchUp delivers the events in the log which were recorded after the event
+// at index, such as those recorded while the watch of the log was
+// re-established. It returns the index to follow the log from.
+func (dc *DaemonConfig) catchUp(sender *webhook.Sender, index uint64) (uint64, error) {
+	events, logIndex, err := dc.Config.ListEvents("")
+	if err != nil {
+		return index, err
+	}
+
+	for _, ev := range events {
+		if ev.Index > index {
+			dc.dispatchWebhooks(sender, ev)
+		}
+	}
+
+	if logIndex > index {
+		return logIndex, nil
+	}
+
+	return index, nil
+}
+
+// dispatchWebhooks delivers the event to each matching receiver in the
+// background.
+func (dc *DaemonConfig) dispatchWebhooks(sender *webhook.Sender, ev *config.Event) {
+	for _, wh := range dc.Global.Webhooks {
+		if wh.Matches(ev) {
+			go dc.deliverWebhook(sender, wh, ev)
+		}
+	}
+}
+
+func (dc *DaemonConfig) deliverWebhook(sender *webhook.Sender, wh *config.Webhook, ev *config.Event) {
+	attempts, err := sender.Send(wh.URL, wh.Secret, ev)
+	if err == nil {
+		return
+	}
+
+	log.Errorf("Could not deliver %s event for volume %q to %q after %d attempts: %v", ev.Type, ev.Volume, wh.URL, attempts, err)
+
+	dl := &config.DeadLetter{
+		URL:      wh.URL,
+		Event:    ev,
+		Attempts: attempts,
+		Error:    err.Error(),
+		Time:     time.Now(),
+	}
+
+	if err := dc.Config.PublishDeadLetter(dl); err != nil {
+		log.Errorf("Could not record undeliverable %s event for volume %q: %v", ev.Type, ev.Volume, err)
+	}
+}
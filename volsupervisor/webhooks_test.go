@@ -0,0 +1,107 @@
+package volsupervisor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	. "testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/contiv/volplugin/config"
+	"github.com/contiv/volplugin/db/impl/etcd3/etcd3test"
+	"github.com/contiv/volplugin/webhook"
+)
+
+type volsupervisorSuite struct {
+	server *etcd3test.Server
+	dc     *DaemonConfig
+}
+
+var _ = Suite(&volsupervisorSuite{})
+
+func TestVolsupervisor(t *T) { TestingT(t) }
+
+func (s *volsupervisorSuite) SetUpTest(c *C) {
+	s.server = etcd3test.NewServer()
+
+	cfg, err := config.NewStoreClient("/volplugin", "etcd3://"+strings.TrimPrefix(s.server.URL, "http://"), nil)
+	c.Assert(err, IsNil)
+
+	s.dc = &DaemonConfig{Config: cfg, Global: config.NewGlobalConfig(), Hostname: "mon0"}
+}
+
+func (s *volsupervisorSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+// receiver records the volumes of the events delivered to it.
+type receiver struct {
+	sync.Mutex
+	volumes []string
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ev := &config.Event{}
+	json.NewDecoder(r.Body).Decode(ev)
+
+	rc.Lock()
+	defer rc.Unlock()
+	rc.volumes = append(rc.volumes, ev.Volume)
+}
+
+func (rc *receiver) delivered(count int) []string {
+	for i := 0; i < 100; i++ {
+		rc.Lock()
+		if len(rc.volumes) >= count {
+			volumes := append([]string{}, rc.volumes...)
+			rc.Unlock()
+			return volumes
+		}
+		rc.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rc.Lock()
+	defer rc.Unlock()
+	return append([]string{}, rc.volumes...)
+}
+
+func (s *volsupervisorSuite) TestCatchUp(c *C) {
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	s.dc.Global.Webhooks = []*config.Webhook{{URL: server.URL}}
+	sender := &webhook.Sender{Client: http.DefaultClient, Backoff: time.Millisecond}
+
+	c.Assert(s.dc.Config.PublishEvent(config.NewEvent(config.EventCreated, "policy1/delivered", "mon0", "")), IsNil)
+	events, _, err := s.dc.Config.ListEvents("")
+	c.Assert(err, IsNil)
+	c.Assert(events, HasLen, 1)
+
+	// these are recorded while the watch is lost.
+	c.Assert(s.dc.Config.PublishEvent(config.NewEvent(config.EventCreated, "policy1/missed1", "mon0", "")), IsNil)
+	c.Assert(s.dc.Config.PublishEvent(config.NewEvent(config.EventMounted, "policy1/missed2", "mon0", "")), IsNil)
+
+	index, err := s.dc.catchUp(sender, events[0].Index)
+	c.Assert(err, IsNil)
+
+	volumes := rc.delivered(2)
+	c.Assert(volumes, HasLen, 2)
+	c.Assert(strings.Join(volumes, ","), Matches, `policy1/missed1,policy1/missed2|policy1/missed2,policy1/missed1`)
+
+	events, logIndex, err := s.dc.Config.ListEvents("")
+	c.Assert(err, IsNil)
+	c.Assert(index, Equals, logIndex)
+	c.Assert(index >= events[2].Index, Equals, true)
+
+	// nothing is delivered twice.
+	_, err = s.dc.catchUp(sender, index)
+	c.Assert(err, IsNil)
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(rc.delivered(2), HasLen, 2)
+}
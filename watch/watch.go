@@ -7,11 +7,14 @@ import (
 	"sync"
 	"time"
 
-	"github.com/Sirupsen/logrus"
+	"github.com/contiv/volplugin/logging"
+	"github.com/contiv/volplugin/metrics"
 	"github.com/coreos/etcd/client"
 	"golang.org/x/net/context"
 )
 
+var log = logging.For("watch")
+
 // Watch is a struct providing a generic way of passing key/value information
 // from etcd that is already unmarshalled.
 type Watch struct {
@@ -72,7 +75,7 @@ func NewWatcher(channel chan *Watch, path string, fun WatcherFunc) *Watcher {
 // then registers it with the watch registry.
 func Create(w *Watcher) {
 	if etcdClient == nil {
-		logrus.Error("etcdClient is nil, cannot watch anything!")
+		log.Error("etcdClient is nil, cannot watch anything!")
 		return
 	}
 
@@ -92,7 +95,7 @@ func Create(w *Watcher) {
 			resp, err := watcher.Next(ctx)
 			if err != nil {
 				if err == context.Canceled {
-					logrus.Debugf("watch for %q canceled", w.Path)
+					log.Debugf("watch for %q canceled", w.Path)
 					return
 				}
 
@@ -102,6 +105,7 @@ func Create(w *Watcher) {
 					return
 				}
 
+				metrics.WatchReconnects.Inc(w.Path)
 				time.Sleep(time.Second)
 				continue
 			}
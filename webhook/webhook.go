@@ -0,0 +1,142 @@
+// Package webhook delivers JSON payloads to HTTP receivers, signing them with
+// an HMAC of the delivery time and body and retrying failed deliveries with
+// exponential backoff.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/contiv/errored"
+)
+
+const (
+	// SignatureHeader carries the signature of the timestamp and body, as
+	// "sha256=<hex>".
+	SignatureHeader = "X-Volplugin-Signature"
+	// TimestampHeader carries the Unix time of the delivery attempt.
+	TimestampHeader = "X-Volplugin-Timestamp"
+
+	// DefaultRetries is the number of retries after a failed delivery.
+	DefaultRetries = 5
+	// DefaultBackoff is the wait before the first retry; it doubles for
+	// each retry after.
+	DefaultBackoff = time.Second
+	// DefaultTimeout bounds each delivery attempt.
+	DefaultTimeout = 10 * time.Second
+	// DefaultTolerance is how far from the current time receivers should
+	// accept delivery timestamps.
+	DefaultTolerance = 5 * time.Minute
+
+	signaturePrefix = "sha256="
+)
+
+// Sender POSTs payloads to webhook receivers.
+type Sender struct {
+	Client  *http.Client
+	Retries int
+	Backoff time.Duration
+}
+
+// NewSender returns a Sender with the default retries, backoff and timeout.
+func NewSender() *Sender {
+	return &Sender{
+		Client:  &http.Client{Timeout: DefaultTimeout},
+		Retries: DefaultRetries,
+		Backoff: DefaultBackoff,
+	}
+}
+
+// Sign returns the signature for the secret of the body delivered at the Unix
+// timestamp. The timestamp and body are signed as "<timestamp>.<body>".
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify is true if the signature is the signature for the secret of the body
+// delivered at the timestamp, and the timestamp is within tolerance of the
+// current time. Receivers use it to authenticate deliveries and to reject
+// replayed ones.
+func Verify(secret string, body []byte, timestamp, signature string, tolerance time.Duration) bool {
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return false
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	if skew := time.Since(time.Unix(ts, 0)); skew > tolerance || skew < -tolerance {
+		return false
+	}
+
+	return hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature))
+}
+
+// Send delivers the payload as JSON to the URL, signed with the secret if it
+// is not empty. Each attempt is signed with its own timestamp. Any response
+// other than a 2xx is a failure; failures are retried with exponential
+// backoff. It returns the number of attempts made, and the last error if all
+// of them failed.
+func (s *Sender) Send(url, secret string, payload interface{}) (int, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	backoff := s.Backoff
+	attempts := 0
+
+	for {
+		attempts++
+
+		err = s.post(url, secret, body)
+		if err == nil || attempts > s.Retries {
+			return attempts, err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (s *Sender) post(url, secret string, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		timestamp := time.Now().Unix()
+		req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(SignatureHeader, Sign(secret, timestamp, body))
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errored.Errorf("Receiver %q responded with status %d", url, resp.StatusCode)
+	}
+
+	return nil
+}
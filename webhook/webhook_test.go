@@ -0,0 +1,109 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	. "testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type webhookSuite struct{}
+
+var _ = Suite(&webhookSuite{})
+
+func TestWebhook(t *T) { TestingT(t) }
+
+// receiver records the deliveries it receives and fails the first failures
+// of them.
+type receiver struct {
+	sync.Mutex
+	secret   string
+	failures int
+	bodies   [][]byte
+	verified []bool
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.Lock()
+	defer rc.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	rc.bodies = append(rc.bodies, body)
+	rc.verified = append(rc.verified, Verify(rc.secret, body, r.Header.Get(TimestampHeader), r.Header.Get(SignatureHeader), DefaultTolerance))
+
+	if rc.failures > 0 {
+		rc.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func testSender() *Sender {
+	return &Sender{Client: http.DefaultClient, Retries: 2, Backoff: time.Millisecond}
+}
+
+func (s *webhookSuite) TestSign(c *C) {
+	now := time.Now().Unix()
+	ts := strconv.FormatInt(now, 10)
+	sig := Sign("secret", now, []byte("body"))
+	c.Assert(Verify("secret", []byte("body"), ts, sig, time.Minute), Equals, true)
+	c.Assert(Verify("other", []byte("body"), ts, sig, time.Minute), Equals, false)
+	c.Assert(Verify("secret", []byte("bodies"), ts, sig, time.Minute), Equals, false)
+	c.Assert(Verify("secret", []byte("body"), ts, sig[len(signaturePrefix):], time.Minute), Equals, false)
+
+	// the timestamp is signed.
+	c.Assert(Verify("secret", []byte("body"), strconv.FormatInt(now+1, 10), sig, time.Minute), Equals, false)
+	c.Assert(Verify("secret", []byte("body"), "", sig, time.Minute), Equals, false)
+}
+
+func (s *webhookSuite) TestReplay(c *C) {
+	then := time.Now().Add(-time.Hour).Unix()
+	sig := Sign("secret", then, []byte("body"))
+	ts := strconv.FormatInt(then, 10)
+
+	c.Assert(Verify("secret", []byte("body"), ts, sig, time.Minute), Equals, false)
+	c.Assert(Verify("secret", []byte("body"), ts, sig, 2*time.Hour), Equals, true)
+
+	later := time.Now().Add(time.Hour).Unix()
+	c.Assert(Verify("secret", []byte("body"), strconv.FormatInt(later, 10), Sign("secret", later, []byte("body")), time.Minute), Equals, false)
+}
+
+func (s *webhookSuite) TestSend(c *C) {
+	rc := &receiver{secret: "secret"}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	attempts, err := testSender().Send(server.URL, "secret", map[string]string{"type": "created"})
+	c.Assert(err, IsNil)
+	c.Assert(attempts, Equals, 1)
+	c.Assert(len(rc.bodies), Equals, 1)
+	c.Assert(string(rc.bodies[0]), Equals, `{"type":"created"}`)
+	c.Assert(rc.verified[0], Equals, true)
+}
+
+func (s *webhookSuite) TestSendRetries(c *C) {
+	rc := &receiver{secret: "secret", failures: 2}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	attempts, err := testSender().Send(server.URL, "secret", "payload")
+	c.Assert(err, IsNil)
+	c.Assert(attempts, Equals, 3)
+	c.Assert(len(rc.bodies), Equals, 3)
+}
+
+func (s *webhookSuite) TestSendFails(c *C) {
+	rc := &receiver{failures: 5}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	attempts, err := testSender().Send(server.URL, "", "payload")
+	c.Assert(err, NotNil)
+	c.Assert(attempts, Equals, 3)
+	c.Assert(rc.failures, Equals, 2)
+	c.Assert(rc.verified[0], Equals, false)
+}